@@ -46,6 +46,7 @@ func (a *App) startup(ctx context.Context) {
 }
 
 func (a *App) shutdown(ctx context.Context) {
+	backend.FlushMirrorHealth()
 	backend.CloseHistoryDB()
 }
 
@@ -56,48 +57,9 @@ type SpotifyMetadataRequest struct {
 	Timeout float64 `json:"timeout"`
 }
 
-type DownloadRequest struct {
-	Service              string `json:"service"`
-	Query                string `json:"query,omitempty"`
-	TrackName            string `json:"track_name,omitempty"`
-	ArtistName           string `json:"artist_name,omitempty"`
-	AlbumName            string `json:"album_name,omitempty"`
-	AlbumArtist          string `json:"album_artist,omitempty"`
-	ReleaseDate          string `json:"release_date,omitempty"`
-	CoverURL             string `json:"cover_url,omitempty"`
-	ApiURL               string `json:"api_url,omitempty"`
-	OutputDir            string `json:"output_dir,omitempty"`
-	AudioFormat          string `json:"audio_format,omitempty"`
-	FilenameFormat       string `json:"filename_format,omitempty"`
-	TrackNumber          bool   `json:"track_number,omitempty"`
-	Position             int    `json:"position,omitempty"`
-	UseAlbumTrackNumber  bool   `json:"use_album_track_number,omitempty"`
-	SpotifyID            string `json:"spotify_id,omitempty"`
-	EmbedLyrics          bool   `json:"embed_lyrics,omitempty"`
-	EmbedMaxQualityCover bool   `json:"embed_max_quality_cover,omitempty"`
-	ServiceURL           string `json:"service_url,omitempty"`
-	Duration             int    `json:"duration,omitempty"`
-	ItemID               string `json:"item_id,omitempty"`
-	SpotifyTrackNumber   int    `json:"spotify_track_number,omitempty"`
-	SpotifyDiscNumber    int    `json:"spotify_disc_number,omitempty"`
-	SpotifyTotalTracks   int    `json:"spotify_total_tracks,omitempty"`
-	SpotifyTotalDiscs    int    `json:"spotify_total_discs,omitempty"`
-	Copyright            string `json:"copyright,omitempty"`
-	Publisher            string `json:"publisher,omitempty"`
-	PlaylistName         string `json:"playlist_name,omitempty"`
-	PlaylistOwner        string `json:"playlist_owner,omitempty"`
-	AllowFallback        bool   `json:"allow_fallback"`
-	UseFirstArtistOnly   bool   `json:"use_first_artist_only,omitempty"`
-}
-
-type DownloadResponse struct {
-	Success       bool   `json:"success"`
-	Message       string `json:"message"`
-	File          string `json:"file,omitempty"`
-	Error         string `json:"error,omitempty"`
-	AlreadyExists bool   `json:"already_exists,omitempty"`
-	ItemID        string `json:"item_id,omitempty"`
-}
+type DownloadRequest = backend.DownloadRequest
+
+type DownloadResponse = backend.DownloadResponse
 
 func (a *App) GetStreamingURLs(spotifyTrackID string, region string) (string, error) {
 	if spotifyTrackID == "" {
@@ -106,7 +68,7 @@ func (a *App) GetStreamingURLs(spotifyTrackID string, region string) (string, er
 
 	fmt.Printf("[GetStreamingURLs] Called for track ID: %s, Region: %s\n", spotifyTrackID, region)
 	client := backend.NewSongLinkClient()
-	urls, err := client.GetAllURLsFromSpotify(spotifyTrackID, region)
+	urls, err := client.GetAllURLsFromSpotify(a.ctx, spotifyTrackID, region)
 	if err != nil {
 		return "", err
 	}
@@ -215,311 +177,7 @@ func (a *App) SearchSpotifyByType(req SpotifySearchByTypeRequest) ([]backend.Sea
 }
 
 func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
-
-	if req.Service == "qobuz" && req.SpotifyID == "" {
-		return DownloadResponse{
-			Success: false,
-			Error:   "Spotify ID is required for Qobuz",
-		}, fmt.Errorf("spotify ID is required for Qobuz")
-	}
-
-	if req.Service == "" {
-		req.Service = "tidal"
-	}
-
-	if req.OutputDir == "" {
-		req.OutputDir = "."
-	} else {
-
-		if req.PlaylistName != "" {
-			sanitizedPlaylist := backend.SanitizeFilename(req.PlaylistName)
-			req.OutputDir = filepath.Join(req.OutputDir, sanitizedPlaylist)
-		}
-
-		req.OutputDir = backend.SanitizeFolderPath(req.OutputDir)
-	}
-
-	if req.AudioFormat == "" {
-		req.AudioFormat = "LOSSLESS"
-	}
-
-	var err error
-	var filename string
-
-	if req.FilenameFormat == "" {
-		req.FilenameFormat = "title-artist"
-	}
-
-	itemID := req.ItemID
-	if itemID == "" {
-
-		if req.SpotifyID != "" {
-			itemID = fmt.Sprintf("%s-%d", req.SpotifyID, time.Now().UnixNano())
-		} else {
-			itemID = fmt.Sprintf("%s-%s-%d", req.TrackName, req.ArtistName, time.Now().UnixNano())
-		}
-
-		backend.AddToQueue(itemID, req.TrackName, req.ArtistName, req.AlbumName, req.SpotifyID)
-	}
-
-	backend.SetDownloading(true)
-	backend.StartDownloadItem(itemID)
-	defer backend.SetDownloading(false)
-
-	spotifyURL := ""
-	if req.SpotifyID != "" {
-		spotifyURL = fmt.Sprintf("https://open.spotify.com/track/%s", req.SpotifyID)
-	}
-
-	if req.SpotifyID != "" && (req.Copyright == "" || req.Publisher == "" || req.SpotifyTotalDiscs == 0 || req.ReleaseDate == "" || req.SpotifyTotalTracks == 0 || req.SpotifyTrackNumber == 0) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		trackURL := fmt.Sprintf("https://open.spotify.com/track/%s", req.SpotifyID)
-		trackData, err := backend.GetFilteredSpotifyData(ctx, trackURL, false, 0)
-		if err == nil {
-
-			var trackResp struct {
-				Track struct {
-					Copyright   string `json:"copyright"`
-					Publisher   string `json:"publisher"`
-					TotalDiscs  int    `json:"total_discs"`
-					TotalTracks int    `json:"total_tracks"`
-					TrackNumber int    `json:"track_number"`
-					ReleaseDate string `json:"release_date"`
-				} `json:"track"`
-			}
-			if jsonData, jsonErr := json.Marshal(trackData); jsonErr == nil {
-				if json.Unmarshal(jsonData, &trackResp) == nil {
-
-					if req.Copyright == "" && trackResp.Track.Copyright != "" {
-						req.Copyright = trackResp.Track.Copyright
-					}
-					if req.Publisher == "" && trackResp.Track.Publisher != "" {
-						req.Publisher = trackResp.Track.Publisher
-					}
-					if req.SpotifyTotalDiscs == 0 && trackResp.Track.TotalDiscs > 0 {
-						req.SpotifyTotalDiscs = trackResp.Track.TotalDiscs
-					}
-					if req.SpotifyTotalTracks == 0 && trackResp.Track.TotalTracks > 0 {
-						req.SpotifyTotalTracks = trackResp.Track.TotalTracks
-					}
-					if req.SpotifyTrackNumber == 0 && trackResp.Track.TrackNumber > 0 {
-						req.SpotifyTrackNumber = trackResp.Track.TrackNumber
-					}
-					if req.ReleaseDate == "" && trackResp.Track.ReleaseDate != "" {
-						req.ReleaseDate = trackResp.Track.ReleaseDate
-					}
-				}
-			}
-		}
-	}
-
-	if req.TrackName != "" && req.ArtistName != "" {
-		expectedFilename := backend.BuildExpectedFilename(req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.SpotifyDiscNumber, req.UseAlbumTrackNumber)
-		expectedPath := filepath.Join(req.OutputDir, expectedFilename)
-
-		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 100*1024 {
-
-			backend.SkipDownloadItem(itemID, expectedPath)
-			return DownloadResponse{
-				Success:       true,
-				Message:       "File already exists",
-				File:          expectedPath,
-				AlreadyExists: true,
-				ItemID:        itemID,
-			}, nil
-		}
-	}
-
-	lyricsChan := make(chan string, 1)
-	isrcChan := make(chan string, 1)
-
-	if req.SpotifyID != "" {
-		if req.EmbedLyrics {
-			go func() {
-				client := backend.NewLyricsClient()
-				resp, _, err := client.FetchLyricsAllSources(req.SpotifyID, req.TrackName, req.ArtistName, req.Duration)
-				if err == nil && resp != nil && len(resp.Lines) > 0 {
-					lrc := client.ConvertToLRC(resp, req.TrackName, req.ArtistName)
-					lyricsChan <- lrc
-				} else {
-					lyricsChan <- ""
-				}
-			}()
-		} else {
-			close(lyricsChan)
-		}
-
-		go func() {
-			client := backend.NewSongLinkClient()
-			isrc, _ := client.GetISRC(req.SpotifyID)
-			isrcChan <- isrc
-		}()
-	} else {
-		close(lyricsChan)
-		close(isrcChan)
-	}
-
-	switch req.Service {
-	case "amazon":
-
-		downloader := backend.NewAmazonDownloader()
-		if req.ServiceURL != "" {
-			filename, err = downloader.DownloadByURL(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.CoverURL, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.EmbedMaxQualityCover, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.UseFirstArtistOnly)
-		} else {
-			filename, err = downloader.DownloadBySpotifyID(req.SpotifyID, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.PlaylistName, req.PlaylistOwner, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.CoverURL, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.EmbedMaxQualityCover, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.UseFirstArtistOnly)
-		}
-
-	case "tidal":
-		if req.ApiURL == "" || req.ApiURL == "auto" {
-			downloader := backend.NewTidalDownloader("")
-			if req.ServiceURL != "" {
-				filename, err = downloader.DownloadByURLWithFallback(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly)
-			} else {
-				filename, err = downloader.Download(req.SpotifyID, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly)
-			}
-		} else {
-			downloader := backend.NewTidalDownloader(req.ApiURL)
-			if req.ServiceURL != "" {
-				filename, err = downloader.DownloadByURL(req.ServiceURL, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly)
-			} else {
-				filename, err = downloader.Download(req.SpotifyID, req.OutputDir, req.AudioFormat, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly)
-			}
-		}
-
-	case "qobuz":
-
-		fmt.Println("Waiting for ISRC (Qobuz dependency)...")
-		isrc := <-isrcChan
-		downloader := backend.NewQobuzDownloader()
-		quality := req.AudioFormat
-		if quality == "" {
-			quality = "6"
-		}
-		filename, err = downloader.DownloadTrackWithISRC(isrc, req.SpotifyID, req.OutputDir, quality, req.FilenameFormat, req.TrackNumber, req.Position, req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.UseAlbumTrackNumber, req.CoverURL, req.EmbedMaxQualityCover, req.SpotifyTrackNumber, req.SpotifyDiscNumber, req.SpotifyTotalTracks, req.SpotifyTotalDiscs, req.Copyright, req.Publisher, spotifyURL, req.AllowFallback, req.UseFirstArtistOnly)
-
-	default:
-		return DownloadResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Unknown service: %s", req.Service),
-		}, fmt.Errorf("unknown service: %s", req.Service)
-	}
-
-	if err != nil {
-		backend.FailDownloadItem(itemID, fmt.Sprintf("Download failed: %v", err))
-
-		if filename != "" && !strings.HasPrefix(filename, "EXISTS:") {
-
-			if _, statErr := os.Stat(filename); statErr == nil {
-				fmt.Printf("Removing corrupted/partial file after failed download: %s\n", filename)
-				if removeErr := os.Remove(filename); removeErr != nil {
-					fmt.Printf("Warning: Failed to remove corrupted file %s: %v\n", filename, removeErr)
-				}
-			}
-		}
-
-		return DownloadResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Download failed: %v", err),
-			ItemID:  itemID,
-		}, err
-	}
-
-	alreadyExists := false
-	if strings.HasPrefix(filename, "EXISTS:") {
-		alreadyExists = true
-		filename = strings.TrimPrefix(filename, "EXISTS:")
-	}
-
-	if !alreadyExists && req.SpotifyID != "" && req.EmbedLyrics && (strings.HasSuffix(filename, ".flac") || strings.HasSuffix(filename, ".mp3") || strings.HasSuffix(filename, ".m4a")) {
-		fmt.Printf("\nWaiting for lyrics fetch to complete...\n")
-		lyrics := <-lyricsChan
-		if lyrics != "" {
-			fmt.Printf("\n--- Full LRC Content ---\n")
-			fmt.Println(lyrics)
-			fmt.Printf("--- End LRC Content ---\n\n")
-
-			fmt.Printf("Embedding into: %s\n", filename)
-
-			if err := backend.EmbedLyricsOnlyUniversal(filename, lyrics); err != nil {
-				fmt.Printf("Failed to embed lyrics: %v\n", err)
-			} else {
-				fmt.Printf("Lyrics embedded successfully!\n")
-			}
-		} else {
-			fmt.Println("No lyrics found to embed.")
-		}
-	} else {
-
-		select {
-		case <-lyricsChan:
-		default:
-		}
-	}
-
-	message := "Download completed successfully"
-	if alreadyExists {
-		message = "File already exists"
-		backend.SkipDownloadItem(itemID, filename)
-	} else {
-
-		if fileInfo, statErr := os.Stat(filename); statErr == nil {
-			finalSize := float64(fileInfo.Size()) / (1024 * 1024)
-			backend.CompleteDownloadItem(itemID, filename, finalSize)
-		} else {
-
-			backend.CompleteDownloadItem(itemID, filename, 0)
-		}
-
-		go func(fPath, track, artist, album, sID, cover, format string) {
-			quality := "Unknown"
-			durationStr := "--:--"
-
-			meta, err := backend.GetTrackMetadata(fPath)
-			if err == nil && meta != nil {
-				quality = fmt.Sprintf("%d-bit/%.1fkHz", meta.BitsPerSample, float64(meta.SampleRate)/1000.0)
-				d := int(meta.Duration)
-				durationStr = fmt.Sprintf("%d:%02d", d/60, d%60)
-			} else {
-
-			}
-
-			item := backend.HistoryItem{
-				SpotifyID:   sID,
-				Title:       track,
-				Artists:     artist,
-				Album:       album,
-				DurationStr: durationStr,
-				CoverURL:    cover,
-				Quality:     quality,
-				Format:      format,
-				Path:        fPath,
-			}
-
-			if item.Format == "" || item.Format == "LOSSLESS" {
-				ext := filepath.Ext(fPath)
-				if len(ext) > 1 {
-					item.Format = strings.ToUpper(ext[1:])
-				}
-			}
-
-			switch item.Format {
-			case "6", "7", "27":
-				item.Format = "FLAC"
-			}
-
-			backend.AddHistoryItem(item, "SpotiFLAC")
-		}(filename, req.TrackName, req.ArtistName, req.AlbumName, req.SpotifyID, req.CoverURL, req.AudioFormat)
-	}
-
-	return DownloadResponse{
-		Success:       true,
-		Message:       message,
-		File:          filename,
-		AlreadyExists: alreadyExists,
-		ItemID:        itemID,
-	}, nil
+	return backend.ExecuteDownload(context.Background(), req)
 }
 
 func (a *App) OpenFolder(path string) error {
@@ -550,7 +208,7 @@ func (a *App) GetDefaults() map[string]string {
 }
 
 func (a *App) GetDownloadProgress() backend.ProgressInfo {
-	return backend.GetDownloadProgress()
+	return backend.GetDownloadProgress("")
 }
 
 func (a *App) GetDownloadQueue() backend.DownloadQueueInfo {
@@ -558,11 +216,11 @@ func (a *App) GetDownloadQueue() backend.DownloadQueueInfo {
 }
 
 func (a *App) ClearCompletedDownloads() {
-	backend.ClearDownloadQueue()
+	backend.ClearDownloadQueue("")
 }
 
 func (a *App) ClearAllDownloads() {
-	backend.ClearAllDownloads()
+	backend.ClearAllDownloads("")
 }
 
 func (a *App) AddToDownloadQueue(spotifyID, trackName, artistName, albumName string) string {
@@ -576,7 +234,7 @@ func (a *App) MarkDownloadItemFailed(itemID, errorMsg string) {
 }
 
 func (a *App) CancelAllQueuedItems() {
-	backend.CancelAllQueuedItems()
+	backend.CancelAllQueuedItems("")
 }
 
 func (a *App) ExportFailedDownloads() (string, error) {
@@ -653,19 +311,19 @@ func (a *App) Quit() {
 }
 
 func (a *App) GetDownloadHistory() ([]backend.HistoryItem, error) {
-	return backend.GetHistoryItems("SpotiFLAC")
+	return backend.GetHistoryItems("", "SpotiFLAC")
 }
 
 func (a *App) ClearDownloadHistory() error {
-	return backend.ClearHistory("SpotiFLAC")
+	return backend.ClearHistory("", "SpotiFLAC")
 }
 
 func (a *App) DeleteDownloadHistoryItem(id string) error {
-	return backend.DeleteHistoryItem(id, "SpotiFLAC")
+	return backend.DeleteHistoryItem(id, "", "SpotiFLAC")
 }
 
 func (a *App) GetFetchHistory() ([]backend.FetchHistoryItem, error) {
-	return backend.GetFetchHistoryItems("SpotiFLAC")
+	return backend.GetFetchHistoryItems("", "SpotiFLAC")
 }
 
 func (a *App) AddFetchHistory(item backend.FetchHistoryItem) error {
@@ -673,15 +331,15 @@ func (a *App) AddFetchHistory(item backend.FetchHistoryItem) error {
 }
 
 func (a *App) ClearFetchHistory() error {
-	return backend.ClearFetchHistory("SpotiFLAC")
+	return backend.ClearFetchHistory("", "SpotiFLAC")
 }
 
 func (a *App) DeleteFetchHistoryItem(id string) error {
-	return backend.DeleteFetchHistoryItem(id, "SpotiFLAC")
+	return backend.DeleteFetchHistoryItem(id, "", "SpotiFLAC")
 }
 
 func (a *App) ClearFetchHistoryByType(itemType string) error {
-	return backend.ClearFetchHistoryByType(itemType, "SpotiFLAC")
+	return backend.ClearFetchHistoryByType(itemType, "", "SpotiFLAC")
 }
 
 func (a *App) AnalyzeTrack(filePath string) (string, error) {
@@ -949,7 +607,7 @@ func (a *App) CheckTrackAvailability(spotifyTrackID string) (string, error) {
 	}
 
 	client := backend.NewSongLinkClient()
-	availability, err := client.CheckTrackAvailability(spotifyTrackID)
+	availability, err := client.CheckTrackAvailability(a.ctx, spotifyTrackID)
 	if err != nil {
 		return "", err
 	}
@@ -1362,50 +1020,5 @@ func (a *App) GetOSInfo() (string, error) {
 }
 
 func (a *App) CreateM3U8File(m3u8Name string, outputDir string, filePaths []string) error {
-	if len(filePaths) == 0 {
-		return nil
-	}
-
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return err
-	}
-
-	fnName := m3u8Name
-
-	safeName := backend.SanitizeFilename(fnName)
-	if safeName == "" {
-		safeName = "playlist"
-	}
-
-	m3u8Path := filepath.Join(outputDir, safeName+".m3u8")
-
-	f, err := os.Create(m3u8Path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	if _, err := f.WriteString("#EXTM3U\n"); err != nil {
-		return err
-	}
-
-	for _, path := range filePaths {
-		if path == "" {
-			continue
-		}
-
-		relPath, err := filepath.Rel(outputDir, path)
-		if err != nil {
-
-			relPath = path
-		}
-
-		relPath = filepath.ToSlash(relPath)
-
-		if _, err := f.WriteString(relPath + "\n"); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return backend.CreateM3U8File(m3u8Name, outputDir, filePaths)
 }
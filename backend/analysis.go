@@ -2,6 +2,7 @@ package backend
 
 import (
 	"fmt"
+	"log/slog"
 	"math"
 	"os"
 
@@ -73,8 +74,7 @@ func AnalyzeTrack(filepath string) (*AnalysisResult, error) {
 
 	spectrum, err := AnalyzeSpectrum(filepath)
 	if err != nil {
-
-		fmt.Printf("Warning: failed to analyze spectrum: %v\n", err)
+		slog.Warn("Failed to analyze spectrum", "file", filepath, "error", err)
 	} else {
 		result.Spectrum = spectrum
 
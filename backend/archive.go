@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ArchiveEntry is one file of an Archive. Path names a file on disk of
+// Size bytes; when Path is empty the entry holds the generated Data and
+// takes the newest Modified time of the other entries.
+type ArchiveEntry struct {
+	Name     string // slash separated name inside the archive
+	Path     string
+	Data     []byte
+	Size     int64
+	Modified time.Time
+}
+
+// Archive is a ZIP of files streamed on the fly without a temporary file.
+// Entries are stored uncompressed (audio and covers do not compress), so
+// the archive has a fixed layout: its size is known before it is written
+// and any byte range can be produced again, which allows resuming.
+type Archive struct {
+	entries []ArchiveEntry
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// NewArchive lays out an archive of entries. The size is measured by a dry
+// run that writes placeholder content, so no file is read yet.
+func NewArchive(entries []ArchiveEntry) (*Archive, error) {
+	a := &Archive{entries: entries}
+
+	for _, entry := range a.entries {
+		if entry.Modified.After(a.modTime) {
+			a.modTime = entry.Modified
+		}
+	}
+
+	hash := sha256.New()
+	for i := range a.entries {
+		entry := &a.entries[i]
+		if entry.Path == "" {
+			// Generated content is dated like the newest file, which keeps
+			// the ETag stable between requests
+			entry.Size = int64(len(entry.Data))
+			entry.Modified = a.modTime
+			hash.Write(entry.Data)
+		}
+		hash.Write([]byte(entry.Name + "\x00"))
+		binary.Write(hash, binary.LittleEndian, []int64{entry.Size, entry.Modified.Unix()})
+	}
+	a.etag = `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	counter := &countWriter{}
+	if err := a.write(counter, true); err != nil {
+		return nil, err
+	}
+	a.size = counter.n
+	return a, nil
+}
+
+// Size returns the length of the archive in bytes
+func (a *Archive) Size() int64 { return a.size }
+
+// ModTime returns the newest modification time of the entries
+func (a *Archive) ModTime() time.Time { return a.modTime }
+
+// ETag identifies the archive by its entry names, sizes and times, so a
+// resumed download can tell whether the files changed in between
+func (a *Archive) ETag() string { return a.etag }
+
+// write produces the archive. A dry run writes zeros instead of reading
+// the files; the layout only depends on names, sizes and times.
+func (a *Archive) write(w io.Writer, dry bool) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range a.entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     entry.Name,
+			Method:   zip.Store,
+			Modified: entry.Modified.UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case dry:
+			err = writeZeros(fw, entry.Size)
+		case entry.Path == "":
+			_, err = fw.Write(entry.Data)
+		default:
+			err = copyArchiveFile(fw, entry.Path, entry.Size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyArchiveFile copies exactly size bytes of path, failing if the file
+// shrank since the archive was laid out
+func copyArchiveFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(w, f, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s changed while archiving", path)
+		}
+		return err
+	}
+	return nil
+}
+
+var zeroBlock = make([]byte, 64*1024)
+
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		chunk := zeroBlock[:min(n, int64(len(zeroBlock)))]
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		n -= int64(len(chunk))
+	}
+	return nil
+}
+
+// countWriter discards its input and counts the bytes
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// skipWriter discards the first skip bytes written to it
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.skip >= int64(n) {
+		s.skip -= int64(n)
+		return n, nil
+	}
+	if _, err := s.w.Write(p[s.skip:]); err != nil {
+		return 0, err
+	}
+	s.skip = 0
+	return n, nil
+}
+
+// Reader returns a reader over the archive bytes for http.ServeContent.
+// Seeking is free until the next Read, which generates the archive from
+// the start and discards everything before the offset. Files before the
+// offset are read again because their checksums go into the central
+// directory at the end.
+func (a *Archive) Reader() *ArchiveReader {
+	return &ArchiveReader{archive: a}
+}
+
+// ArchiveReader is an io.ReadSeekCloser over an Archive. Close stops the
+// goroutine writing the archive.
+type ArchiveReader struct {
+	archive *Archive
+	offset  int64
+	pipe    *io.PipeReader
+}
+
+func (r *ArchiveReader) Read(p []byte) (int, error) {
+	if r.offset >= r.archive.size {
+		return 0, io.EOF
+	}
+	if r.pipe == nil {
+		pr, pw := io.Pipe()
+		r.pipe = pr
+		skip := r.offset
+		go func() {
+			pw.CloseWithError(r.archive.write(&skipWriter{w: pw, skip: skip}, false))
+		}()
+	}
+
+	n, err := r.pipe.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ArchiveReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.archive.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *ArchiveReader) Close() error {
+	if r.pipe != nil {
+		r.pipe.Close()
+		r.pipe = nil
+	}
+	return nil
+}
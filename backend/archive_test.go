@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testArchiveEntries writes two files and returns them with a generated
+// playlist as archive entries
+func testArchiveEntries(t *testing.T) []ArchiveEntry {
+	t.Helper()
+	dir := t.TempDir()
+	modified := time.Unix(1700000000, 0)
+	files := map[string][]byte{
+		"01 - First.flac":  bytes.Repeat([]byte("first track "), 10000),
+		"02 - Second.flac": bytes.Repeat([]byte("second track "), 7000),
+	}
+
+	var entries []ArchiveEntry
+	for _, name := range []string{"01 - First.flac", "02 - Second.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, ArchiveEntry{Name: "Album/" + name, Path: path, Size: int64(len(files[name])), Modified: modified})
+	}
+	return append(entries, ArchiveEntry{Name: "Album/playlist.m3u8", Data: []byte("01 - First.flac\n02 - Second.flac\n")})
+}
+
+func readArchive(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	return data
+}
+
+func TestArchive(t *testing.T) {
+	entries := testArchiveEntries(t)
+	a, err := NewArchive(entries)
+	if err != nil {
+		t.Fatalf("NewArchive() error = %v", err)
+	}
+
+	r := a.Reader()
+	defer r.Close()
+	data := readArchive(t, r)
+	if int64(len(data)) != a.Size() {
+		t.Fatalf("archive has %d bytes, Size() = %d", len(data), a.Size())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("archive is no valid ZIP: %v", err)
+	}
+	if len(zr.File) != len(entries) {
+		t.Fatalf("archive has %d files, want %d", len(zr.File), len(entries))
+	}
+	for i, f := range zr.File {
+		want := entries[i].Data
+		if entries[i].Path != "" {
+			want, _ = os.ReadFile(entries[i].Path)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		got := readArchive(t, rc)
+		rc.Close()
+		if f.Name != entries[i].Name || !bytes.Equal(got, want) {
+			t.Errorf("file %d = %s with %d bytes, want %s with %d bytes", i, f.Name, len(got), entries[i].Name, len(want))
+		}
+		if !f.Modified.Equal(a.ModTime()) {
+			t.Errorf("%s modified %v, want %v", f.Name, f.Modified, a.ModTime())
+		}
+	}
+}
+
+func TestArchiveETag(t *testing.T) {
+	entries := testArchiveEntries(t)
+	a, _ := NewArchive(append([]ArchiveEntry(nil), entries...))
+	same, _ := NewArchive(append([]ArchiveEntry(nil), entries...))
+	if a.ETag() != same.ETag() {
+		t.Errorf("ETag changed between identical archives: %s != %s", a.ETag(), same.ETag())
+	}
+
+	changes := map[string]func(e []ArchiveEntry){
+		"file size": func(e []ArchiveEntry) { e[0].Size-- },
+		"file time": func(e []ArchiveEntry) { e[1].Modified = e[1].Modified.Add(time.Second) },
+		"file name": func(e []ArchiveEntry) { e[0].Name = "Album/renamed.flac" },
+		"generated": func(e []ArchiveEntry) { e[2].Data = []byte("01 - First.flac\n") },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := append([]ArchiveEntry(nil), entries...)
+			change(changed)
+			b, err := NewArchive(changed)
+			if err != nil {
+				t.Fatalf("NewArchive() error = %v", err)
+			}
+			if b.ETag() == a.ETag() {
+				t.Error("ETag did not change")
+			}
+		})
+	}
+}
+
+func TestArchiveReaderSeek(t *testing.T) {
+	a, err := NewArchive(testArchiveEntries(t))
+	if err != nil {
+		t.Fatalf("NewArchive() error = %v", err)
+	}
+	r := a.Reader()
+	defer r.Close()
+	full := readArchive(t, r)
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+	}{
+		{"start", 0, io.SeekStart, 0},
+		{"middle of a file", 50000, io.SeekStart, 50000},
+		{"into the central directory", -100, io.SeekEnd, a.Size() - 100},
+		{"end", 0, io.SeekEnd, a.Size()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := a.Reader()
+			defer r.Close()
+
+			// Read a little first so the seek has to restart the writer
+			head := make([]byte, 10)
+			if _, err := io.ReadFull(r, head); err != nil {
+				t.Fatal(err)
+			}
+			pos, err := r.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatalf("Seek() error = %v", err)
+			}
+			if pos != tt.want {
+				t.Fatalf("Seek() = %d, want %d", pos, tt.want)
+			}
+			if got := readArchive(t, r); !bytes.Equal(got, full[tt.want:]) {
+				t.Errorf("read %d bytes after the seek, want the %d bytes from %d", len(got), len(full)-int(tt.want), tt.want)
+			}
+		})
+	}
+
+	t.Run("relative to the current offset", func(t *testing.T) {
+		r := a.Reader()
+		defer r.Close()
+		buf := make([]byte, 100)
+		io.ReadFull(r, buf)
+		if pos, _ := r.Seek(-40, io.SeekCurrent); pos != 60 {
+			t.Fatalf("Seek() = %d, want 60", pos)
+		}
+		io.ReadFull(r, buf[:20])
+		if !bytes.Equal(buf[:20], full[60:80]) {
+			t.Error("bytes after a relative seek differ")
+		}
+	})
+
+	t.Run("negative position", func(t *testing.T) {
+		if _, err := a.Reader().Seek(-1, io.SeekStart); err == nil {
+			t.Error("Seek() to a negative position succeeded")
+		}
+	})
+}
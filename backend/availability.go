@@ -0,0 +1,308 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Availability check states
+const (
+	AvailabilityQueued    = "queued"
+	AvailabilityRunning   = "running"
+	AvailabilityCompleted = "completed"
+	AvailabilityCancelled = "cancelled"
+)
+
+// availabilityRetention is how long finished checks can still be read
+const availabilityRetention = 15 * time.Minute
+
+var (
+	ErrAvailabilityQueueFull     = errors.New("too many tracks are waiting for an availability check")
+	ErrAvailabilityCheckNotFound = errors.New("availability check not found")
+)
+
+// AvailabilityUpdate is the payload of availability events: the result of
+// one track, or the end of a check when the event type is
+// EventAvailabilityDone
+type AvailabilityUpdate struct {
+	CheckID   string             `json:"check_id"`
+	UserID    string             `json:"user_id,omitempty"`
+	Status    string             `json:"status"`
+	SpotifyID string             `json:"spotify_id,omitempty"`
+	Result    *TrackAvailability `json:"result,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Done      int                `json:"done"`
+	Total     int                `json:"total"`
+}
+
+// AvailabilityCheck is a batch of tracks checked in the background.
+// Results are in the order the tracks were checked; Errors holds the
+// message of every track that could not be checked.
+type AvailabilityCheck struct {
+	ID         string              `json:"id"`
+	UserID     string              `json:"user_id,omitempty"`
+	Status     string              `json:"status"`
+	Total      int                 `json:"total"`
+	Done       int                 `json:"done"`
+	Results    []TrackAvailability `json:"results"`
+	Errors     map[string]string   `json:"errors,omitempty"`
+	CreatedAt  int64               `json:"created_at"`
+	FinishedAt int64               `json:"finished_at,omitempty"`
+
+	pending []string
+}
+
+type cachedAvailability struct {
+	result  TrackAvailability
+	expires time.Time
+}
+
+// availabilityQueue holds the checks with tracks left. The checker takes
+// one track of the first check and moves it to the back, so a large batch
+// does not hold up everyone else. All state is guarded by availabilityLock.
+var (
+	availabilityChecks    = make(map[string]*AvailabilityCheck)
+	availabilityQueue     []*AvailabilityCheck
+	availabilityQueued    int
+	availabilityCache     = make(map[string]cachedAvailability)
+	availabilityMaxQueued = 2000
+	availabilityCacheTTL  = time.Hour
+	availabilityLock      sync.Mutex
+	availabilityCond      = sync.NewCond(&availabilityLock)
+	availabilityOnce      sync.Once
+)
+
+// StartAvailabilityChecker starts the goroutine that works through
+// availability checks. It owns the only SongLinkClient used for them, so
+// the client's budget of nine lookups per minute holds for all checks
+// together. maxQueued caps the tracks waiting across all checks and
+// results are reused for cacheTTL. Calling it more than once is a no-op.
+func StartAvailabilityChecker(maxQueued int, cacheTTL time.Duration) {
+	availabilityOnce.Do(func() {
+		availabilityLock.Lock()
+		if maxQueued > 0 {
+			availabilityMaxQueued = maxQueued
+		}
+		if cacheTTL > 0 {
+			availabilityCacheTTL = cacheTTL
+		}
+		availabilityLock.Unlock()
+
+		go runAvailabilityChecker()
+	})
+}
+
+// StartAvailabilityCheck queues spotifyIDs for userID and returns the new
+// check together with the number of tracks already waiting before it.
+// Duplicate IDs are checked once.
+func StartAvailabilityCheck(spotifyIDs []string, userID string) (AvailabilityCheck, int, error) {
+	seen := make(map[string]bool, len(spotifyIDs))
+	pending := make([]string, 0, len(spotifyIDs))
+	for _, id := range spotifyIDs {
+		if !seen[id] {
+			seen[id] = true
+			pending = append(pending, id)
+		}
+	}
+
+	availabilityLock.Lock()
+	defer availabilityLock.Unlock()
+
+	pruneAvailabilityLocked()
+
+	if availabilityQueued+len(pending) > availabilityMaxQueued {
+		return AvailabilityCheck{}, 0, ErrAvailabilityQueueFull
+	}
+
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	check := &AvailabilityCheck{
+		ID:        hex.EncodeToString(buf),
+		UserID:    userID,
+		Status:    AvailabilityQueued,
+		Total:     len(pending),
+		Results:   []TrackAvailability{},
+		Errors:    map[string]string{},
+		CreatedAt: time.Now().Unix(),
+		pending:   pending,
+	}
+
+	ahead := availabilityQueued
+	availabilityChecks[check.ID] = check
+	availabilityQueue = append(availabilityQueue, check)
+	availabilityQueued += len(pending)
+	availabilityCond.Signal()
+
+	return check.snapshot(), ahead, nil
+}
+
+// GetAvailabilityCheck returns a check of userID; an empty userID may read
+// every check
+func GetAvailabilityCheck(id, userID string) (AvailabilityCheck, error) {
+	availabilityLock.Lock()
+	defer availabilityLock.Unlock()
+
+	check, ok := availabilityChecks[id]
+	if !ok || (userID != "" && check.UserID != userID) {
+		return AvailabilityCheck{}, ErrAvailabilityCheckNotFound
+	}
+	return check.snapshot(), nil
+}
+
+// CancelAvailabilityCheck drops the unchecked tracks of a check. Finished
+// checks are returned unchanged.
+func CancelAvailabilityCheck(id, userID string) (AvailabilityCheck, error) {
+	availabilityLock.Lock()
+	defer availabilityLock.Unlock()
+
+	check, ok := availabilityChecks[id]
+	if !ok || (userID != "" && check.UserID != userID) {
+		return AvailabilityCheck{}, ErrAvailabilityCheckNotFound
+	}
+	if check.FinishedAt != 0 {
+		return check.snapshot(), nil
+	}
+
+	for i, queued := range availabilityQueue {
+		if queued == check {
+			availabilityQueue = append(availabilityQueue[:i], availabilityQueue[i+1:]...)
+			break
+		}
+	}
+	availabilityQueued -= len(check.pending)
+	check.pending = nil
+	check.finishLocked(AvailabilityCancelled)
+
+	return check.snapshot(), nil
+}
+
+func runAvailabilityChecker() {
+	client := NewSongLinkClient()
+	for {
+		check, spotifyID, cached := nextAvailabilityTrack()
+		if cached != nil {
+			recordAvailability(check, spotifyID, cached, nil)
+			continue
+		}
+
+		result, err := client.CheckTrackAvailability(context.Background(), spotifyID)
+		if err != nil {
+			slog.Warn("Availability check failed", "spotify_id", spotifyID, "error", err)
+		}
+		recordAvailability(check, spotifyID, result, err)
+	}
+}
+
+// nextAvailabilityTrack blocks until a track is queued and returns it with
+// its cached result, if any
+func nextAvailabilityTrack() (*AvailabilityCheck, string, *TrackAvailability) {
+	availabilityLock.Lock()
+	defer availabilityLock.Unlock()
+
+	for len(availabilityQueue) == 0 {
+		availabilityCond.Wait()
+	}
+
+	check := availabilityQueue[0]
+	availabilityQueue = availabilityQueue[1:]
+	spotifyID := check.pending[0]
+	check.pending = check.pending[1:]
+	if len(check.pending) > 0 {
+		availabilityQueue = append(availabilityQueue, check)
+	}
+	availabilityQueued--
+	check.Status = AvailabilityRunning
+
+	if cached, ok := availabilityCache[spotifyID]; ok && time.Now().Before(cached.expires) {
+		result := cached.result
+		return check, spotifyID, &result
+	}
+	return check, spotifyID, nil
+}
+
+// recordAvailability stores the outcome of one track and publishes it.
+// Results of cancelled checks are only cached.
+func recordAvailability(check *AvailabilityCheck, spotifyID string, result *TrackAvailability, err error) {
+	availabilityLock.Lock()
+	defer availabilityLock.Unlock()
+
+	if err == nil {
+		availabilityCache[spotifyID] = cachedAvailability{result: *result, expires: time.Now().Add(availabilityCacheTTL)}
+	}
+	if check.FinishedAt != 0 {
+		return
+	}
+
+	check.Done++
+	update := AvailabilityUpdate{
+		CheckID:   check.ID,
+		UserID:    check.UserID,
+		SpotifyID: spotifyID,
+		Done:      check.Done,
+		Total:     check.Total,
+	}
+	if err != nil {
+		check.Errors[spotifyID] = err.Error()
+		update.Error = err.Error()
+	} else {
+		check.Results = append(check.Results, *result)
+		update.Result = result
+	}
+
+	finished := check.Done == check.Total
+	if finished {
+		check.Status = AvailabilityCompleted
+	}
+	update.Status = check.Status
+	emitAvailabilityEvent(EventAvailabilityResult, update)
+
+	if finished {
+		check.finishLocked(AvailabilityCompleted)
+	}
+}
+
+// finishLocked ends a check and publishes EventAvailabilityDone
+func (check *AvailabilityCheck) finishLocked(status string) {
+	check.Status = status
+	check.FinishedAt = time.Now().Unix()
+	emitAvailabilityEvent(EventAvailabilityDone, AvailabilityUpdate{
+		CheckID: check.ID,
+		UserID:  check.UserID,
+		Status:  status,
+		Done:    check.Done,
+		Total:   check.Total,
+	})
+}
+
+// pruneAvailabilityLocked forgets finished checks past their retention and
+// expired cache entries
+func pruneAvailabilityLocked() {
+	now := time.Now()
+	for id, check := range availabilityChecks {
+		if check.FinishedAt != 0 && now.Sub(time.Unix(check.FinishedAt, 0)) > availabilityRetention {
+			delete(availabilityChecks, id)
+		}
+	}
+	for id, cached := range availabilityCache {
+		if now.After(cached.expires) {
+			delete(availabilityCache, id)
+		}
+	}
+}
+
+// snapshot copies a check so it can be read without availabilityLock
+func (check *AvailabilityCheck) snapshot() AvailabilityCheck {
+	out := *check
+	out.Results = append([]TrackAvailability{}, check.Results...)
+	out.Errors = make(map[string]string, len(check.Errors))
+	for id, msg := range check.Errors {
+		out.Errors[id] = msg
+	}
+	out.pending = nil
+	return out
+}
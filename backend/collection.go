@@ -0,0 +1,185 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SpotifyCollection is an album, playlist or artist discography resolved
+// from a Spotify URL, flattened to the list of tracks to download.
+type SpotifyCollection struct {
+	Type   string               `json:"type"`
+	Name   string               `json:"name"`
+	Owner  string               `json:"owner,omitempty"`
+	Tracks []AlbumTrackMetadata `json:"tracks"`
+}
+
+// DownloadBatch groups the queue items created for one collection so the
+// M3U8 playlist can be written once every item has finished.
+type DownloadBatch struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	OutputDir  string   `json:"output_dir"`
+	ItemIDs    []string `json:"item_ids"`
+	CreateM3U8 bool     `json:"create_m3u8"`
+}
+
+var (
+	downloadBatches     = make(map[string]*DownloadBatch)
+	downloadBatchesLock sync.Mutex
+)
+
+// ResolveSpotifyCollection fetches an album, playlist or artist URL, going
+// through the SpotFetch API when spotFetchURL is set. Single track URLs are
+// rejected.
+func ResolveSpotifyCollection(ctx context.Context, spotifyURL, spotFetchURL string) (*SpotifyCollection, error) {
+	data, err := GetSpotifyDataWithAPI(ctx, spotifyURL, spotFetchURL != "", spotFetchURL, false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch payload := data.(type) {
+	case *AlbumResponsePayload:
+		return &SpotifyCollection{
+			Type:   "album",
+			Name:   payload.AlbumInfo.Name,
+			Tracks: payload.TrackList,
+		}, nil
+	case PlaylistResponsePayload:
+		return &SpotifyCollection{
+			Type:   "playlist",
+			Name:   payload.PlaylistInfo.Owner.Name,
+			Owner:  payload.PlaylistInfo.Owner.DisplayName,
+			Tracks: payload.TrackList,
+		}, nil
+	case *ArtistDiscographyPayload:
+		return &SpotifyCollection{
+			Type:   "artist",
+			Name:   payload.ArtistInfo.Name,
+			Tracks: payload.TrackList,
+		}, nil
+	case TrackResponse:
+		return nil, fmt.Errorf("URL points to a single track, not an album, playlist or artist")
+	default:
+		return nil, fmt.Errorf("unsupported Spotify payload")
+	}
+}
+
+// EnqueueCollection queues every track of a collection. Fields shared by all
+// tracks (service, output directory, formats, options) are taken from
+// template; per-track metadata, playlist position and playlist name/owner
+// are filled in from the collection.
+func EnqueueCollection(col *SpotifyCollection, template DownloadRequest, createM3U8 bool) *DownloadBatch {
+	batch := &DownloadBatch{
+		ID:         fmt.Sprintf("batch-%d", time.Now().UnixNano()),
+		Type:       col.Type,
+		Name:       col.Name,
+		OutputDir:  downloadOutputDir(template.OutputDir, col.Name),
+		ItemIDs:    make([]string, 0, len(col.Tracks)),
+		CreateM3U8: createM3U8,
+	}
+
+	// Register the batch before the first item is queued so the worker
+	// can never finish an item of an unknown batch
+	downloadBatchesLock.Lock()
+	downloadBatches[batch.ID] = batch
+	downloadBatchesLock.Unlock()
+
+	for i, track := range col.Tracks {
+		if track.SpotifyID == "" {
+			continue
+		}
+
+		req := template
+		req.ItemID = ""
+		req.BatchID = batch.ID
+		req.SpotifyID = track.SpotifyID
+		req.TrackName = track.Name
+		req.ArtistName = track.Artists
+		req.AlbumName = track.AlbumName
+		req.AlbumArtist = track.AlbumArtist
+		req.ReleaseDate = track.ReleaseDate
+		req.CoverURL = track.Images
+		req.Duration = track.DurationMS / 1000
+		req.Position = i + 1
+		req.SpotifyTrackNumber = track.TrackNumber
+		req.SpotifyDiscNumber = track.DiscNumber
+		req.SpotifyTotalTracks = track.TotalTracks
+		req.SpotifyTotalDiscs = track.TotalDiscs
+		req.PlaylistName = col.Name
+		req.PlaylistOwner = col.Owner
+
+		// Discographies span many albums, so the album track number is
+		// the only meaningful position
+		if col.Type == "artist" && track.TrackNumber > 0 {
+			req.Position = track.TrackNumber
+		}
+
+		itemID := NewDownloadItemID(req)
+		req.ItemID = itemID
+
+		downloadBatchesLock.Lock()
+		batch.ItemIDs = append(batch.ItemIDs, itemID)
+		downloadBatchesLock.Unlock()
+
+		EnqueueDownload(req)
+	}
+
+	downloadBatchesLock.Lock()
+	result := *batch
+	result.ItemIDs = append([]string(nil), batch.ItemIDs...)
+	downloadBatchesLock.Unlock()
+
+	saveDownloadBatch(result)
+
+	return &result
+}
+
+// finishBatchIfDone writes the batch M3U8 once none of its items are
+// queued or downloading anymore and then forgets the batch.
+func finishBatchIfDone(batchID string) {
+	downloadBatchesLock.Lock()
+	batch, ok := downloadBatches[batchID]
+	if !ok {
+		downloadBatchesLock.Unlock()
+		return
+	}
+	itemIDs := append([]string(nil), batch.ItemIDs...)
+	downloadBatchesLock.Unlock()
+
+	items := make(map[string]DownloadItem, len(itemIDs))
+	for _, item := range GetDownloadQueue().Queue {
+		items[item.ID] = item
+	}
+
+	filePaths := make([]string, 0, len(itemIDs))
+	for _, id := range itemIDs {
+		item, found := items[id]
+		if !found {
+			continue
+		}
+		if item.Status == StatusQueued || item.Status == StatusDownloading {
+			return
+		}
+		if item.FilePath != "" {
+			filePaths = append(filePaths, item.FilePath)
+		}
+	}
+
+	downloadBatchesLock.Lock()
+	delete(downloadBatches, batchID)
+	downloadBatchesLock.Unlock()
+	deleteDownloadBatch(batchID)
+
+	if !batch.CreateM3U8 || len(filePaths) == 0 {
+		return
+	}
+
+	if err := CreateM3U8File(batch.Name, batch.OutputDir, filePaths); err != nil {
+		slog.Warn("Failed to create M3U8", "batch", batch.Name, "error", err)
+	}
+}
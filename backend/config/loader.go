@@ -2,15 +2,39 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
 
-var globalConfig *Config
+var (
+	// globalConfig is swapped as a whole, never changed in place, so Get
+	// can be called from any goroutine
+	globalConfig atomic.Pointer[Config]
+	// writeLock serializes Update and ReloadProviders so neither loses
+	// the changes of the other
+	writeLock sync.Mutex
+	// loadedPath is the file globalConfig was loaded from, see
+	// ReloadProviders
+	loadedPath string
+)
+
+// providerNamePattern matches the names download providers are registered
+// under
+var providerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+var (
+	endpointKindPattern = regexp.MustCompile(`^[a-z0-9_-]{0,32}$`)
+	headerNamePattern   = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+)
 
 // Load reads and parses the configuration file
 // Following rule #9: Zero Trust Input - validates all configuration values
@@ -26,6 +50,8 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	migrateTidalAPIURL(&cfg)
+
 	// Apply defaults
 	applyDefaults(&cfg)
 
@@ -38,18 +64,93 @@ func Load(configPath string) (*Config, error) {
 	}
 
 	// Store globally for access throughout application
-	globalConfig = &cfg
+	writeLock.Lock()
+	globalConfig.Store(&cfg)
+	loadedPath = configPath
+	writeLock.Unlock()
 
 	return &cfg, nil
 }
 
+// ReloadProviders re-reads the providers section from the loaded
+// configuration file and hands it to apply. The file is validated as a
+// whole, but only the provider endpoints of the running configuration
+// change, and only once apply accepted them; everything else needs a
+// restart.
+func ReloadProviders(apply func(map[string]ProviderConfig) error) error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	current := Get()
+	if loadedPath == "" {
+		return fmt.Errorf("configuration was not loaded from a file")
+	}
+
+	data, err := os.ReadFile(loadedPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	migrateTidalAPIURL(&cfg)
+	applyDefaults(&cfg)
+	applyEnvOverrides(&cfg)
+	if err := validate(&cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := apply(cfg.Providers); err != nil {
+		return err
+	}
+
+	next := *current
+	next.Providers = cfg.Providers
+	globalConfig.Store(&next)
+	return nil
+}
+
+// migrateTidalAPIURL moves the deprecated services.tidal_api_url into the
+// endpoint list of providers.tidal. Without such a list the URL stays the
+// only Tidal endpoint, as before.
+func migrateTidalAPIURL(cfg *Config) {
+	apiURL := strings.TrimSpace(cfg.Services.TidalAPIURL)
+	cfg.Services.TidalAPIURL = ""
+	if apiURL == "" || apiURL == "auto" {
+		return
+	}
+	slog.Warn("services.tidal_api_url is deprecated, list the URL under providers.tidal.endpoints", "url", apiURL)
+
+	if cfg.Providers == nil {
+		cfg.Providers = map[string]ProviderConfig{}
+	}
+	tidal := cfg.Providers["tidal"]
+	for _, e := range tidal.Endpoints {
+		if e.URL == apiURL {
+			return
+		}
+	}
+	tidal.Endpoints = append([]EndpointConfig{{URL: apiURL}}, tidal.Endpoints...)
+	cfg.Providers["tidal"] = tidal
+}
+
+// Path returns the file the configuration was loaded from, where Update
+// saves changes made at runtime
+func Path() string {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	return loadedPath
+}
+
 // Get returns the global configuration
 // Must call Load() first
+// The returned configuration must not be modified, use Update.
 func Get() *Config {
-	if globalConfig == nil {
+	cfg := globalConfig.Load()
+	if cfg == nil {
 		panic("configuration not loaded - call config.Load() first")
 	}
-	return globalConfig
+	return cfg
 }
 
 // applyDefaults sets default values for missing configuration
@@ -64,6 +165,21 @@ func applyDefaults(cfg *Config) {
 	if len(cfg.Server.CORSOrigins) == 0 {
 		cfg.Server.CORSOrigins = []string{"http://localhost:5173", "http://localhost:8080"}
 	}
+	if cfg.Server.TrustedProxies == nil {
+		cfg.Server.TrustedProxies = []string{"127.0.0.1", "::1"}
+	}
+	if cfg.Server.WSSendBuffer == 0 {
+		cfg.Server.WSSendBuffer = 256
+	}
+	if cfg.Server.EventHistorySize == 0 {
+		cfg.Server.EventHistorySize = 1000
+	}
+	if cfg.Server.ShutdownTimeoutSeconds == 0 {
+		cfg.Server.ShutdownTimeoutSeconds = 10
+	}
+	if cfg.Server.DrainTimeoutSeconds == 0 {
+		cfg.Server.DrainTimeoutSeconds = 30
+	}
 
 	// Download defaults
 	if cfg.Download.Path == "" {
@@ -81,11 +197,20 @@ func applyDefaults(cfg *Config) {
 	if cfg.Download.AudioFormat == "" {
 		cfg.Download.AudioFormat = "LOSSLESS"
 	}
+	if cfg.Download.Concurrency == 0 {
+		cfg.Download.Concurrency = 3
+	}
+	if cfg.Download.StreamRetries == 0 {
+		cfg.Download.StreamRetries = 3
+	}
 
 	// Services defaults
 	if cfg.Services.DefaultService == "" {
 		cfg.Services.DefaultService = "tidal"
 	}
+	if len(cfg.Services.EnabledProviders) == 0 {
+		cfg.Services.EnabledProviders = []string{"tidal", "qobuz", "amazon"}
+	}
 
 	// UI defaults
 	if cfg.UI.Theme == "" {
@@ -102,6 +227,105 @@ func applyDefaults(cfg *Config) {
 	if cfg.Database.Path == "" {
 		cfg.Database.Path = "SpotiFLAC"
 	}
+
+	if cfg.Download.UsersDir == "" {
+		cfg.Download.UsersDir = "users"
+	}
+
+	// Auth defaults
+	if cfg.Auth.SessionTTLHours == 0 {
+		cfg.Auth.SessionTTLHours = 12
+	}
+	if cfg.Auth.MinPasswordLength == 0 {
+		cfg.Auth.MinPasswordLength = 12
+	}
+
+	// Logging defaults
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = "info"
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = "text"
+	}
+
+	// Health check defaults
+	if cfg.Health.MinFreeSpaceMB == 0 {
+		cfg.Health.MinFreeSpaceMB = 500
+	}
+	if cfg.Health.TimeoutSeconds == 0 {
+		cfg.Health.TimeoutSeconds = 5
+	}
+	if cfg.Health.ExternalCacheSeconds == 0 {
+		cfg.Health.ExternalCacheSeconds = 60
+	}
+
+	// Library defaults
+	if cfg.Library.Transcode.DefaultBitrateKbps == 0 {
+		cfg.Library.Transcode.DefaultBitrateKbps = 192
+	}
+	if cfg.Library.Transcode.MaxBitrateKbps == 0 {
+		cfg.Library.Transcode.MaxBitrateKbps = 320
+	}
+	if cfg.Library.Transcode.MaxConcurrent == 0 {
+		cfg.Library.Transcode.MaxConcurrent = 2
+	}
+	if cfg.Library.Archive.MaxFiles == 0 {
+		cfg.Library.Archive.MaxFiles = 5000
+	}
+
+	// Asset defaults
+	if len(cfg.Assets.AllowedImageHosts) == 0 {
+		cfg.Assets.AllowedImageHosts = []string{"scdn.co", "spotifycdn.com"}
+	}
+	if cfg.Assets.BatchConcurrency == 0 {
+		cfg.Assets.BatchConcurrency = 4
+	}
+	if cfg.Assets.MaxBatchSize == 0 {
+		cfg.Assets.MaxBatchSize = 500
+	}
+
+	// Availability defaults
+	if cfg.Availability.MaxBatchSize == 0 {
+		cfg.Availability.MaxBatchSize = 500
+	}
+	if cfg.Availability.MaxQueued == 0 {
+		cfg.Availability.MaxQueued = 2000
+	}
+	if cfg.Availability.CacheMinutes == 0 {
+		cfg.Availability.CacheMinutes = 60
+	}
+
+	// Mirror circuit breaker defaults
+	if cfg.Mirrors.FailureThreshold == 0 {
+		cfg.Mirrors.FailureThreshold = 3
+	}
+	if cfg.Mirrors.CooldownSeconds == 0 {
+		cfg.Mirrors.CooldownSeconds = 30
+	}
+	if cfg.Mirrors.MaxCooldownSeconds == 0 {
+		cfg.Mirrors.MaxCooldownSeconds = 900
+	}
+	if cfg.Mirrors.FlushIntervalSeconds == 0 {
+		cfg.Mirrors.FlushIntervalSeconds = 30
+	}
+
+	// Provider endpoint defaults
+	for _, provider := range cfg.Providers {
+		for i := range provider.Endpoints {
+			if provider.Endpoints[i].Weight == 0 {
+				provider.Endpoints[i].Weight = 1
+			}
+			if provider.Endpoints[i].TimeoutSeconds == 0 {
+				provider.Endpoints[i].TimeoutSeconds = 30
+			}
+		}
+	}
+
+	// Rate limit defaults
+	setBudgetDefaults(&cfg.RateLimit.Metadata, 30, 10)
+	setBudgetDefaults(&cfg.RateLimit.Search, 30, 10)
+	setBudgetDefaults(&cfg.RateLimit.Download, 60, 20)
+	setBudgetDefaults(&cfg.RateLimit.Login, 10, 5)
 }
 
 // applyEnvOverrides applies environment variable overrides
@@ -117,16 +341,74 @@ func applyEnvOverrides(cfg *Config) {
 	if host := os.Getenv("SPOTIFLAC_SERVER_HOST"); host != "" {
 		cfg.Server.Host = host
 	}
+	if timeout := os.Getenv("SPOTIFLAC_SHUTDOWN_TIMEOUT"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			cfg.Server.ShutdownTimeoutSeconds = t
+		}
+	}
+	if timeout := os.Getenv("SPOTIFLAC_DRAIN_TIMEOUT"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			cfg.Server.DrainTimeoutSeconds = t
+		}
+	}
 
 	// Download path override
 	if path := os.Getenv("SPOTIFLAC_DOWNLOAD_PATH"); path != "" {
 		cfg.Download.Path = path
 	}
 
+	// Download concurrency override
+	if concurrency := os.Getenv("SPOTIFLAC_DOWNLOAD_CONCURRENCY"); concurrency != "" {
+		if c, err := strconv.Atoi(concurrency); err == nil {
+			cfg.Download.Concurrency = c
+		}
+	}
+
 	// Service overrides
 	if service := os.Getenv("SPOTIFLAC_DEFAULT_SERVICE"); service != "" {
 		cfg.Services.DefaultService = service
 	}
+
+	// Logging overrides
+	if level := os.Getenv("SPOTIFLAC_LOG_LEVEL"); level != "" {
+		cfg.Logging.Level = level
+	}
+	if format := os.Getenv("SPOTIFLAC_LOG_FORMAT"); format != "" {
+		cfg.Logging.Format = format
+	}
+
+	// Metrics overrides
+	if enabled := os.Getenv("SPOTIFLAC_METRICS_ENABLED"); enabled != "" {
+		if b, err := strconv.ParseBool(enabled); err == nil {
+			cfg.Metrics.Enabled = b
+		}
+	}
+
+	// Auth overrides (rule #11: keep secrets out of config files)
+	if enabled := os.Getenv("SPOTIFLAC_AUTH_ENABLED"); enabled != "" {
+		if b, err := strconv.ParseBool(enabled); err == nil {
+			cfg.Auth.Enabled = b
+		}
+	}
+	// SPOTIFLAC_API_KEYS: comma separated "name:key" or plain "key" entries
+	if keys := os.Getenv("SPOTIFLAC_API_KEYS"); keys != "" {
+		for i, entry := range strings.Split(keys, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, key, found := strings.Cut(entry, ":")
+			if !found {
+				name, key = fmt.Sprintf("env-%d", i+1), entry
+			}
+			// "name@user:key" binds the key to a user account
+			name, user, _ := strings.Cut(name, "@")
+			cfg.Auth.EnvAPIKeys = append(cfg.Auth.EnvAPIKeys, APIKeyConfig{Name: name, Key: key, User: user})
+		}
+	}
+	if secret := os.Getenv("SPOTIFLAC_SESSION_SECRET"); secret != "" {
+		cfg.Auth.EnvSessionSecret = secret
+	}
 }
 
 // validate checks configuration values for correctness
@@ -137,10 +419,20 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("server port must be between 1024-65535 (non-privileged ports)")
 	}
 
+	if cfg.Server.ShutdownTimeoutSeconds < 1 || cfg.Server.ShutdownTimeoutSeconds > 3600 {
+		return fmt.Errorf("server shutdown_timeout_seconds must be between 1-3600")
+	}
+	if cfg.Server.DrainTimeoutSeconds < 1 || cfg.Server.DrainTimeoutSeconds > 3600 {
+		return fmt.Errorf("server drain_timeout_seconds must be between 1-3600")
+	}
+
 	// Validate download path (rule #9: prevent path traversal)
 	if strings.Contains(cfg.Download.Path, "..") {
 		return fmt.Errorf("download path cannot contain '..' (path traversal attempt)")
 	}
+	if filepath.IsAbs(cfg.Download.UsersDir) || strings.Contains(cfg.Download.UsersDir, "..") {
+		return fmt.Errorf("users_dir must be a relative directory below the download path")
+	}
 
 	// Validate audio format
 	validFormats := map[string]bool{
@@ -153,14 +445,50 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("invalid audio format: %s (must be LOSSLESS, 6, 7, or 27)", cfg.Download.AudioFormat)
 	}
 
+	// Validate enabled providers; the names themselves are checked against
+	// the provider registry on startup
+	enabledProviders := make(map[string]bool, len(cfg.Services.EnabledProviders))
+	for _, name := range cfg.Services.EnabledProviders {
+		if !providerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid provider name in enabled_providers: %q", name)
+		}
+		if enabledProviders[name] {
+			return fmt.Errorf("duplicate provider in enabled_providers: %s", name)
+		}
+		enabledProviders[name] = true
+	}
+
+	// Validate the fallback chain
+	inChain := make(map[string]bool, len(cfg.Services.FallbackChain))
+	for _, name := range cfg.Services.FallbackChain {
+		if !enabledProviders[name] {
+			return fmt.Errorf("invalid provider in fallback_chain: %q (must be one of enabled_providers)", name)
+		}
+		if inChain[name] {
+			return fmt.Errorf("duplicate provider in fallback_chain: %s", name)
+		}
+		inChain[name] = true
+	}
+
 	// Validate default service
-	validServices := map[string]bool{
-		"tidal":  true,
-		"qobuz":  true,
-		"amazon": true,
+	if !enabledProviders[cfg.Services.DefaultService] {
+		return fmt.Errorf("invalid default service: %s (must be one of enabled_providers)", cfg.Services.DefaultService)
+	}
+
+	// Validate download concurrency (keep mirrors and proxies from being hammered)
+	if cfg.Download.Concurrency < 1 || cfg.Download.Concurrency > 16 {
+		return fmt.Errorf("download concurrency must be between 1-16")
 	}
-	if !validServices[cfg.Services.DefaultService] {
-		return fmt.Errorf("invalid default service: %s (must be tidal, qobuz, or amazon)", cfg.Services.DefaultService)
+	if cfg.Download.StreamRetries < 1 || cfg.Download.StreamRetries > 10 {
+		return fmt.Errorf("download stream_retries must be between 1-10")
+	}
+	for service, limit := range cfg.Download.ProviderConcurrency {
+		if !providerNamePattern.MatchString(service) {
+			return fmt.Errorf("invalid service in provider_concurrency: %s", service)
+		}
+		if limit < 0 {
+			return fmt.Errorf("provider_concurrency for %s cannot be negative", service)
+		}
 	}
 
 	// Validate theme mode
@@ -173,12 +501,230 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("invalid theme mode: %s (must be light, dark, or auto)", cfg.UI.ThemeMode)
 	}
 
+	// Validate logging
+	validLogLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+	cfg.Logging.Level = strings.ToLower(cfg.Logging.Level)
+	if !validLogLevels[cfg.Logging.Level] {
+		return fmt.Errorf("invalid log level: %s (must be debug, info, warn or error)", cfg.Logging.Level)
+	}
+	cfg.Logging.Format = strings.ToLower(cfg.Logging.Format)
+	if cfg.Logging.Format != "text" && cfg.Logging.Format != "json" {
+		return fmt.Errorf("invalid log format: %s (must be text or json)", cfg.Logging.Format)
+	}
+
+	// Validate health checks
+	if cfg.Health.MinFreeSpaceMB < 0 {
+		return fmt.Errorf("health.min_free_space_mb cannot be negative")
+	}
+	if cfg.Health.TimeoutSeconds < 1 || cfg.Health.TimeoutSeconds > 60 {
+		return fmt.Errorf("health.timeout_seconds must be between 1-60")
+	}
+	if cfg.Health.ExternalCacheSeconds < 1 {
+		return fmt.Errorf("health.external_cache_seconds must be at least 1")
+	}
+
+	// Validate transcoding (keep ffmpeg from exhausting the CPU)
+	transcode := cfg.Library.Transcode
+	if transcode.MaxBitrateKbps < 32 || transcode.MaxBitrateKbps > 512 {
+		return fmt.Errorf("library.transcode.max_bitrate_kbps must be between 32-512")
+	}
+	if transcode.DefaultBitrateKbps < 32 || transcode.DefaultBitrateKbps > transcode.MaxBitrateKbps {
+		return fmt.Errorf("library.transcode.default_bitrate_kbps must be between 32 and max_bitrate_kbps")
+	}
+	if transcode.MaxConcurrent < 1 || transcode.MaxConcurrent > 32 {
+		return fmt.Errorf("library.transcode.max_concurrent must be between 1-32")
+	}
+	if cfg.Library.Archive.MaxFiles < 1 || cfg.Library.Archive.MaxFiles > 100000 {
+		return fmt.Errorf("library.archive.max_files must be between 1-100000")
+	}
+
+	// Validate assets; image hosts are bare domains so URLs cannot smuggle
+	// a scheme, port or path past the allowlist
+	for _, host := range cfg.Assets.AllowedImageHosts {
+		if host == "" || strings.ContainsAny(host, ":/ ") {
+			return fmt.Errorf("assets.allowed_image_hosts must contain bare domain names: %q", host)
+		}
+	}
+	if cfg.Assets.BatchConcurrency < 1 || cfg.Assets.BatchConcurrency > 16 {
+		return fmt.Errorf("assets.batch_concurrency must be between 1-16")
+	}
+	if cfg.Assets.MaxBatchSize < 1 || cfg.Assets.MaxBatchSize > 5000 {
+		return fmt.Errorf("assets.max_batch_size must be between 1-5000")
+	}
+
+	if cfg.Availability.MaxBatchSize < 1 || cfg.Availability.MaxBatchSize > 5000 {
+		return fmt.Errorf("availability.max_batch_size must be between 1-5000")
+	}
+	if cfg.Availability.MaxQueued < cfg.Availability.MaxBatchSize || cfg.Availability.MaxQueued > 100000 {
+		return fmt.Errorf("availability.max_queued must be between availability.max_batch_size and 100000")
+	}
+	if cfg.Availability.CacheMinutes < 1 || cfg.Availability.CacheMinutes > 10080 {
+		return fmt.Errorf("availability.cache_minutes must be between 1-10080")
+	}
+
+	if cfg.Mirrors.FailureThreshold < 1 || cfg.Mirrors.FailureThreshold > 100 {
+		return fmt.Errorf("mirrors.failure_threshold must be between 1-100")
+	}
+	if cfg.Mirrors.CooldownSeconds < 1 || cfg.Mirrors.CooldownSeconds > 86400 {
+		return fmt.Errorf("mirrors.cooldown_seconds must be between 1-86400")
+	}
+	if cfg.Mirrors.MaxCooldownSeconds < cfg.Mirrors.CooldownSeconds || cfg.Mirrors.MaxCooldownSeconds > 86400 {
+		return fmt.Errorf("mirrors.max_cooldown_seconds must be between mirrors.cooldown_seconds and 86400")
+	}
+	if cfg.Mirrors.FlushIntervalSeconds < 1 || cfg.Mirrors.FlushIntervalSeconds > 3600 {
+		return fmt.Errorf("mirrors.flush_interval_seconds must be between 1-3600")
+	}
+
+	if err := validateProviders(cfg.Providers, enabledProviders); err != nil {
+		return err
+	}
+
+	if err := validateRateLimit(&cfg.RateLimit); err != nil {
+		return err
+	}
+
+	return validateAuth(&cfg.Auth)
+}
+
+// setBudgetDefaults fills an unset rate limit budget
+func setBudgetDefaults(budget *RateLimitBudget, perMinute float64, burst int) {
+	if budget.RequestsPerMinute == 0 {
+		budget.RequestsPerMinute = perMinute
+	}
+	if budget.Burst == 0 {
+		budget.Burst = burst
+	}
+}
+
+// validateProviders checks the provider endpoint lists (rule #9: Zero
+// Trust - endpoints receive our requests, headers must not inject lines)
+func validateProviders(providers map[string]ProviderConfig, enabled map[string]bool) error {
+	for name, provider := range providers {
+		if !providerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid provider name in providers: %q", name)
+		}
+
+		seen := make(map[string]bool, len(provider.Endpoints))
+		usable := 0
+		for _, e := range provider.Endpoints {
+			u, err := url.Parse(e.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+				return fmt.Errorf("providers.%s: endpoint url must be an http(s) URL: %q", name, e.URL)
+			}
+			if seen[e.URL] {
+				return fmt.Errorf("providers.%s: duplicate endpoint %s", name, e.URL)
+			}
+			seen[e.URL] = true
+			if !endpointKindPattern.MatchString(e.Kind) {
+				return fmt.Errorf("providers.%s: invalid endpoint kind %q", name, e.Kind)
+			}
+			if e.Weight <= 0 || e.Weight > 100 {
+				return fmt.Errorf("providers.%s: weight of %s must be between 0-100", name, e.URL)
+			}
+			if e.TimeoutSeconds < 1 || e.TimeoutSeconds > 600 {
+				return fmt.Errorf("providers.%s: timeout_seconds of %s must be between 1-600", name, e.URL)
+			}
+			for header, value := range e.Headers {
+				if !headerNamePattern.MatchString(header) || strings.ContainsAny(value, "\r\n") {
+					return fmt.Errorf("providers.%s: invalid header %q of %s", name, header, e.URL)
+				}
+			}
+			if e.IsEnabled() {
+				usable++
+			}
+		}
+		if enabled[name] && usable == 0 {
+			return fmt.Errorf("providers.%s needs at least one enabled endpoint", name)
+		}
+	}
 	return nil
 }
 
-// Save writes the current configuration to a file
-// Used when updating settings via API
-func Save(cfg *Config, configPath string) error {
+// validateRateLimit checks the ratelimit section
+func validateRateLimit(rl *RateLimitConfig) error {
+	budgets := map[string]RateLimitBudget{
+		"metadata": rl.Metadata,
+		"search":   rl.Search,
+		"download": rl.Download,
+		"login":    rl.Login,
+	}
+	for name, budget := range budgets {
+		if budget.RequestsPerMinute <= 0 || budget.Burst < 1 {
+			return fmt.Errorf("ratelimit.%s needs a positive requests_per_minute and burst", name)
+		}
+	}
+	return nil
+}
+
+// validateAuth checks the auth section (rule #14: Secure by Default - weak
+// secrets are rejected instead of silently accepted)
+func validateAuth(auth *AuthConfig) error {
+	if !auth.Enabled {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for _, key := range auth.AllAPIKeys() {
+		if len(key.Key) < minAPIKeyLength {
+			return fmt.Errorf("api key %q must be at least %d characters", key.Name, minAPIKeyLength)
+		}
+		if key.Name == "" || names[key.Name] {
+			return fmt.Errorf("api keys need unique, non-empty names")
+		}
+		names[key.Name] = true
+	}
+
+	usernames := make(map[string]bool)
+	for _, user := range auth.Users {
+		if user.Username == "" || usernames[user.Username] {
+			return fmt.Errorf("auth users need unique, non-empty usernames")
+		}
+		usernames[user.Username] = true
+		if !strings.HasPrefix(user.PasswordHash, "$2") {
+			return fmt.Errorf("password_hash of user %q must be a bcrypt hash", user.Username)
+		}
+	}
+
+	if secret := auth.EffectiveSessionSecret(); secret != "" && len(secret) < minSessionSecretLength {
+		return fmt.Errorf("session secret must be at least %d characters", minSessionSecretLength)
+	}
+	if auth.MinPasswordLength < 8 {
+		return fmt.Errorf("min_password_length must be at least 8")
+	}
+	if auth.SessionTTLHours < 1 || auth.SessionTTLHours > 24*30 {
+		return fmt.Errorf("session_ttl_hours must be between 1 and 720")
+	}
+
+	return nil
+}
+
+const (
+	minAPIKeyLength        = 32
+	minSessionSecretLength = 32
+)
+
+// Update applies change to a copy of the current configuration, writes it
+// to configPath and makes it the current one. Nothing changes when change
+// or the validation fails. Used when updating settings via API.
+func Update(configPath string, change func(cfg *Config) error) error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	// The copy shares slices and maps with the current configuration,
+	// change replaces them instead of modifying them
+	next := *Get()
+	if err := change(&next); err != nil {
+		return err
+	}
+	if err := save(&next, configPath); err != nil {
+		return err
+	}
+	globalConfig.Store(&next)
+	return nil
+}
+
+// save writes cfg to a file
+func save(cfg *Config, configPath string) error {
 	// Validate before saving
 	if err := validate(cfg); err != nil {
 		return fmt.Errorf("cannot save invalid configuration: %w", err)
@@ -195,13 +741,11 @@ func Save(cfg *Config, configPath string) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Write with restricted permissions (rule #14: Secure by Default)
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// Write with restricted permissions (rule #14: Secure by Default), the
+	// file may hold API keys and password hashes
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
-	// Update global config
-	globalConfig = cfg
-
 	return nil
 }
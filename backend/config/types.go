@@ -3,11 +3,25 @@ package config
 // Config represents the complete application configuration
 // loaded from config.yml
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Download DownloadConfig `yaml:"download"`
-	Services ServicesConfig `yaml:"services"`
-	UI       UIConfig       `yaml:"ui"`
-	Database DatabaseConfig `yaml:"database"`
+	Server    ServerConfig    `yaml:"server"`
+	Download  DownloadConfig  `yaml:"download"`
+	Services  ServicesConfig  `yaml:"services"`
+	UI        UIConfig        `yaml:"ui"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"ratelimit"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Health    HealthConfig    `yaml:"health"`
+	Library   LibraryConfig   `yaml:"library"`
+	Assets    AssetsConfig    `yaml:"assets"`
+
+	Availability AvailabilityConfig `yaml:"availability"`
+	Mirrors      MirrorsConfig      `yaml:"mirrors"`
+
+	// Providers holds the API endpoints of each download provider, keyed
+	// by provider name. Providers missing here use their built-in list.
+	Providers map[string]ProviderConfig `yaml:"providers"`
 }
 
 // ServerConfig contains HTTP server settings
@@ -15,28 +29,71 @@ type ServerConfig struct {
 	Host        string   `yaml:"host"`
 	Port        int      `yaml:"port"`
 	CORSOrigins []string `yaml:"cors_origins"`
+
+	// TrustedProxies are the proxy addresses/CIDRs whose X-Forwarded-For
+	// header is used as client IP (for rate limits and audit logs)
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// WSSendBuffer is the number of messages queued per WebSocket client
+	// before a client that does not keep up is disconnected
+	WSSendBuffer int `yaml:"ws_send_buffer"`
+
+	// EventHistorySize is the number of recent queue events kept for
+	// Last-Event-ID replay on GET /api/events
+	EventHistorySize int `yaml:"event_history_size"`
+
+	// ShutdownTimeoutSeconds is how long a SIGTERM waits for HTTP
+	// requests to finish
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+
+	// DrainTimeoutSeconds is how long a SIGTERM then waits for running
+	// downloads to finish. Downloads still running are checkpointed back
+	// to queued.
+	DrainTimeoutSeconds int `yaml:"drain_timeout_seconds"`
 }
 
 // DownloadConfig contains download preferences
 // These settings match the settings used in the Wails frontend
 type DownloadConfig struct {
-	Path                  string `yaml:"path"`
-	FilenameFormat        string `yaml:"filename_format"`
-	AudioFormat           string `yaml:"audio_format"`
-	EmbedLyrics           bool   `yaml:"embed_lyrics"`
-	EmbedMaxQualityCover  bool   `yaml:"embed_max_quality_cover"`
-	TrackNumber           bool   `yaml:"track_number"`
-	UseAlbumTrackNumber   bool   `yaml:"use_album_track_number"`
-	UseFirstArtistOnly    bool   `yaml:"use_first_artist_only"`
-	AllowFallback         bool   `yaml:"allow_fallback"`
+	Path                 string `yaml:"path"`
+	FilenameFormat       string `yaml:"filename_format"`
+	AudioFormat          string `yaml:"audio_format"`
+	EmbedLyrics          bool   `yaml:"embed_lyrics"`
+	EmbedMaxQualityCover bool   `yaml:"embed_max_quality_cover"`
+	TrackNumber          bool   `yaml:"track_number"`
+	UseAlbumTrackNumber  bool   `yaml:"use_album_track_number"`
+	UseFirstArtistOnly   bool   `yaml:"use_first_artist_only"`
+	AllowFallback        bool   `yaml:"allow_fallback"`
+	CreateM3U8           bool   `yaml:"create_m3u8"`
+
+	// Concurrency is the number of downloads running in parallel,
+	// ProviderConcurrency optionally caps it per service
+	Concurrency         int            `yaml:"concurrency"`
+	ProviderConcurrency map[string]int `yaml:"provider_concurrency"`
+
+	// StreamRetries is how often a transfer cut off by a network error is
+	// resumed from its .part file before the attempt fails
+	StreamRetries int `yaml:"stream_retries"`
+
+	// UsersDir is the directory below Path that holds one download
+	// directory per user account
+	UsersDir string `yaml:"users_dir"`
 }
 
 // ServicesConfig contains streaming service settings
 type ServicesConfig struct {
-	DefaultService    string `yaml:"default_service"`
-	TidalAPIURL       string `yaml:"tidal_api_url"`
-	UseSpotFetchAPI   bool   `yaml:"use_spotfetch_api"`
-	SpotFetchAPIURL   string `yaml:"spotfetch_api_url"`
+	DefaultService string `yaml:"default_service"`
+	// EnabledProviders are the download providers that may be used,
+	// registered providers missing here are disabled
+	EnabledProviders []string `yaml:"enabled_providers"`
+	// FallbackChain lists the providers tried in order when the requested
+	// one cannot download a track; empty disables the fallback
+	FallbackChain []string `yaml:"fallback_chain"`
+
+	// TidalAPIURL is deprecated, it is migrated into providers.tidal on load
+	TidalAPIURL     string `yaml:"tidal_api_url,omitempty"`
+	UseSpotFetchAPI bool   `yaml:"use_spotfetch_api"`
+	SpotFetchAPIURL string `yaml:"spotfetch_api_url"`
 }
 
 // UIConfig contains user interface preferences
@@ -46,7 +103,204 @@ type UIConfig struct {
 	FontFamily string `yaml:"font_family"`
 }
 
+// MetricsConfig controls the Prometheus endpoint GET /metrics
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Public serves /metrics without credentials, for scrapers on a
+	// trusted network. Otherwise an admin API key or token is required.
+	Public bool `yaml:"public"`
+}
+
+// LibraryConfig controls serving downloaded files through /api/library
+type LibraryConfig struct {
+	Transcode TranscodeConfig `yaml:"transcode"`
+	Archive   ArchiveConfig   `yaml:"archive"`
+}
+
+// ArchiveConfig controls ZIP downloads of history items and directories
+type ArchiveConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxFiles caps the number of files in one archive
+	MaxFiles int `yaml:"max_files"`
+}
+
+// TranscodeConfig controls on the fly transcoding of streamed files
+type TranscodeConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// DefaultBitrateKbps is used when a request sets no bitrate,
+	// MaxBitrateKbps caps what a request may ask for
+	DefaultBitrateKbps int `yaml:"default_bitrate_kbps"`
+	MaxBitrateKbps     int `yaml:"max_bitrate_kbps"`
+
+	// MaxConcurrent limits parallel ffmpeg transcodes; further requests
+	// get 503 until one finishes
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// AssetsConfig controls the lyrics and artwork downloads
+type AssetsConfig struct {
+	// AllowedImageHosts are the domains image URLs may point to, including
+	// their subdomains
+	AllowedImageHosts []string `yaml:"allowed_image_hosts"`
+
+	// BatchConcurrency is the number of tracks a batch request fetches in
+	// parallel, MaxBatchSize the number of tracks it may contain
+	BatchConcurrency int `yaml:"batch_concurrency"`
+	MaxBatchSize     int `yaml:"max_batch_size"`
+}
+
+// AvailabilityConfig controls the background availability checks, which
+// look tracks up on song.link at most nine times per minute
+type AvailabilityConfig struct {
+	// MaxBatchSize caps the tracks of one request, MaxQueued the tracks
+	// waiting across all requests
+	MaxBatchSize int `yaml:"max_batch_size"`
+	MaxQueued    int `yaml:"max_queued"`
+
+	// CacheMinutes is how long a result is reused before song.link is
+	// asked again
+	CacheMinutes int `yaml:"cache_minutes"`
+}
+
+// HealthConfig controls the readiness checks behind GET /health/ready
+type HealthConfig struct {
+	// MinFreeSpaceMB is the free space the download path needs to be ready
+	MinFreeSpaceMB int `yaml:"min_free_space_mb"`
+	// TimeoutSeconds bounds each individual check
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	// CheckSpotify and CheckProviders add the Spotify token bootstrap and
+	// the provider mirrors to readiness. Their results are cached for
+	// ExternalCacheSeconds so probes do not hammer upstream services.
+	CheckSpotify         bool `yaml:"check_spotify"`
+	CheckProviders       bool `yaml:"check_providers"`
+	ExternalCacheSeconds int  `yaml:"external_cache_seconds"`
+}
+
+// LoggingConfig contains log output settings
+type LoggingConfig struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+}
+
 // DatabaseConfig contains database settings
 type DatabaseConfig struct {
 	Path string `yaml:"path"`
 }
+
+// AuthConfig contains HTTP server authentication settings
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Static API keys, sent as "Authorization: Bearer <key>" or "X-API-Key"
+	APIKeys []APIKeyConfig `yaml:"api_keys"`
+
+	// Admin accounts created on startup if missing. Further users are
+	// managed through /api/users and stored in the database.
+	Users []UserConfig `yaml:"users"`
+
+	// MinPasswordLength applies to passwords set through the API
+	MinPasswordLength int `yaml:"min_password_length"`
+
+	// SessionSecret signs session tokens (HMAC-SHA256). If empty, a random
+	// secret is generated on startup and tokens do not survive a restart.
+	SessionSecret   string `yaml:"session_secret"`
+	SessionTTLHours int    `yaml:"session_ttl_hours"`
+
+	// Secrets supplied through the environment. They are never written
+	// back to config.yml by Save.
+	EnvAPIKeys       []APIKeyConfig `yaml:"-"`
+	EnvSessionSecret string         `yaml:"-"`
+}
+
+// APIKeyConfig is a named static API key. Keys bound to a User act as
+// that user account; unbound keys have admin rights.
+type APIKeyConfig struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	User string `yaml:"user,omitempty"`
+}
+
+// UserConfig is a login user. PasswordHash must be a bcrypt hash.
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`
+}
+
+// AllAPIKeys returns the API keys from config.yml and the environment
+func (a AuthConfig) AllAPIKeys() []APIKeyConfig {
+	keys := make([]APIKeyConfig, 0, len(a.APIKeys)+len(a.EnvAPIKeys))
+	keys = append(keys, a.APIKeys...)
+	return append(keys, a.EnvAPIKeys...)
+}
+
+// EffectiveSessionSecret prefers the secret from the environment
+func (a AuthConfig) EffectiveSessionSecret() string {
+	if a.EnvSessionSecret != "" {
+		return a.EnvSessionSecret
+	}
+	return a.SessionSecret
+}
+
+// RateLimitConfig contains per-client token bucket limits. Clients are
+// identified by API key or user account, unauthenticated clients by IP.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Separate budgets per route group
+	Metadata RateLimitBudget `yaml:"metadata"`
+	Search   RateLimitBudget `yaml:"search"`
+	Download RateLimitBudget `yaml:"download"`
+
+	// Login attempts per IP
+	Login RateLimitBudget `yaml:"login"`
+}
+
+// RateLimitBudget is a token bucket: Burst requests at once, refilled at
+// RequestsPerMinute
+type RateLimitBudget struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	Burst             int     `yaml:"burst"`
+}
+
+// MirrorsConfig controls the circuit breaker of provider API mirrors. A
+// mirror that fails FailureThreshold times in a row is skipped for
+// CooldownSeconds, doubling with every further failure up to
+// MaxCooldownSeconds. Health changes are written to the database every
+// FlushIntervalSeconds and on shutdown.
+type MirrorsConfig struct {
+	FailureThreshold     int `yaml:"failure_threshold"`
+	CooldownSeconds      int `yaml:"cooldown_seconds"`
+	MaxCooldownSeconds   int `yaml:"max_cooldown_seconds"`
+	FlushIntervalSeconds int `yaml:"flush_interval_seconds"`
+}
+
+// ProviderConfig lists the API endpoints of one download provider
+type ProviderConfig struct {
+	Endpoints []EndpointConfig `yaml:"endpoints"`
+}
+
+// EndpointConfig is one API endpoint (mirror) of a provider. Endpoints are
+// ranked by Weight times their health score; Kind selects the protocol for
+// providers that speak more than one (Qobuz: "" or "jumo").
+type EndpointConfig struct {
+	URL  string `yaml:"url"`
+	Kind string `yaml:"kind,omitempty"`
+	// Enabled defaults to true, false keeps an endpoint listed but unused
+	Enabled        *bool   `yaml:"enabled,omitempty"`
+	Weight         float64 `yaml:"weight,omitempty"`
+	TimeoutSeconds int     `yaml:"timeout_seconds,omitempty"`
+	// Headers are sent with every request, values may reference
+	// environment variables as ${NAME} to keep tokens out of the file
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// IsEnabled reports whether the endpoint is used
+func (e EndpointConfig) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
@@ -0,0 +1,17 @@
+package backend
+
+import "golang.org/x/sys/windows"
+
+// diskFreeBytes returns the space available to the current user on the
+// volume holding path
+func diskFreeBytes(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeToCaller, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeToCaller, &total, &free); err != nil {
+		return 0, err
+	}
+	return freeToCaller, nil
+}
@@ -0,0 +1,756 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadRequest describes a single track download. It is shared by the
+// Wails desktop app and the headless HTTP server so both run the exact same
+// download flow.
+type DownloadRequest struct {
+	Service              string `json:"service"`
+	Query                string `json:"query,omitempty"`
+	TrackName            string `json:"track_name,omitempty"`
+	ArtistName           string `json:"artist_name,omitempty"`
+	AlbumName            string `json:"album_name,omitempty"`
+	AlbumArtist          string `json:"album_artist,omitempty"`
+	ReleaseDate          string `json:"release_date,omitempty"`
+	CoverURL             string `json:"cover_url,omitempty"`
+	ApiURL               string `json:"api_url,omitempty"`
+	OutputDir            string `json:"output_dir,omitempty"`
+	AudioFormat          string `json:"audio_format,omitempty"`
+	FilenameFormat       string `json:"filename_format,omitempty"`
+	TrackNumber          bool   `json:"track_number,omitempty"`
+	Position             int    `json:"position,omitempty"`
+	UseAlbumTrackNumber  bool   `json:"use_album_track_number,omitempty"`
+	SpotifyID            string `json:"spotify_id,omitempty"`
+	EmbedLyrics          bool   `json:"embed_lyrics,omitempty"`
+	EmbedMaxQualityCover bool   `json:"embed_max_quality_cover,omitempty"`
+	ServiceURL           string `json:"service_url,omitempty"`
+	Duration             int    `json:"duration,omitempty"`
+	ItemID               string `json:"item_id,omitempty"`
+	SpotifyTrackNumber   int    `json:"spotify_track_number,omitempty"`
+	SpotifyDiscNumber    int    `json:"spotify_disc_number,omitempty"`
+	SpotifyTotalTracks   int    `json:"spotify_total_tracks,omitempty"`
+	SpotifyTotalDiscs    int    `json:"spotify_total_discs,omitempty"`
+	Copyright            string `json:"copyright,omitempty"`
+	Publisher            string `json:"publisher,omitempty"`
+	PlaylistName         string `json:"playlist_name,omitempty"`
+	PlaylistOwner        string `json:"playlist_owner,omitempty"`
+	AllowFallback        bool   `json:"allow_fallback"`
+	UseFirstArtistOnly   bool   `json:"use_first_artist_only,omitempty"`
+	BatchID              string `json:"batch_id,omitempty"`
+	UserID               string `json:"user_id,omitempty"`
+	RequestID            string `json:"request_id,omitempty"`
+}
+
+// DownloadResponse is the result of a finished (or rejected) download.
+type DownloadResponse struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	File          string `json:"file,omitempty"`
+	Error         string `json:"error,omitempty"`
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	ItemID        string `json:"item_id,omitempty"`
+}
+
+// NewDownloadItemID builds the queue item ID for a request. Spotify IDs are
+// preferred; requests without one fall back to track and artist name.
+func NewDownloadItemID(req DownloadRequest) string {
+	if req.SpotifyID != "" {
+		return fmt.Sprintf("%s-%d", req.SpotifyID, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s-%s-%d", req.TrackName, req.ArtistName, time.Now().UnixNano())
+}
+
+// trackRequest converts req into the provider-neutral request of the
+// download pipeline
+func (req DownloadRequest) trackRequest() TrackRequest {
+	return TrackRequest{
+		TrackRef: TrackRef{
+			SpotifyID:     req.SpotifyID,
+			ServiceURL:    req.ServiceURL,
+			Quality:       req.AudioFormat,
+			AllowFallback: req.AllowFallback,
+			APIURL:        req.ApiURL,
+		},
+		OutputDir:            req.OutputDir,
+		FilenameFormat:       req.FilenameFormat,
+		PlaylistName:         req.PlaylistName,
+		PlaylistOwner:        req.PlaylistOwner,
+		IncludeTrackNumber:   req.TrackNumber,
+		Position:             req.Position,
+		UseAlbumTrackNumber:  req.UseAlbumTrackNumber,
+		UseFirstArtistOnly:   req.UseFirstArtistOnly,
+		TrackName:            req.TrackName,
+		ArtistName:           req.ArtistName,
+		AlbumName:            req.AlbumName,
+		AlbumArtist:          req.AlbumArtist,
+		ReleaseDate:          req.ReleaseDate,
+		TrackNumber:          req.SpotifyTrackNumber,
+		DiscNumber:           req.SpotifyDiscNumber,
+		TotalTracks:          req.SpotifyTotalTracks,
+		TotalDiscs:           req.SpotifyTotalDiscs,
+		Copyright:            req.Copyright,
+		Publisher:            req.Publisher,
+		CoverURL:             req.CoverURL,
+		EmbedMaxQualityCover: req.EmbedMaxQualityCover,
+	}
+}
+
+// downloadJob ties a transfer to its queue item so written bytes report
+// progress on the item and count for the provider serving them
+type downloadJob struct {
+	itemID   string
+	provider string
+}
+
+// progressWriter wraps w so written bytes count as progress of the job's
+// queue item and as bytes downloaded from its provider
+func (j downloadJob) progressWriter(w io.Writer) *ProgressWriter {
+	pw := NewProgressWriterWithID(w, j.itemID)
+	pw.provider = j.provider
+	return pw
+}
+
+// ExecuteDownload runs the full download flow for one track: queue
+// bookkeeping, Spotify metadata backfill, skip-if-exists, the download on
+// the provider named by req.Service with fallback to the configured chain,
+// lyrics embedding and history recording. It blocks until the file is
+// written, the download failed or ctx is cancelled.
+func ExecuteDownload(ctx context.Context, req DownloadRequest) (DownloadResponse, error) {
+	if req.Service == "" {
+		req.Service = "tidal"
+	}
+
+	req.OutputDir = downloadOutputDir(req.OutputDir, req.PlaylistName)
+
+	if req.AudioFormat == "" {
+		req.AudioFormat = "LOSSLESS"
+	}
+
+	var err error
+	var filename string
+
+	if req.FilenameFormat == "" {
+		req.FilenameFormat = "title-artist"
+	}
+
+	itemID := req.ItemID
+	if itemID == "" {
+		itemID = NewDownloadItemID(req)
+		AddToQueue(itemID, req.TrackName, req.ArtistName, req.AlbumName, req.SpotifyID)
+	}
+
+	ctx = withItemID(ctx, itemID)
+	// Queue workers claimed the item already, direct calls start it here
+	StartDownloadItem(itemID)
+
+	// Providers are looked up by name, the configuration decides which
+	// ones are enabled and which ones to fall back to
+	chain, err := providerChain(req.Service)
+	if err != nil {
+		FailDownloadItem(itemID, err.Error())
+		return DownloadResponse{
+			Success: false,
+			Error:   err.Error(),
+			ItemID:  itemID,
+		}, err
+	}
+
+	if req.SpotifyID != "" && (req.Copyright == "" || req.Publisher == "" || req.SpotifyTotalDiscs == 0 || req.ReleaseDate == "" || req.SpotifyTotalTracks == 0 || req.SpotifyTrackNumber == 0) {
+		backfillTrackMetadata(ctx, &req)
+	}
+
+	job := downloadJob{itemID: itemID}
+	trackReq := req.trackRequest()
+	outputPath, err := trackReq.outputPath()
+	if err != nil {
+		FailDownloadItem(itemID, err.Error())
+		return DownloadResponse{
+			Success: false,
+			Error:   err.Error(),
+			ItemID:  itemID,
+		}, err
+	}
+
+	expectedPath := ""
+	if req.TrackName != "" && req.ArtistName != "" {
+		expectedPath = outputPath
+
+		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 100*1024 {
+			SkipDownloadItem(itemID, expectedPath)
+			downloadsFinishedTotal.inc(req.Service, downloadResultSkipped)
+			return DownloadResponse{
+				Success:       true,
+				Message:       "File already exists",
+				File:          expectedPath,
+				AlreadyExists: true,
+				ItemID:        itemID,
+			}, nil
+		}
+	}
+
+	lyricsChan := make(chan string, 1)
+
+	if req.SpotifyID != "" && req.EmbedLyrics {
+		go func() {
+			client := NewLyricsClient()
+			resp, _, err := client.FetchLyricsAllSources(req.SpotifyID, req.TrackName, req.ArtistName, req.Duration)
+			if err == nil && resp != nil && len(resp.Lines) > 0 {
+				lrc := client.ConvertToLRC(resp, req.TrackName, req.ArtistName)
+				lyricsChan <- lrc
+			} else {
+				lyricsChan <- ""
+			}
+		}()
+	} else {
+		close(lyricsChan)
+	}
+
+	rememberPartBase(itemID, strings.TrimSuffix(outputPath, ".flac"))
+	filename, servedBy, err := downloadTrack(ctx, chain, trackReq, job)
+
+	if err != nil && ctx.Err() != nil {
+		// Cancelled or paused: the queue item already carries its new
+		// status, only the partial file needs to go
+		removePartialDownload(ctx, filename, expectedPath)
+		return DownloadResponse{
+			Success: false,
+			Error:   "Download cancelled",
+			ItemID:  itemID,
+		}, context.Cause(ctx)
+	}
+
+	if err != nil {
+		FailDownloadItem(itemID, fmt.Sprintf("Download failed: %v", err))
+
+		if filename != "" && !strings.HasPrefix(filename, "EXISTS:") {
+			if _, statErr := os.Stat(filename); statErr == nil {
+				slog.InfoContext(ctx, "Removing corrupted/partial file after failed download", "file", filename)
+				if removeErr := os.Remove(filename); removeErr != nil {
+					slog.WarnContext(ctx, "Failed to remove corrupted file", "file", filename, "error", removeErr)
+				}
+			}
+		}
+
+		return DownloadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Download failed: %v", err),
+			ItemID:  itemID,
+		}, err
+	}
+
+	alreadyExists := false
+	if strings.HasPrefix(filename, "EXISTS:") {
+		alreadyExists = true
+		filename = strings.TrimPrefix(filename, "EXISTS:")
+	}
+
+	if !alreadyExists && req.SpotifyID != "" && req.EmbedLyrics && (strings.HasSuffix(filename, ".flac") || strings.HasSuffix(filename, ".mp3") || strings.HasSuffix(filename, ".m4a")) {
+		lyrics := <-lyricsChan
+		if lyrics != "" {
+			if err := EmbedLyricsOnlyUniversal(filename, lyrics); err != nil {
+				slog.WarnContext(ctx, "Failed to embed lyrics", "file", filename, "error", err)
+			} else {
+				slog.DebugContext(ctx, "Lyrics embedded", "file", filename)
+			}
+		} else {
+			slog.DebugContext(ctx, "No lyrics found to embed")
+		}
+	} else {
+		select {
+		case <-lyricsChan:
+		default:
+		}
+	}
+
+	message := "Download completed successfully"
+	if alreadyExists {
+		message = "File already exists"
+		SkipDownloadItem(itemID, filename)
+		downloadsFinishedTotal.inc(req.Service, downloadResultSkipped)
+	} else {
+		if fileInfo, statErr := os.Stat(filename); statErr == nil {
+			finalSize := float64(fileInfo.Size()) / (1024 * 1024)
+			CompleteDownloadItem(itemID, filename, servedBy, finalSize)
+		} else {
+			CompleteDownloadItem(itemID, filename, servedBy, 0)
+		}
+
+		// The requested quality code means nothing to a fallback provider
+		format := req.AudioFormat
+		if servedBy != req.Service {
+			format = ""
+		}
+		go recordDownloadHistory(filename, req.TrackName, req.ArtistName, req.AlbumName, req.SpotifyID, req.CoverURL, format, servedBy, req.UserID)
+	}
+
+	return DownloadResponse{
+		Success:       true,
+		Message:       message,
+		File:          filename,
+		AlreadyExists: alreadyExists,
+		ItemID:        itemID,
+	}, nil
+}
+
+// removePartialDownload deletes what an aborted transfer left behind.
+// expectedPath did not hold a complete file when the download started
+// (skip-if-exists checked it), so anything there now is partial.
+func removePartialDownload(ctx context.Context, filename, expectedPath string) {
+	for _, path := range []string{filename, expectedPath} {
+		if path == "" || strings.HasPrefix(path, "EXISTS:") {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			slog.InfoContext(ctx, "Removing partial file after cancelled download", "file", path)
+			os.Remove(path)
+		}
+	}
+}
+
+// downloadOutputDir returns the folder a track is written to. Playlist
+// downloads get their own sanitized subfolder below outputDir.
+func downloadOutputDir(outputDir, playlistName string) string {
+	if outputDir == "" {
+		return "."
+	}
+
+	if playlistName != "" {
+		sanitizedPlaylist := SanitizeFilename(playlistName)
+		outputDir = filepath.Join(outputDir, sanitizedPlaylist)
+	}
+
+	return SanitizeFolderPath(outputDir)
+}
+
+// backfillTrackMetadata fills album-level tags that callers often omit
+// (copyright, publisher, disc/track counts, release date) from Spotify.
+func backfillTrackMetadata(ctx context.Context, req *DownloadRequest) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	trackURL := fmt.Sprintf("https://open.spotify.com/track/%s", req.SpotifyID)
+	trackData, err := GetFilteredSpotifyData(ctx, trackURL, false, 0)
+	if err != nil {
+		return
+	}
+
+	var trackResp struct {
+		Track struct {
+			Copyright   string `json:"copyright"`
+			Publisher   string `json:"publisher"`
+			TotalDiscs  int    `json:"total_discs"`
+			TotalTracks int    `json:"total_tracks"`
+			TrackNumber int    `json:"track_number"`
+			ReleaseDate string `json:"release_date"`
+		} `json:"track"`
+	}
+	jsonData, err := json.Marshal(trackData)
+	if err != nil || json.Unmarshal(jsonData, &trackResp) != nil {
+		return
+	}
+
+	if req.Copyright == "" && trackResp.Track.Copyright != "" {
+		req.Copyright = trackResp.Track.Copyright
+	}
+	if req.Publisher == "" && trackResp.Track.Publisher != "" {
+		req.Publisher = trackResp.Track.Publisher
+	}
+	if req.SpotifyTotalDiscs == 0 && trackResp.Track.TotalDiscs > 0 {
+		req.SpotifyTotalDiscs = trackResp.Track.TotalDiscs
+	}
+	if req.SpotifyTotalTracks == 0 && trackResp.Track.TotalTracks > 0 {
+		req.SpotifyTotalTracks = trackResp.Track.TotalTracks
+	}
+	if req.SpotifyTrackNumber == 0 && trackResp.Track.TrackNumber > 0 {
+		req.SpotifyTrackNumber = trackResp.Track.TrackNumber
+	}
+	if req.ReleaseDate == "" && trackResp.Track.ReleaseDate != "" {
+		req.ReleaseDate = trackResp.Track.ReleaseDate
+	}
+}
+
+// recordDownloadHistory stores a finished download in the history DB,
+// probing the file for quality and duration.
+func recordDownloadHistory(fPath, track, artist, album, sID, cover, format, provider, userID string) {
+	quality := "Unknown"
+	durationStr := "--:--"
+
+	meta, err := GetTrackMetadata(fPath)
+	if err == nil && meta != nil {
+		quality = fmt.Sprintf("%d-bit/%.1fkHz", meta.BitsPerSample, float64(meta.SampleRate)/1000.0)
+		d := int(meta.Duration)
+		durationStr = fmt.Sprintf("%d:%02d", d/60, d%60)
+	}
+
+	item := HistoryItem{
+		SpotifyID:   sID,
+		Title:       track,
+		Artists:     artist,
+		Album:       album,
+		DurationStr: durationStr,
+		CoverURL:    cover,
+		Quality:     quality,
+		Format:      format,
+		Path:        fPath,
+		Provider:    provider,
+		UserID:      userID,
+	}
+
+	if item.Format == "" || item.Format == "LOSSLESS" {
+		ext := filepath.Ext(fPath)
+		if len(ext) > 1 {
+			item.Format = strings.ToUpper(ext[1:])
+		}
+	}
+
+	switch item.Format {
+	case "6", "7", "27":
+		item.Format = "FLAC"
+	}
+
+	AddHistoryItem(item, "SpotiFLAC")
+}
+
+var (
+	pendingDownloads     []DownloadRequest
+	pendingDownloadsLock sync.Mutex
+	pendingCond          = sync.NewCond(&pendingDownloadsLock)
+	downloadWorkerOnce   sync.Once
+
+	// providerLimits caps concurrent downloads per service, providerActive
+	// counts the running ones. Both are guarded by pendingDownloadsLock.
+	providerLimits = map[string]int{}
+	providerActive = map[string]int{}
+
+	// downloadRequests keeps the original request of every queued item so
+	// it can be resumed or retried; activeDownloads holds the cancel func of
+	// running items. Both are guarded by pendingDownloadsLock.
+	downloadRequests = map[string]DownloadRequest{}
+	activeDownloads  = map[string]context.CancelCauseFunc{}
+	// partBases holds where the partial files of every started item go,
+	// so they can be removed with the item. Guarded by
+	// pendingDownloadsLock.
+	partBases = map[string]string{}
+
+	// downloadsDraining stops the workers from taking further requests,
+	// runningDownloads counts the requests they are working on. Both are
+	// updated under pendingDownloadsLock.
+	downloadsDraining bool
+	runningDownloads  sync.WaitGroup
+
+	errDownloadCancelled = errors.New("download cancelled")
+	errDownloadPaused    = errors.New("download paused")
+	errDownloadShutdown  = errors.New("server shutting down")
+)
+
+// downloadAbortWait is how long DrainDownloads waits for aborted downloads
+// to close their partial files
+const downloadAbortWait = 5 * time.Second
+
+// EnqueueDownload adds a request to the download queue and returns its item
+// ID immediately. The download itself runs on the worker pool started by
+// StartDownloadWorkers. The full request is persisted so the item survives
+// a restart (see RestoreDownloadQueue).
+func EnqueueDownload(req DownloadRequest) string {
+	if req.ItemID == "" {
+		req.ItemID = NewDownloadItemID(req)
+	}
+	addToQueue(DownloadItem{
+		ID:         req.ItemID,
+		TrackName:  req.TrackName,
+		ArtistName: req.ArtistName,
+		AlbumName:  req.AlbumName,
+		SpotifyID:  req.SpotifyID,
+		UserID:     req.UserID,
+		Status:     StatusQueued,
+	})
+
+	if item, ok := GetDownloadItem(req.ItemID); ok {
+		if err := saveQueuedDownload(req, item); err != nil {
+			slog.Error("Failed to persist queue item", "item_id", req.ItemID, "error", err)
+		}
+	}
+
+	pendingDownloadsLock.Lock()
+	downloadRequests[req.ItemID] = req
+	pendingDownloads = append(pendingDownloads, req)
+	pendingDownloadsLock.Unlock()
+	pendingCond.Broadcast()
+
+	return req.ItemID
+}
+
+// StartDownloadWorkers starts concurrency workers that process queued
+// downloads in parallel. limits caps the number of concurrent downloads per
+// service (e.g. "tidal": 2); services without a positive limit are only
+// bound by concurrency. Calling it more than once is a no-op.
+func StartDownloadWorkers(concurrency int, limits map[string]int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	downloadWorkerOnce.Do(func() {
+		pendingDownloadsLock.Lock()
+		for service, limit := range limits {
+			if limit > 0 {
+				providerLimits[service] = limit
+			}
+		}
+		pendingDownloadsLock.Unlock()
+
+		for i := 0; i < concurrency; i++ {
+			go runDownloadWorker()
+		}
+	})
+}
+
+func runDownloadWorker() {
+	for {
+		req := nextPendingDownload()
+
+		ctx, cancel := context.WithCancelCause(WithRequestID(context.Background(), req.RequestID))
+		pendingDownloadsLock.Lock()
+		activeDownloads[req.ItemID] = cancel
+		pendingDownloadsLock.Unlock()
+
+		// Items cancelled or paused while waiting are no longer queued
+		if claimQueuedItem(req.ItemID) {
+			if _, err := ExecuteDownload(ctx, req); err != nil {
+				slog.InfoContext(withItemID(ctx, req.ItemID), "Download stopped", "error", err)
+			}
+		}
+
+		pendingDownloadsLock.Lock()
+		delete(activeDownloads, req.ItemID)
+		pendingDownloadsLock.Unlock()
+		cancel(nil)
+
+		releaseProviderSlot(req.Service)
+
+		status, found := GetDownloadItemStatus(req.ItemID)
+		if !found {
+			// Removed from the queue while it ran
+			forgetDownloadRequests([]string{req.ItemID})
+		} else if status == StatusQueued {
+			// Resumed or retried while this worker was still winding down
+			requeueDownload(req.ItemID)
+		}
+
+		if req.BatchID != "" {
+			finishBatchIfDone(req.BatchID)
+		}
+
+		runningDownloads.Done()
+	}
+}
+
+// nextPendingDownload blocks until a request is pending whose service has
+// a free slot, takes it off the pending list and reserves the slot. Requests
+// for saturated services are skipped so other services keep downloading.
+func nextPendingDownload() DownloadRequest {
+	pendingDownloadsLock.Lock()
+	defer pendingDownloadsLock.Unlock()
+
+	for {
+		for i, req := range pendingDownloads {
+			// Nothing new starts once DrainDownloads was called
+			if downloadsDraining {
+				break
+			}
+			limit, capped := providerLimits[req.Service]
+			if capped && providerActive[req.Service] >= limit {
+				continue
+			}
+
+			providerActive[req.Service]++
+			runningDownloads.Add(1)
+			pendingDownloads = append(pendingDownloads[:i], pendingDownloads[i+1:]...)
+			return req
+		}
+		pendingCond.Wait()
+	}
+}
+
+func releaseProviderSlot(service string) {
+	pendingDownloadsLock.Lock()
+	if providerActive[service] > 0 {
+		providerActive[service]--
+	}
+	pendingDownloadsLock.Unlock()
+	pendingCond.Broadcast()
+}
+
+// requeueDownload hands the original request of an item back to the
+// workers. Running items are picked up again by their worker once it has
+// finished. Returns false if the item has no stored request.
+func requeueDownload(id string) bool {
+	pendingDownloadsLock.Lock()
+	defer pendingDownloadsLock.Unlock()
+
+	req, ok := downloadRequests[id]
+	if !ok {
+		return false
+	}
+	if _, running := activeDownloads[id]; running {
+		return true
+	}
+	for _, pending := range pendingDownloads {
+		if pending.ItemID == id {
+			return true
+		}
+	}
+
+	pendingDownloads = append(pendingDownloads, req)
+	pendingCond.Broadcast()
+	return true
+}
+
+func hasDownloadRequest(id string) bool {
+	pendingDownloadsLock.Lock()
+	defer pendingDownloadsLock.Unlock()
+
+	_, ok := downloadRequests[id]
+	return ok
+}
+
+// stopDownload takes an item off the pending list and aborts its transfer
+// if it is running
+func stopDownload(id string, cause error) {
+	pendingDownloadsLock.Lock()
+	defer pendingDownloadsLock.Unlock()
+
+	stopDownloadLocked(id, cause)
+}
+
+// stopDownloadLocked is stopDownload with pendingDownloadsLock held. It
+// reports whether the item was running.
+func stopDownloadLocked(id string, cause error) bool {
+	for i, pending := range pendingDownloads {
+		if pending.ItemID == id {
+			pendingDownloads = append(pendingDownloads[:i], pendingDownloads[i+1:]...)
+			break
+		}
+	}
+	cancel, running := activeDownloads[id]
+	if running {
+		cancel(cause)
+	}
+	return running
+}
+
+// rememberPartBase records base, the path of the item's file without
+// extension, as the place of its partial files
+func rememberPartBase(id, base string) {
+	pendingDownloadsLock.Lock()
+	known := partBases[id] == base
+	partBases[id] = base
+	pendingDownloadsLock.Unlock()
+
+	if !known {
+		setQueuePartBase(id, base)
+	}
+}
+
+// partProgress is the progress in MB a resume of the item starts from,
+// judged from the partial files it left
+func partProgress(id string) float64 {
+	pendingDownloadsLock.Lock()
+	base, ok := partBases[id]
+	pendingDownloadsLock.Unlock()
+
+	if !ok {
+		return 0
+	}
+	return float64(resumableSize(base)) / (1024 * 1024)
+}
+
+// forgetDownloadRequests drops the stored requests of removed items, takes
+// them off the pending list and deletes the partial files they left.
+// Running transfers are cancelled; their files are deleted by their worker
+// once the transfer stopped.
+func forgetDownloadRequests(ids []string) {
+	pendingDownloadsLock.Lock()
+	var bases []string
+	for _, id := range ids {
+		delete(downloadRequests, id)
+		if stopDownloadLocked(id, errDownloadCancelled) {
+			continue
+		}
+		if base, ok := partBases[id]; ok {
+			bases = append(bases, base)
+			delete(partBases, id)
+		}
+	}
+	pendingDownloadsLock.Unlock()
+
+	for _, base := range bases {
+		removePartFiles(base)
+	}
+}
+
+// DrainDownloads stops the workers from starting queued downloads and waits
+// until the running ones have finished or ctx expires. Downloads still
+// running then are aborted and their items checkpointed back to queued.
+// Their partial files are kept, so RestoreDownloadQueue resumes them where
+// they stopped on the next start. Returns the number of checkpointed items.
+func DrainDownloads(ctx context.Context) int {
+	pendingDownloadsLock.Lock()
+	downloadsDraining = true
+	pendingDownloadsLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		runningDownloads.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+	}
+
+	pendingDownloadsLock.Lock()
+	running := make([]string, 0, len(activeDownloads))
+	for id := range activeDownloads {
+		running = append(running, id)
+	}
+	pendingDownloadsLock.Unlock()
+
+	// Change the status before aborting, ExecuteDownload leaves the item
+	// alone once its context is cancelled
+	checkpointed := 0
+	for _, id := range running {
+		progress := partProgress(id)
+		err := transitionQueueItem(id, []DownloadStatus{StatusDownloading}, EventItemQueued, func(item *DownloadItem) {
+			item.Status = StatusQueued
+			item.Progress = progress
+			item.Speed = 0
+			item.StartTime = 0
+		})
+		if err == nil {
+			checkpointed++
+		}
+		stopDownload(id, errDownloadShutdown)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(downloadAbortWait):
+		slog.Warn("Aborted downloads did not stop in time", "count", len(running))
+	}
+	return checkpointed
+}
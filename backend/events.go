@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventItemQueued    EventType = "item_queued"
+	EventItemStarted   EventType = "item_started"
+	EventItemProgress  EventType = "item_progress"
+	EventItemCompleted EventType = "item_completed"
+	EventItemFailed    EventType = "item_failed"
+	EventItemSkipped   EventType = "item_skipped"
+	EventItemPaused    EventType = "item_paused"
+	EventItemCancelled EventType = "item_cancelled"
+
+	EventAvailabilityResult EventType = "availability_result"
+	EventAvailabilityDone   EventType = "availability_done"
+)
+
+// Event is a queue state change or an availability check result; exactly
+// one of Item and Availability is set. IDs increase monotonically per
+// process so consumers can tell which events they have already seen.
+// Progress events are live only: they carry no ID and are never replayed.
+type Event struct {
+	ID           uint64              `json:"id,omitempty"`
+	Type         EventType           `json:"type"`
+	Timestamp    int64               `json:"timestamp"`
+	Item         *DownloadItem       `json:"item,omitempty"`
+	Availability *AvailabilityUpdate `json:"availability,omitempty"`
+}
+
+// UserID returns the user the event belongs to, empty for the local user
+func (e Event) UserID() string {
+	if e.Availability != nil {
+		return e.Availability.UserID
+	}
+	if e.Item != nil {
+		return e.Item.UserID
+	}
+	return ""
+}
+
+// Payload returns the set one of Item and Availability
+func (e Event) Payload() interface{} {
+	if e.Availability != nil {
+		return e.Availability
+	}
+	return e.Item
+}
+
+type eventSubscriber struct {
+	ch chan Event
+}
+
+// eventHistory is a ring buffer of the most recent events used to replay
+// missed events to reconnecting clients. Guarded by eventsLock together
+// with the subscriber set and the ID counter, so a subscription and its
+// replay never overlap or leave a gap.
+var (
+	eventSubscribers = make(map[*eventSubscriber]struct{})
+	eventHistory     = make([]Event, 0, defaultEventHistorySize)
+	eventHistorySize = defaultEventHistorySize
+	eventHistoryNext int
+	lastEventID      uint64
+	eventsLock       sync.RWMutex
+)
+
+const defaultEventHistorySize = 1000
+
+// SetEventHistorySize sets how many recent events are kept for replay.
+// Call it before any events are emitted.
+func SetEventHistorySize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+
+	eventHistorySize = size
+	eventHistory = make([]Event, 0, size)
+	eventHistoryNext = 0
+}
+
+// SubscribeEvents registers a listener for queue events. Events are
+// delivered on a channel buffered to buffer entries; when a subscriber
+// falls behind, further events are dropped for it instead of blocking the
+// download path. The returned func unsubscribes and closes the channel.
+func SubscribeEvents(buffer int) (<-chan Event, func()) {
+	_, _, _, ch, unsubscribe := SubscribeEventsSince(0, buffer)
+	return ch, unsubscribe
+}
+
+// SubscribeEventsSince subscribes like SubscribeEvents and atomically
+// returns the buffered events newer than lastID for replay. complete is
+// false when events after lastID have already left the ring buffer.
+// start is the ID of the last event before the subscription, the channel
+// delivers the ones after it. A lastID of 0 replays nothing.
+func SubscribeEventsSince(lastID uint64, buffer int) (replay []Event, complete bool, start uint64, events <-chan Event, unsubscribe func()) {
+	sub := &eventSubscriber{ch: make(chan Event, buffer)}
+
+	eventsLock.Lock()
+	complete = true
+	if lastID > 0 {
+		replay, complete = eventsSinceLocked(lastID)
+	}
+	start = lastEventID
+	eventSubscribers[sub] = struct{}{}
+	eventsLock.Unlock()
+
+	unsubscribe = func() {
+		eventsLock.Lock()
+		defer eventsLock.Unlock()
+		if _, ok := eventSubscribers[sub]; ok {
+			delete(eventSubscribers, sub)
+			close(sub.ch)
+		}
+	}
+
+	return replay, complete, start, sub.ch, unsubscribe
+}
+
+// CloseEventSubscribers ends every subscription by closing its channel, so
+// Server-Sent Event streams return on shutdown. Unsubscribing afterwards is
+// a no-op.
+func CloseEventSubscribers() {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+
+	for sub := range eventSubscribers {
+		delete(eventSubscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// EventsSince returns the buffered events newer than lastID, oldest first.
+// complete is false when some of them have already been evicted.
+func EventsSince(lastID uint64) ([]Event, bool) {
+	eventsLock.RLock()
+	defer eventsLock.RUnlock()
+	return eventsSinceLocked(lastID)
+}
+
+func eventsSinceLocked(lastID uint64) ([]Event, bool) {
+	if lastID == lastEventID {
+		return nil, true
+	}
+	// IDs restart with the process, so an ID from the future belongs to a
+	// previous run and nothing can be replayed reliably
+	if lastID > lastEventID {
+		return nil, false
+	}
+
+	ordered := make([]Event, 0, len(eventHistory))
+	if len(eventHistory) == eventHistorySize {
+		ordered = append(ordered, eventHistory[eventHistoryNext:]...)
+		ordered = append(ordered, eventHistory[:eventHistoryNext]...)
+	} else {
+		ordered = append(ordered, eventHistory...)
+	}
+
+	var events []Event
+	for _, event := range ordered {
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+
+	complete := len(ordered) > 0 && ordered[0].ID <= lastID+1
+	return events, complete
+}
+
+// emitEvent publishes a queue event to all subscribers without blocking.
+// Callers hold downloadQueueLock, which keeps events in state order.
+func emitEvent(eventType EventType, item DownloadItem) {
+	// Any other change of the item ends its progress throttle, so the
+	// next transfer reports at once
+	if eventType != EventItemProgress {
+		delete(lastProgressEvent, item.ID)
+	}
+	publishEvent(Event{Type: eventType, Item: &item})
+}
+
+// emitAvailabilityEvent publishes an availability check result. Callers
+// hold availabilityLock.
+func emitAvailabilityEvent(eventType EventType, update AvailabilityUpdate) {
+	publishEvent(Event{Type: eventType, Availability: &update})
+}
+
+// publishEvent numbers and timestamps event, records it for replay and
+// hands it to every subscriber that has room for it. Progress events are
+// outdated by the next one, so they are neither numbered nor recorded and
+// cannot push state changes out of the ring buffer.
+func publishEvent(event Event) {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+
+	event.Timestamp = time.Now().UnixMilli()
+
+	if event.Type != EventItemProgress {
+		lastEventID++
+		event.ID = lastEventID
+
+		if len(eventHistory) < eventHistorySize {
+			eventHistory = append(eventHistory, event)
+		} else {
+			eventHistory[eventHistoryNext] = event
+			eventHistoryNext = (eventHistoryNext + 1) % eventHistorySize
+		}
+	}
+
+	for sub := range eventSubscribers {
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
@@ -184,27 +185,27 @@ func DownloadFFmpeg(progressCallback func(int)) error {
 		if !ffmpegInstalled && !ffprobeInstalled {
 
 			ffmpegURL, _ := decodeBase64(ffmpegMacOSURL)
-			fmt.Printf("[FFmpeg] Downloading ffmpeg from: %s\n", ffmpegURL)
+			slog.Info("Downloading ffmpeg", "url", ffmpegURL)
 			if err := downloadAndExtract(ffmpegURL, ffmpegDir, progressCallback, 0, 50); err != nil {
 				return err
 			}
 
 			ffprobeURL, _ := decodeBase64(ffprobeMacOSURL)
-			fmt.Printf("[FFmpeg] Downloading ffprobe from: %s\n", ffprobeURL)
+			slog.Info("Downloading ffprobe", "url", ffprobeURL)
 			if err := downloadAndExtract(ffprobeURL, ffmpegDir, progressCallback, 50, 100); err != nil {
 				return fmt.Errorf("failed to download ffprobe: %w", err)
 			}
 		} else if !ffmpegInstalled {
 
 			ffmpegURL, _ := decodeBase64(ffmpegMacOSURL)
-			fmt.Printf("[FFmpeg] Downloading ffmpeg from: %s\n", ffmpegURL)
+			slog.Info("Downloading ffmpeg", "url", ffmpegURL)
 			if err := downloadAndExtract(ffmpegURL, ffmpegDir, progressCallback, 0, 100); err != nil {
 				return err
 			}
 		} else if !ffprobeInstalled {
 
 			ffprobeURL, _ := decodeBase64(ffprobeMacOSURL)
-			fmt.Printf("[FFmpeg] Downloading ffprobe from: %s\n", ffprobeURL)
+			slog.Info("Downloading ffprobe", "url", ffprobeURL)
 			if err := downloadAndExtract(ffprobeURL, ffmpegDir, progressCallback, 0, 100); err != nil {
 				return fmt.Errorf("failed to download ffprobe: %w", err)
 			}
@@ -227,7 +228,7 @@ func DownloadFFmpeg(progressCallback func(int)) error {
 		return fmt.Errorf("failed to decode ffmpeg URL: %w", err)
 	}
 
-	fmt.Printf("[FFmpeg] Downloading from: %s\n", url)
+	slog.Info("Downloading FFmpeg bundle", "url", url)
 
 	if err := downloadAndExtract(url, ffmpegDir, progressCallback, 0, 100); err != nil {
 		return err
@@ -260,12 +261,7 @@ func downloadAndExtract(url, destDir string, progressCallback func(int), progres
 	lastTime := time.Now()
 	var lastBytes int64
 
-	if totalSize > 0 {
-		totalSizeMB := float64(totalSize) / (1024 * 1024)
-		fmt.Printf("[FFmpeg] Total size: %.2f MB\n", totalSizeMB)
-	} else {
-		fmt.Printf("[FFmpeg] Downloading... (size unknown)\n")
-	}
+	slog.Info("Downloading FFmpeg", "url", url, "size_mb", float64(totalSize)/(1024*1024))
 
 	buf := make([]byte, 32*1024)
 	for {
@@ -299,23 +295,6 @@ func downloadAndExtract(url, destDir string, progressCallback func(int), progres
 				scaledProgress := progressStart + int(rawProgress*float64(progressEnd-progressStart))
 				progressCallback(scaledProgress)
 			}
-
-			if totalSize > 0 {
-				percent := float64(downloaded) * 100 / float64(totalSize)
-				if speedMBps > 0 {
-					fmt.Printf("\r[FFmpeg] Downloading: %.2f MB / %.2f MB (%.1f%%) - %.2f MB/s",
-						mbDownloaded, float64(totalSize)/(1024*1024), percent, speedMBps)
-				} else {
-					fmt.Printf("\r[FFmpeg] Downloading: %.2f MB / %.2f MB (%.1f%%)",
-						mbDownloaded, float64(totalSize)/(1024*1024), percent)
-				}
-			} else {
-				if speedMBps > 0 {
-					fmt.Printf("\r[FFmpeg] Downloading: %.2f MB - %.2f MB/s", mbDownloaded, speedMBps)
-				} else {
-					fmt.Printf("\r[FFmpeg] Downloading: %.2f MB", mbDownloaded)
-				}
-			}
 		}
 		if err == io.EOF {
 			break
@@ -327,13 +306,7 @@ func downloadAndExtract(url, destDir string, progressCallback func(int), progres
 
 	tmpFile.Close()
 
-	if totalSize > 0 {
-		fmt.Printf("\r[FFmpeg] Download complete: %.2f MB / %.2f MB (100%%)          \n",
-			float64(downloaded)/(1024*1024), float64(totalSize)/(1024*1024))
-	} else {
-		fmt.Printf("\r[FFmpeg] Download complete: %.2f MB          \n", float64(downloaded)/(1024*1024))
-	}
-	fmt.Printf("[FFmpeg] Extracting...\n")
+	slog.Info("FFmpeg download complete, extracting", "mb", float64(downloaded)/(1024*1024))
 
 	if strings.HasSuffix(url, ".tar.xz") || runtime.GOOS == "linux" {
 		return extractTarXz(tmpFile.Name(), destDir)
@@ -376,7 +349,7 @@ func extractZip(zipPath, destDir string) error {
 			continue
 		}
 
-		fmt.Printf("[FFmpeg] Found: %s\n", f.Name)
+		slog.Debug("Found FFmpeg archive entry", "name", f.Name)
 
 		rc, err := f.Open()
 		if err != nil {
@@ -397,7 +370,7 @@ func extractZip(zipPath, destDir string) error {
 			return fmt.Errorf("failed to extract file: %w", err)
 		}
 
-		fmt.Printf("[FFmpeg] Extracted to: %s\n", destPath)
+		slog.Debug("Extracted FFmpeg binary", "path", destPath)
 	}
 
 	if !foundFFmpeg && !foundFFprobe {
@@ -405,10 +378,10 @@ func extractZip(zipPath, destDir string) error {
 	}
 
 	if foundFFmpeg {
-		fmt.Printf("[FFmpeg] ffmpeg extracted successfully\n")
+		slog.Info("ffmpeg extracted")
 	}
 	if foundFFprobe {
-		fmt.Printf("[FFmpeg] ffprobe extracted successfully\n")
+		slog.Info("ffprobe extracted")
 	}
 
 	return nil
@@ -460,7 +433,7 @@ func extractTarXz(tarXzPath, destDir string) error {
 			continue
 		}
 
-		fmt.Printf("[FFmpeg] Found: %s\n", header.Name)
+		slog.Debug("Found FFmpeg archive entry", "name", header.Name)
 
 		outFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 		if err != nil {
@@ -474,7 +447,7 @@ func extractTarXz(tarXzPath, destDir string) error {
 			return fmt.Errorf("failed to extract file: %w", err)
 		}
 
-		fmt.Printf("[FFmpeg] Extracted to: %s\n", destPath)
+		slog.Debug("Extracted FFmpeg binary", "path", destPath)
 	}
 
 	if !foundFFmpeg && !foundFFprobe {
@@ -482,10 +455,10 @@ func extractTarXz(tarXzPath, destDir string) error {
 	}
 
 	if foundFFmpeg {
-		fmt.Printf("[FFmpeg] ffmpeg extracted successfully\n")
+		slog.Info("ffmpeg extracted")
 	}
 	if foundFFprobe {
-		fmt.Printf("[FFmpeg] ffprobe extracted successfully\n")
+		slog.Info("ffprobe extracted")
 	}
 
 	return nil
@@ -569,17 +542,17 @@ func ConvertAudio(req ConvertAudioRequest) ([]ConvertAudioResult, error) {
 
 			inputMetadata, err = ExtractFullMetadataFromFile(inputFile)
 			if err != nil {
-				fmt.Printf("[FFmpeg] Warning: Failed to extract metadata from %s: %v\n", inputFile, err)
+				slog.Warn("Failed to extract metadata", "file", inputFile, "error", err)
 			}
 
 			coverArtPath, _ = ExtractCoverArt(inputFile)
 			lyrics, err = ExtractLyrics(inputFile)
 			if err != nil {
-				fmt.Printf("[FFmpeg] Warning: Failed to extract lyrics from %s: %v\n", inputFile, err)
+				slog.Warn("Failed to extract lyrics", "file", inputFile, "error", err)
 			} else if lyrics != "" {
-				fmt.Printf("[FFmpeg] Lyrics extracted from %s: %d characters\n", inputFile, len(lyrics))
+				slog.Debug("Lyrics extracted", "file", inputFile, "chars", len(lyrics))
 			} else {
-				fmt.Printf("[FFmpeg] No lyrics found in %s\n", inputFile)
+				slog.Debug("No lyrics found", "file", inputFile)
 			}
 
 			inputMetadata.Lyrics = lyrics
@@ -622,7 +595,7 @@ func ConvertAudio(req ConvertAudioRequest) ([]ConvertAudioResult, error) {
 
 			args = append(args, outputFile)
 
-			fmt.Printf("[FFmpeg] Converting: %s -> %s\n", inputFile, outputFile)
+			slog.Info("Converting audio", "input", inputFile, "output", outputFile)
 
 			cmd := exec.Command(ffmpegPath, args...)
 
@@ -642,16 +615,16 @@ func ConvertAudio(req ConvertAudioRequest) ([]ConvertAudioResult, error) {
 			}
 
 			if err := EmbedMetadataToConvertedFile(outputFile, inputMetadata, coverArtPath); err != nil {
-				fmt.Printf("[FFmpeg] Warning: Failed to embed metadata: %v\n", err)
+				slog.Warn("Failed to embed metadata", "file", outputFile, "error", err)
 			} else {
-				fmt.Printf("[FFmpeg] Metadata embedded successfully\n")
+				slog.Debug("Metadata embedded", "file", outputFile)
 			}
 
 			if lyrics != "" {
 				if err := EmbedLyricsOnlyUniversal(outputFile, lyrics); err != nil {
-					fmt.Printf("[FFmpeg] Warning: Failed to embed lyrics: %v\n", err)
+					slog.Warn("Failed to embed lyrics", "file", outputFile, "error", err)
 				} else {
-					fmt.Printf("[FFmpeg] Lyrics embedded successfully\n")
+					slog.Debug("Lyrics embedded", "file", outputFile)
 				}
 			}
 
@@ -660,7 +633,7 @@ func ConvertAudio(req ConvertAudioRequest) ([]ConvertAudioResult, error) {
 			}
 
 			result.Success = true
-			fmt.Printf("[FFmpeg] Successfully converted: %s\n", outputFile)
+			slog.Info("Converted audio", "output", outputFile)
 
 			mu.Lock()
 			results[idx] = result
@@ -56,6 +56,9 @@ func ListDirectory(dirPath string) ([]FileInfo, error) {
 
 	var result []FileInfo
 	for _, entry := range entries {
+		if !entry.IsDir() && IsPartialDownload(entry.Name()) {
+			continue
+		}
 		info, err := entry.Info()
 		if err != nil {
 			continue
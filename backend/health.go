@@ -0,0 +1,341 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Component states reported by CheckReadiness
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// ComponentHealth is the result of one readiness check. Error is a short
+// generic reason; the underlying error is only logged so paths and upstream
+// responses are not exposed on the unauthenticated probe (rule #15).
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	Required  bool   `json:"required"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// HealthOptions configures CheckReadiness
+type HealthOptions struct {
+	DownloadPath string
+	MinFreeBytes uint64
+	Timeout      time.Duration
+
+	// CheckSpotify bootstraps a Spotify token, CheckProviders probes every
+	// provider mirror. Both results are cached for ExternalCacheTTL so
+	// frequent probes do not hit upstream services.
+	CheckSpotify     bool
+	CheckProviders   bool
+	ExternalCacheTTL time.Duration
+}
+
+// healthCheck is one named readiness check
+type healthCheck struct {
+	name     string
+	required bool
+	run      func(ctx context.Context) error
+}
+
+// CheckReadiness runs the local checks (database, download path, ffmpeg,
+// ffprobe) and the optional external ones concurrently, keyed by component
+func CheckReadiness(ctx context.Context, opts HealthOptions) map[string]ComponentHealth {
+	checks := []healthCheck{
+		{name: "database", required: true, run: checkHistoryDB},
+		{name: "download_path", required: true, run: func(context.Context) error {
+			return checkDownloadPath(opts.DownloadPath, opts.MinFreeBytes)
+		}},
+		{name: "ffmpeg", required: true, run: func(context.Context) error {
+			return checkExecutable(GetFFmpegPath)
+		}},
+		{name: "ffprobe", required: true, run: func(context.Context) error {
+			return checkExecutable(GetFFprobePath)
+		}},
+	}
+
+	results := runHealthChecks(ctx, checks, opts.Timeout)
+	for name, result := range externalHealth.get(ctx, opts) {
+		results[name] = result
+	}
+	return results
+}
+
+func runHealthChecks(ctx context.Context, checks []healthCheck, timeout time.Duration) map[string]ComponentHealth {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]ComponentHealth, len(checks))
+	)
+
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runWithTimeout(checkCtx, check.run)
+			result := ComponentHealth{
+				Status:    HealthUp,
+				Required:  check.required,
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = HealthDown
+				result.Error = healthErrorReason(err)
+				slog.WarnContext(ctx, "Readiness check failed", "component", check.name, "error", err)
+			}
+
+			mu.Lock()
+			results[check.name] = result
+			mu.Unlock()
+		}(check)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// runWithTimeout returns when run finishes or ctx expires, whichever comes
+// first. Checks that cannot take a context keep running in the background.
+func runWithTimeout(ctx context.Context, run func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- run(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// healthError carries the generic reason reported to clients
+type healthError struct {
+	reason string
+	err    error
+}
+
+func (e *healthError) Error() string {
+	if e.err == nil {
+		return e.reason
+	}
+	return e.reason + ": " + e.err.Error()
+}
+
+func (e *healthError) Unwrap() error { return e.err }
+
+func healthErrorReason(err error) string {
+	var he *healthError
+	if errors.As(err, &he) {
+		return he.reason
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "check failed"
+}
+
+func checkHistoryDB(context.Context) error {
+	if historyDB == nil {
+		return &healthError{reason: "database not open"}
+	}
+	if err := historyDB.View(func(tx *bolt.Tx) error { return nil }); err != nil {
+		return &healthError{reason: "database not readable", err: err}
+	}
+	return nil
+}
+
+// checkDownloadPath verifies that a file can be created in path and that
+// at least minFreeBytes are available
+func checkDownloadPath(path string, minFreeBytes uint64) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return &healthError{reason: "download path not accessible", err: err}
+	}
+
+	probe, err := os.CreateTemp(path, ".spotiflac-health-*")
+	if err != nil {
+		return &healthError{reason: "download path not writable", err: err}
+	}
+	_, writeErr := probe.WriteString("ok")
+	closeErr := probe.Close()
+	os.Remove(probe.Name())
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		return &healthError{reason: "download path not writable", err: err}
+	}
+
+	free, err := diskFreeBytes(path)
+	if err != nil {
+		return &healthError{reason: "free space unknown", err: err}
+	}
+	if free < minFreeBytes {
+		return &healthError{
+			reason: "insufficient free space",
+			err:    fmt.Errorf("%d bytes free, %d required", free, minFreeBytes),
+		}
+	}
+	return nil
+}
+
+// checkExecutable resolves a binary with resolve and validates it
+func checkExecutable(resolve func() (string, error)) error {
+	path, err := resolve()
+	if err != nil {
+		return &healthError{reason: "executable not found", err: err}
+	}
+	if err := ValidateExecutable(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &healthError{reason: "executable not found", err: err}
+		}
+		return &healthError{reason: "executable not usable", err: err}
+	}
+	return nil
+}
+
+// externalHealthCache holds the last results of the Spotify and mirror
+// checks
+type externalHealthCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	key       string
+	results   map[string]ComponentHealth
+}
+
+var externalHealth externalHealthCache
+
+func (c *externalHealthCache) get(ctx context.Context, opts HealthOptions) map[string]ComponentHealth {
+	if !opts.CheckSpotify && !opts.CheckProviders {
+		return nil
+	}
+
+	// Serialize refreshes so concurrent probes share one round of requests
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Reloaded endpoints invalidate the cached mirror results
+	key := fmt.Sprintf("%t/%t/%d", opts.CheckSpotify, opts.CheckProviders, currentEndpointsGeneration())
+	if c.results != nil && c.key == key && time.Since(c.checkedAt) < opts.ExternalCacheTTL {
+		return c.results
+	}
+
+	var checks []healthCheck
+	if opts.CheckSpotify {
+		checks = append(checks, healthCheck{name: "spotify", required: true, run: func(context.Context) error {
+			if err := NewSpotifyClient().Initialize(); err != nil {
+				return &healthError{reason: "token bootstrap failed", err: err}
+			}
+			return nil
+		}})
+	}
+
+	mirrors := map[string][]string{}
+	if opts.CheckProviders {
+		mirrors = providerMirrors()
+		for provider, urls := range mirrors {
+			for _, mirrorURL := range urls {
+				checks = append(checks, healthCheck{
+					name: "mirror:" + provider + ":" + mirrorLabel(mirrorURL),
+					run: func(ctx context.Context) error {
+						return checkMirror(ctx, mirrorURL)
+					},
+				})
+			}
+		}
+	}
+
+	// Detach from the request so a client hanging up does not poison the
+	// cached results
+	results := runHealthChecks(context.WithoutCancel(ctx), checks, opts.Timeout)
+
+	// A provider is down only when none of its mirrors answer
+	for provider, urls := range mirrors {
+		result := ComponentHealth{Status: HealthDown, Required: true, Error: "no mirror reachable"}
+		for _, mirrorURL := range urls {
+			mirror := results["mirror:"+provider+":"+mirrorLabel(mirrorURL)]
+			if mirror.Status == HealthUp {
+				result = ComponentHealth{Status: HealthUp, Required: true}
+				break
+			}
+		}
+		results["provider:"+provider] = result
+	}
+
+	c.results = results
+	c.checkedAt = time.Now()
+	c.key = key
+	return results
+}
+
+// providerMirrors lists the base URL of every endpoint used by the enabled
+// download providers
+func providerMirrors() map[string][]string {
+	mirrors := map[string][]string{}
+	for _, p := range EnabledProviders() {
+		var urls []string
+		for _, e := range ProviderEndpoints(p.Name()) {
+			urls = append(urls, e.root())
+		}
+		mirrors[p.Name()] = dedupeMirrors(urls)
+	}
+	return mirrors
+}
+
+func dedupeMirrors(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	out := urls[:0]
+	for _, u := range urls {
+		host := mirrorLabel(u)
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		out = append(out, u)
+	}
+	return out
+}
+
+var healthHTTPClient = &http.Client{
+	// Any answer proves the mirror is reachable, redirects are not needed
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// checkMirror treats any HTTP answer below 500 as reachable; mirrors
+// usually answer their bare base URL with 404
+func checkMirror(ctx context.Context, mirrorURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(mirrorURL, "/")+"/", nil)
+	if err != nil {
+		return &healthError{reason: "invalid mirror url", err: err}
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
+
+	resp, err := healthHTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &healthError{reason: "timeout", err: err}
+		}
+		return &healthError{reason: "unreachable", err: err}
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &healthError{reason: "server error", err: fmt.Errorf("HTTP %d", resp.StatusCode)}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -23,13 +24,22 @@ type HistoryItem struct {
 	Format      string `json:"format"`
 	Path        string `json:"path"`
 	Timestamp   int64  `json:"timestamp"`
+	// Provider is the service that served the file, which differs from the
+	// requested one after a fallback
+	Provider string `json:"provider,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
 }
 
 var historyDB *bolt.DB
 
+// ErrHistoryItemNotFound is returned when deleting an entry that does not
+// exist or belongs to another user
+var ErrHistoryItemNotFound = errors.New("history item not found")
+
 const (
 	historyBucket = "DownloadHistory"
-	maxHistory    = 10000
+	// maxHistory is how many entries each user keeps per history
+	maxHistory = 10000
 )
 
 func InitHistoryDB(appName string) error {
@@ -89,28 +99,17 @@ func AddHistoryItem(item HistoryItem, appName string) error {
 			return err
 		}
 
-		if b.Stats().KeyN >= maxHistory {
-			c := b.Cursor()
-
-			toDelete := maxHistory / 20
-			if toDelete < 1 {
-				toDelete = 1
-			}
-
-			count := 0
-			for k, _ := c.First(); k != nil && count < toDelete; k, _ = c.Next() {
-				if err := b.Delete(k); err != nil {
-					return err
-				}
-				count++
-			}
+		if err := trimUserHistory(b, item.UserID, maxHistory); err != nil {
+			return err
 		}
 
 		return b.Put([]byte(item.ID), buf)
 	})
 }
 
-func GetHistoryItems(appName string) ([]HistoryItem, error) {
+// GetHistoryItems returns the download history, newest first. A non-empty
+// userID limits it to that user's downloads.
+func GetHistoryItems(userID string, appName string) ([]HistoryItem, error) {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return nil, err
@@ -126,7 +125,7 @@ func GetHistoryItems(appName string) ([]HistoryItem, error) {
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			var item HistoryItem
-			if err := json.Unmarshal(v, &item); err == nil {
+			if err := json.Unmarshal(v, &item); err == nil && inUserScope(item.UserID, userID) {
 				items = append(items, item)
 			}
 		}
@@ -140,14 +139,49 @@ func GetHistoryItems(appName string) ([]HistoryItem, error) {
 	return items, err
 }
 
-func ClearHistory(appName string) error {
+// GetHistoryItem returns one download history entry. With a non-empty
+// userID, entries of other users are reported as not found.
+func GetHistoryItem(id string, userID string) (HistoryItem, error) {
+	if historyDB == nil {
+		return HistoryItem{}, fmt.Errorf("history database not initialized")
+	}
+	var item HistoryItem
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		if b == nil {
+			return ErrHistoryItemNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrHistoryItemNotFound
+		}
+		if err := json.Unmarshal(v, &item); err != nil {
+			return err
+		}
+		if !inUserScope(item.UserID, userID) {
+			return ErrHistoryItemNotFound
+		}
+		return nil
+	})
+	return item, err
+}
+
+// ClearHistory removes the download history of userID, or of everyone when
+// userID is empty
+func ClearHistory(userID string, appName string) error {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return err
 		}
 	}
 	return historyDB.Update(func(tx *bolt.Tx) error {
-		return tx.DeleteBucket([]byte(historyBucket))
+		if userID == "" {
+			return tx.DeleteBucket([]byte(historyBucket))
+		}
+		return deleteScopedEntries(tx.Bucket([]byte(historyBucket)), func(v []byte) bool {
+			var item HistoryItem
+			return json.Unmarshal(v, &item) == nil && item.UserID == userID
+		})
 	})
 }
 
@@ -160,6 +194,7 @@ type FetchHistoryItem struct {
 	Image     string `json:"image"`
 	Data      string `json:"data"`
 	Timestamp int64  `json:"timestamp"`
+	UserID    string `json:"user_id,omitempty"`
 }
 
 const (
@@ -184,7 +219,7 @@ func AddFetchHistoryItem(item FetchHistoryItem, appName string) error {
 			for k, v := c.First(); k != nil; k, v = c.Next() {
 				var existing FetchHistoryItem
 				if err := json.Unmarshal(v, &existing); err == nil {
-					if existing.URL == item.URL && existing.Type == item.Type {
+					if existing.URL == item.URL && existing.Type == item.Type && existing.UserID == item.UserID {
 						if err := b.Delete(k); err != nil {
 							return err
 						}
@@ -201,26 +236,17 @@ func AddFetchHistoryItem(item FetchHistoryItem, appName string) error {
 			return err
 		}
 
-		if b.Stats().KeyN >= maxHistory {
-			c := b.Cursor()
-			toDelete := maxHistory / 20
-			if toDelete < 1 {
-				toDelete = 1
-			}
-			count := 0
-			for k, _ := c.First(); k != nil && count < toDelete; k, _ = c.Next() {
-				if err := b.Delete(k); err != nil {
-					return err
-				}
-				count++
-			}
+		if err := trimUserHistory(b, item.UserID, maxHistory); err != nil {
+			return err
 		}
 
 		return b.Put([]byte(item.ID), buf)
 	})
 }
 
-func GetFetchHistoryItems(appName string) ([]FetchHistoryItem, error) {
+// GetFetchHistoryItems returns the fetch history, newest first. A non-empty
+// userID limits it to that user's entries.
+func GetFetchHistoryItems(userID string, appName string) ([]FetchHistoryItem, error) {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return nil, err
@@ -236,7 +262,7 @@ func GetFetchHistoryItems(appName string) ([]FetchHistoryItem, error) {
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			var item FetchHistoryItem
-			if err := json.Unmarshal(v, &item); err == nil {
+			if err := json.Unmarshal(v, &item); err == nil && inUserScope(item.UserID, userID) {
 				items = append(items, item)
 			}
 		}
@@ -250,77 +276,146 @@ func GetFetchHistoryItems(appName string) ([]FetchHistoryItem, error) {
 	return items, err
 }
 
-func ClearFetchHistory(appName string) error {
+// ClearFetchHistory removes the fetch history of userID, or of everyone when
+// userID is empty
+func ClearFetchHistory(userID string, appName string) error {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return err
 		}
 	}
 	return historyDB.Update(func(tx *bolt.Tx) error {
-		return tx.DeleteBucket([]byte(fetchHistoryBucket))
+		if userID == "" {
+			return tx.DeleteBucket([]byte(fetchHistoryBucket))
+		}
+		return deleteScopedEntries(tx.Bucket([]byte(fetchHistoryBucket)), func(v []byte) bool {
+			var item FetchHistoryItem
+			return json.Unmarshal(v, &item) == nil && item.UserID == userID
+		})
 	})
 }
 
-func ClearFetchHistoryByType(itemType string, appName string) error {
+// ClearFetchHistoryByType removes fetch history entries of one type, limited
+// to userID unless it is empty
+func ClearFetchHistoryByType(itemType string, userID string, appName string) error {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return err
 		}
 	}
 	return historyDB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(fetchHistoryBucket))
-		if b == nil {
-			return nil
-		}
-
-		var keysToDelete [][]byte
-
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+		return deleteScopedEntries(tx.Bucket([]byte(fetchHistoryBucket)), func(v []byte) bool {
 			var item FetchHistoryItem
-			if err := json.Unmarshal(v, &item); err == nil {
-				if item.Type == itemType {
-					keysToDelete = append(keysToDelete, k)
-				}
+			if err := json.Unmarshal(v, &item); err != nil {
+				return false
 			}
-		}
-
-		for _, k := range keysToDelete {
-			if err := b.Delete(k); err != nil {
-				return err
-			}
-		}
-		return nil
+			return item.Type == itemType && inUserScope(item.UserID, userID)
+		})
 	})
 }
 
-func DeleteHistoryItem(id string, appName string) error {
+// DeleteHistoryItem removes one download history entry. With a non-empty
+// userID, entries of other users are reported as not found.
+func DeleteHistoryItem(id string, userID string, appName string) error {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return err
 		}
 	}
 	return historyDB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(historyBucket))
-		if b == nil {
-			return nil
-		}
-
-		return b.Delete([]byte(id))
+		return deleteScopedEntry(tx.Bucket([]byte(historyBucket)), id, userID, func(v []byte) string {
+			var item HistoryItem
+			json.Unmarshal(v, &item)
+			return item.UserID
+		})
 	})
 }
 
-func DeleteFetchHistoryItem(id string, appName string) error {
+// DeleteFetchHistoryItem removes one fetch history entry. With a non-empty
+// userID, entries of other users are reported as not found.
+func DeleteFetchHistoryItem(id string, userID string, appName string) error {
 	if historyDB == nil {
 		if err := InitHistoryDB(appName); err != nil {
 			return err
 		}
 	}
 	return historyDB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(fetchHistoryBucket))
-		if b == nil {
+		return deleteScopedEntry(tx.Bucket([]byte(fetchHistoryBucket)), id, userID, func(v []byte) string {
+			var item FetchHistoryItem
+			json.Unmarshal(v, &item)
+			return item.UserID
+		})
+	})
+}
+
+// inUserScope reports whether an entry owned by ownerID is visible in the
+// scope of userID. An empty userID is the unscoped (admin) view.
+func inUserScope(ownerID, userID string) bool {
+	return userID == "" || ownerID == userID
+}
+
+// trimUserHistory deletes the oldest entries of userID from b once the
+// user has limit of them, so one user cannot push the history of others
+// out. Keys start with the creation time and sort oldest first.
+func trimUserHistory(b *bolt.Bucket, userID string, limit int) error {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var entry struct {
+			UserID string `json:"user_id"`
+		}
+		if err := json.Unmarshal(v, &entry); err == nil && entry.UserID == userID {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+	}
+	if len(keys) < limit {
+		return nil
+	}
+
+	toDelete := max(limit/20, len(keys)-limit+1)
+	for _, k := range keys[:toDelete] {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteScopedEntries deletes every entry of b for which match is true
+func deleteScopedEntries(b *bolt.Bucket, match func(v []byte) bool) error {
+	if b == nil {
+		return nil
+	}
+
+	var keysToDelete [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if match(v) {
+			keysToDelete = append(keysToDelete, k)
+		}
+	}
+
+	for _, k := range keysToDelete {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteScopedEntry deletes the entry id of b if it is in the scope of userID
+func deleteScopedEntry(b *bolt.Bucket, id, userID string, owner func(v []byte) string) error {
+	if b == nil {
+		if userID == "" {
 			return nil
 		}
-		return b.Delete([]byte(id))
-	})
+		return ErrHistoryItemNotFound
+	}
+	if userID != "" {
+		v := b.Get([]byte(id))
+		if v == nil || owner(v) != userID {
+			return ErrHistoryItemNotFound
+		}
+	}
+	return b.Delete([]byte(id))
 }
@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestTrimUserHistory(t *testing.T) {
+	initTestHistoryDB(t)
+
+	// u1 fills its history, u2 has a single old entry
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		put := func(key, userID string) {
+			buf, _ := json.Marshal(HistoryItem{ID: key, UserID: userID})
+			b.Put([]byte(key), buf)
+		}
+		put("0000", "u2")
+		for i := 1; i <= 40; i++ {
+			put(fmt.Sprintf("%04d", i), "u1")
+		}
+		return trimUserHistory(b, "u1", 40)
+	})
+	if err != nil {
+		t.Fatalf("trimUserHistory() error = %v", err)
+	}
+
+	items, err := GetHistoryItems("", "SpotiFLAC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owned := map[string][]string{}
+	for _, item := range items {
+		owned[item.UserID] = append(owned[item.UserID], item.ID)
+	}
+	if len(owned["u2"]) != 1 {
+		t.Errorf("u2 kept %d entries, want 1", len(owned["u2"]))
+	}
+	if len(owned["u1"]) != 38 {
+		t.Fatalf("u1 kept %d entries, want 38", len(owned["u1"]))
+	}
+	for _, id := range owned["u1"] {
+		if id == "0001" || id == "0002" {
+			t.Errorf("oldest entry %s of u1 kept", id)
+		}
+	}
+}
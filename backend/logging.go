@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// logContextKey is the context key for the fields every log line written
+// with that context carries
+type logContextKey struct{}
+
+// logFields are attached to a context by the HTTP server and the download
+// workers so one request can be followed from the API call to the download
+type logFields struct {
+	requestID string
+	itemID    string
+}
+
+// WithRequestID returns a context whose log lines carry request_id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	fields := contextLogFields(ctx)
+	fields.requestID = requestID
+	return context.WithValue(ctx, logContextKey{}, fields)
+}
+
+// RequestIDFromContext returns the request ID stored by WithRequestID
+func RequestIDFromContext(ctx context.Context) string {
+	return contextLogFields(ctx).requestID
+}
+
+// withItemID returns a context whose log lines carry item_id
+func withItemID(ctx context.Context, itemID string) context.Context {
+	fields := contextLogFields(ctx)
+	fields.itemID = itemID
+	return context.WithValue(ctx, logContextKey{}, fields)
+}
+
+func contextLogFields(ctx context.Context) logFields {
+	if ctx == nil {
+		return logFields{}
+	}
+	fields, _ := ctx.Value(logContextKey{}).(logFields)
+	return fields
+}
+
+// contextHandler adds the request and item ID of the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := contextLogFields(ctx)
+	if fields.requestID != "" {
+		r.AddAttrs(slog.String("request_id", fields.requestID))
+	}
+	if fields.itemID != "" {
+		r.AddAttrs(slog.String("item_id", fields.itemID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ParseLogLevel converts debug, info, warn or error to a slog level
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level: %s", level)
+	}
+	return l, nil
+}
+
+// ConfigureLogging installs the default slog logger writing to w with the
+// given level and format ("text" or "json"). The standard log package is
+// routed through it as well.
+func ConfigureLogging(w io.Writer, level, format string) error {
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format: %s (must be text or json)", format)
+	}
+
+	// SetDefault redirects the log package to the handler at info level;
+	// drop its own prefix first so lines are not timestamped twice
+	log.SetFlags(0)
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -230,17 +231,17 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 	if err == nil && resp != nil && !resp.Error && len(resp.Lines) > 0 {
 		return resp, "LRCLIB", nil
 	}
-	fmt.Printf("   LRCLIB exact: %v\n", err)
+	slog.Debug("LRCLIB exact lookup failed", "track", trackName, "error", err)
 
 	resp, err = c.FetchLyricsFromLRCLibSearch(trackName, artistName)
 	if err == nil && resp != nil && !resp.Error && len(resp.Lines) > 0 {
 		return resp, "LRCLIB Search", nil
 	}
-	fmt.Printf("   LRCLIB search: %v\n", err)
+	slog.Debug("LRCLIB search failed", "track", trackName, "error", err)
 
 	simplifiedTrack := simplifyTrackName(trackName)
 	if simplifiedTrack != trackName {
-		fmt.Printf("   Trying simplified name: %s\n", simplifiedTrack)
+		slog.Debug("Trying simplified track name for lyrics", "track", simplifiedTrack)
 
 		resp, err = c.FetchLyricsWithMetadata(simplifiedTrack, artistName, duration)
 		if err == nil && resp != nil && !resp.Error && len(resp.Lines) > 0 {
@@ -451,7 +452,7 @@ func (c *LyricsClient) DownloadLyrics(req LyricsDownloadRequest) (*LyricsDownloa
 		duration, err := GetAudioDuration(audioFile)
 		if err == nil && duration > 0 {
 			audioDuration = int(duration)
-			fmt.Printf("[DownloadLyrics] Found audio file, duration: %d seconds\n", audioDuration)
+			slog.Debug("Found audio file for lyrics", "file", audioFile, "duration_s", audioDuration)
 		}
 	}
 
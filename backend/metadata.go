@@ -3,6 +3,7 @@ package backend
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	pathfilepath "path/filepath"
@@ -104,7 +105,7 @@ func EmbedMetadata(filepath string, metadata Metadata, coverPath string) error {
 
 	if coverPath != "" && fileExists(coverPath) {
 		if err := embedCoverArt(f, coverPath); err != nil {
-			fmt.Printf("Warning: Failed to embed cover art: %v\n", err)
+			slog.Warn("Failed to embed cover art", "file", filepath, "error", err)
 		}
 	}
 
@@ -317,22 +318,22 @@ func extractLyricsFromMp3(filePath string) (string, error) {
 
 	usltFrames := tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription"))
 	if len(usltFrames) == 0 {
-		fmt.Printf("[ExtractLyrics] No USLT frames found in MP3: %s\n", filePath)
+		slog.Debug("No USLT frames found in MP3", "file", filePath)
 		return "", nil
 	}
 
 	uslt, ok := usltFrames[0].(id3v2.UnsynchronisedLyricsFrame)
 	if !ok {
-		fmt.Printf("[ExtractLyrics] USLT frame type assertion failed in MP3: %s\n", filePath)
+		slog.Debug("USLT frame type assertion failed in MP3", "file", filePath)
 		return "", nil
 	}
 
 	if uslt.Lyrics == "" {
-		fmt.Printf("[ExtractLyrics] USLT frame has empty lyrics in MP3: %s\n", filePath)
+		slog.Debug("USLT frame has empty lyrics in MP3", "file", filePath)
 		return "", nil
 	}
 
-	fmt.Printf("[ExtractLyrics] Successfully extracted lyrics from MP3: %s (%d characters)\n", filePath, len(uslt.Lyrics))
+	slog.Debug("Extracted lyrics from MP3", "file", filePath, "chars", len(uslt.Lyrics))
 	return uslt.Lyrics, nil
 }
 
@@ -355,7 +356,7 @@ func extractLyricsFromFlac(filePath string) (string, error) {
 					fieldName := strings.ToUpper(parts[0])
 					if fieldName == "LYRICS" || fieldName == "UNSYNCEDLYRICS" {
 						lyrics := parts[1]
-						fmt.Printf("[ExtractLyrics] Successfully extracted lyrics from FLAC: %s (%d characters)\n", filePath, len(lyrics))
+						slog.Debug("Extracted lyrics from FLAC", "file", filePath, "chars", len(lyrics))
 						return lyrics, nil
 					}
 				}
@@ -363,7 +364,7 @@ func extractLyricsFromFlac(filePath string) (string, error) {
 		}
 	}
 
-	fmt.Printf("[ExtractLyrics] No lyrics found in FLAC: %s\n", filePath)
+	slog.Debug("No lyrics found in FLAC", "file", filePath)
 	return "", nil
 }
 
@@ -422,7 +423,7 @@ func EmbedLyricsOnlyMP3(filepath string, lyrics string) error {
 
 	validatedLyrics, err := validateLyricsDuration(lyrics, filepath)
 	if err != nil {
-		fmt.Printf("[EmbedLyricsOnlyMP3] Warning: Failed to validate lyrics duration: %v, using original lyrics\n", err)
+		slog.Warn("Failed to validate lyrics duration, using original lyrics", "file", filepath, "error", err)
 		validatedLyrics = lyrics
 	}
 	lyrics = validatedLyrics
@@ -454,7 +455,7 @@ func embedLyricsToM4A(filepath string, lyrics string) error {
 
 	validatedLyrics, err := validateLyricsDuration(lyrics, filepath)
 	if err != nil {
-		fmt.Printf("[embedLyricsToM4A] Warning: Failed to validate lyrics duration: %v, using original lyrics\n", err)
+		slog.Warn("Failed to validate lyrics duration, using original lyrics", "file", filepath, "error", err)
 		validatedLyrics = lyrics
 	}
 	lyrics = validatedLyrics
@@ -469,7 +470,9 @@ func embedLyricsToM4A(filepath string, lyrics string) error {
 	}
 
 	tmpOutputFile := strings.TrimSuffix(filepath, pathfilepath.Ext(filepath)) + ".tmp" + pathfilepath.Ext(filepath)
+	trackTempFile(tmpOutputFile)
 	defer func() {
+		untrackTempFile(tmpOutputFile)
 
 		if _, err := os.Stat(tmpOutputFile); err == nil {
 			os.Remove(tmpOutputFile)
@@ -492,7 +495,7 @@ func embedLyricsToM4A(filepath string, lyrics string) error {
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		fmt.Printf("[FFmpeg] Error embedding lyrics to M4A: %s\n", string(output))
+		slog.Warn("FFmpeg failed to embed lyrics to M4A", "file", filepath, "output", string(output))
 		return fmt.Errorf("ffmpeg failed to embed lyrics: %s - %w", string(output), err)
 	}
 
@@ -500,7 +503,7 @@ func embedLyricsToM4A(filepath string, lyrics string) error {
 		return fmt.Errorf("failed to replace original file: %w", err)
 	}
 
-	fmt.Printf("[FFmpeg] Lyrics embedded to M4A successfully: %d characters\n", len(lyrics))
+	slog.Debug("Lyrics embedded to M4A", "file", filepath, "chars", len(lyrics))
 	return nil
 }
 
@@ -511,7 +514,7 @@ func EmbedLyricsOnlyUniversal(filepath string, lyrics string) error {
 
 	validatedLyrics, err := validateLyricsDuration(lyrics, filepath)
 	if err != nil {
-		fmt.Printf("[EmbedLyricsOnlyUniversal] Warning: Failed to validate lyrics duration: %v, using original lyrics\n", err)
+		slog.Warn("Failed to validate lyrics duration, using original lyrics", "file", filepath, "error", err)
 		validatedLyrics = lyrics
 	}
 	lyrics = validatedLyrics
@@ -623,13 +626,13 @@ func validateLyricsDuration(lyrics string, filepath string) (string, error) {
 	duration, err := GetAudioDuration(filepath)
 	if err != nil {
 
-		fmt.Printf("[ValidateLyrics] Warning: Could not get audio duration: %v, skipping validation\n", err)
+		slog.Warn("Could not get audio duration, skipping lyrics validation", "file", filepath, "error", err)
 		return lyrics, nil
 	}
 
 	if duration <= 0 {
 
-		fmt.Printf("[ValidateLyrics] Warning: Invalid duration (%f seconds), skipping validation\n", duration)
+		slog.Warn("Invalid audio duration, skipping lyrics validation", "file", filepath, "duration_s", duration)
 		return lyrics, nil
 	}
 
@@ -656,7 +659,7 @@ func validateLyricsDuration(lyrics string, filepath string) (string, error) {
 					if ms <= durationMs {
 						validLines = append(validLines, line)
 					} else {
-						fmt.Printf("[ValidateLyrics] Filtered out line with timestamp %s (exceeds duration %d ms): %s\n", timestampStr, durationMs, trimmedLine)
+						slog.Debug("Filtered out lyrics line past the end of the track", "timestamp", timestampStr, "duration_ms", durationMs)
 					}
 				} else {
 
@@ -885,7 +888,7 @@ func embedMetadataToMP3(filePath string, metadata Metadata, coverPath string) er
 			}
 			tag.AddAttachedPicture(pic)
 		} else {
-			fmt.Printf("[EmbedMetadataToMP3] Warning: Failed to read cover art file: %v\n", err)
+			slog.Warn("Failed to read cover art file", "file", coverPath, "error", err)
 		}
 	}
 
@@ -958,7 +961,9 @@ func embedMetadataToM4A(filePath string, metadata Metadata, coverPath string) er
 	}
 
 	tmpOutputFile := strings.TrimSuffix(filePath, pathfilepath.Ext(filePath)) + ".tmp" + pathfilepath.Ext(filePath)
+	trackTempFile(tmpOutputFile)
 	defer func() {
+		untrackTempFile(tmpOutputFile)
 		if _, err := os.Stat(tmpOutputFile); err == nil {
 			os.Remove(tmpOutputFile)
 		}
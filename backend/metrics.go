@@ -0,0 +1,301 @@
+package backend
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are kept in process and written in the Prometheus text exposition
+// format by WriteMetrics. Label values must come from a small fixed set
+// (provider names, mirror hosts, statuses), never from user input.
+
+// latencyBuckets are the histogram buckets in seconds for upstream requests
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	metricsMu      sync.Mutex
+	metricFamilies []metricFamily
+)
+
+type metricFamily interface {
+	write(w *bufio.Writer)
+}
+
+// metricSeries is one label combination of a counter or histogram
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	count       uint64
+}
+
+// metricVec is a counter or histogram family with labels
+type metricVec struct {
+	name       string
+	help       string
+	kind       string // "counter" or "histogram"
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+func newMetricVec(name, help, kind string, buckets []float64, labelNames ...string) *metricVec {
+	v := &metricVec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+	metricsMu.Lock()
+	metricFamilies = append(metricFamilies, v)
+	metricsMu.Unlock()
+	return v
+}
+
+func newCounterVec(name, help string, labelNames ...string) *metricVec {
+	return newMetricVec(name, help, "counter", nil, labelNames...)
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *metricVec {
+	return newMetricVec(name, help, "histogram", buckets, labelNames...)
+}
+
+// get returns the series for labelValues. Callers hold v.mu.
+func (v *metricVec) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if v.kind == "histogram" {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// add increments a counter
+func (v *metricVec) add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value += delta
+	v.mu.Unlock()
+}
+
+func (v *metricVec) inc(labelValues ...string) {
+	v.add(1, labelValues...)
+}
+
+// observe records one histogram sample
+func (v *metricVec) observe(sample float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s := v.get(labelValues)
+	for i, upper := range v.buckets {
+		if sample <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.value += sample
+	s.count++
+}
+
+func (v *metricVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeMetricHeader(w, v.name, v.help, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.kind == "counter" {
+			writeSample(w, v.name, v.labelNames, s.labelValues, s.value)
+			continue
+		}
+
+		names := append(append([]string(nil), v.labelNames...), "le")
+		for i, upper := range v.buckets {
+			values := append(append([]string(nil), s.labelValues...), formatMetricValue(upper))
+			writeSample(w, v.name+"_bucket", names, values, float64(s.buckets[i]))
+		}
+		values := append(append([]string(nil), s.labelValues...), "+Inf")
+		writeSample(w, v.name+"_bucket", names, values, float64(s.count))
+		writeSample(w, v.name+"_sum", v.labelNames, s.labelValues, s.value)
+		writeSample(w, v.name+"_count", v.labelNames, s.labelValues, float64(s.count))
+	}
+}
+
+// GaugeSample is one value of a gauge collected at scrape time
+type GaugeSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// gaugeFunc is a gauge whose samples are computed on every scrape
+type gaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	collect    func() []GaugeSample
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeMetricHeader(w, g.name, g.help, "gauge")
+	for _, sample := range g.collect() {
+		writeSample(w, g.name, g.labelNames, sample.LabelValues, sample.Value)
+	}
+}
+
+// RegisterGaugeFunc adds a gauge computed by collect on every scrape. It is
+// used by packages that own state the backend cannot see, such as the
+// number of WebSocket clients.
+func RegisterGaugeFunc(name, help string, collect func() []GaugeSample, labelNames ...string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricFamilies = append(metricFamilies, &gaugeFunc{name: name, help: help, labelNames: labelNames, collect: collect})
+}
+
+// WriteMetrics writes all metrics in the Prometheus text format (0.0.4)
+func WriteMetrics(w io.Writer) error {
+	metricsMu.Lock()
+	families := append([]metricFamily(nil), metricFamilies...)
+	metricsMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, family := range families {
+		family.write(bw)
+	}
+	return bw.Flush()
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help, kind string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			labelValue := ""
+			if i < len(labelValues) {
+				labelValue = labelValues[i]
+			}
+			w.WriteString(labelName + `="` + escapeLabelValue(labelValue) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatMetricValue(value) + "\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Download and upstream metrics
+var (
+	downloadsStartedTotal = newCounterVec("spotiflac_downloads_started_total",
+		"Downloads handed to a provider.", "provider")
+	downloadsFinishedTotal = newCounterVec("spotiflac_downloads_finished_total",
+		"Downloads finished by result (completed, failed, skipped, cancelled).", "provider", "result")
+	downloadBytesTotal = newCounterVec("spotiflac_download_bytes_total",
+		"Bytes received from provider download URLs.", "provider")
+	upstreamRequestsTotal = newCounterVec("spotiflac_upstream_requests_total",
+		"Requests to provider APIs and mirrors by result (success, error).", "provider", "mirror", "result")
+	upstreamRequestDuration = newHistogramVec("spotiflac_upstream_request_duration_seconds",
+		"Latency of requests to provider APIs and mirrors.", latencyBuckets, "provider", "mirror")
+	spotifyMetadataDuration = newHistogramVec("spotiflac_spotify_metadata_duration_seconds",
+		"Latency of Spotify metadata fetches and searches.", latencyBuckets, "operation", "result")
+)
+
+// Download results
+const (
+	downloadResultCompleted = "completed"
+	downloadResultFailed    = "failed"
+	downloadResultSkipped   = "skipped"
+	downloadResultCancelled = "cancelled"
+)
+
+// observeUpstream records the latency and result of one provider API or
+// mirror request started at start, in the metrics and the mirror health
+func observeUpstream(provider, mirror string, start time.Time, err error) {
+	recordMirrorResult(provider, mirror, start, err)
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	upstreamRequestsTotal.inc(provider, mirror, result)
+	upstreamRequestDuration.observe(time.Since(start).Seconds(), provider, mirror)
+}
+
+// observeSpotifyMetadata records the latency of a Spotify metadata call
+func observeSpotifyMetadata(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	spotifyMetadataDuration.observe(time.Since(start).Seconds(), operation, result)
+}
+
+// mirrorLabel reduces a mirror URL to its host so query strings and tokens
+// never end up in a label
+func mirrorLabel(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+func init() {
+	RegisterGaugeFunc("spotiflac_queue_items", "Download queue items waiting, running or paused.", collectQueueDepth, "status")
+}
+
+// collectQueueDepth counts the unfinished queue items by status
+func collectQueueDepth() []GaugeSample {
+	statuses := []DownloadStatus{StatusQueued, StatusDownloading, StatusPaused}
+	counts := make(map[DownloadStatus]int, len(statuses))
+
+	downloadQueueLock.RLock()
+	for _, item := range downloadQueue {
+		counts[item.Status]++
+	}
+	downloadQueueLock.RUnlock()
+
+	samples := make([]GaugeSample, 0, len(statuses))
+	for _, status := range statuses {
+		samples = append(samples, GaugeSample{LabelValues: []string{string(status)}, Value: float64(counts[status])})
+	}
+	return samples
+}
@@ -0,0 +1,391 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const mirrorHealthBucket = "MirrorHealth"
+
+// Circuit states of a mirror
+const (
+	MirrorClosed   = "closed"
+	MirrorOpen     = "open"
+	MirrorHalfOpen = "half_open"
+)
+
+// mirrorEWMAWeight is the weight of the newest request in the success rate
+// and latency averages
+const mirrorEWMAWeight = 0.2
+
+// MirrorHealth is the tracked state of one provider API endpoint. Success
+// rate and latency are moving averages, so a mirror recovers its score once
+// it answers again.
+type MirrorHealth struct {
+	Provider string `json:"provider"`
+	// Mirror is the host of the endpoint
+	Mirror string `json:"mirror"`
+	State  string `json:"state"`
+	// Score orders the mirrors of a provider, best first (0-1)
+	Score       float64 `json:"score"`
+	SuccessRate float64 `json:"success_rate"`
+	LatencyMs   float64 `json:"latency_ms"`
+	Requests    int64   `json:"requests"`
+	Failures    int64   `json:"failures"`
+	// ConsecutiveFailures opens the circuit at the failure threshold
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastSuccess         int64  `json:"last_success,omitempty"`
+	LastFailure         int64  `json:"last_failure,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	// OpenUntil is when an open circuit lets a trial request through
+	OpenUntil int64 `json:"open_until,omitempty"`
+	// Weight is the configured weight of the endpoint, only set in reports
+	Weight float64 `json:"weight,omitempty"`
+}
+
+var (
+	mirrorsLock sync.Mutex
+	// mirrorHealth is keyed by provider and mirror host, mirrorsDirty
+	// holds the keys changed since the last FlushMirrorHealth
+	mirrorHealth = map[string]*MirrorHealth{}
+	mirrorsDirty = map[string]bool{}
+
+	// The flusher persists mirrorsDirty in the background, see
+	// StartMirrorHealthFlusher
+	mirrorFlushOnce    sync.Once
+	mirrorFlushStopped sync.Once
+	mirrorFlushStop    = make(chan struct{})
+	mirrorFlushDone    chan struct{}
+
+	// Circuit breaker settings, see ConfigureMirrorBreaker
+	mirrorFailureThreshold = 3
+	mirrorCooldown         = 30 * time.Second
+	mirrorMaxCooldown      = 15 * time.Minute
+)
+
+func mirrorKey(provider, mirror string) string {
+	return provider + "/" + mirror
+}
+
+// ConfigureMirrorBreaker sets after how many consecutive failures a mirror
+// is skipped and for how long. The cooldown doubles with every further
+// failure up to maxCooldown.
+func ConfigureMirrorBreaker(threshold int, cooldown, maxCooldown time.Duration) {
+	mirrorsLock.Lock()
+	defer mirrorsLock.Unlock()
+
+	if threshold > 0 {
+		mirrorFailureThreshold = threshold
+	}
+	if cooldown > 0 {
+		mirrorCooldown = cooldown
+	}
+	if maxCooldown >= mirrorCooldown {
+		mirrorMaxCooldown = maxCooldown
+	}
+}
+
+// state returns the circuit state of h at now
+func (h *MirrorHealth) state(now time.Time) string {
+	if h.ConsecutiveFailures < mirrorFailureThreshold {
+		return MirrorClosed
+	}
+	if now.Unix() < h.OpenUntil {
+		return MirrorOpen
+	}
+	return MirrorHalfOpen
+}
+
+// score favours reliable mirrors and, among those, fast ones
+func (h *MirrorHealth) score() float64 {
+	return h.SuccessRate * 1000 / (1000 + h.LatencyMs)
+}
+
+// newMirrorHealth is the state of a mirror without history. It starts with
+// a perfect record so new mirrors are tried before known bad ones.
+func newMirrorHealth(provider, mirror string) *MirrorHealth {
+	return &MirrorHealth{Provider: provider, Mirror: mirror, State: MirrorClosed, SuccessRate: 1}
+}
+
+// recordMirrorResult updates the health of a mirror after a request that
+// started at start. Only faults of the mirror itself count as failures:
+// a mirror that answers that it has no such track is still up. Requests
+// cancelled by the caller are not counted.
+func recordMirrorResult(provider, mirror string, start time.Time, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	now := time.Now()
+	latency := float64(now.Sub(start).Milliseconds())
+
+	mirrorsLock.Lock()
+	h, ok := mirrorHealth[mirrorKey(provider, mirror)]
+	if !ok {
+		h = newMirrorHealth(provider, mirror)
+		mirrorHealth[mirrorKey(provider, mirror)] = h
+	}
+
+	h.Requests++
+	if h.LatencyMs == 0 {
+		h.LatencyMs = latency
+	} else {
+		h.LatencyMs += mirrorEWMAWeight * (latency - h.LatencyMs)
+	}
+
+	switch {
+	case err == nil:
+		h.SuccessRate += mirrorEWMAWeight * (1 - h.SuccessRate)
+		h.ConsecutiveFailures = 0
+		h.OpenUntil = 0
+		h.LastSuccess = now.Unix()
+	case mirrorFault(err):
+		h.SuccessRate -= mirrorEWMAWeight * h.SuccessRate
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastFailure = now.Unix()
+		h.LastError = err.Error()
+		if excess := h.ConsecutiveFailures - mirrorFailureThreshold; excess >= 0 {
+			cooldown := mirrorMaxCooldown
+			if excess < 16 && mirrorCooldown<<excess < mirrorMaxCooldown {
+				cooldown = mirrorCooldown << excess
+			}
+			h.OpenUntil = now.Add(cooldown).Unix()
+			slog.Warn("Mirror circuit opened", "provider", provider, "mirror", mirror, "failures", h.ConsecutiveFailures, "cooldown", cooldown, "error", err)
+		}
+	default:
+		// Reachable but without a usable answer for this track
+		h.ConsecutiveFailures = 0
+		h.OpenUntil = 0
+	}
+	h.State = h.state(now)
+	h.Score = h.score()
+	mirrorsDirty[mirrorKey(provider, mirror)] = true
+	mirrorsLock.Unlock()
+}
+
+// mirrorFault reports whether err means the mirror itself is unhealthy:
+// it is unreachable, timed out, failed with a server error or throttles us
+func mirrorFault(err error) bool {
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// upstreamStatusError is a non-200 answer of a provider API
+type upstreamStatusError struct {
+	StatusCode int
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// rankEndpoints orders the endpoints of provider for the next attempt:
+// endpoints with a closed or half-open circuit by weight times score, best
+// first, keeping the given order among equals. Endpoints with an open
+// circuit are skipped; when all are open, only the one that cools down
+// first is tried.
+func rankEndpoints(provider string, endpoints []Endpoint) []Endpoint {
+	now := time.Now()
+
+	mirrorsLock.Lock()
+	type ranked struct {
+		endpoint  Endpoint
+		rank      float64
+		openUntil int64
+	}
+	var usable, open []ranked
+	for _, e := range endpoints {
+		h, ok := mirrorHealth[mirrorKey(provider, mirrorLabel(e.URL))]
+		if !ok {
+			h = newMirrorHealth(provider, mirrorLabel(e.URL))
+		}
+		r := ranked{endpoint: e, rank: e.Weight * h.score(), openUntil: h.OpenUntil}
+		if h.state(now) == MirrorOpen {
+			open = append(open, r)
+		} else {
+			usable = append(usable, r)
+		}
+	}
+	mirrorsLock.Unlock()
+
+	if len(usable) == 0 && len(open) > 0 {
+		sort.SliceStable(open, func(i, j int) bool { return open[i].openUntil < open[j].openUntil })
+		usable = open[:1]
+	}
+	sort.SliceStable(usable, func(i, j int) bool { return usable[i].rank > usable[j].rank })
+
+	ordered := make([]Endpoint, len(usable))
+	for i, r := range usable {
+		ordered[i] = r.endpoint
+	}
+	if skipped := len(endpoints) - len(ordered); skipped > 0 {
+		slog.Debug("Skipping mirrors with open circuit", "provider", provider, "skipped", skipped)
+	}
+	return ordered
+}
+
+// MirrorHealthReport returns the health of every endpoint of the enabled
+// providers, by provider and rank. Mirrors that were never used are
+// listed with their initial state.
+func MirrorHealthReport() []MirrorHealth {
+	now := time.Now()
+
+	endpoints := map[string][]Endpoint{}
+	for _, p := range EnabledProviders() {
+		endpoints[p.Name()] = ProviderEndpoints(p.Name())
+	}
+
+	var report []MirrorHealth
+	mirrorsLock.Lock()
+	for provider, list := range endpoints {
+		for _, e := range list {
+			h, ok := mirrorHealth[mirrorKey(provider, mirrorLabel(e.URL))]
+			if !ok {
+				h = newMirrorHealth(provider, mirrorLabel(e.URL))
+			}
+			entry := *h
+			entry.State = h.state(now)
+			entry.Score = h.score()
+			entry.Weight = e.Weight
+			report = append(report, entry)
+		}
+	}
+	mirrorsLock.Unlock()
+
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Provider != report[j].Provider {
+			return report[i].Provider < report[j].Provider
+		}
+		return report[i].Weight*report[i].Score > report[j].Weight*report[j].Score
+	})
+	return report
+}
+
+// FlushMirrorHealth persists the mirrors whose health changed since the
+// last flush, so it survives a restart. Results are only kept in memory
+// until then; API lookups must not wait for a database write each.
+func FlushMirrorHealth() {
+	mirrorsLock.Lock()
+	dirty := make([]MirrorHealth, 0, len(mirrorsDirty))
+	for key := range mirrorsDirty {
+		if h, ok := mirrorHealth[key]; ok {
+			dirty = append(dirty, *h)
+		}
+	}
+	mirrorsDirty = map[string]bool{}
+	mirrorsLock.Unlock()
+
+	if historyDB == nil || len(dirty) == 0 {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(mirrorHealthBucket))
+		if err != nil {
+			return err
+		}
+		for _, h := range dirty {
+			buf, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(mirrorKey(h.Provider, h.Mirror)), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to persist mirror health", "mirrors", len(dirty), "error", err)
+
+		// Try again with the next flush
+		mirrorsLock.Lock()
+		for _, h := range dirty {
+			mirrorsDirty[mirrorKey(h.Provider, h.Mirror)] = true
+		}
+		mirrorsLock.Unlock()
+	}
+}
+
+// StartMirrorHealthFlusher runs FlushMirrorHealth every interval until
+// StopMirrorHealthFlusher is called. Calling it more than once is a no-op.
+func StartMirrorHealthFlusher(interval time.Duration) {
+	mirrorFlushOnce.Do(func() {
+		mirrorFlushDone = make(chan struct{})
+		go func() {
+			defer close(mirrorFlushDone)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					FlushMirrorHealth()
+				case <-mirrorFlushStop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// StopMirrorHealthFlusher stops the periodic flush and persists what
+// changed since the last one. Call it before the history database closes.
+func StopMirrorHealthFlusher() {
+	mirrorFlushOnce.Do(func() {})
+	mirrorFlushStopped.Do(func() {
+		close(mirrorFlushStop)
+		if mirrorFlushDone != nil {
+			<-mirrorFlushDone
+		}
+	})
+	FlushMirrorHealth()
+}
+
+// RestoreMirrorHealth loads the mirror health saved by a previous run.
+// Returns the number of mirrors restored.
+func RestoreMirrorHealth() (int, error) {
+	if historyDB == nil {
+		return 0, nil
+	}
+
+	restored := map[string]*MirrorHealth{}
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(mirrorHealthBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var h MirrorHealth
+			if err := json.Unmarshal(v, &h); err != nil {
+				slog.Warn("Skipping unreadable mirror health record", "mirror", string(k), "error", err)
+				return nil
+			}
+			restored[mirrorKey(h.Provider, h.Mirror)] = &h
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	mirrorsLock.Lock()
+	defer mirrorsLock.Unlock()
+	for key, h := range restored {
+		mirrorHealth[key] = h
+	}
+	return len(restored), nil
+}
@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetMirrorHealth starts the test without mirror history and with the
+// default breaker settings, and restores them afterwards
+func resetMirrorHealth(t *testing.T) {
+	t.Helper()
+	mirrorsLock.Lock()
+	threshold, cooldown, maxCooldown := mirrorFailureThreshold, mirrorCooldown, mirrorMaxCooldown
+	mirrorHealth = map[string]*MirrorHealth{}
+	mirrorsDirty = map[string]bool{}
+	mirrorsLock.Unlock()
+
+	t.Cleanup(func() {
+		mirrorsLock.Lock()
+		mirrorHealth = map[string]*MirrorHealth{}
+		mirrorsDirty = map[string]bool{}
+		mirrorFailureThreshold, mirrorCooldown, mirrorMaxCooldown = threshold, cooldown, maxCooldown
+		mirrorsLock.Unlock()
+	})
+}
+
+func endpointHosts(endpoints []Endpoint) string {
+	hosts := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		hosts[i] = mirrorLabel(e.URL)
+	}
+	return strings.Join(hosts, " ")
+}
+
+func mirrorState(provider, mirror string) *MirrorHealth {
+	mirrorsLock.Lock()
+	defer mirrorsLock.Unlock()
+	return mirrorHealth[mirrorKey(provider, mirror)]
+}
+
+var (
+	errMirrorDown     = &upstreamStatusError{StatusCode: http.StatusBadGateway}
+	errTrackNotListed = &upstreamStatusError{StatusCode: http.StatusNotFound}
+)
+
+func TestRankEndpoints(t *testing.T) {
+	resetMirrorHealth(t)
+	endpoints := []Endpoint{
+		{URL: "https://a.example/", Weight: 1},
+		{URL: "https://b.example/", Weight: 1},
+		{URL: "https://c.example/", Weight: 1},
+	}
+
+	// Without history the configured order is kept
+	if got := endpointHosts(rankEndpoints("tidal", endpoints)); got != "a.example b.example c.example" {
+		t.Errorf("ranking without history = %s", got)
+	}
+
+	// Failures and latency lower the score
+	now := time.Now()
+	recordMirrorResult("tidal", "a.example", now, errMirrorDown)
+	recordMirrorResult("tidal", "b.example", now.Add(-100*time.Millisecond), nil)
+	recordMirrorResult("tidal", "c.example", now, nil)
+	if got := endpointHosts(rankEndpoints("tidal", endpoints)); got != "c.example b.example a.example" {
+		t.Errorf("ranking by score = %s, want c.example b.example a.example", got)
+	}
+
+	// Weight scales the score
+	weighted := append([]Endpoint(nil), endpoints...)
+	weighted[0].Weight = 10
+	if got := endpointHosts(rankEndpoints("tidal", weighted)); !strings.HasPrefix(got, "a.example") {
+		t.Errorf("ranking by weight = %s, want a.example first", got)
+	}
+
+	// Health is tracked per provider
+	if got := endpointHosts(rankEndpoints("qobuz", endpoints)); got != "a.example b.example c.example" {
+		t.Errorf("ranking of another provider = %s", got)
+	}
+}
+
+func TestMirrorCircuitBreaker(t *testing.T) {
+	resetMirrorHealth(t)
+	ConfigureMirrorBreaker(3, time.Minute, 10*time.Minute)
+	endpoints := []Endpoint{
+		{URL: "https://a.example/", Weight: 1},
+		{URL: "https://b.example/", Weight: 1},
+	}
+
+	for i := 0; i < 2; i++ {
+		recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+	}
+	if h := mirrorState("tidal", "a.example"); h.State != MirrorClosed {
+		t.Fatalf("state below the threshold = %s, want %s", h.State, MirrorClosed)
+	}
+
+	recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+	h := mirrorState("tidal", "a.example")
+	if h.State != MirrorOpen {
+		t.Fatalf("state at the threshold = %s, want %s", h.State, MirrorOpen)
+	}
+	if cooldown := time.Until(time.Unix(h.OpenUntil, 0)); cooldown < 58*time.Second || cooldown > time.Minute {
+		t.Errorf("cooldown = %v, want 1m", cooldown)
+	}
+	if got := endpointHosts(rankEndpoints("tidal", endpoints)); got != "b.example" {
+		t.Errorf("ranking with an open circuit = %s, want b.example", got)
+	}
+
+	// Every further failure doubles the cooldown up to the maximum
+	recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+	if cooldown := time.Until(time.Unix(mirrorState("tidal", "a.example").OpenUntil, 0)); cooldown < 118*time.Second {
+		t.Errorf("cooldown after another failure = %v, want 2m", cooldown)
+	}
+	for i := 0; i < 10; i++ {
+		recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+	}
+	if cooldown := time.Until(time.Unix(mirrorState("tidal", "a.example").OpenUntil, 0)); cooldown > 10*time.Minute {
+		t.Errorf("cooldown = %v, want at most 10m", cooldown)
+	}
+
+	// After the cooldown a trial request goes through
+	mirrorsLock.Lock()
+	mirrorHealth[mirrorKey("tidal", "a.example")].OpenUntil = time.Now().Add(-time.Second).Unix()
+	mirrorsLock.Unlock()
+	if got := endpointHosts(rankEndpoints("tidal", endpoints)); got != "b.example a.example" {
+		t.Errorf("ranking with a half-open circuit = %s, want b.example a.example", got)
+	}
+
+	// A successful trial closes the circuit
+	recordMirrorResult("tidal", "a.example", time.Now(), nil)
+	if h := mirrorState("tidal", "a.example"); h.State != MirrorClosed || h.ConsecutiveFailures != 0 {
+		t.Errorf("state after a success = %s with %d failures, want closed", h.State, h.ConsecutiveFailures)
+	}
+}
+
+func TestMirrorCircuitAllOpen(t *testing.T) {
+	resetMirrorHealth(t)
+	ConfigureMirrorBreaker(1, time.Minute, time.Hour)
+	endpoints := []Endpoint{
+		{URL: "https://a.example/", Weight: 1},
+		{URL: "https://b.example/", Weight: 1},
+	}
+
+	// b opened first, so it cools down first
+	recordMirrorResult("tidal", "b.example", time.Now(), errMirrorDown)
+	recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+	recordMirrorResult("tidal", "a.example", time.Now(), errMirrorDown)
+
+	if got := endpointHosts(rankEndpoints("tidal", endpoints)); got != "b.example" {
+		t.Errorf("ranking with every circuit open = %s, want b.example", got)
+	}
+}
+
+func TestMirrorFaults(t *testing.T) {
+	resetMirrorHealth(t)
+	ConfigureMirrorBreaker(2, time.Minute, time.Hour)
+
+	// A mirror that does not have a track is still up
+	for i := 0; i < 5; i++ {
+		recordMirrorResult("tidal", "a.example", time.Now(), errTrackNotListed)
+	}
+	if h := mirrorState("tidal", "a.example"); h.State != MirrorClosed || h.Failures != 0 {
+		t.Errorf("state after not found answers = %s with %d failures, want closed", h.State, h.Failures)
+	}
+
+	// Requests cancelled by the caller are not counted at all
+	recordMirrorResult("tidal", "b.example", time.Now(), fmt.Errorf("search: %w", context.Canceled))
+	if h := mirrorState("tidal", "b.example"); h != nil {
+		t.Errorf("cancelled request recorded: %+v", *h)
+	}
+
+	// An answer in between resets the count
+	recordMirrorResult("tidal", "c.example", time.Now(), errMirrorDown)
+	recordMirrorResult("tidal", "c.example", time.Now(), errTrackNotListed)
+	recordMirrorResult("tidal", "c.example", time.Now(), errMirrorDown)
+	if h := mirrorState("tidal", "c.example"); h.State != MirrorClosed {
+		t.Errorf("state after interrupted failures = %s, want closed", h.State)
+	}
+
+	for _, key := range []string{mirrorKey("tidal", "a.example"), mirrorKey("tidal", "c.example")} {
+		if !mirrorsDirty[key] {
+			t.Errorf("%s not marked for the next flush", key)
+		}
+	}
+}
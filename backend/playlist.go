@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CreateM3U8File writes an extended M3U8 playlist named after m3u8Name into
+// outputDir. Entries are written relative to outputDir so the playlist keeps
+// working when the folder is moved.
+func CreateM3U8File(m3u8Name string, outputDir string, filePaths []string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	safeName := SanitizeFilename(m3u8Name)
+	if safeName == "" {
+		safeName = "playlist"
+	}
+
+	m3u8Path := filepath.Join(outputDir, safeName+".m3u8")
+
+	f, err := os.Create(m3u8Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return WriteM3U8(f, outputDir, filePaths)
+}
+
+// WriteM3U8 writes an extended M3U8 playlist of filePaths to w, with
+// entries relative to baseDir
+func WriteM3U8(w io.Writer, baseDir string, filePaths []string) error {
+	if _, err := io.WriteString(w, "#EXTM3U\n"); err != nil {
+		return err
+	}
+
+	for _, path := range filePaths {
+		if path == "" {
+			continue
+		}
+
+		relPath, err := filepath.Rel(baseDir, path)
+		if err != nil {
+
+			relPath = path
+		}
+
+		relPath = filepath.ToSlash(relPath)
+
+		if _, err := io.WriteString(w, relPath+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -15,8 +16,14 @@ const (
 	StatusCompleted   DownloadStatus = "completed"
 	StatusFailed      DownloadStatus = "failed"
 	StatusSkipped     DownloadStatus = "skipped"
+	StatusPaused      DownloadStatus = "paused"
+	StatusCancelled   DownloadStatus = "cancelled"
 )
 
+// ErrQueueItemNotFound is returned by the per-item queue operations for
+// unknown item IDs
+var ErrQueueItemNotFound = errors.New("queue item not found")
+
 type DownloadItem struct {
 	ID           string         `json:"id"`
 	TrackName    string         `json:"track_name"`
@@ -31,6 +38,9 @@ type DownloadItem struct {
 	EndTime      int64          `json:"end_time"`
 	ErrorMessage string         `json:"error_message"`
 	FilePath     string         `json:"file_path"`
+	// Provider is the service that served the file once it is completed
+	Provider string `json:"provider,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
 }
 
 var (
@@ -41,16 +51,23 @@ var (
 	currentSpeed        float64
 	speedLock           sync.RWMutex
 
-	downloadQueue       []DownloadItem
-	downloadQueueLock   sync.RWMutex
-	currentItemID       string
-	currentItemLock     sync.RWMutex
-	totalDownloaded     float64
+	downloadQueue     []DownloadItem
+	downloadQueueLock sync.RWMutex
+	// totalDownloaded holds the MB completed this session per user
+	totalDownloaded     = map[string]float64{}
 	totalDownloadedLock sync.RWMutex
 	sessionStartTime    int64
 	sessionStartLock    sync.RWMutex
+
+	// lastProgressEvent holds when a running item last sent its progress.
+	// Guarded by downloadQueueLock.
+	lastProgressEvent = map[string]time.Time{}
 )
 
+// progressEventInterval is the least time between two progress events of
+// one item
+const progressEventInterval = time.Second
+
 type ProgressInfo struct {
 	IsDownloading bool    `json:"is_downloading"`
 	MBDownloaded  float64 `json:"mb_downloaded"`
@@ -64,12 +81,43 @@ type DownloadQueueInfo struct {
 	TotalDownloaded  float64        `json:"total_downloaded"`
 	SessionStartTime int64          `json:"session_start_time"`
 	QueuedCount      int            `json:"queued_count"`
+	DownloadingCount int            `json:"downloading_count"`
 	CompletedCount   int            `json:"completed_count"`
 	FailedCount      int            `json:"failed_count"`
 	SkippedCount     int            `json:"skipped_count"`
+	PausedCount      int            `json:"paused_count"`
+	CancelledCount   int            `json:"cancelled_count"`
 }
 
-func GetDownloadProgress() ProgressInfo {
+// GetDownloadProgress reports the combined progress of the running
+// downloads of userID, or of all users when userID is empty. Without
+// running queue items (e.g. while FFmpeg is being downloaded) it falls back
+// to the global counters, which only the unscoped view sees.
+func GetDownloadProgress(userID string) ProgressInfo {
+	downloadQueueLock.RLock()
+	active := 0
+	var mbDownloaded, speedMBps float64
+	for _, item := range downloadQueue {
+		if item.Status == StatusDownloading && inUserScope(item.UserID, userID) {
+			active++
+			mbDownloaded += item.Progress
+			speedMBps += item.Speed
+		}
+	}
+	downloadQueueLock.RUnlock()
+
+	if active > 0 {
+		return ProgressInfo{
+			IsDownloading: true,
+			MBDownloaded:  mbDownloaded,
+			SpeedMBps:     speedMBps,
+		}
+	}
+	if userID != "" {
+		// The global counters belong to all users
+		return ProgressInfo{}
+	}
+
 	downloadingLock.RLock()
 	downloading := isDownloading
 	downloadingLock.RUnlock()
@@ -121,6 +169,7 @@ type ProgressWriter struct {
 	lastTime    int64
 	lastBytes   int64
 	itemID      string
+	provider    string
 }
 
 func NewProgressWriter(writer io.Writer) *ProgressWriter {
@@ -149,6 +198,9 @@ func getCurrentTimeMillis() int64 {
 func (pw *ProgressWriter) Write(p []byte) (int, error) {
 	n, err := pw.writer.Write(p)
 	pw.total += int64(n)
+	if pw.provider != "" && n > 0 {
+		downloadBytesTotal.add(float64(n), pw.provider)
+	}
 
 	if pw.total-pw.lastPrinted >= 256*1024 {
 		mbDownloaded := float64(pw.total) / (1024 * 1024)
@@ -160,17 +212,9 @@ func (pw *ProgressWriter) Write(p []byte) (int, error) {
 		var speedMBps float64
 		if timeDiff > 0 {
 			speedMBps = (bytesDiff / (1024 * 1024)) / timeDiff
-			SetDownloadSpeed(speedMBps)
-			fmt.Printf("\rDownloaded: %.2f MB (%.2f MB/s)", mbDownloaded, speedMBps)
-		} else {
-			fmt.Printf("\rDownloaded: %.2f MB", mbDownloaded)
 		}
 
-		SetDownloadProgress(mbDownloaded)
-
-		if pw.itemID != "" {
-			UpdateItemProgress(pw.itemID, mbDownloaded, speedMBps)
-		}
+		reportProgress(pw.itemID, mbDownloaded, speedMBps)
 
 		pw.lastPrinted = pw.total
 		pw.lastTime = now
@@ -180,15 +224,33 @@ func (pw *ProgressWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// reportProgress records progress for a queue item, or on the global
+// counters when the transfer does not belong to one
+func reportProgress(itemID string, mbDownloaded, speedMBps float64) {
+	if itemID != "" {
+		UpdateItemProgress(itemID, mbDownloaded, speedMBps)
+		return
+	}
+	SetDownloadProgress(mbDownloaded)
+	SetDownloadSpeed(speedMBps)
+}
+
+// resumeAt counts the n bytes already on disk of a resumed transfer as
+// progress, without reporting them as downloaded from the provider. The
+// queue item shows them right away.
+func (pw *ProgressWriter) resumeAt(n int64) {
+	pw.total, pw.lastPrinted, pw.lastBytes = n, n, n
+	if pw.itemID != "" {
+		UpdateItemProgress(pw.itemID, float64(n)/(1024*1024), 0)
+	}
+}
+
 func (pw *ProgressWriter) GetTotal() int64 {
 	return pw.total
 }
 
 func AddToQueue(id, trackName, artistName, albumName, spotifyID string) {
-	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
-
-	item := DownloadItem{
+	addToQueue(DownloadItem{
 		ID:         id,
 		TrackName:  trackName,
 		ArtistName: artistName,
@@ -200,9 +262,17 @@ func AddToQueue(id, trackName, artistName, albumName, spotifyID string) {
 		Speed:      0,
 		StartTime:  0,
 		EndTime:    0,
-	}
+	})
+}
+
+// addToQueue appends a queued item, so that the queued event already
+// carries every field of the item
+func addToQueue(item DownloadItem) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
 
 	downloadQueue = append(downloadQueue, item)
+	emitEvent(EventItemQueued, item)
 
 	sessionStartLock.Lock()
 	if sessionStartTime == 0 {
@@ -211,22 +281,28 @@ func AddToQueue(id, trackName, artistName, albumName, spotifyID string) {
 	sessionStartLock.Unlock()
 }
 
-func StartDownloadItem(id string) {
+// restoreQueueItem puts an item loaded from the persisted queue back into
+// the in-memory queue as is
+func restoreQueueItem(item DownloadItem) {
 	downloadQueueLock.Lock()
 	defer downloadQueueLock.Unlock()
 
-	for i := range downloadQueue {
-		if downloadQueue[i].ID == id {
-			downloadQueue[i].Status = StatusDownloading
-			downloadQueue[i].StartTime = time.Now().Unix()
-			downloadQueue[i].Progress = 0
-			break
+	downloadQueue = append(downloadQueue, item)
+
+	if item.Status == StatusQueued {
+		sessionStartLock.Lock()
+		if sessionStartTime == 0 {
+			sessionStartTime = time.Now().Unix()
 		}
+		sessionStartLock.Unlock()
 	}
+}
 
-	currentItemLock.Lock()
-	currentItemID = id
-	currentItemLock.Unlock()
+// StartDownloadItem marks a queued item as downloading. Items in any other
+// state are left alone: the worker pool already claimed them, or they were
+// paused or cancelled in the meantime.
+func StartDownloadItem(id string) {
+	claimQueuedItem(id)
 }
 
 func UpdateItemProgress(id string, progress, speed float64) {
@@ -237,66 +313,259 @@ func UpdateItemProgress(id string, progress, speed float64) {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Progress = progress
 			downloadQueue[i].Speed = speed
+
+			now := time.Now()
+			if now.Sub(lastProgressEvent[id]) >= progressEventInterval {
+				lastProgressEvent[id] = now
+				emitEvent(EventItemProgress, downloadQueue[i])
+			}
 			break
 		}
 	}
 }
 
-func GetCurrentItemID() string {
-	currentItemLock.RLock()
-	defer currentItemLock.RUnlock()
-	return currentItemID
+func GetDownloadItem(id string) (DownloadItem, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for _, item := range downloadQueue {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return DownloadItem{}, false
+}
+
+func GetDownloadItemStatus(id string) (DownloadStatus, bool) {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	for _, item := range downloadQueue {
+		if item.ID == id {
+			return item.Status, true
+		}
+	}
+	return "", false
 }
 
-func CompleteDownloadItem(id, filePath string, finalSize float64) {
+// claimQueuedItem moves a queued item to downloading. It fails if the item
+// was cancelled, paused or removed in the meantime, so a worker never starts
+// an item that is no longer wanted.
+func claimQueuedItem(id string) bool {
 	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
+	claimed := false
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			if downloadQueue[i].Status == StatusQueued {
+				downloadQueue[i].Status = StatusDownloading
+				downloadQueue[i].StartTime = time.Now().Unix()
+				// Progress stays until the part file reports its own, a
+				// resumed item continues where it was paused
+				downloadQueue[i].Speed = 0
+				emitEvent(EventItemStarted, downloadQueue[i])
+				claimed = true
+			}
+			break
+		}
+	}
+	downloadQueueLock.Unlock()
+
+	if claimed {
+		updateQueueRecord(id)
+	}
+	return claimed
+}
 
+// transitionQueueItem applies update to an item if its current status is
+// one of from and publishes event for the new state
+func transitionQueueItem(id string, from []DownloadStatus, event EventType, update func(item *DownloadItem)) error {
+	downloadQueueLock.Lock()
+	err := ErrQueueItemNotFound
+	for i := range downloadQueue {
+		if downloadQueue[i].ID != id {
+			continue
+		}
+		err = fmt.Errorf("cannot change item in %s state", downloadQueue[i].Status)
+		for _, status := range from {
+			if downloadQueue[i].Status == status {
+				update(&downloadQueue[i])
+				emitEvent(event, downloadQueue[i])
+				err = nil
+				break
+			}
+		}
+		break
+	}
+	downloadQueueLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+	updateQueueRecord(id)
+	return nil
+}
+
+// CancelDownloadItem cancels a queued, paused or running item. A running
+// transfer is aborted through its context and the partial file removed.
+func CancelDownloadItem(id string) error {
+	err := transitionQueueItem(id, []DownloadStatus{StatusQueued, StatusPaused, StatusDownloading}, EventItemCancelled, func(item *DownloadItem) {
+		item.Status = StatusCancelled
+		item.EndTime = time.Now().Unix()
+		item.ErrorMessage = "Cancelled"
+		item.Speed = 0
+	})
+	if err != nil {
+		return err
+	}
+
+	stopDownload(id, errDownloadCancelled)
+	return nil
+}
+
+// PauseDownloadItem holds a queued item back, or aborts a running one so it
+// can be resumed later. The partial file is kept, so a resumed download
+// continues from the bytes already written and the item keeps its progress.
+func PauseDownloadItem(id string) error {
+	if !hasDownloadRequest(id) {
+		return fmt.Errorf("item has no stored request and cannot be resumed")
+	}
+
+	err := transitionQueueItem(id, []DownloadStatus{StatusQueued, StatusDownloading}, EventItemPaused, func(item *DownloadItem) {
+		item.Status = StatusPaused
+		item.Speed = 0
+	})
+	if err != nil {
+		return err
+	}
+
+	stopDownload(id, errDownloadPaused)
+	return nil
+}
+
+// ResumeDownloadItem puts a paused item back into the queue
+func ResumeDownloadItem(id string) error {
+	if !hasDownloadRequest(id) {
+		return fmt.Errorf("item has no stored request and cannot be resumed")
+	}
+
+	err := transitionQueueItem(id, []DownloadStatus{StatusPaused}, EventItemQueued, func(item *DownloadItem) {
+		item.Status = StatusQueued
+		item.StartTime = 0
+	})
+	if err != nil {
+		return err
+	}
+
+	requeueDownload(id)
+	return nil
+}
+
+// RetryDownloadItem queues a failed, cancelled or skipped item again with
+// its original request parameters
+func RetryDownloadItem(id string) error {
+	if !hasDownloadRequest(id) {
+		return fmt.Errorf("item has no stored request and cannot be retried")
+	}
+
+	// A failed transfer kept its partial file, the retry continues there
+	progress := partProgress(id)
+	err := transitionQueueItem(id, []DownloadStatus{StatusFailed, StatusCancelled, StatusSkipped}, EventItemQueued, func(item *DownloadItem) {
+		item.Status = StatusQueued
+		item.Progress = progress
+		item.TotalSize = 0
+		item.Speed = 0
+		item.StartTime = 0
+		item.EndTime = 0
+		item.ErrorMessage = ""
+		item.FilePath = ""
+		item.Provider = ""
+	})
+	if err != nil {
+		return err
+	}
+
+	requeueDownload(id)
+	return nil
+}
+
+func CompleteDownloadItem(id, filePath, provider string, finalSize float64) {
+	downloadQueueLock.Lock()
+	found := false
 	for i := range downloadQueue {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Status = StatusCompleted
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].FilePath = filePath
+			downloadQueue[i].Provider = provider
 			downloadQueue[i].Progress = finalSize
 			downloadQueue[i].TotalSize = finalSize
+			downloadQueue[i].Speed = 0
 
 			totalDownloadedLock.Lock()
-			totalDownloaded += finalSize
+			totalDownloaded[downloadQueue[i].UserID] += finalSize
 			totalDownloadedLock.Unlock()
+			emitEvent(EventItemCompleted, downloadQueue[i])
+			found = true
 			break
 		}
 	}
+	downloadQueueLock.Unlock()
+
+	if found {
+		updateQueueRecord(id)
+	}
 }
 
 func FailDownloadItem(id, errorMsg string) {
 	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
-
+	found := false
 	for i := range downloadQueue {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Status = StatusFailed
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].ErrorMessage = errorMsg
+			downloadQueue[i].Speed = 0
+			emitEvent(EventItemFailed, downloadQueue[i])
+			found = true
 			break
 		}
 	}
+	downloadQueueLock.Unlock()
+
+	if found {
+		updateQueueRecord(id)
+	}
 }
 
 func SkipDownloadItem(id, filePath string) {
 	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
-
+	found := false
 	for i := range downloadQueue {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Status = StatusSkipped
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].FilePath = filePath
+			downloadQueue[i].Speed = 0
+			emitEvent(EventItemSkipped, downloadQueue[i])
+			found = true
 			break
 		}
 	}
+	downloadQueueLock.Unlock()
+
+	if found {
+		updateQueueRecord(id)
+	}
 }
 
 func GetDownloadQueue() DownloadQueueInfo {
+	return GetDownloadQueueForUser("")
+}
+
+// GetDownloadQueueForUser returns the queue limited to the items of userID,
+// or the whole queue when userID is empty. Counts and speed cover only the
+// returned items.
+func GetDownloadQueueForUser(userID string) DownloadQueueInfo {
 
 	ResetSessionIfComplete()
 
@@ -312,29 +581,54 @@ func GetDownloadQueue() DownloadQueueInfo {
 	speedLock.RUnlock()
 
 	totalDownloadedLock.RLock()
-	total := totalDownloaded
+	var total float64
+	for owner, mb := range totalDownloaded {
+		if inUserScope(owner, userID) {
+			total += mb
+		}
+	}
 	totalDownloadedLock.RUnlock()
 
 	sessionStartLock.RLock()
 	sessionStart := sessionStartTime
 	sessionStartLock.RUnlock()
 
-	var queued, completed, failed, skipped int
+	var queued, downloadingCount, completed, failed, skipped, paused, cancelled int
+	var activeSpeed float64
+	queueCopy := make([]DownloadItem, 0, len(downloadQueue))
 	for _, item := range downloadQueue {
+		if !inUserScope(item.UserID, userID) {
+			continue
+		}
+		queueCopy = append(queueCopy, item)
+
 		switch item.Status {
 		case StatusQueued:
 			queued++
+		case StatusDownloading:
+			downloadingCount++
+			activeSpeed += item.Speed
 		case StatusCompleted:
 			completed++
 		case StatusFailed:
 			failed++
 		case StatusSkipped:
 			skipped++
+		case StatusPaused:
+			paused++
+		case StatusCancelled:
+			cancelled++
 		}
 	}
 
-	queueCopy := make([]DownloadItem, len(downloadQueue))
-	copy(queueCopy, downloadQueue)
+	if downloadingCount > 0 {
+		downloading = true
+		speed = activeSpeed
+	} else if userID != "" {
+		// The global counters belong to all users
+		downloading = false
+		speed = 0
+	}
 
 	return DownloadQueueInfo{
 		IsDownloading:    downloading,
@@ -343,57 +637,110 @@ func GetDownloadQueue() DownloadQueueInfo {
 		TotalDownloaded:  total,
 		SessionStartTime: sessionStart,
 		QueuedCount:      queued,
+		DownloadingCount: downloadingCount,
 		CompletedCount:   completed,
 		FailedCount:      failed,
 		SkippedCount:     skipped,
+		PausedCount:      paused,
+		CancelledCount:   cancelled,
 	}
 }
 
-func ClearDownloadQueue() {
+// ClearDownloadQueue removes finished items of userID (all users when empty)
+func ClearDownloadQueue(userID string) {
 	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
 
 	newQueue := make([]DownloadItem, 0)
+	var removed []string
 	for _, item := range downloadQueue {
-		if item.Status == StatusQueued || item.Status == StatusDownloading {
+		if !inUserScope(item.UserID, userID) || item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusPaused {
 			newQueue = append(newQueue, item)
+		} else {
+			removed = append(removed, item.ID)
 		}
 	}
 	downloadQueue = newQueue
+	downloadQueueLock.Unlock()
+
+	deleteQueueRecords(removed)
+	forgetDownloadRequests(removed)
 }
 
-func ClearAllDownloads() {
+// ClearAllDownloads removes every item of userID from the queue. With an
+// empty userID the whole queue and the session counters are reset.
+func ClearAllDownloads(userID string) {
+	if userID != "" {
+		clearUserDownloads(userID)
+		return
+	}
+
 	downloadQueueLock.Lock()
+	removed := make([]string, 0, len(downloadQueue))
+	for _, item := range downloadQueue {
+		removed = append(removed, item.ID)
+	}
 	downloadQueue = []DownloadItem{}
+	lastProgressEvent = map[string]time.Time{}
 	downloadQueueLock.Unlock()
 
+	deleteQueueRecords(removed)
+	forgetDownloadRequests(removed)
+
 	totalDownloadedLock.Lock()
-	totalDownloaded = 0
+	totalDownloaded = map[string]float64{}
 	totalDownloadedLock.Unlock()
 
 	sessionStartLock.Lock()
 	sessionStartTime = 0
 	sessionStartLock.Unlock()
 
-	currentItemLock.Lock()
-	currentItemID = ""
-	currentItemLock.Unlock()
-
 	SetDownloadProgress(0)
 	SetDownloadSpeed(0)
 }
 
-func CancelAllQueuedItems() {
+// clearUserDownloads removes all items of one user and resets the user's
+// download total, leaving the items and counters of other users alone
+func clearUserDownloads(userID string) {
 	downloadQueueLock.Lock()
-	defer downloadQueueLock.Unlock()
+	newQueue := make([]DownloadItem, 0, len(downloadQueue))
+	var removed []string
+	for _, item := range downloadQueue {
+		if item.UserID == userID {
+			removed = append(removed, item.ID)
+			delete(lastProgressEvent, item.ID)
+		} else {
+			newQueue = append(newQueue, item)
+		}
+	}
+	downloadQueue = newQueue
+	downloadQueueLock.Unlock()
 
+	deleteQueueRecords(removed)
+	forgetDownloadRequests(removed)
+
+	totalDownloadedLock.Lock()
+	delete(totalDownloaded, userID)
+	totalDownloadedLock.Unlock()
+}
+
+// CancelAllQueuedItems skips the queued items of userID (all users when empty)
+func CancelAllQueuedItems(userID string) {
+	downloadQueueLock.Lock()
+	var skipped []string
 	for i := range downloadQueue {
-		if downloadQueue[i].Status == StatusQueued {
+		if downloadQueue[i].Status == StatusQueued && inUserScope(downloadQueue[i].UserID, userID) {
 			downloadQueue[i].Status = StatusSkipped
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].ErrorMessage = "Cancelled"
+			emitEvent(EventItemSkipped, downloadQueue[i])
+			skipped = append(skipped, downloadQueue[i].ID)
 		}
 	}
+	downloadQueueLock.Unlock()
+
+	for _, id := range skipped {
+		updateQueueRecord(id)
+	}
 }
 
 func ResetSessionIfComplete() {
@@ -413,7 +760,7 @@ func ResetSessionIfComplete() {
 		sessionStartLock.Unlock()
 
 		totalDownloadedLock.Lock()
-		totalDownloaded = 0
+		totalDownloaded = map[string]float64{}
 		totalDownloadedLock.Unlock()
 	}
 }
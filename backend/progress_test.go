@@ -0,0 +1,267 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func wantStatus(t *testing.T, id string, want DownloadStatus) {
+	t.Helper()
+	if got, _ := GetDownloadItemStatus(id); got != want {
+		t.Fatalf("status = %q, want %q", got, want)
+	}
+}
+
+func TestQueueTransitions(t *testing.T) {
+	resetDownloadQueue(t)
+	id := EnqueueDownload(DownloadRequest{ItemID: "item-1", Service: "tidal", TrackName: "Track"})
+	wantStatus(t, id, StatusQueued)
+	if !isPending(id) {
+		t.Fatal("enqueued item is not pending")
+	}
+
+	// Pausing a queued item takes it off the pending list
+	if err := PauseDownloadItem(id); err != nil {
+		t.Fatalf("PauseDownloadItem() error = %v", err)
+	}
+	wantStatus(t, id, StatusPaused)
+	if isPending(id) {
+		t.Error("paused item is still pending")
+	}
+	if claimQueuedItem(id) {
+		t.Error("worker claimed a paused item")
+	}
+
+	if err := ResumeDownloadItem(id); err != nil {
+		t.Fatalf("ResumeDownloadItem() error = %v", err)
+	}
+	wantStatus(t, id, StatusQueued)
+	if !isPending(id) {
+		t.Error("resumed item is not pending")
+	}
+
+	if !claimQueuedItem(id) {
+		t.Fatal("claimQueuedItem() = false for a queued item")
+	}
+	wantStatus(t, id, StatusDownloading)
+	if claimQueuedItem(id) {
+		t.Error("item claimed twice")
+	}
+
+	// Pausing a running item aborts its transfer and keeps its progress
+	ctx, cancel := context.WithCancelCause(context.Background())
+	pendingDownloadsLock.Lock()
+	activeDownloads[id] = cancel
+	pendingDownloadsLock.Unlock()
+	t.Cleanup(func() {
+		pendingDownloadsLock.Lock()
+		delete(activeDownloads, id)
+		pendingDownloadsLock.Unlock()
+	})
+	UpdateItemProgress(id, 12.5, 3)
+
+	if err := PauseDownloadItem(id); err != nil {
+		t.Fatalf("PauseDownloadItem() error = %v", err)
+	}
+	wantStatus(t, id, StatusPaused)
+	if !errors.Is(context.Cause(ctx), errDownloadPaused) {
+		t.Errorf("transfer cause = %v, want %v", context.Cause(ctx), errDownloadPaused)
+	}
+	item, _ := GetDownloadItem(id)
+	if item.Progress != 12.5 || item.Speed != 0 {
+		t.Errorf("paused item progress = %v speed = %v, want 12.5 and 0", item.Progress, item.Speed)
+	}
+
+	if err := CancelDownloadItem(id); err != nil {
+		t.Fatalf("CancelDownloadItem() error = %v", err)
+	}
+	wantStatus(t, id, StatusCancelled)
+
+	// Cancelled items can be retried, not resumed
+	if err := ResumeDownloadItem(id); err == nil {
+		t.Error("ResumeDownloadItem() of a cancelled item succeeded")
+	}
+	if err := RetryDownloadItem(id); err != nil {
+		t.Fatalf("RetryDownloadItem() error = %v", err)
+	}
+	wantStatus(t, id, StatusQueued)
+	item, _ = GetDownloadItem(id)
+	if item.Progress != 0 || item.ErrorMessage != "" {
+		t.Errorf("retried item progress = %v error = %q, want a fresh item", item.Progress, item.ErrorMessage)
+	}
+}
+
+func TestQueueTransitionErrors(t *testing.T) {
+	resetDownloadQueue(t)
+	id := EnqueueDownload(DownloadRequest{ItemID: "item-2", Service: "tidal"})
+	AddToQueue("no-request", "Track", "Artist", "Album", "")
+
+	tests := []struct {
+		name string
+		call func(string) error
+		id   string
+	}{
+		{"resume queued item", ResumeDownloadItem, id},
+		{"retry queued item", RetryDownloadItem, id},
+		{"pause item without request", PauseDownloadItem, "no-request"},
+		{"resume item without request", ResumeDownloadItem, "no-request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(tt.id); err == nil {
+				t.Error("invalid transition succeeded")
+			}
+		})
+	}
+
+	for name, call := range map[string]func(string) error{
+		"cancel": CancelDownloadItem,
+		"pause":  PauseDownloadItem,
+		"resume": ResumeDownloadItem,
+		"retry":  RetryDownloadItem,
+	} {
+		t.Run(name+" unknown item", func(t *testing.T) {
+			err := call("missing")
+			if name == "cancel" && !errors.Is(err, ErrQueueItemNotFound) {
+				t.Errorf("error = %v, want %v", err, ErrQueueItemNotFound)
+			} else if err == nil {
+				t.Error("change of an unknown item succeeded")
+			}
+		})
+	}
+
+	// Finished items stay finished
+	CompleteDownloadItem(id, "/music/track.flac", "tidal", 10)
+	if err := CancelDownloadItem(id); err == nil {
+		t.Error("CancelDownloadItem() of a completed item succeeded")
+	}
+	wantStatus(t, id, StatusCompleted)
+}
+
+func TestClearStopsRunningDownloads(t *testing.T) {
+	clears := map[string]func(){
+		"all items":         func() { ClearAllDownloads("") },
+		"items of one user": func() { ClearAllDownloads("u1") },
+	}
+	for name, clear := range clears {
+		t.Run(name, func(t *testing.T) {
+			resetDownloadQueue(t)
+			running := EnqueueDownload(DownloadRequest{ItemID: "running", Service: "tidal", UserID: "u1"})
+			queued := EnqueueDownload(DownloadRequest{ItemID: "queued", Service: "tidal", UserID: "u1"})
+			claimQueuedItem(running)
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			pendingDownloadsLock.Lock()
+			for i, req := range pendingDownloads {
+				if req.ItemID == running {
+					pendingDownloads = append(pendingDownloads[:i], pendingDownloads[i+1:]...)
+					break
+				}
+			}
+			activeDownloads[running] = cancel
+			pendingDownloadsLock.Unlock()
+			t.Cleanup(func() {
+				pendingDownloadsLock.Lock()
+				delete(activeDownloads, running)
+				pendingDownloadsLock.Unlock()
+			})
+
+			clear()
+
+			if !errors.Is(context.Cause(ctx), errDownloadCancelled) {
+				t.Errorf("transfer cause = %v, want %v", context.Cause(ctx), errDownloadCancelled)
+			}
+			if isPending(queued) {
+				t.Error("removed item is still pending")
+			}
+			if hasDownloadRequest(running) || hasDownloadRequest(queued) {
+				t.Error("requests of removed items are kept")
+			}
+		})
+	}
+}
+
+func TestRetryKeepsPartProgress(t *testing.T) {
+	resetDownloadQueue(t)
+	id := EnqueueDownload(DownloadRequest{ItemID: "item-3", Service: "tidal"})
+	base := filepath.Join(t.TempDir(), "track")
+	leavePart(t, testCandidate(0), base, make([]byte, 512*1024), func(p *PartFile) error { return p.setSize(1024 * 1024) })
+	rememberPartBase(id, base)
+
+	claimQueuedItem(id)
+	FailDownloadItem(id, "connection reset")
+	if err := RetryDownloadItem(id); err != nil {
+		t.Fatalf("RetryDownloadItem() error = %v", err)
+	}
+	if item, _ := GetDownloadItem(id); item.Progress != 0.5 {
+		t.Errorf("retried item progress = %v, want 0.5", item.Progress)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	resetDownloadQueue(t)
+	id := EnqueueDownload(DownloadRequest{ItemID: "item-4", Service: "tidal"})
+	events, unsubscribe := SubscribeEvents(16)
+	defer unsubscribe()
+	claimQueuedItem(id)
+	started := <-events
+
+	for i := 1; i <= 5; i++ {
+		UpdateItemProgress(id, float64(i), 1)
+	}
+	FailDownloadItem(id, "connection reset")
+
+	// Updates within a second are folded into the item state
+	progress := <-events
+	if progress.Type != EventItemProgress || progress.ID != 0 || progress.Item.Progress != 1 {
+		t.Errorf("first event after start = %s id %d progress %v, want %s without id at 1", progress.Type, progress.ID, progress.Item.Progress, EventItemProgress)
+	}
+	failed := <-events
+	if failed.Type != EventItemFailed || failed.Item.Progress != 5 {
+		t.Errorf("next event = %s progress %v, want %s at 5", failed.Type, failed.Item.Progress, EventItemFailed)
+	}
+	if failed.ID != started.ID+1 {
+		t.Errorf("failed event id = %d, want %d", failed.ID, started.ID+1)
+	}
+
+	// Progress is live only and not replayed
+	replay, _ := EventsSince(started.ID - 1)
+	for _, event := range replay {
+		if event.Type == EventItemProgress {
+			t.Errorf("progress event %+v kept for replay", event)
+		}
+	}
+}
+
+func TestUserTotals(t *testing.T) {
+	resetDownloadQueue(t)
+	for _, user := range []string{"u1", "u2"} {
+		id := EnqueueDownload(DownloadRequest{ItemID: "total-" + user, Service: "tidal", UserID: user})
+		claimQueuedItem(id)
+		UpdateItemProgress(id, 2, 1)
+	}
+	CompleteDownloadItem("total-u1", "/music/track.flac", "tidal", 10)
+
+	if got := GetDownloadQueueForUser("u1").TotalDownloaded; got != 10 {
+		t.Errorf("total of u1 = %v, want 10", got)
+	}
+	if got := GetDownloadQueueForUser("u2").TotalDownloaded; got != 0 {
+		t.Errorf("total of u2 = %v, want 0", got)
+	}
+	if got := GetDownloadProgress("u1"); got.IsDownloading {
+		t.Errorf("progress of u1 = %+v, want nothing running", got)
+	}
+	if got := GetDownloadProgress("u2"); !got.IsDownloading || got.MBDownloaded != 2 {
+		t.Errorf("progress of u2 = %+v, want 2 MB running", got)
+	}
+	if got := GetDownloadProgress(""); got.MBDownloaded != 2 {
+		t.Errorf("progress of all users = %+v, want 2 MB", got)
+	}
+
+	ClearAllDownloads("u1")
+	if got := GetDownloadQueueForUser("").TotalDownloaded; got != 0 {
+		t.Errorf("total after clearing u1 = %v, want 0", got)
+	}
+}
@@ -0,0 +1,786 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is a download source such as Tidal, Qobuz or Amazon Music.
+// Resolve finds a stream for a track, Fetch writes its bytes to a part file,
+// continuing at its offset when an earlier attempt was interrupted. Naming,
+// conversion and tagging are shared by all providers (see downloadTrack).
+type Provider interface {
+	// Name is the key of the provider in the registry and in requests
+	Name() string
+	// DefaultEndpoints are the APIs used until the configuration sets
+	// others (see SetProviderEndpoints)
+	DefaultEndpoints() []Endpoint
+	Resolve(ctx context.Context, ref TrackRef) (Candidate, error)
+	Fetch(ctx context.Context, c Candidate, part *PartFile) error
+}
+
+// TrackRef identifies the track a provider should find
+type TrackRef struct {
+	SpotifyID string
+	// ISRC is looked up from the Spotify ID when a request has none
+	ISRC string
+	// ServiceURL links the track on the provider's own service and skips
+	// the song.link lookup
+	ServiceURL string
+	// Quality is provider specific, empty for the provider default
+	Quality string
+	// AllowFallback accepts a lower quality of the same provider
+	AllowFallback bool
+	// APIURL pins one mirror; empty or "auto" tries all of them
+	APIURL string
+}
+
+// TrackRequest is one track download on a provider: the track, where the
+// file goes and how it is named and tagged
+type TrackRequest struct {
+	TrackRef
+
+	OutputDir           string
+	FilenameFormat      string
+	PlaylistName        string
+	PlaylistOwner       string
+	IncludeTrackNumber  bool
+	Position            int
+	UseAlbumTrackNumber bool
+	UseFirstArtistOnly  bool
+
+	TrackName            string
+	ArtistName           string
+	AlbumName            string
+	AlbumArtist          string
+	ReleaseDate          string
+	TrackNumber          int
+	DiscNumber           int
+	TotalTracks          int
+	TotalDiscs           int
+	Copyright            string
+	Publisher            string
+	CoverURL             string
+	EmbedMaxQualityCover bool
+}
+
+// Candidate is a stream a provider resolved for a track
+type Candidate struct {
+	Provider string
+	// TrackID is the provider's own ID of the track
+	TrackID string
+	// Mirror is the host that resolved the stream
+	Mirror  string
+	Quality string
+
+	// URL is fetched as a whole, Segments (DASH) one after another
+	URL      string
+	Segments []string
+
+	// Format is the container Fetch writes, "flac" or "m4a". m4a streams
+	// are decrypted with DecryptionKey and, with ConvertToFLAC, converted.
+	Format        string
+	DecryptionKey string
+	ConvertToFLAC bool
+}
+
+// Endpoint is one API a provider asks for streams
+type Endpoint struct {
+	URL string
+	// Kind selects the API protocol of providers that speak several, such
+	// as "jumo" for Qobuz; empty for the provider's standard API
+	Kind string
+	// Weight scales the health score when endpoints are ranked
+	Weight  float64
+	Timeout time.Duration
+	// Headers are sent with every API request
+	Headers map[string]string
+}
+
+// root is the scheme and host of the endpoint, which readiness checks probe
+func (e Endpoint) root() string {
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Host == "" {
+		return e.URL
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// get requests apiURL with the endpoint's headers and timeout and returns
+// the body of a 200 answer. Other answers are an *upstreamStatusError.
+func (e Endpoint) get(ctx context.Context, apiURL string) ([]byte, error) {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", browserUserAgent)
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := endpointClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// endpointClient sends provider API requests; each endpoint bounds them
+// with its own timeout
+var endpointClient = &http.Client{}
+
+var (
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrProviderDisabled = errors.New("provider is disabled")
+)
+
+var (
+	providersLock sync.RWMutex
+	// registeredProviders holds every provider compiled in, enabledProviders
+	// the ones the configuration allows; nil allows all
+	registeredProviders = map[string]Provider{}
+	enabledProviders    map[string]bool
+	// fallbackChain is the order in which other providers are tried when
+	// the requested one fails; empty disables the fallback
+	fallbackChain []string
+	// providerEndpoints replaces the default endpoints of the providers it
+	// holds; endpointsGeneration counts the replacements
+	providerEndpoints   map[string][]Endpoint
+	endpointsGeneration uint64
+)
+
+func init() {
+	RegisterProvider(newTidalProvider())
+	RegisterProvider(newQobuzProvider())
+	RegisterProvider(newAmazonProvider())
+}
+
+// RegisterProvider adds p to the registry, replacing a provider of the
+// same name
+func RegisterProvider(p Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	registeredProviders[p.Name()] = p
+}
+
+// EnableProviders limits downloads to the named providers. Unknown names
+// are an error so a typo in the configuration does not go unnoticed.
+func EnableProviders(names []string) error {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := registeredProviders[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+		enabled[name] = true
+	}
+	enabledProviders = enabled
+	return nil
+}
+
+// SetFallbackChain sets the providers a download falls back to, in order,
+// when its own provider cannot resolve or transfer the track. Disabled
+// providers in the chain are skipped.
+func SetFallbackChain(names []string) error {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	for _, name := range names {
+		if _, ok := registeredProviders[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+	}
+	fallbackChain = append([]string(nil), names...)
+	return nil
+}
+
+// SetProviderEndpoints replaces the endpoints of the providers in
+// endpoints; the others go back to their defaults. It can be called while
+// downloads run, requests already sent finish on their old endpoint.
+func SetProviderEndpoints(endpoints map[string][]Endpoint) error {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	configured := make(map[string][]Endpoint, len(endpoints))
+	for name, list := range endpoints {
+		p, ok := registeredProviders[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+
+		// The default endpoints show which API kinds a provider speaks
+		kinds := map[string]bool{"": true}
+		for _, e := range p.DefaultEndpoints() {
+			kinds[e.Kind] = true
+		}
+		for _, e := range list {
+			if !kinds[e.Kind] {
+				return fmt.Errorf("%s endpoint %s: unknown kind %q", name, e.URL, e.Kind)
+			}
+		}
+		configured[name] = append([]Endpoint(nil), list...)
+	}
+
+	providerEndpoints = configured
+	endpointsGeneration++
+	return nil
+}
+
+// ProviderEndpoints returns the endpoints a provider currently uses
+func ProviderEndpoints(name string) []Endpoint {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	if list, ok := providerEndpoints[name]; ok {
+		return append([]Endpoint(nil), list...)
+	}
+	if p, ok := registeredProviders[name]; ok {
+		return p.DefaultEndpoints()
+	}
+	return nil
+}
+
+func currentEndpointsGeneration() uint64 {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	return endpointsGeneration
+}
+
+// ProviderRegistered reports whether a provider of that name exists,
+// enabled or not
+func ProviderRegistered(name string) bool {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	_, ok := registeredProviders[name]
+	return ok
+}
+
+// ProviderEnabled reports whether downloads may use the named provider
+func ProviderEnabled(name string) bool {
+	_, err := LookupProvider(name)
+	return err == nil
+}
+
+// LookupProvider returns the enabled provider of that name
+func LookupProvider(name string) (Provider, error) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	p, ok := registeredProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	if enabledProviders != nil && !enabledProviders[name] {
+		return nil, fmt.Errorf("%w: %s", ErrProviderDisabled, name)
+	}
+	return p, nil
+}
+
+// providerChain returns the provider named first followed by the enabled
+// providers of the fallback chain, each once
+func providerChain(first string) ([]Provider, error) {
+	p, err := LookupProvider(first)
+	if err != nil {
+		return nil, err
+	}
+
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	chain := []Provider{p}
+	seen := map[string]bool{first: true}
+	for _, name := range fallbackChain {
+		if seen[name] || (enabledProviders != nil && !enabledProviders[name]) {
+			continue
+		}
+		seen[name] = true
+		chain = append(chain, registeredProviders[name])
+	}
+	return chain, nil
+}
+
+// EnabledProviders returns the enabled providers sorted by name
+func EnabledProviders() []Provider {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	providers := make([]Provider, 0, len(registeredProviders))
+	for name, p := range registeredProviders {
+		if enabledProviders == nil || enabledProviders[name] {
+			providers = append(providers, p)
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name() < providers[j].Name() })
+	return providers
+}
+
+// streamTimeout bounds a single stream or segment transfer
+const streamTimeout = 10 * time.Minute
+
+// browserUserAgent is sent to mirrors that reject unknown clients
+const browserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36"
+
+var streamClient = &http.Client{Timeout: streamTimeout}
+
+// httpFetcher implements Provider.Fetch for candidates served over plain
+// HTTP GET, either as one URL resumed with Range requests or as DASH
+// segments resumed after the last complete one
+type httpFetcher struct{}
+
+func (httpFetcher) Fetch(ctx context.Context, c Candidate, part *PartFile) error {
+	if len(c.Segments) == 0 {
+		return retryStream(ctx, part, func() error {
+			return fetchStream(ctx, c.URL, part)
+		})
+	}
+
+	done := part.checkpoint.SegmentsDone
+	slog.DebugContext(ctx, "Downloading segments", "segments", len(c.Segments), "done", done)
+	for i := done; i < len(c.Segments); i++ {
+		start := part.Offset()
+		err := retryStream(ctx, part, func() error {
+			if err := part.truncate(start); err != nil {
+				return err
+			}
+			return fetchSegment(ctx, c.Segments[i], part)
+		})
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		if err := part.segmentDone(i + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchStream appends the rest of streamURL to part, asking for the bytes
+// from its offset on. A mirror that ignores the range sends everything
+// again, which then replaces the part.
+func fetchStream(ctx context.Context, streamURL string, part *PartFile) error {
+	offset := part.Offset()
+	if size := part.checkpoint.Size; size > 0 && offset == size {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", browserUserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return restartStream(part)
+		}
+		if err := part.setSize(total); err != nil {
+			return restartStream(part)
+		}
+		slog.DebugContext(ctx, "Resuming stream", "offset", offset, "size", total)
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			slog.InfoContext(ctx, "Mirror ignored the range, downloading the whole stream again", "offset", offset)
+			if err := part.truncate(0); err != nil {
+				return err
+			}
+		}
+		if err := part.setSize(resp.ContentLength); err != nil {
+			return err
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Past the end: the stream is shorter than the part on disk
+		return restartStream(part)
+	default:
+		return fmt.Errorf("download failed: %w", &upstreamStatusError{StatusCode: resp.StatusCode})
+	}
+
+	if _, err := io.Copy(part, resp.Body); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+	return nil
+}
+
+// restartStream drops a part that does not fit the stream the mirror
+// serves now, so the next try starts from zero
+func restartStream(part *PartFile) error {
+	if err := part.truncate(0); err != nil {
+		return err
+	}
+	if err := part.save(); err != nil {
+		return err
+	}
+	return errStreamChanged
+}
+
+// fetchSegment appends one DASH segment to part
+func fetchSegment(ctx context.Context, segmentURL string, part *PartFile) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", segmentURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", browserUserAgent)
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %w", &upstreamStatusError{StatusCode: resp.StatusCode})
+	}
+
+	if _, err := io.Copy(part, resp.Body); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+	return nil
+}
+
+// filename is the name of the finished file, with a .flac extension that
+// finishStream replaces for other formats
+func (r TrackRequest) filename() string {
+	artist, albumArtist := r.ArtistName, r.AlbumArtist
+	if r.UseFirstArtistOnly {
+		artist, albumArtist = GetFirstArtist(artist), GetFirstArtist(albumArtist)
+	}
+
+	position := r.Position
+	if r.UseAlbumTrackNumber && r.TrackNumber > 0 {
+		position = r.TrackNumber
+	}
+
+	return BuildExpectedFilename(r.TrackName, artist, r.AlbumName, albumArtist, r.ReleaseDate, r.FilenameFormat, r.PlaylistName, r.PlaylistOwner, r.IncludeTrackNumber, position, r.DiscNumber, r.UseAlbumTrackNumber)
+}
+
+// outputPath is where the finished file of r goes. Only the substituted
+// values of the filename format are sanitized, so the joined path is
+// checked to stay inside the output directory (rule #9: Zero Trust Input).
+func (r TrackRequest) outputPath() (string, error) {
+	path := filepath.Join(r.OutputDir, r.filename())
+	rel, err := filepath.Rel(r.OutputDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("filename format leads out of the output directory")
+	}
+	return path, nil
+}
+
+// downloadTrack runs req on the first provider of chain that resolves and
+// transfers the track, then converts and tags the file. Returns the path
+// of the file and the provider that served it, or "EXISTS:" and the path
+// when it was downloaded before.
+func downloadTrack(ctx context.Context, chain []Provider, req TrackRequest, job downloadJob) (string, string, error) {
+	if req.OutputDir != "." {
+		if err := os.MkdirAll(req.OutputDir, 0755); err != nil {
+			return "", "", fmt.Errorf("directory error: %w", err)
+		}
+	}
+
+	outputPath, err := req.outputPath()
+	if err != nil {
+		return "", "", err
+	}
+	if fileInfo, err := os.Stat(outputPath); err == nil && fileInfo.Size() > 0 {
+		slog.InfoContext(ctx, "File already exists", "file", outputPath, "mb", float64(fileInfo.Size())/(1024*1024))
+		return "EXISTS:" + outputPath, "", nil
+	}
+
+	if req.ISRC == "" && req.SpotifyID != "" {
+		if isrc, err := NewSongLinkClient().GetISRC(ctx, req.SpotifyID); err == nil {
+			req.ISRC = isrc
+		} else {
+			slog.DebugContext(ctx, "ISRC lookup failed", "error", err)
+		}
+	}
+
+	base := strings.TrimSuffix(outputPath, ".flac")
+	var failures []string
+	for i, p := range chain {
+		ref := req.TrackRef
+		if i > 0 {
+			// Service links, mirrors and quality codes belong to the
+			// requested provider, fallbacks use their own defaults
+			ref.ServiceURL, ref.APIURL, ref.Quality = "", "", ""
+			slog.InfoContext(ctx, "Falling back to next provider", "service", p.Name(), "previous_error", failures[i-1])
+		}
+
+		downloadsStartedTotal.inc(p.Name())
+		candidate, part, err := fetchCandidate(ctx, p, ref, base, job)
+		filePath := ""
+		if err == nil {
+			// Decryption and conversion failures fall back like transfer
+			// failures
+			filePath, err = finishStream(ctx, candidate, part.path, base)
+			part.discard()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				downloadsFinishedTotal.inc(p.Name(), downloadResultCancelled)
+				return "", "", err
+			}
+			downloadsFinishedTotal.inc(p.Name(), downloadResultFailed)
+			if len(chain) == 1 {
+				return "", "", err
+			}
+			failures = append(failures, p.Name()+": "+err.Error())
+			continue
+		}
+
+		// A provider that failed before may have left a part in the other
+		// format, which no later attempt resumes
+		removePartFiles(base)
+		tagTrack(ctx, filePath, req)
+
+		downloadsFinishedTotal.inc(p.Name(), downloadResultCompleted)
+		slog.InfoContext(ctx, "Downloaded successfully", "service", p.Name(), "file", filePath)
+		return filePath, p.Name(), nil
+	}
+
+	return "", "", fmt.Errorf("no provider could download the track: %s", strings.Join(failures, "; "))
+}
+
+// fetchCandidate resolves ref on p and writes the stream to the part file
+// next to base. A failed, paused or interrupted transfer keeps the part
+// and its checkpoint so the next attempt resumes it; a cancelled one
+// removes them. On success the caller finishes and discards the part.
+func fetchCandidate(ctx context.Context, p Provider, ref TrackRef, base string, job downloadJob) (Candidate, *PartFile, error) {
+	candidate, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return Candidate{}, nil, err
+	}
+
+	job.provider = p.Name()
+	part, err := openPartFile(ctx, candidate, base, job)
+	if err != nil {
+		return Candidate{}, nil, err
+	}
+
+	slog.InfoContext(ctx, "Downloading track", "service", p.Name(), "mirror", candidate.Mirror, "quality", candidate.Quality, "file", base+"."+candidate.Format)
+	err = p.Fetch(ctx, candidate, part)
+	if closeErr := part.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if errors.Is(context.Cause(ctx), errDownloadCancelled) {
+			part.discard()
+		} else {
+			slog.InfoContext(ctx, "Keeping partial download for a later resume", "file", part.path, "mb", float64(part.Offset())/(1024*1024))
+		}
+		return Candidate{}, nil, err
+	}
+
+	slog.DebugContext(ctx, "Download complete", "mb", float64(part.progress.GetTotal())/(1024*1024))
+	return candidate, part, nil
+}
+
+// finishStream moves a fetched stream to base plus its final extension,
+// decrypting or converting m4a streams with ffmpeg
+func finishStream(ctx context.Context, c Candidate, tempPath, base string) (string, error) {
+	if c.Format == "flac" {
+		finalPath := base + ".flac"
+		if err := os.Rename(tempPath, finalPath); err != nil {
+			return "", fmt.Errorf("failed to move file: %w", err)
+		}
+		return finalPath, nil
+	}
+
+	if c.DecryptionKey == "" && !c.ConvertToFLAC {
+		finalPath := base + ".m4a"
+		if err := os.Rename(tempPath, finalPath); err != nil {
+			return "", fmt.Errorf("failed to move file: %w", err)
+		}
+		return finalPath, nil
+	}
+
+	ffmpegPath, err := GetFFmpegPath()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	if err := ValidateExecutable(ffmpegPath); err != nil {
+		return "", fmt.Errorf("invalid ffmpeg executable: %w", err)
+	}
+
+	if c.DecryptionKey != "" {
+		// Decryption copies the audio, the container follows the codec
+		ext := ".m4a"
+		if probeAudioCodec(ctx, tempPath) == "flac" {
+			ext = ".flac"
+		}
+		decryptedPath := base + ".decrypted" + ext
+		trackTempFile(decryptedPath)
+		defer untrackTempFile(decryptedPath)
+
+		slog.DebugContext(ctx, "Decrypting file", "file", tempPath)
+		cmd := exec.Command(ffmpegPath, "-decryption_key", c.DecryptionKey, "-i", tempPath, "-c", "copy", "-y", decryptedPath)
+		setHideWindow(cmd)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(decryptedPath)
+			outStr := string(output)
+			if len(outStr) > 500 {
+				outStr = outStr[len(outStr)-500:]
+			}
+			return "", fmt.Errorf("ffmpeg decryption failed: %v\nTail Output: %s", err, outStr)
+		}
+		if info, err := os.Stat(decryptedPath); err != nil || info.Size() == 0 {
+			os.Remove(decryptedPath)
+			return "", fmt.Errorf("decrypted file missing or empty")
+		}
+
+		finalPath := base + ext
+		if err := os.Rename(decryptedPath, finalPath); err != nil {
+			os.Remove(decryptedPath)
+			return "", fmt.Errorf("failed to rename decrypted file: %w", err)
+		}
+		return finalPath, nil
+	}
+
+	finalPath := base + ".flac"
+	slog.DebugContext(ctx, "Converting to FLAC", "file", finalPath)
+	cmd := exec.Command(ffmpegPath, "-y", "-i", tempPath, "-vn", "-c:a", "flac", finalPath)
+	setHideWindow(cmd)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(finalPath)
+		m4aPath := base + ".m4a"
+		os.Rename(tempPath, m4aPath)
+		return "", fmt.Errorf("ffmpeg conversion failed (M4A saved as %s): %w - %s", m4aPath, err, stderr.String())
+	}
+	return finalPath, nil
+}
+
+// probeAudioCodec returns the codec of the first audio stream of path, or
+// "" when ffprobe is missing or fails
+func probeAudioCodec(ctx context.Context, path string) string {
+	ffprobePath, err := GetFFprobePath()
+	if err != nil {
+		return ""
+	}
+
+	cmd := exec.Command(ffprobePath,
+		"-v", "quiet",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	setHideWindow(cmd)
+	output, _ := cmd.Output()
+	codec := strings.TrimSpace(string(output))
+	slog.DebugContext(ctx, "Detected codec", "codec", codec)
+	return codec
+}
+
+// tagTrack embeds the Spotify metadata and cover into a downloaded file.
+// Tagging errors leave the file in place.
+func tagTrack(ctx context.Context, filePath string, req TrackRequest) {
+	coverPath := ""
+	if req.CoverURL != "" {
+		coverPath = filePath + ".cover.jpg"
+		if err := NewCoverClient().DownloadCoverToPath(req.CoverURL, coverPath, req.EmbedMaxQualityCover); err != nil {
+			slog.WarnContext(ctx, "Failed to download Spotify cover", "error", err)
+			coverPath = ""
+		} else {
+			defer os.Remove(coverPath)
+		}
+	}
+
+	trackNumber := req.TrackNumber
+	if trackNumber == 0 {
+		trackNumber = 1
+	}
+
+	spotifyURL := ""
+	if req.SpotifyID != "" {
+		spotifyURL = "https://open.spotify.com/track/" + req.SpotifyID
+	}
+
+	metadata := Metadata{
+		Title:       req.TrackName,
+		Artist:      req.ArtistName,
+		Album:       req.AlbumName,
+		AlbumArtist: req.AlbumArtist,
+		Date:        req.ReleaseDate,
+		TrackNumber: trackNumber,
+		TotalTracks: req.TotalTracks,
+		DiscNumber:  req.DiscNumber,
+		TotalDiscs:  req.TotalDiscs,
+		URL:         spotifyURL,
+		Copyright:   req.Copyright,
+		Publisher:   req.Publisher,
+		Description: "https://github.com/afkarxyz/SpotiFLAC",
+		ISRC:        req.ISRC,
+	}
+
+	if err := EmbedMetadataToConvertedFile(filePath, metadata, coverPath); err != nil {
+		slog.WarnContext(ctx, "Tagging failed", "file", filePath, "error", err)
+	} else {
+		slog.DebugContext(ctx, "Metadata saved", "file", filePath)
+	}
+}
+
+// songLinkPlatformURL asks song.link for the link of a Spotify track on
+// another platform, e.g. "tidal" or "amazonMusic". The lookup counts
+// against the shared song.link budget like every other one.
+func songLinkPlatformURL(ctx context.Context, spotifyTrackID, platform string) (string, error) {
+	slog.DebugContext(ctx, "Looking up track link", "spotify_id", spotifyTrackID, "platform", platform)
+
+	resp, err := NewSongLinkClient().get(ctx, songLinkAPIURL(spotifyTrackID))
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s URL: %w", platform, err)
+	}
+	defer resp.Body.Close()
+
+	var songLinkResp struct {
+		LinksByPlatform map[string]struct {
+			URL string `json:"url"`
+		} `json:"linksByPlatform"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&songLinkResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	link, ok := songLinkResp.LinksByPlatform[platform]
+	if !ok || link.URL == "" {
+		return "", fmt.Errorf("%s link not found", platform)
+	}
+
+	slog.DebugContext(ctx, "Found track link", "platform", platform, "url", link.URL)
+	return link.URL, nil
+}
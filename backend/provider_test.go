@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTrackOutputPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "music")
+	tests := []struct {
+		name    string
+		format  string
+		track   string
+		want    string
+		wantErr bool
+	}{
+		{"preset", "title-artist", "Song", filepath.Join(dir, "Song - Artist.flac"), false},
+		{"template", "{artist} - {title}", "Song", filepath.Join(dir, "Artist - Song.flac"), false},
+		{"separators in the values are sanitized", "{title}", "../../Song", "", false},
+		{"parent directory in the format", "../../{title}", "Song", "", true},
+		{"absolute format stays inside", "/tmp/{title}", "Song", filepath.Join(dir, "tmp", "Song.flac"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := TrackRequest{OutputDir: dir, FilenameFormat: tt.format}
+			r.TrackName, r.ArtistName = tt.track, "Artist"
+
+			got, err := r.outputPath()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("outputPath() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("outputPath() error = %v", err)
+			}
+			if filepath.Dir(got) != dir && tt.want == "" {
+				t.Errorf("outputPath() = %q, want a file in %s", got, dir)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("outputPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,37 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type QobuzDownloader struct {
+// qobuzJumoKind marks Jumo-DL endpoints, which take the track ID, format
+// and region as query parameters and may answer XOR encoded
+const qobuzJumoKind = "jumo"
+
+// qobuzProvider finds tracks on Qobuz by ISRC and downloads FLAC streams
+// through public mirrors
+type qobuzProvider struct {
 	client *http.Client
 	appID  string
+	httpFetcher
+}
+
+func newQobuzProvider() *qobuzProvider {
+	return &qobuzProvider{
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		appID: "798273057",
+	}
 }
 
 type QobuzSearchResponse struct {
@@ -68,20 +84,75 @@ type QobuzStreamResponse struct {
 	URL string `json:"url"`
 }
 
-func NewQobuzDownloader() *QobuzDownloader {
-	return &QobuzDownloader{
-		client: &http.Client{
-			Timeout: 60 * time.Second,
-		},
-		appID: "798273057",
+func (q *qobuzProvider) Name() string { return "qobuz" }
+
+// DefaultEndpoints are the public stream mirrors, where the track ID is
+// appended to the URL, and Jumo-DL as the last resort
+func (q *qobuzProvider) DefaultEndpoints() []Endpoint {
+	var endpoints []Endpoint
+	for _, api := range []string{
+		"https://dab.yeet.su/api/stream?trackId=",
+		"https://dabmusic.xyz/api/stream?trackId=",
+		"https://qobuz.squid.wtf/api/download-music?track_id=",
+	} {
+		endpoints = append(endpoints, Endpoint{URL: api, Weight: 1, Timeout: 60 * time.Second})
+	}
+	return append(endpoints, Endpoint{
+		URL:     "https://jumo-dl.pages.dev",
+		Kind:    qobuzJumoKind,
+		Weight:  0.5,
+		Timeout: 30 * time.Second,
+		Headers: map[string]string{"Referer": "https://jumo-dl.pages.dev/"},
+	})
+}
+
+// Resolve searches Qobuz for the ISRC of ref and asks the mirrors for a
+// stream of the quality code in ref (6, 7 or 27). With AllowFallback the
+// quality steps down 27, 7, 6 until a mirror has it.
+func (q *qobuzProvider) Resolve(ctx context.Context, ref TrackRef) (Candidate, error) {
+	if ref.ISRC == "" {
+		return Candidate{}, fmt.Errorf("qobuz needs the ISRC of the track, which requires a Spotify ID")
 	}
+
+	slog.DebugContext(ctx, "Fetching Qobuz track info", "isrc", ref.ISRC)
+	track, err := q.searchByISRC(ctx, ref.ISRC)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	qualityInfo := "Standard"
+	if track.Hires {
+		qualityInfo = fmt.Sprintf("Hi-Res (%d-bit / %.1f kHz)", track.MaximumBitDepth, track.MaximumSamplingRate)
+	}
+	slog.InfoContext(ctx, "Found Qobuz track", "track", track.Title, "album", track.Album.Title, "quality", qualityInfo)
+
+	streamURL, mirror, quality, err := q.streamURL(ctx, track.ID, ref.Quality, ref.AllowFallback)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("failed to get download URL: %w", err)
+	}
+	if streamURL == "" {
+		return Candidate{}, fmt.Errorf("received empty download URL")
+	}
+
+	return Candidate{
+		Provider: q.Name(),
+		TrackID:  strconv.FormatInt(track.ID, 10),
+		Mirror:   mirror,
+		Quality:  quality,
+		URL:      streamURL,
+		Format:   "flac",
+	}, nil
 }
 
-func (q *QobuzDownloader) searchByISRC(isrc string) (*QobuzTrack, error) {
-	apiBase := "https://www.qobuz.com/api.json/0.2/track/search?query="
-	url := fmt.Sprintf("%s%s&limit=1&app_id=%s", apiBase, isrc, q.appID)
+func (q *qobuzProvider) searchByISRC(ctx context.Context, isrc string) (*QobuzTrack, error) {
+	searchURL := fmt.Sprintf("https://www.qobuz.com/api.json/0.2/track/search?query=%s&limit=1&app_id=%s", url.QueryEscape(isrc), q.appID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	resp, err := q.client.Get(url)
+	resp, err := q.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search track: %w", err)
 	}
@@ -129,45 +200,22 @@ func decodeXOR(data []byte) string {
 	return string(result)
 }
 
-func (q *QobuzDownloader) mapJumoQuality(quality string) int {
+// qobuzQuality maps a requested quality to a Qobuz format code; anything
+// else, such as the Tidal style "LOSSLESS", means 16-bit (6)
+func qobuzQuality(quality string) string {
 	switch quality {
-	case "6":
-		return 6
-	case "7":
-		return 7
-	case "27":
-		return 27
+	case "6", "7", "27":
+		return quality
 	default:
-		return 6
+		return "6"
 	}
 }
 
-func (q *QobuzDownloader) DownloadFromJumo(trackID int64, quality string) (string, error) {
-	formatID := q.mapJumoQuality(quality)
+func (q *qobuzProvider) jumoStreamURL(ctx context.Context, api Endpoint, trackID int64, quality string) (string, error) {
 	region := "US"
-	url := fmt.Sprintf("https://jumo-dl.pages.dev/get?track_id=%d&format_id=%d&region=%s", trackID, formatID, region)
+	jumoURL := fmt.Sprintf("%s/get?track_id=%d&format_id=%s&region=%s", strings.TrimRight(api.URL, "/"), trackID, quality, region)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
-	req.Header.Set("Referer", "https://jumo-dl.pages.dev/")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := api.get(ctx, jumoURL)
 	if err != nil {
 		return "", err
 	}
@@ -191,19 +239,8 @@ func (q *QobuzDownloader) DownloadFromJumo(trackID int64, quality string) (strin
 	return "", fmt.Errorf("URL not found in Jumo response")
 }
 
-func (q *QobuzDownloader) DownloadFromStandard(apiBase string, trackID int64, quality string) (string, error) {
-	apiURL := fmt.Sprintf("%s%d&quality=%s", apiBase, trackID, quality)
-	resp, err := q.client.Get(apiURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("status %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
+func (q *qobuzProvider) standardStreamURL(ctx context.Context, api Endpoint, trackID int64, quality string) (string, error) {
+	body, err := api.get(ctx, fmt.Sprintf("%s%d&quality=%s", api.URL, trackID, quality))
 	if err != nil {
 		return "", err
 	}
@@ -229,337 +266,59 @@ func (q *QobuzDownloader) DownloadFromStandard(apiBase string, trackID int64, qu
 	return "", fmt.Errorf("invalid response")
 }
 
-func (q *QobuzDownloader) GetDownloadURL(trackID int64, quality string, allowFallback bool) (string, error) {
-	qualityCode := quality
-	if qualityCode == "" || qualityCode == "5" {
-		qualityCode = "6"
-	}
-
-	fmt.Printf("Getting download URL for track ID: %d with requested quality: %s\n", trackID, qualityCode)
-
-	standardAPIs := []string{
-		"https://dab.yeet.su/api/stream?trackId=",
-		"https://dabmusic.xyz/api/stream?trackId=",
-		"https://qobuz.squid.wtf/api/download-music?track_id=",
-	}
-
-	downloadFunc := func(qual string) (string, error) {
-		type Provider struct {
-			Name string
-			Func func() (string, error)
-		}
-
-		var providers []Provider
-
-		for _, api := range standardAPIs {
-			currentAPI := api
-			providers = append(providers, Provider{
-				Name: "Standard(" + currentAPI + ")",
-				Func: func() (string, error) {
-					return q.DownloadFromStandard(currentAPI, trackID, qual)
-				},
-			})
-		}
-
-		providers = append(providers, Provider{
-			Name: "Jumo-DL",
-			Func: func() (string, error) {
-				return q.DownloadFromJumo(trackID, qual)
-			},
-		})
+// streamURL asks the mirrors for a stream of trackID and returns it with
+// the mirror that answered and the quality it has
+func (q *qobuzProvider) streamURL(ctx context.Context, trackID int64, quality string, allowFallback bool) (string, string, string, error) {
+	qualityCode := qobuzQuality(quality)
 
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(providers), func(i, j int) { providers[i], providers[j] = providers[j], providers[i] })
+	slog.DebugContext(ctx, "Getting Qobuz download URL", "track_id", trackID, "quality", qualityCode)
 
+	tryMirrors := func(qual string) (string, string, error) {
 		var lastErr error
-		for _, p := range providers {
-
-			fmt.Printf("Trying Provider: %s (Quality: %s)...\n", p.Name, qual)
-
-			url, err := p.Func()
+		for _, api := range rankEndpoints("qobuz", ProviderEndpoints(q.Name())) {
+			label := mirrorLabel(api.URL)
+			slog.DebugContext(ctx, "Trying Qobuz mirror", "mirror", label, "kind", api.Kind, "quality", qual)
+
+			start := time.Now()
+			var streamURL string
+			var err error
+			if api.Kind == qobuzJumoKind {
+				streamURL, err = q.jumoStreamURL(ctx, api, trackID, qual)
+			} else {
+				streamURL, err = q.standardStreamURL(ctx, api, trackID, qual)
+			}
+			observeUpstream("qobuz", label, start, err)
 			if err == nil {
-				fmt.Printf("✓ Success\n")
-				return url, nil
+				slog.DebugContext(ctx, "Qobuz mirror succeeded", "mirror", label)
+				return streamURL, label, nil
 			}
 
-			fmt.Printf("Provider failed: %v\n", err)
+			slog.WarnContext(ctx, "Qobuz mirror failed", "mirror", label, "error", err)
 			lastErr = err
 		}
-		return "", lastErr
-	}
-
-	url, err := downloadFunc(qualityCode)
-	if err == nil {
-		return url, nil
-	}
-
-	currentQuality := qualityCode
-
-	if currentQuality == "27" && allowFallback {
-		fmt.Printf("⚠ Download with quality 27 failed, trying fallback to 7 (24-bit Standard)...\n")
-		url, err := downloadFunc("7")
-		if err == nil {
-			fmt.Println("✓ Success with fallback quality 7")
-			return url, nil
-		}
-
-		currentQuality = "7"
-	}
-
-	if currentQuality == "7" && allowFallback {
-		fmt.Printf("⚠ Download with quality 7 failed, trying fallback to 6 (16-bit Lossless)...\n")
-		url, err := downloadFunc("6")
-		if err == nil {
-			fmt.Println("✓ Success with fallback quality 6")
-			return url, nil
-		}
-	}
-
-	return "", fmt.Errorf("all APIs and fallbacks failed. Last error: %v", err)
-}
-
-func (q *QobuzDownloader) DownloadFile(url, filepath string) error {
-	fmt.Println("Starting file download...")
-
-	downloadClient := &http.Client{
-		Timeout: 5 * time.Minute,
-	}
-
-	resp, err := downloadClient.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
-	}
-
-	fmt.Printf("Creating file: %s\n", filepath)
-	out, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer out.Close()
-
-	fmt.Println("Downloading...")
-
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
-	return nil
-}
-
-func (q *QobuzDownloader) DownloadCoverArt(coverURL, filepath string) error {
-	if coverURL == "" {
-		return fmt.Errorf("no cover URL provided")
-	}
-
-	resp, err := q.client.Get(coverURL)
-	if err != nil {
-		return fmt.Errorf("failed to download cover: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("cover download failed with status %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to create cover file: %w", err)
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
-func buildQobuzFilename(title, artist, album, albumArtist, releaseDate string, trackNumber, discNumber int, format string, includeTrackNumber bool, position int, useAlbumTrackNumber bool) string {
-	var filename string
-
-	numberToUse := position
-	if useAlbumTrackNumber && trackNumber > 0 {
-		numberToUse = trackNumber
-	}
-
-	year := ""
-	if len(releaseDate) >= 4 {
-		year = releaseDate[:4]
-	}
-
-	if strings.Contains(format, "{") {
-		filename = format
-		filename = strings.ReplaceAll(filename, "{title}", title)
-		filename = strings.ReplaceAll(filename, "{artist}", artist)
-		filename = strings.ReplaceAll(filename, "{album}", album)
-		filename = strings.ReplaceAll(filename, "{album_artist}", albumArtist)
-		filename = strings.ReplaceAll(filename, "{year}", year)
-
-		if discNumber > 0 {
-			filename = strings.ReplaceAll(filename, "{disc}", fmt.Sprintf("%d", discNumber))
-		} else {
-			filename = strings.ReplaceAll(filename, "{disc}", "")
-		}
-
-		if numberToUse > 0 {
-			filename = strings.ReplaceAll(filename, "{track}", fmt.Sprintf("%02d", numberToUse))
-		} else {
-
-			filename = regexp.MustCompile(`\{track\}\.\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*-\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*`).ReplaceAllString(filename, "")
-		}
-	} else {
-
-		switch format {
-		case "artist-title":
-			filename = fmt.Sprintf("%s - %s", artist, title)
-		case "title":
-			filename = title
-		default:
-			filename = fmt.Sprintf("%s - %s", title, artist)
-		}
-
-		if includeTrackNumber && position > 0 {
-			filename = fmt.Sprintf("%02d. %s", numberToUse, filename)
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no mirrors available")
 		}
+		return "", "", lastErr
 	}
 
-	return filename + ".flac"
-}
-
-func (q *QobuzDownloader) DownloadTrack(spotifyID, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool) (string, error) {
-	var deezerISRC string
-	if spotifyID != "" {
-		songlinkClient := NewSongLinkClient()
-		isrc, err := songlinkClient.GetISRC(spotifyID)
-		if err != nil {
-			return "", fmt.Errorf("failed to get ISRC: %v", err)
-		}
-		deezerISRC = isrc
-	} else {
-		return "", fmt.Errorf("spotify ID is required for Qobuz download")
+	streamURL, mirror, err := tryMirrors(qualityCode)
+	if err == nil {
+		return streamURL, mirror, qualityCode, nil
 	}
 
-	return q.DownloadTrackWithISRC(deezerISRC, spotifyID, outputDir, quality, filenameFormat, includeTrackNumber, position, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate, useAlbumTrackNumber, spotifyCoverURL, embedMaxQualityCover, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks, spotifyTotalDiscs, spotifyCopyright, spotifyPublisher, spotifyURL, allowFallback, useFirstArtistOnly)
-}
-
-func (q *QobuzDownloader) DownloadTrackWithISRC(deezerISRC, spotifyID, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool) (string, error) {
-	fmt.Printf("Fetching track info for ISRC: %s\n", deezerISRC)
-
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create output directory: %w", err)
+	// Step down one quality at a time: 27 (24-bit Hi-Res), 7 (24-bit
+	// Standard), 6 (16-bit Lossless)
+	for _, fallback := range []struct{ from, to string }{{"27", "7"}, {"7", "6"}} {
+		if !allowFallback || qualityCode != fallback.from {
+			continue
 		}
-	}
-
-	track, err := q.searchByISRC(deezerISRC)
-	if err != nil {
-		return "", err
-	}
-
-	artists := spotifyArtistName
-	trackTitle := spotifyTrackName
-	albumTitle := spotifyAlbumName
-
-	fmt.Printf("Found track: %s - %s\n", artists, trackTitle)
-	fmt.Printf("Album: %s\n", albumTitle)
-
-	qualityInfo := "Standard"
-	if track.Hires {
-		qualityInfo = fmt.Sprintf("Hi-Res (%d-bit / %.1f kHz)", track.MaximumBitDepth, track.MaximumSamplingRate)
-	}
-	fmt.Printf("Quality: %s\n", qualityInfo)
-
-	fmt.Println("Getting download URL...")
-	downloadURL, err := q.GetDownloadURL(track.ID, quality, allowFallback)
-	if err != nil {
-		return "", fmt.Errorf("failed to get download URL: %w", err)
-	}
-
-	if downloadURL == "" {
-		return "", fmt.Errorf("received empty download URL")
-	}
-
-	urlPreview := downloadURL
-	if len(downloadURL) > 60 {
-		urlPreview = downloadURL[:60] + "..."
-	}
-	fmt.Printf("Download URL obtained: %s\n", urlPreview)
-
-	safeArtist := sanitizeFilename(artists)
-	safeAlbumArtist := sanitizeFilename(spotifyAlbumArtist)
-
-	if useFirstArtistOnly {
-		safeArtist = sanitizeFilename(GetFirstArtist(artists))
-		safeAlbumArtist = sanitizeFilename(GetFirstArtist(spotifyAlbumArtist))
-	}
-
-	safeTitle := sanitizeFilename(trackTitle)
-	safeAlbum := sanitizeFilename(albumTitle)
-
-	filename := buildQobuzFilename(safeTitle, safeArtist, safeAlbum, safeAlbumArtist, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	filepath := filepath.Join(outputDir, filename)
-
-	if fileInfo, err := os.Stat(filepath); err == nil && fileInfo.Size() > 0 {
-		fmt.Printf("File already exists: %s (%.2f MB)\n", filepath, float64(fileInfo.Size())/(1024*1024))
-		return "EXISTS:" + filepath, nil
-	}
-
-	fmt.Printf("Downloading FLAC file to: %s\n", filepath)
-	if err := q.DownloadFile(downloadURL, filepath); err != nil {
-		return "", fmt.Errorf("failed to download file: %w", err)
-	}
-
-	fmt.Printf("Downloaded: %s\n", filepath)
-
-	coverPath := ""
-
-	if spotifyCoverURL != "" {
-		coverPath = filepath + ".cover.jpg"
-		coverClient := NewCoverClient()
-		if err := coverClient.DownloadCoverToPath(spotifyCoverURL, coverPath, embedMaxQualityCover); err != nil {
-			fmt.Printf("Warning: Failed to download Spotify cover: %v\n", err)
-			coverPath = ""
-		} else {
-			defer os.Remove(coverPath)
-			fmt.Println("Spotify cover downloaded")
+		slog.InfoContext(ctx, "Qobuz quality unavailable, falling back", "quality", fallback.from, "fallback", fallback.to)
+		qualityCode = fallback.to
+		if streamURL, mirror, err := tryMirrors(qualityCode); err == nil {
+			return streamURL, mirror, qualityCode, nil
 		}
 	}
 
-	fmt.Println("Embedding metadata and cover art...")
-
-	trackNumberToEmbed := spotifyTrackNumber
-	if trackNumberToEmbed == 0 {
-		trackNumberToEmbed = 1
-	}
-
-	metadata := Metadata{
-		Title:       trackTitle,
-		Artist:      artists,
-		Album:       albumTitle,
-		AlbumArtist: spotifyAlbumArtist,
-		Date:        spotifyReleaseDate,
-		TrackNumber: trackNumberToEmbed,
-		TotalTracks: spotifyTotalTracks,
-		DiscNumber:  spotifyDiscNumber,
-		TotalDiscs:  spotifyTotalDiscs,
-		URL:         spotifyURL,
-		Copyright:   spotifyCopyright,
-		Publisher:   spotifyPublisher,
-		Description: "https://github.com/afkarxyz/SpotiFLAC",
-		ISRC:        deezerISRC,
-	}
-
-	if err := EmbedMetadata(filepath, metadata, coverPath); err != nil {
-		return "", fmt.Errorf("failed to embed metadata: %w", err)
-	}
-
-	fmt.Println("Metadata embedded successfully!")
-	return filepath, nil
+	return "", "", "", fmt.Errorf("all APIs and fallbacks failed. Last error: %v", err)
 }
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	downloadQueueBucket   = "DownloadQueue"
+	downloadBatchesBucket = "DownloadBatches"
+)
+
+// queueRecord is the persisted form of a queue item. Request holds the full
+// download payload so the item can be resumed after a restart.
+type queueRecord struct {
+	Seq     uint64          `json:"seq"`
+	Item    DownloadItem    `json:"item"`
+	Request DownloadRequest `json:"request"`
+	// PartBase is where the partial files of the item go, see
+	// rememberPartBase
+	PartBase string `json:"part_base,omitempty"`
+}
+
+// saveQueuedDownload stores a freshly queued request together with its
+// queue item. Only items stored here are tracked by updateQueueRecord.
+func saveQueuedDownload(req DownloadRequest, item DownloadItem) error {
+	if historyDB == nil {
+		return nil
+	}
+	return historyDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(downloadQueueBucket))
+		if err != nil {
+			return err
+		}
+		seq, _ := b.NextSequence()
+
+		buf, err := json.Marshal(queueRecord{Seq: seq, Item: item, Request: req})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(item.ID), buf)
+	})
+}
+
+// updateQueueRecord writes the current state of an item that was stored by
+// saveQueuedDownload. Items queued without a payload (the desktop app adds
+// them directly through AddToQueue) are not persisted. The item is read
+// inside the write transaction, so concurrent updates cannot store an
+// older state last. Must not be called with downloadQueueLock held.
+func updateQueueRecord(id string) {
+	if historyDB == nil {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadQueueBucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		item, ok := GetDownloadItem(id)
+		if !ok {
+			// Removed meanwhile, deleteQueueRecords drops the record
+			return nil
+		}
+
+		var record queueRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		record.Item = item
+
+		buf, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), buf)
+	})
+	if err != nil {
+		slog.Error("Failed to persist queue item", "item_id", id, "error", err)
+	}
+}
+
+// setQueuePartBase records where the partial files of a persisted item go
+func setQueuePartBase(id, base string) {
+	if historyDB == nil {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadQueueBucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+
+		var record queueRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		record.PartBase = base
+
+		buf, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), buf)
+	})
+	if err != nil {
+		slog.Error("Failed to persist queue item", "item_id", id, "error", err)
+	}
+}
+
+// deleteQueueRecords removes the given items from the persisted queue
+func deleteQueueRecords(ids []string) {
+	if historyDB == nil || len(ids) == 0 {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadQueueBucket))
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to delete persisted queue items", "error", err)
+	}
+}
+
+func loadQueueRecords() ([]queueRecord, error) {
+	var records []queueRecord
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadQueueBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var record queueRecord
+			if err := json.Unmarshal(v, &record); err == nil {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	return records, err
+}
+
+func saveDownloadBatch(batch DownloadBatch) {
+	if historyDB == nil {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(downloadBatchesBucket))
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(batch.ID), buf)
+	})
+	if err != nil {
+		slog.Error("Failed to persist batch", "batch_id", batch.ID, "error", err)
+	}
+}
+
+func deleteDownloadBatch(id string) {
+	if historyDB == nil {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadBatchesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		slog.Error("Failed to delete persisted download batch", "batch_id", id, "error", err)
+	}
+}
+
+func loadDownloadBatches() ([]DownloadBatch, error) {
+	var batches []DownloadBatch
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(downloadBatchesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var batch DownloadBatch
+			if err := json.Unmarshal(v, &batch); err == nil {
+				batches = append(batches, batch)
+			}
+			return nil
+		})
+	})
+	return batches, err
+}
+
+// RestoreDownloadQueue loads the persisted queue into memory. Items that
+// were downloading when the process stopped are re-queued, queued items are
+// handed back to the download workers and finished or paused items are kept
+// so they can still be retried or resumed. Must be called after
+// InitHistoryDB and before StartDownloadWorkers.
+func RestoreDownloadQueue() (int, error) {
+	if historyDB == nil {
+		return 0, fmt.Errorf("history database not initialized")
+	}
+
+	records, err := loadQueueRecords()
+	if err != nil {
+		return 0, err
+	}
+
+	batches, err := loadDownloadBatches()
+	if err != nil {
+		return 0, err
+	}
+
+	downloadBatchesLock.Lock()
+	for i := range batches {
+		batch := batches[i]
+		downloadBatches[batch.ID] = &batch
+	}
+	downloadBatchesLock.Unlock()
+
+	resumed := 0
+	for _, record := range records {
+		item := record.Item
+		interrupted := item.Status == StatusDownloading
+		if interrupted {
+			item.Status = StatusQueued
+			item.Progress = 0
+			if record.PartBase != "" {
+				item.Progress = float64(resumableSize(record.PartBase)) / (1024 * 1024)
+			}
+			item.Speed = 0
+			item.StartTime = 0
+		}
+
+		restoreQueueItem(item)
+		if interrupted {
+			updateQueueRecord(item.ID)
+		}
+
+		record.Request.ItemID = item.ID
+		pendingDownloadsLock.Lock()
+		downloadRequests[item.ID] = record.Request
+		if record.PartBase != "" {
+			partBases[item.ID] = record.PartBase
+		}
+		if item.Status == StatusQueued {
+			pendingDownloads = append(pendingDownloads, record.Request)
+			resumed++
+		}
+		pendingDownloadsLock.Unlock()
+	}
+
+	// Batches whose items all finished before the restart still need
+	// their playlist written
+	for _, batch := range batches {
+		finishBatchIfDone(batch.ID)
+	}
+
+	if resumed > 0 {
+		pendingCond.Broadcast()
+	}
+
+	return resumed, nil
+}
@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+// initTestHistoryDB opens a fresh history database below a temporary home
+// directory and closes it when the test ends
+func initTestHistoryDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := InitHistoryDB("SpotiFLAC"); err != nil {
+		t.Fatalf("InitHistoryDB() error = %v", err)
+	}
+	t.Cleanup(func() {
+		CloseHistoryDB()
+		historyDB = nil
+	})
+}
+
+// resetDownloadQueue empties the queue and the pending requests when the
+// test ends
+func resetDownloadQueue(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		ClearAllDownloads("")
+		pendingDownloadsLock.Lock()
+		pendingDownloads = nil
+		pendingDownloadsLock.Unlock()
+	})
+}
+
+// forgetQueue drops the in-memory queue like a restart would, leaving the
+// persisted records alone
+func forgetQueue() {
+	downloadQueueLock.Lock()
+	downloadQueue = []DownloadItem{}
+	lastProgressEvent = map[string]time.Time{}
+	downloadQueueLock.Unlock()
+
+	pendingDownloadsLock.Lock()
+	pendingDownloads = nil
+	downloadRequests = map[string]DownloadRequest{}
+	partBases = map[string]string{}
+	pendingDownloadsLock.Unlock()
+}
+
+func isPending(id string) bool {
+	pendingDownloadsLock.Lock()
+	defer pendingDownloadsLock.Unlock()
+	for _, req := range pendingDownloads {
+		if req.ItemID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRestoreDownloadQueue(t *testing.T) {
+	initTestHistoryDB(t)
+	resetDownloadQueue(t)
+
+	queued := EnqueueDownload(DownloadRequest{ItemID: "queued", Service: "tidal", TrackName: "Queued"})
+	running := EnqueueDownload(DownloadRequest{ItemID: "running", Service: "qobuz", TrackName: "Running"})
+	paused := EnqueueDownload(DownloadRequest{ItemID: "paused", Service: "tidal", TrackName: "Paused"})
+	done := EnqueueDownload(DownloadRequest{ItemID: "done", Service: "tidal", TrackName: "Done"})
+	AddToQueue("direct", "Direct", "Artist", "Album", "")
+
+	claimQueuedItem(running)
+	rememberPartBase(running, "/music/Artist - Running")
+	if err := PauseDownloadItem(paused); err != nil {
+		t.Fatalf("PauseDownloadItem() error = %v", err)
+	}
+	CompleteDownloadItem(done, "/music/Artist - Done.flac", "tidal", 10)
+
+	forgetQueue()
+	resumed, err := RestoreDownloadQueue()
+	if err != nil {
+		t.Fatalf("RestoreDownloadQueue() error = %v", err)
+	}
+	if resumed != 2 {
+		t.Errorf("resumed = %d, want 2", resumed)
+	}
+
+	tests := []struct {
+		id      string
+		status  DownloadStatus
+		pending bool
+	}{
+		{queued, StatusQueued, true},
+		{running, StatusQueued, true},
+		{paused, StatusPaused, false},
+		{done, StatusCompleted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			status, ok := GetDownloadItemStatus(tt.id)
+			if !ok || status != tt.status {
+				t.Fatalf("status = %q (found %v), want %q", status, ok, tt.status)
+			}
+			if isPending(tt.id) != tt.pending {
+				t.Errorf("pending = %v, want %v", !tt.pending, tt.pending)
+			}
+			if !hasDownloadRequest(tt.id) {
+				t.Error("request not restored")
+			}
+		})
+	}
+
+	if _, ok := GetDownloadItem("direct"); ok {
+		t.Error("item queued without a request was persisted")
+	}
+	if got := GetDownloadQueue().Queue; len(got) != 4 || got[0].ID != queued || got[3].ID != done {
+		t.Errorf("restored queue order is wrong: %+v", got)
+	}
+	pendingDownloadsLock.Lock()
+	base := partBases[running]
+	pendingDownloadsLock.Unlock()
+	if base != "/music/Artist - Running" {
+		t.Errorf("part base = %q, want it restored", base)
+	}
+
+	// Removed items stay removed after the next restart
+	ClearAllDownloads("")
+	forgetQueue()
+	if resumed, _ := RestoreDownloadQueue(); resumed != 0 {
+		t.Errorf("resumed = %d after clearing the queue, want 0", resumed)
+	}
+}
@@ -0,0 +1,321 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Streams are fetched into "<file>.<format>.part" next to the final file.
+// The sidecar "<file>.<format>.part.json" checkpoints which stream the part
+// belongs to and, for DASH, how many segments are complete, so a paused,
+// failed or interrupted download continues where it stopped instead of
+// starting from zero.
+const (
+	partSuffix       = ".part"
+	checkpointSuffix = ".part.json"
+)
+
+// streamRetries is how often an interrupted transfer is resumed before the
+// attempt fails, see SetStreamRetries
+var streamRetries = 3
+
+// errStreamChanged means the bytes on disk do not belong to the stream the
+// mirror serves now, so the transfer starts over
+var errStreamChanged = errors.New("stream changed since the partial download")
+
+// SetStreamRetries sets how often a transfer cut off by a network error is
+// resumed from the bytes already written before the attempt fails
+func SetStreamRetries(retries int) {
+	if retries >= 0 {
+		streamRetries = retries
+	}
+}
+
+// partCheckpoint identifies the stream a .part file holds and how far it
+// got. Stream URLs are signed and change with every resolve, so the track,
+// quality and format identify the stream instead.
+type partCheckpoint struct {
+	Provider string `json:"provider"`
+	TrackID  string `json:"track_id"`
+	Quality  string `json:"quality,omitempty"`
+	Format   string `json:"format"`
+	// Size is the length of a single-URL stream, once a mirror told it
+	Size int64 `json:"size,omitempty"`
+	// Segments is the number of DASH segments, SegmentsDone how many of
+	// them are complete and Offset the length of the file after them
+	Segments     int   `json:"segments,omitempty"`
+	SegmentsDone int   `json:"segments_done,omitempty"`
+	Offset       int64 `json:"offset,omitempty"`
+	Updated      int64 `json:"updated"`
+}
+
+// matches reports whether the checkpoint was written for candidate c
+func (cp partCheckpoint) matches(c Candidate) bool {
+	return cp.Provider == c.Provider && cp.TrackID == c.TrackID && cp.Quality == c.Quality &&
+		cp.Format == c.Format && cp.Segments == len(c.Segments)
+}
+
+// PartFile is the partial file a provider fetches a stream into. Writes
+// append at Offset, which is where a previous attempt stopped when the
+// download was resumed.
+type PartFile struct {
+	path       string
+	file       *os.File
+	progress   *ProgressWriter
+	offset     int64
+	checkpoint partCheckpoint
+}
+
+// openPartFile opens the .part file of candidate c next to base. A part
+// left by an earlier attempt at the same stream is continued, anything
+// else there is overwritten.
+func openPartFile(ctx context.Context, c Candidate, base string, job downloadJob) (*PartFile, error) {
+	path := base + "." + c.Format + partSuffix
+	fresh := partCheckpoint{
+		Provider: c.Provider,
+		TrackID:  c.TrackID,
+		Quality:  c.Quality,
+		Format:   c.Format,
+		Segments: len(c.Segments),
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	p := &PartFile{path: path, file: file, checkpoint: fresh}
+	p.progress = job.progressWriter(file)
+
+	offset := p.resumableOffset(c)
+	if offset > 0 {
+		slog.InfoContext(ctx, "Resuming partial download", "file", path, "mb", float64(offset)/(1024*1024), "segments_done", p.checkpoint.SegmentsDone)
+	}
+	if err := p.truncate(offset); err != nil {
+		p.file.Close()
+		return nil, err
+	}
+	if err := p.save(); err != nil {
+		p.file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// resumableOffset loads the checkpoint of an earlier attempt and returns
+// how many bytes of the part file can be kept. DASH parts are cut back to
+// the last complete segment; single-URL parts keep every byte written,
+// since they are a prefix of the stream.
+func (p *PartFile) resumableOffset(c Candidate) int64 {
+	data, err := os.ReadFile(p.checkpointPath())
+	if err != nil {
+		return 0
+	}
+	var cp partCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil || !cp.matches(c) {
+		return 0
+	}
+	info, err := p.file.Stat()
+	if err != nil {
+		return 0
+	}
+
+	offset := info.Size()
+	if cp.Segments > 0 {
+		if cp.SegmentsDone > cp.Segments || cp.Offset > offset {
+			return 0
+		}
+		offset = cp.Offset
+	} else if cp.Size > 0 && offset > cp.Size {
+		return 0
+	}
+	cp.Offset = offset
+	p.checkpoint = cp
+	return offset
+}
+
+// Write appends to the part file and reports the bytes as progress
+func (p *PartFile) Write(b []byte) (int, error) {
+	n, err := p.progress.Write(b)
+	p.offset += int64(n)
+	return n, err
+}
+
+// Offset is the number of bytes in the part file
+func (p *PartFile) Offset() int64 {
+	return p.offset
+}
+
+// truncate cuts the part file to offset and continues writing there
+func (p *PartFile) truncate(offset int64) error {
+	if err := p.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+	if _, err := p.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek partial file: %w", err)
+	}
+	p.offset = offset
+	p.progress.resumeAt(offset)
+	if offset == 0 {
+		p.checkpoint.Size, p.checkpoint.SegmentsDone, p.checkpoint.Offset = 0, 0, 0
+	}
+	return nil
+}
+
+// setSize records the length of a single-URL stream. A different length
+// than the one recorded before means the bytes on disk belong to another
+// stream.
+func (p *PartFile) setSize(size int64) error {
+	if size <= 0 || size == p.checkpoint.Size {
+		return nil
+	}
+	if p.checkpoint.Size != 0 {
+		return errStreamChanged
+	}
+	p.checkpoint.Size = size
+	return p.save()
+}
+
+// segmentDone checkpoints the first done segments as complete
+func (p *PartFile) segmentDone(done int) error {
+	p.checkpoint.SegmentsDone = done
+	p.checkpoint.Offset = p.offset
+	return p.save()
+}
+
+// save writes the checkpoint sidecar
+func (p *PartFile) save() error {
+	p.checkpoint.Updated = time.Now().Unix()
+	data, err := json.Marshal(p.checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p.checkpointPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write download checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (p *PartFile) checkpointPath() string {
+	return strings.TrimSuffix(p.path, partSuffix) + checkpointSuffix
+}
+
+// close closes the part file, keeping it and its checkpoint for a later
+// resume
+func (p *PartFile) close() error {
+	return p.file.Close()
+}
+
+// discard removes the part file and its checkpoint
+func (p *PartFile) discard() {
+	os.Remove(p.path)
+	os.Remove(p.checkpointPath())
+}
+
+// IsPartialDownload reports whether name is a part file or checkpoint of a
+// download that has not finished. Listings and archives leave them out.
+func IsPartialDownload(name string) bool {
+	return strings.HasSuffix(name, partSuffix) || strings.HasSuffix(name, checkpointSuffix)
+}
+
+// removePartFiles deletes the part files and checkpoints an item may have
+// left next to base, the path of its file without extension
+func removePartFiles(base string) {
+	for _, format := range []string{"flac", "m4a"} {
+		path := base + "." + format
+		os.Remove(path + partSuffix)
+		os.Remove(path + checkpointSuffix)
+	}
+}
+
+// resumableSize returns how many bytes of the partial files at base, the
+// path of an item's file without extension, a resume can keep. Parts
+// without a checkpoint are started over; DASH parts are cut back to their
+// last complete segment.
+func resumableSize(base string) int64 {
+	var size int64
+	for _, format := range []string{"flac", "m4a"} {
+		path := base + "." + format
+		info, err := os.Stat(path + partSuffix)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path + checkpointSuffix)
+		if err != nil {
+			continue
+		}
+		var cp partCheckpoint
+		if err := json.Unmarshal(data, &cp); err != nil {
+			continue
+		}
+
+		kept := info.Size()
+		if cp.Segments > 0 {
+			kept = min(kept, cp.Offset)
+		}
+		size = max(size, kept)
+	}
+	return size
+}
+
+// parseContentRange reads the start and total length of a
+// "bytes start-end/total" header; total is -1 when the server sent "*"
+func parseContentRange(header string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	byteRange, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	first, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if size == "*" {
+		return start, -1, true
+	}
+	total, err = strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// retryStream runs fetch until it succeeds, fails for good or ran out of
+// retries. Only interruptions are retried: network errors, timeouts,
+// server errors, truncated bodies and streams that changed under us.
+func retryStream(ctx context.Context, part *PartFile, fetch func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fetch()
+		if err == nil || ctx.Err() != nil || attempt >= streamRetries || !streamInterrupted(err) {
+			return err
+		}
+
+		delay := time.Duration(attempt+1) * time.Second
+		slog.WarnContext(ctx, "Transfer interrupted, resuming", "mb", float64(part.Offset())/(1024*1024), "retry", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// streamInterrupted reports whether a failed transfer is worth resuming
+func streamInterrupted(err error) bool {
+	return mirrorFault(err) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errStreamChanged)
+}
@@ -0,0 +1,341 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantTotal int64
+		wantOK    bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-0/1", 0, 1, true},
+		{"bytes 100-199/*", 100, -1, true},
+		{"", 0, 0, false},
+		{"items 100-199/1000", 0, 0, false},
+		{"bytes 100-199", 0, 0, false},
+		{"bytes 100/1000", 0, 0, false},
+		{"bytes x-199/1000", 0, 0, false},
+		{"bytes 100-199/x", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, total, ok := parseContentRange(tt.header)
+			if start != tt.wantStart || total != tt.wantTotal || ok != tt.wantOK {
+				t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v",
+					tt.header, start, total, ok, tt.wantStart, tt.wantTotal, tt.wantOK)
+			}
+		})
+	}
+}
+
+func testCandidate(segments int) Candidate {
+	c := Candidate{Provider: "tidal", TrackID: "42", Quality: "LOSSLESS", Format: "flac"}
+	for i := 0; i < segments; i++ {
+		c.Segments = append(c.Segments, fmt.Sprintf("segment-%d", i))
+	}
+	return c
+}
+
+// leavePart writes data into the part file of c like an interrupted
+// attempt would, then lets checkpoint adjust the sidecar
+func leavePart(t *testing.T, c Candidate, base string, data []byte, checkpoint func(p *PartFile) error) {
+	t.Helper()
+	p, err := openPartFile(context.Background(), c, base, downloadJob{})
+	if err != nil {
+		t.Fatalf("openPartFile() error = %v", err)
+	}
+	defer p.close()
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != nil {
+		if err := checkpoint(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func partContents(t *testing.T, p *PartFile) []byte {
+	t.Helper()
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestResumableOffset(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 150)
+
+	tests := []struct {
+		name       string
+		previous   Candidate
+		checkpoint func(p *PartFile) error
+		current    Candidate
+		want       int64
+	}{
+		{"no earlier attempt", testCandidate(0), nil, testCandidate(0), 0},
+		{"stream keeps every byte", testCandidate(0), func(p *PartFile) error { return p.setSize(1000) }, testCandidate(0), 150},
+		{"stream without known size", testCandidate(0), func(p *PartFile) error { return p.save() }, testCandidate(0), 150},
+		{"part longer than the stream", testCandidate(0), func(p *PartFile) error { return p.setSize(100) }, testCandidate(0), 0},
+		{"other quality", testCandidate(0), func(p *PartFile) error { return p.setSize(1000) },
+			Candidate{Provider: "tidal", TrackID: "42", Quality: "HI_RES", Format: "flac"}, 0},
+		{"other track", testCandidate(0), func(p *PartFile) error { return p.setSize(1000) },
+			Candidate{Provider: "tidal", TrackID: "43", Quality: "LOSSLESS", Format: "flac"}, 0},
+		{"dash cut back to the last segment", testCandidate(3), func(p *PartFile) error {
+			if err := p.truncate(100); err != nil {
+				return err
+			}
+			if err := p.segmentDone(1); err != nil {
+				return err
+			}
+			_, err := p.Write(data[:50])
+			return err
+		}, testCandidate(3), 100},
+		{"dash with other segment count", testCandidate(3), func(p *PartFile) error { return p.segmentDone(1) }, testCandidate(4), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "track")
+			if tt.checkpoint != nil {
+				leavePart(t, tt.previous, base, data, tt.checkpoint)
+			} else {
+				os.WriteFile(base+".flac"+partSuffix, data, 0644)
+			}
+
+			p, err := openPartFile(context.Background(), tt.current, base, downloadJob{})
+			if err != nil {
+				t.Fatalf("openPartFile() error = %v", err)
+			}
+			defer p.close()
+
+			if p.Offset() != tt.want {
+				t.Errorf("Offset() = %d, want %d", p.Offset(), tt.want)
+			}
+			if got := int64(len(partContents(t, p))); got != tt.want {
+				t.Errorf("part file has %d bytes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumableSize(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 150)
+
+	tests := []struct {
+		name       string
+		current    Candidate
+		checkpoint func(p *PartFile) error
+		want       int64
+	}{
+		{"no part", testCandidate(0), nil, 0},
+		{"stream", testCandidate(0), func(p *PartFile) error { return p.setSize(1000) }, 150},
+		{"dash cut back to the last segment", testCandidate(3), func(p *PartFile) error {
+			if err := p.truncate(100); err != nil {
+				return err
+			}
+			if err := p.segmentDone(1); err != nil {
+				return err
+			}
+			_, err := p.Write(data[:50])
+			return err
+		}, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "track")
+			if tt.checkpoint != nil {
+				leavePart(t, tt.current, base, data, tt.checkpoint)
+			}
+			if got := resumableSize(base); got != tt.want {
+				t.Errorf("resumableSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("part without checkpoint", func(t *testing.T) {
+		base := filepath.Join(t.TempDir(), "track")
+		os.WriteFile(base+".flac"+partSuffix, data, 0644)
+		if got := resumableSize(base); got != 0 {
+			t.Errorf("resumableSize() = %d, want 0", got)
+		}
+	})
+}
+
+func TestFetchStreamResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	modified := time.Unix(1700000000, 0)
+	var ranges []string
+	var rangesLock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangesLock.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		rangesLock.Unlock()
+		switch r.URL.Path {
+		case "/ranged":
+			http.ServeContent(w, r, "track.flac", modified, bytes.NewReader(content))
+		case "/whole":
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content)
+		case "/changed":
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", 300, 1999, 2000))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		wantRange string
+	}{
+		{"range request continues the part", "/ranged", "bytes=300-"},
+		{"mirror without ranges replaces the part", "/whole", "bytes=300-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges = nil
+			c := testCandidate(0)
+			base := filepath.Join(t.TempDir(), "track")
+			leavePart(t, c, base, content[:300], func(p *PartFile) error { return p.setSize(int64(len(content))) })
+
+			p, err := openPartFile(context.Background(), c, base, downloadJob{})
+			if err != nil {
+				t.Fatalf("openPartFile() error = %v", err)
+			}
+			defer p.close()
+			if err := fetchStream(context.Background(), server.URL+tt.path, p); err != nil {
+				t.Fatalf("fetchStream() error = %v", err)
+			}
+
+			if !bytes.Equal(partContents(t, p), content) {
+				t.Error("part file differs from the stream")
+			}
+			if len(ranges) != 1 || ranges[0] != tt.wantRange {
+				t.Errorf("requested ranges = %q, want [%q]", ranges, tt.wantRange)
+			}
+		})
+	}
+
+	t.Run("complete part is not fetched again", func(t *testing.T) {
+		ranges = nil
+		c := testCandidate(0)
+		base := filepath.Join(t.TempDir(), "track")
+		leavePart(t, c, base, content, func(p *PartFile) error { return p.setSize(int64(len(content))) })
+
+		p, _ := openPartFile(context.Background(), c, base, downloadJob{})
+		defer p.close()
+		if err := fetchStream(context.Background(), server.URL+"/ranged", p); err != nil {
+			t.Fatalf("fetchStream() error = %v", err)
+		}
+		if len(ranges) != 0 {
+			t.Errorf("requested ranges = %q, want none", ranges)
+		}
+	})
+
+	t.Run("other stream length starts over", func(t *testing.T) {
+		c := testCandidate(0)
+		base := filepath.Join(t.TempDir(), "track")
+		leavePart(t, c, base, content[:300], func(p *PartFile) error { return p.setSize(int64(len(content))) })
+
+		p, _ := openPartFile(context.Background(), c, base, downloadJob{})
+		defer p.close()
+		err := fetchStream(context.Background(), server.URL+"/changed", p)
+		if !errors.Is(err, errStreamChanged) {
+			t.Fatalf("fetchStream() error = %v, want %v", err, errStreamChanged)
+		}
+		if p.Offset() != 0 || len(partContents(t, p)) != 0 {
+			t.Errorf("part kept %d bytes of the old stream", p.Offset())
+		}
+		if !streamInterrupted(err) {
+			t.Error("changed stream is not retried")
+		}
+	})
+}
+
+func TestSegmentResume(t *testing.T) {
+	segments := []string{"first segment,", "second segment,", "third segment"}
+	var requested []string
+	var requestedLock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedLock.Lock()
+		requested = append(requested, r.URL.Path)
+		requestedLock.Unlock()
+		var i int
+		fmt.Sscanf(r.URL.Path, "/segment/%d", &i)
+		io.WriteString(w, segments[i])
+	}))
+	defer server.Close()
+
+	c := testCandidate(0)
+	for i := range segments {
+		c.Segments = append(c.Segments, fmt.Sprintf("%s/segment/%d", server.URL, i))
+	}
+	base := filepath.Join(t.TempDir(), "track")
+
+	// The first attempt finished one segment and broke off in the second
+	leavePart(t, c, base, []byte(segments[0]), func(p *PartFile) error {
+		if err := p.segmentDone(1); err != nil {
+			return err
+		}
+		_, err := p.Write([]byte("second seg"))
+		return err
+	})
+
+	p, err := openPartFile(context.Background(), c, base, downloadJob{})
+	if err != nil {
+		t.Fatalf("openPartFile() error = %v", err)
+	}
+	defer p.close()
+	if err := (httpFetcher{}).Fetch(context.Background(), c, p); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if got, want := string(partContents(t, p)), strings.Join(segments, ""); got != want {
+		t.Errorf("part file = %q, want %q", got, want)
+	}
+	if want := []string{"/segment/1", "/segment/2"}; strings.Join(requested, " ") != strings.Join(want, " ") {
+		t.Errorf("requested = %v, want %v", requested, want)
+	}
+	if p.checkpoint.SegmentsDone != len(segments) {
+		t.Errorf("SegmentsDone = %d, want %d", p.checkpoint.SegmentsDone, len(segments))
+	}
+}
+
+func TestStreamInterrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &upstreamStatusError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", &upstreamStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"truncated body", fmt.Errorf("download interrupted: %w", io.ErrUnexpectedEOF), true},
+		{"stream changed", errStreamChanged, true},
+		{"not found", &upstreamStatusError{StatusCode: http.StatusNotFound}, false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamInterrupted(tt.err); got != tt.want {
+				t.Errorf("streamInterrupted(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,74 @@
 package backend
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
 type SongLinkClient struct {
-	client           *http.Client
-	lastAPICallTime  time.Time
-	apiCallCount     int
-	apiCallResetTime time.Time
+	client *http.Client
+}
+
+// songLinkLimiter keeps the song.link lookups of all clients within the
+// API's budget: nine per minute, at least seven seconds apart. Downloads,
+// availability checks and streaming URL lookups each create their own
+// client, so the budget cannot live in one.
+var songLinkLimiter = &songLinkBudget{resetTime: time.Now()}
+
+type songLinkBudget struct {
+	mu        sync.Mutex
+	lastCall  time.Time
+	count     int
+	resetTime time.Time
+}
+
+// wait reserves the next slot of the budget and blocks until it is due or
+// ctx is done. The slot is taken under the lock, the wait happens outside
+// of it, so waiting callers queue up in slots instead of behind each other.
+func (b *songLinkBudget) wait(ctx context.Context) error {
+	const minDelay = 7 * time.Second
+
+	b.mu.Lock()
+	at := time.Now()
+	if !b.lastCall.IsZero() && at.Sub(b.lastCall) < minDelay {
+		at = b.lastCall.Add(minDelay)
+	}
+	if at.Sub(b.resetTime) >= time.Minute {
+		b.count = 0
+		b.resetTime = at
+	}
+	if b.count >= 9 {
+		at = b.resetTime.Add(time.Minute)
+		b.count = 0
+		b.resetTime = at
+	}
+	b.lastCall = at
+	b.count++
+	b.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	slog.DebugContext(ctx, "song.link rate limiting, waiting", "wait", delay.Round(time.Second))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 type SongLinkURLs struct {
@@ -39,83 +92,70 @@ func NewSongLinkClient() *SongLinkClient {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		apiCallResetTime: time.Now(),
 	}
 }
 
-func (s *SongLinkClient) GetAllURLsFromSpotify(spotifyTrackID string, region string) (*SongLinkURLs, error) {
-
-	now := time.Now()
-	if now.Sub(s.apiCallResetTime) >= time.Minute {
-		s.apiCallCount = 0
-		s.apiCallResetTime = now
-	}
-
-	if s.apiCallCount >= 9 {
-		waitTime := time.Minute - now.Sub(s.apiCallResetTime)
-		if waitTime > 0 {
-			fmt.Printf("Rate limit reached, waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-			s.apiCallCount = 0
-			s.apiCallResetTime = time.Now()
-		}
-	}
-
-	if !s.lastAPICallTime.IsZero() {
-		timeSinceLastCall := now.Sub(s.lastAPICallTime)
-		minDelay := 7 * time.Second
-		if timeSinceLastCall < minDelay {
-			waitTime := minDelay - timeSinceLastCall
-			fmt.Printf("Rate limiting: waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-		}
-	}
-
+// songLinkAPIURL is the song.link lookup of a Spotify track
+func songLinkAPIURL(spotifyTrackID string) string {
 	spotifyBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9vcGVuLnNwb3RpZnkuY29tL3RyYWNrLw==")
 	spotifyURL := fmt.Sprintf("%s%s", string(spotifyBase), spotifyTrackID)
 
 	apiBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9hcGkuc29uZy5saW5rL3YxLWFscGhhLjEvbGlua3M/dXJsPQ==")
-	apiURL := fmt.Sprintf("%s%s", string(apiBase), url.QueryEscape(spotifyURL))
-
-	if region != "" {
-		apiURL += fmt.Sprintf("&userCountry=%s", region)
-	}
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	return fmt.Sprintf("%s%s", string(apiBase), url.QueryEscape(spotifyURL))
+}
 
-	fmt.Println("Getting streaming URLs from song.link...")
+// get requests apiURL within the shared song.link budget and retries when
+// song.link throttles us anyway. The caller closes the body of the
+// returned 200 response.
+func (s *SongLinkClient) get(ctx context.Context, apiURL string) (*http.Response, error) {
+	const maxRetries = 3
+	for i := 0; ; i++ {
+		if err := songLinkLimiter.wait(ctx); err != nil {
+			return nil, err
+		}
 
-	maxRetries := 3
-	var resp *http.Response
-	for i := 0; i < maxRetries; i++ {
-		resp, err = s.client.Do(req)
+		req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get URLs: %w", err)
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
 		}
 
-		s.lastAPICallTime = time.Now()
-		s.apiCallCount++
-
-		if resp.StatusCode == 429 {
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
 			resp.Body.Close()
-			if i < maxRetries-1 {
-				waitTime := 15 * time.Second
-				fmt.Printf("Rate limited by API, waiting %v before retry...\n", waitTime)
-				time.Sleep(waitTime)
-				continue
+			if i >= maxRetries-1 {
+				return nil, fmt.Errorf("API rate limit exceeded after %d retries", maxRetries)
 			}
-			return nil, fmt.Errorf("API rate limit exceeded after %d retries", maxRetries)
-		}
-
-		if resp.StatusCode != 200 {
+			waitTime := 15 * time.Second
+			slog.WarnContext(ctx, "Rate limited by song.link, waiting before retry", "wait", waitTime)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(waitTime):
+			}
+		case resp.StatusCode != http.StatusOK:
 			resp.Body.Close()
 			return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		default:
+			return resp, nil
 		}
+	}
+}
 
-		break
+func (s *SongLinkClient) GetAllURLsFromSpotify(ctx context.Context, spotifyTrackID string, region string) (*SongLinkURLs, error) {
+	apiURL := songLinkAPIURL(spotifyTrackID)
+	if region != "" {
+		apiURL += fmt.Sprintf("&userCountry=%s", region)
+	}
+
+	slog.DebugContext(ctx, "Getting streaming URLs from song.link", "spotify_id", spotifyTrackID)
+
+	resp, err := s.get(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URLs: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -147,7 +187,7 @@ func (s *SongLinkClient) GetAllURLsFromSpotify(spotifyTrackID string, region str
 
 	if tidalLink, ok := songLinkResp.LinksByPlatform["tidal"]; ok && tidalLink.URL != "" {
 		urls.TidalURL = tidalLink.URL
-		fmt.Printf("✓ Tidal URL found\n")
+		slog.Debug("Tidal URL found", "spotify_id", spotifyTrackID)
 	}
 
 	if amazonLink, ok := songLinkResp.LinksByPlatform["amazonMusic"]; ok && amazonLink.URL != "" {
@@ -155,7 +195,7 @@ func (s *SongLinkClient) GetAllURLsFromSpotify(spotifyTrackID string, region str
 
 		if len(amazonURL) > 0 {
 			urls.AmazonURL = amazonURL
-			fmt.Printf("✓ Amazon URL found\n")
+			slog.Debug("Amazon URL found", "spotify_id", spotifyTrackID)
 		}
 	}
 
@@ -172,75 +212,12 @@ func (s *SongLinkClient) GetAllURLsFromSpotify(spotifyTrackID string, region str
 	return urls, nil
 }
 
-func (s *SongLinkClient) CheckTrackAvailability(spotifyTrackID string) (*TrackAvailability, error) {
+func (s *SongLinkClient) CheckTrackAvailability(ctx context.Context, spotifyTrackID string) (*TrackAvailability, error) {
+	slog.DebugContext(ctx, "Checking availability for track", "spotify_id", spotifyTrackID)
 
-	now := time.Now()
-	if now.Sub(s.apiCallResetTime) >= time.Minute {
-		s.apiCallCount = 0
-		s.apiCallResetTime = now
-	}
-
-	if s.apiCallCount >= 9 {
-		waitTime := time.Minute - now.Sub(s.apiCallResetTime)
-		if waitTime > 0 {
-			fmt.Printf("Rate limit reached, waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-			s.apiCallCount = 0
-			s.apiCallResetTime = time.Now()
-		}
-	}
-
-	if !s.lastAPICallTime.IsZero() {
-		timeSinceLastCall := now.Sub(s.lastAPICallTime)
-		minDelay := 7 * time.Second
-		if timeSinceLastCall < minDelay {
-			waitTime := minDelay - timeSinceLastCall
-			fmt.Printf("Rate limiting: waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-		}
-	}
-
-	spotifyBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9vcGVuLnNwb3RpZnkuY29tL3RyYWNrLw==")
-	spotifyURL := fmt.Sprintf("%s%s", string(spotifyBase), spotifyTrackID)
-
-	apiBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9hcGkuc29uZy5saW5rL3YxLWFscGhhLjEvbGlua3M/dXJsPQ==")
-	apiURL := fmt.Sprintf("%s%s", string(apiBase), url.QueryEscape(spotifyURL))
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+	resp, err := s.get(ctx, songLinkAPIURL(spotifyTrackID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	fmt.Printf("Checking availability for track: %s\n", spotifyTrackID)
-
-	maxRetries := 3
-	var resp *http.Response
-	for i := 0; i < maxRetries; i++ {
-		resp, err = s.client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check availability: %w", err)
-		}
-
-		s.lastAPICallTime = time.Now()
-		s.apiCallCount++
-
-		if resp.StatusCode == 429 {
-			resp.Body.Close()
-			if i < maxRetries-1 {
-				waitTime := 15 * time.Second
-				fmt.Printf("Rate limited by API, waiting %v before retry...\n", waitTime)
-				time.Sleep(waitTime)
-				continue
-			}
-			return nil, fmt.Errorf("API rate limit exceeded after %d retries", maxRetries)
-		}
-
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
-		}
-
-		break
+		return nil, fmt.Errorf("failed to check availability: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -324,75 +301,12 @@ func checkQobuzAvailability(isrc string) bool {
 	return searchResp.Tracks.Total > 0
 }
 
-func (s *SongLinkClient) GetDeezerURLFromSpotify(spotifyTrackID string) (string, error) {
+func (s *SongLinkClient) GetDeezerURLFromSpotify(ctx context.Context, spotifyTrackID string) (string, error) {
+	slog.DebugContext(ctx, "Getting Deezer URL from song.link", "spotify_id", spotifyTrackID)
 
-	now := time.Now()
-	if now.Sub(s.apiCallResetTime) >= time.Minute {
-		s.apiCallCount = 0
-		s.apiCallResetTime = now
-	}
-
-	if s.apiCallCount >= 9 {
-		waitTime := time.Minute - now.Sub(s.apiCallResetTime)
-		if waitTime > 0 {
-			fmt.Printf("Rate limit reached, waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-			s.apiCallCount = 0
-			s.apiCallResetTime = time.Now()
-		}
-	}
-
-	if !s.lastAPICallTime.IsZero() {
-		timeSinceLastCall := now.Sub(s.lastAPICallTime)
-		minDelay := 7 * time.Second
-		if timeSinceLastCall < minDelay {
-			waitTime := minDelay - timeSinceLastCall
-			fmt.Printf("Rate limiting: waiting %v...\n", waitTime.Round(time.Second))
-			time.Sleep(waitTime)
-		}
-	}
-
-	spotifyBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9vcGVuLnNwb3RpZnkuY29tL3RyYWNrLw==")
-	spotifyURL := fmt.Sprintf("%s%s", string(spotifyBase), spotifyTrackID)
-
-	apiBase, _ := base64.StdEncoding.DecodeString("aHR0cHM6Ly9hcGkuc29uZy5saW5rL3YxLWFscGhhLjEvbGlua3M/dXJsPQ==")
-	apiURL := fmt.Sprintf("%s%s", string(apiBase), url.QueryEscape(spotifyURL))
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+	resp, err := s.get(ctx, songLinkAPIURL(spotifyTrackID))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	fmt.Println("Getting Deezer URL from song.link...")
-
-	maxRetries := 3
-	var resp *http.Response
-	for i := 0; i < maxRetries; i++ {
-		resp, err = s.client.Do(req)
-		if err != nil {
-			return "", fmt.Errorf("failed to get Deezer URL: %w", err)
-		}
-
-		s.lastAPICallTime = time.Now()
-		s.apiCallCount++
-
-		if resp.StatusCode == 429 {
-			resp.Body.Close()
-			if i < maxRetries-1 {
-				waitTime := 15 * time.Second
-				fmt.Printf("Rate limited by API, waiting %v before retry...\n", waitTime)
-				time.Sleep(waitTime)
-				continue
-			}
-			return "", fmt.Errorf("API rate limit exceeded after %d retries", maxRetries)
-		}
-
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			return "", fmt.Errorf("API returned status %d", resp.StatusCode)
-		}
-
-		break
+		return "", fmt.Errorf("failed to get Deezer URL: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -411,7 +325,7 @@ func (s *SongLinkClient) GetDeezerURLFromSpotify(spotifyTrackID string) (string,
 	}
 
 	deezerURL := deezerLink.URL
-	fmt.Printf("Found Deezer URL: %s\n", deezerURL)
+	slog.Debug("Found Deezer URL", "url", deezerURL)
 	return deezerURL, nil
 }
 
@@ -456,12 +370,12 @@ func getDeezerISRC(deezerURL string) (string, error) {
 		return "", fmt.Errorf("ISRC not found in Deezer API response for track %s", trackID)
 	}
 
-	fmt.Printf("Found ISRC from Deezer: %s (track: %s)\n", deezerTrack.ISRC, deezerTrack.Title)
+	slog.Debug("Found ISRC from Deezer", "isrc", deezerTrack.ISRC, "track", deezerTrack.Title)
 	return deezerTrack.ISRC, nil
 }
 
-func (s *SongLinkClient) GetISRC(spotifyID string) (string, error) {
-	deezerURL, err := s.GetDeezerURLFromSpotify(spotifyID)
+func (s *SongLinkClient) GetISRC(ctx context.Context, spotifyID string) (string, error) {
+	deezerURL, err := s.GetDeezerURLFromSpotify(ctx, spotifyID)
 	if err != nil {
 		return "", err
 	}
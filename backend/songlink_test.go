@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSongLinkBudget(t *testing.T) {
+	b := &songLinkBudget{resetTime: time.Now()}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The first request is due at once
+	if err := b.wait(cancelled); err != nil {
+		t.Fatalf("first wait() error = %v", err)
+	}
+	first := b.lastCall
+
+	// Later ones reserve the next free slot and give up with their context
+	// without holding up the others
+	for i := 1; i <= 3; i++ {
+		start := time.Now()
+		if err := b.wait(cancelled); !errors.Is(err, context.Canceled) {
+			t.Fatalf("wait() error = %v, want %v", err, context.Canceled)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("cancelled wait() took %v", elapsed)
+		}
+		if want := first.Add(time.Duration(i) * 7 * time.Second); !b.lastCall.Equal(want) {
+			t.Errorf("slot %d at %v, want %v", i, b.lastCall.Sub(first), want.Sub(first))
+		}
+	}
+	if b.count != 4 {
+		t.Errorf("count = %d, want 4", b.count)
+	}
+}
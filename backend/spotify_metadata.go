@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -343,8 +344,11 @@ type SearchResponse struct {
 }
 
 func GetFilteredSpotifyData(ctx context.Context, spotifyURL string, batch bool, delay time.Duration) (interface{}, error) {
+	start := time.Now()
 	client := NewSpotifyMetadataClient()
-	return client.GetFilteredData(ctx, spotifyURL, batch, delay)
+	data, err := client.GetFilteredData(ctx, spotifyURL, batch, delay)
+	observeSpotifyMetadata("fetch", start, err)
+	return data, err
 }
 
 func (c *SpotifyMetadataClient) GetFilteredData(ctx context.Context, spotifyURL string, batch bool, delay time.Duration) (interface{}, error) {
@@ -1083,7 +1087,7 @@ func (c *SpotifyMetadataClient) formatArtistDiscographyData(ctx context.Context,
 
 			albumData, err := c.fetchAlbumWithClient(ctx, sharedClient, albumID)
 			if err != nil {
-				fmt.Printf("Error getting tracks for album %s: %v\n", albumName, err)
+				slog.WarnContext(ctx, "Error getting tracks for album", "album", albumName, "error", err)
 				resultsChan <- fetchResult{tracks: []AlbumTrackMetadata{}}
 				return
 			}
@@ -1360,8 +1364,11 @@ func (c *SpotifyMetadataClient) Search(ctx context.Context, query string, limit
 }
 
 func SearchSpotify(ctx context.Context, query string, limit int) (*SearchResponse, error) {
+	start := time.Now()
 	client := NewSpotifyMetadataClient()
-	return client.Search(ctx, query, limit)
+	response, err := client.Search(ctx, query, limit)
+	observeSpotifyMetadata("search", start, err)
+	return response, err
 }
 
 func (c *SpotifyMetadataClient) SearchByType(ctx context.Context, query string, searchType string, limit int, offset int) ([]SearchResult, error) {
@@ -1477,8 +1484,11 @@ func (c *SpotifyMetadataClient) SearchByType(ctx context.Context, query string,
 }
 
 func SearchSpotifyByType(ctx context.Context, query string, searchType string, limit int, offset int) ([]SearchResult, error) {
+	start := time.Now()
 	client := NewSpotifyMetadataClient()
-	return client.SearchByType(ctx, query, searchType, limit, offset)
+	results, err := client.SearchByType(ctx, query, searchType, limit, offset)
+	observeSpotifyMetadata("search_by_type", start, err)
+	return results, err
 }
 
 func GetPreviewURL(trackID string) (string, error) {
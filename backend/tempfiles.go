@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Temporary files written next to downloads (the .tmp.m4a ffmpeg writes
+// while embedding metadata, the dec_ file during decryption) are tracked
+// while in use, so RemoveTempFiles can delete what an aborted download
+// leaves behind. Stream .part files are not tracked, they are kept for
+// resuming (see PartFile).
+var (
+	tempFiles     = map[string]struct{}{}
+	tempFilesLock sync.Mutex
+)
+
+// trackTempFile registers path until untrackTempFile is called
+func trackTempFile(path string) {
+	tempFilesLock.Lock()
+	tempFiles[path] = struct{}{}
+	tempFilesLock.Unlock()
+}
+
+func untrackTempFile(path string) {
+	tempFilesLock.Lock()
+	delete(tempFiles, path)
+	tempFilesLock.Unlock()
+}
+
+// RemoveTempFiles deletes all tracked temporary files and returns how many
+// were removed. Called on shutdown after the downloads have stopped.
+func RemoveTempFiles() int {
+	tempFilesLock.Lock()
+	defer tempFilesLock.Unlock()
+
+	removed := 0
+	for path := range tempFiles {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			removed++
+		case !errors.Is(err, fs.ErrNotExist):
+			slog.Warn("Failed to remove temporary file", "file", path, "error", err)
+		}
+		delete(tempFiles, path)
+	}
+	return removed
+}
@@ -1,27 +1,30 @@
 package backend
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"io"
-	"math/rand"
-	"net/http"
-	"net/url"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"log/slog"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type TidalDownloader struct {
-	client     *http.Client
-	timeout    time.Duration
-	maxRetries int
-	apiURL     string
+// tidalAPITimeout bounds one request to a Tidal proxy
+const tidalAPITimeout = 15 * time.Second
+
+// tidalProvider downloads from Tidal through public proxy APIs. Lossless
+// streams arrive as FLAC, hi-res ones as DASH segments that are converted
+// to FLAC.
+type tidalProvider struct {
+	httpFetcher
+}
+
+func newTidalProvider() *tidalProvider {
+	return &tidalProvider{}
 }
 
 type TidalAPIResponse struct {
@@ -50,682 +53,119 @@ type TidalBTSManifest struct {
 	URLs           []string `json:"urls"`
 }
 
-func NewTidalDownloader(apiURL string) *TidalDownloader {
-	if apiURL == "" {
-		downloader := &TidalDownloader{
-			client: &http.Client{
-				Timeout: 5 * time.Second,
-			},
-			timeout:    5 * time.Second,
-			maxRetries: 3,
-			apiURL:     "",
-		}
+func (t *tidalProvider) Name() string { return "tidal" }
 
-		apis, err := downloader.GetAvailableAPIs()
-		if err == nil && len(apis) > 0 {
-			apiURL = apis[0]
-		}
-	}
-
-	return &TidalDownloader{
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		timeout:    5 * time.Second,
-		maxRetries: 3,
-		apiURL:     apiURL,
-	}
-}
-
-func (t *TidalDownloader) GetAvailableAPIs() ([]string, error) {
-	apis := []string{
+// DefaultEndpoints are the public Tidal proxies
+func (t *tidalProvider) DefaultEndpoints() []Endpoint {
+	var endpoints []Endpoint
+	for _, api := range []string{
 		"https://triton.squid.wtf",
 		"https://hifi-one.spotisaver.net",
 		"https://hifi-two.spotisaver.net",
 		"https://tidal.kinoplus.online",
 		"https://tidal-api.binimum.org",
+	} {
+		endpoints = append(endpoints, Endpoint{URL: api, Weight: 1, Timeout: tidalAPITimeout})
 	}
-	return apis, nil
-}
-
-func (t *TidalDownloader) GetTidalURLFromSpotify(spotifyTrackID string) (string, error) {
-
-	spotifyBase := "https://open.spotify.com/track/"
-	spotifyURL := fmt.Sprintf("%s%s", spotifyBase, spotifyTrackID)
-
-	apiBase := "https://api.song.link/v1-alpha.1/links?url="
-	apiURL := fmt.Sprintf("%s%s", apiBase, url.QueryEscape(spotifyURL))
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
-
-	fmt.Println("Getting Tidal URL...")
-
-	resp, err := t.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to get Tidal URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
-
-	var songLinkResp struct {
-		LinksByPlatform map[string]struct {
-			URL string `json:"url"`
-		} `json:"linksByPlatform"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&songLinkResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	tidalLink, ok := songLinkResp.LinksByPlatform["tidal"]
-	if !ok || tidalLink.URL == "" {
-		return "", fmt.Errorf("tidal link not found")
-	}
-
-	tidalURL := tidalLink.URL
-	fmt.Printf("Found Tidal URL: %s\n", tidalURL)
-	return tidalURL, nil
-}
-
-func (t *TidalDownloader) GetTrackIDFromURL(tidalURL string) (int64, error) {
-
-	parts := strings.Split(tidalURL, "/track/")
-	if len(parts) < 2 {
-		return 0, fmt.Errorf("invalid tidal URL format")
-	}
-
-	trackIDStr := strings.Split(parts[1], "?")[0]
-	trackIDStr = strings.TrimSpace(trackIDStr)
-
-	var trackID int64
-	_, err := fmt.Sscanf(trackIDStr, "%d", &trackID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse track ID: %w", err)
-	}
-
-	return trackID, nil
+	return endpoints
 }
 
-func (t *TidalDownloader) GetDownloadURL(trackID int64, quality string) (string, error) {
-	fmt.Println("Fetching URL...")
-
-	url := fmt.Sprintf("%s/track/?id=%d&quality=%s", t.apiURL, trackID, quality)
-	fmt.Printf("Tidal API URL: %s\n", url)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("✗ failed to create request: %v\n", err)
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
-
-	resp, err := t.client.Do(req)
-	if err != nil {
-		fmt.Printf("✗ Tidal API request failed: %v\n", err)
-		return "", fmt.Errorf("failed to get download URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		fmt.Printf("✗ Tidal API returned status code: %d\n", resp.StatusCode)
-		return "", fmt.Errorf("API returned status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("✗ Failed to read response body: %v\n", err)
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	var v2Response TidalAPIResponseV2
-	if err := json.Unmarshal(body, &v2Response); err == nil && v2Response.Data.Manifest != "" {
-		fmt.Println("✓ Tidal manifest found (v2 API)")
-		return "MANIFEST:" + v2Response.Data.Manifest, nil
-	}
-
-	var apiResponses []TidalAPIResponse
-	if err := json.Unmarshal(body, &apiResponses); err != nil {
-
-		bodyStr := string(body)
-		if len(bodyStr) > 200 {
-			bodyStr = bodyStr[:200] + "..."
-		}
-		fmt.Printf("✗ Failed to decode Tidal API response: %v (response: %s)\n", err, bodyStr)
-		return "", fmt.Errorf("failed to decode response: %w (response: %s)", err, bodyStr)
-	}
-
-	if len(apiResponses) == 0 {
-		fmt.Println("✗ Tidal API returned empty response")
-		return "", fmt.Errorf("no download URL in response")
-	}
-
-	for _, item := range apiResponses {
-		if item.OriginalTrackURL != "" {
-			fmt.Println("✓ Tidal download URL found")
-			return item.OriginalTrackURL, nil
+// Resolve finds the Tidal track through song.link unless ref carries a
+// Tidal URL, then asks the mirrors for a stream. HI_RES falls back to
+// LOSSLESS when allowed.
+func (t *tidalProvider) Resolve(ctx context.Context, ref TrackRef) (Candidate, error) {
+	tidalURL := ref.ServiceURL
+	if tidalURL == "" {
+		if ref.SpotifyID == "" {
+			return Candidate{}, fmt.Errorf("spotify ID or Tidal URL is required")
+		}
+		var err error
+		tidalURL, err = songLinkPlatformURL(ctx, ref.SpotifyID, "tidal")
+		if err != nil {
+			return Candidate{}, fmt.Errorf("songlink couldn't find Tidal URL: %w", err)
 		}
 	}
 
-	fmt.Println("✗ No valid download URL in Tidal API response")
-	return "", fmt.Errorf("download URL not found in response")
-}
-
-func (t *TidalDownloader) DownloadFile(url, filepath string) error {
-
-	if strings.HasPrefix(url, "MANIFEST:") {
-		return t.DownloadFromManifest(strings.TrimPrefix(url, "MANIFEST:"), filepath)
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
+	slog.DebugContext(ctx, "Using Tidal URL", "url", tidalURL)
+	trackID, err := tidalTrackID(tidalURL)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return Candidate{}, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
-
-	resp, err := t.client.Do(req)
-
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+	apis := ProviderEndpoints(t.Name())
+	if ref.APIURL != "" && ref.APIURL != "auto" {
+		apis = []Endpoint{{URL: ref.APIURL, Weight: 1, Timeout: tidalAPITimeout}}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	quality := ref.Quality
+	if quality == "" {
+		quality = "LOSSLESS"
 	}
 
-	out, err := os.Create(filepath)
+	api, streamURL, err := getDownloadURLRotated(ctx, apis, trackID, quality)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer out.Close()
-
-	pw := NewProgressWriter(out)
-	_, err = io.Copy(pw, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
-
-	fmt.Println("Download complete")
-	return nil
-}
-
-func (t *TidalDownloader) DownloadFromManifest(manifestB64, outputPath string) error {
-	directURL, initURL, mediaURLs, mimeType, err := parseManifest(manifestB64)
-	if err != nil {
-		return fmt.Errorf("failed to parse manifest: %w", err)
-	}
-
-	client := &http.Client{
-		Timeout: 120 * time.Second,
-	}
-
-	doRequest := func(url string) (*http.Response, error) {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36")
-		return client.Do(req)
-	}
-
-	if directURL != "" && (strings.Contains(strings.ToLower(mimeType), "flac") || mimeType == "") {
-		fmt.Println("Downloading file...")
-
-		resp, err := doRequest(directURL)
-		if err != nil {
-			return fmt.Errorf("failed to download file: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("download failed with status %d", resp.StatusCode)
-		}
-
-		out, err := os.Create(outputPath)
-		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
+		if quality != "HI_RES" || !ref.AllowFallback {
+			return Candidate{}, err
 		}
-		defer out.Close()
-
-		pw := NewProgressWriter(out)
-		_, err = io.Copy(pw, resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to write file: %w", err)
-		}
-
-		fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
-		fmt.Println("Download complete")
-		return nil
-	}
-
-	tempPath := outputPath + ".m4a.tmp"
-
-	if directURL != "" {
-		fmt.Printf("Downloading non-FLAC file (%s)...\n", mimeType)
-
-		resp, err := doRequest(directURL)
-		if err != nil {
-			return fmt.Errorf("failed to download file: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("download failed with status %d", resp.StatusCode)
-		}
-
-		out, err := os.Create(tempPath)
-		if err != nil {
-			return fmt.Errorf("failed to create temp file: %w", err)
-		}
-
-		pw := NewProgressWriter(out)
-		_, err = io.Copy(pw, resp.Body)
-		out.Close()
-
+		slog.InfoContext(ctx, "HI_RES unavailable on all APIs, falling back to LOSSLESS")
+		quality = "LOSSLESS"
+		api, streamURL, err = getDownloadURLRotated(ctx, apis, trackID, quality)
 		if err != nil {
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to write temp file: %w", err)
-		}
-
-		fmt.Printf("\rDownloaded: %.2f MB (Complete)\n", float64(pw.GetTotal())/(1024*1024))
-
-	} else {
-
-		fmt.Printf("Downloading %d segments...\n", len(mediaURLs)+1)
-
-		out, err := os.Create(tempPath)
-		if err != nil {
-			return fmt.Errorf("failed to create temp file: %w", err)
-		}
-
-		fmt.Print("Downloading init segment... ")
-		resp, err := doRequest(initURL)
-		if err != nil {
-			out.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to download init segment: %w", err)
-		}
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			out.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("init segment download failed with status %d", resp.StatusCode)
-		}
-		_, err = io.Copy(out, resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			out.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to write init segment: %w", err)
-		}
-		fmt.Println("OK")
-
-		totalSegments := len(mediaURLs)
-		var totalBytes int64
-		lastTime := time.Now()
-		var lastBytes int64
-		for i, mediaURL := range mediaURLs {
-			resp, err := doRequest(mediaURL)
-			if err != nil {
-				out.Close()
-				os.Remove(tempPath)
-				return fmt.Errorf("failed to download segment %d: %w", i+1, err)
-			}
-			if resp.StatusCode != 200 {
-				resp.Body.Close()
-				out.Close()
-				os.Remove(tempPath)
-				return fmt.Errorf("segment %d download failed with status %d", i+1, resp.StatusCode)
-			}
-			n, err := io.Copy(out, resp.Body)
-			totalBytes += n
-			resp.Body.Close()
-			if err != nil {
-				out.Close()
-				os.Remove(tempPath)
-				return fmt.Errorf("failed to write segment %d: %w", i+1, err)
-			}
-
-			mbDownloaded := float64(totalBytes) / (1024 * 1024)
-			now := time.Now()
-			timeDiff := now.Sub(lastTime).Seconds()
-			var speedMBps float64
-			if timeDiff > 0.1 {
-				bytesDiff := float64(totalBytes - lastBytes)
-				speedMBps = (bytesDiff / (1024 * 1024)) / timeDiff
-				SetDownloadSpeed(speedMBps)
-				lastTime = now
-				lastBytes = totalBytes
-			}
-			SetDownloadProgress(mbDownloaded)
-
-			fmt.Printf("\rDownloading: %.2f MB (%d/%d segments)", mbDownloaded, i+1, totalSegments)
+			return Candidate{}, fmt.Errorf("failed to get download URL (HI_RES & LOSSLESS both failed): %w", err)
 		}
-
-		out.Close()
-
-		tempInfo, _ := os.Stat(tempPath)
-		fmt.Printf("\rDownloaded: %.2f MB (Complete)          \n", float64(tempInfo.Size())/(1024*1024))
 	}
 
-	fmt.Println("Converting to FLAC...")
-	ffmpegPath, err := GetFFmpegPath()
-	if err != nil {
-		return fmt.Errorf("ffmpeg not found: %w", err)
-	}
-
-	if err := ValidateExecutable(ffmpegPath); err != nil {
-		return fmt.Errorf("invalid ffmpeg executable: %w", err)
+	candidate := Candidate{
+		Provider: t.Name(),
+		TrackID:  strconv.FormatInt(trackID, 10),
+		Mirror:   mirrorLabel(api),
+		Quality:  quality,
+		URL:      streamURL,
+		Format:   "flac",
 	}
 
-	cmd := exec.Command(ffmpegPath, "-y", "-i", tempPath, "-vn", "-c:a", "flac", outputPath)
-	setHideWindow(cmd)
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-
-		m4aPath := strings.TrimSuffix(outputPath, ".flac") + ".m4a"
-		os.Rename(tempPath, m4aPath)
-		return fmt.Errorf("ffmpeg conversion failed (M4A saved as %s): %w - %s", m4aPath, err, stderr.String())
+	manifest, ok := strings.CutPrefix(streamURL, "MANIFEST:")
+	if !ok {
+		return candidate, nil
 	}
 
-	os.Remove(tempPath)
-	fmt.Println("Download complete")
-
-	return nil
-}
-
-func (t *TidalDownloader) DownloadByURL(tidalURL, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool) (string, error) {
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("directory error: %w", err)
-		}
-	}
-
-	fmt.Printf("Using Tidal URL: %s\n", tidalURL)
-
-	trackID, err := t.GetTrackIDFromURL(tidalURL)
+	directURL, initURL, mediaURLs, mimeType, err := parseManifest(manifest)
 	if err != nil {
-		return "", err
-	}
-
-	if trackID == 0 {
-		return "", fmt.Errorf("no track ID found")
-	}
-
-	artistName := spotifyArtistName
-	trackTitle := spotifyTrackName
-	albumTitle := spotifyAlbumName
-
-	artistNameForFile := sanitizeFilename(artistName)
-	albumArtistForFile := sanitizeFilename(spotifyAlbumArtist)
-
-	if useFirstArtistOnly {
-		artistNameForFile = sanitizeFilename(GetFirstArtist(artistName))
-		albumArtistForFile = sanitizeFilename(GetFirstArtist(spotifyAlbumArtist))
-	}
-
-	trackTitleForFile := sanitizeFilename(trackTitle)
-	albumTitleForFile := sanitizeFilename(albumTitle)
-
-	filename := buildTidalFilename(trackTitleForFile, artistNameForFile, albumTitleForFile, albumArtistForFile, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	outputFilename := filepath.Join(outputDir, filename)
-
-	if fileInfo, err := os.Stat(outputFilename); err == nil && fileInfo.Size() > 0 {
-		fmt.Printf("File already exists: %s (%.2f MB)\n", outputFilename, float64(fileInfo.Size())/(1024*1024))
-		return "EXISTS:" + outputFilename, nil
-	}
-
-	downloadURL, err := t.GetDownloadURL(trackID, quality)
-	if err != nil {
-		if quality == "HI_RES" && allowFallback {
-			fmt.Println("⚠ HI_RES unavailable/failed, falling back to LOSSLESS...")
-			downloadURL, err = t.GetDownloadURL(trackID, "LOSSLESS")
-			if err != nil {
-				return "", fmt.Errorf("failed to get download URL (HI_RES & LOSSLESS both failed): %w", err)
-			}
-		} else {
-			return "", err
-		}
-	}
-
-	isrcChan := make(chan string, 1)
-	if spotifyURL != "" {
-		go func() {
-			var isrc string
-			parts := strings.Split(spotifyURL, "/")
-			if len(parts) > 0 {
-				sID := strings.Split(parts[len(parts)-1], "?")[0]
-				if sID != "" {
-					client := NewSongLinkClient()
-					if val, err := client.GetISRC(sID); err == nil {
-						isrc = val
-					}
-				}
-			}
-			isrcChan <- isrc
-		}()
-	} else {
-		close(isrcChan)
-	}
-
-	fmt.Printf("Downloading to: %s\n", outputFilename)
-	if err := t.DownloadFile(downloadURL, outputFilename); err != nil {
-		return "", err
-	}
-
-	var isrc string
-	if spotifyURL != "" {
-		isrc = <-isrcChan
-	}
-
-	fmt.Println("Adding metadata...")
-
-	coverPath := ""
-
-	if spotifyCoverURL != "" {
-		coverPath = outputFilename + ".cover.jpg"
-		coverClient := NewCoverClient()
-		if err := coverClient.DownloadCoverToPath(spotifyCoverURL, coverPath, embedMaxQualityCover); err != nil {
-			fmt.Printf("Warning: Failed to download Spotify cover: %v\n", err)
-			coverPath = ""
-		} else {
-			defer os.Remove(coverPath)
-			fmt.Println("Spotify cover downloaded")
-		}
-	}
-
-	trackNumberToEmbed := spotifyTrackNumber
-	if trackNumberToEmbed == 0 {
-		trackNumberToEmbed = 1
-	}
-
-	metadata := Metadata{
-		Title:       trackTitle,
-		Artist:      artistName,
-		Album:       albumTitle,
-		AlbumArtist: spotifyAlbumArtist,
-		Date:        spotifyReleaseDate,
-		TrackNumber: trackNumberToEmbed,
-		TotalTracks: spotifyTotalTracks,
-		DiscNumber:  spotifyDiscNumber,
-		TotalDiscs:  spotifyTotalDiscs,
-		URL:         spotifyURL,
-		Copyright:   spotifyCopyright,
-		Publisher:   spotifyPublisher,
-		Description: "https://github.com/afkarxyz/SpotiFLAC",
-		ISRC:        isrc,
-	}
-
-	if err := EmbedMetadata(outputFilename, metadata, coverPath); err != nil {
-		fmt.Printf("Tagging failed: %v\n", err)
-	} else {
-		fmt.Println("Metadata saved")
-	}
-
-	fmt.Println("Done")
-	fmt.Println("✓ Downloaded successfully from Tidal")
-	return outputFilename, nil
+		return Candidate{}, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	switch {
+	case directURL != "" && (strings.Contains(strings.ToLower(mimeType), "flac") || mimeType == ""):
+		candidate.URL = directURL
+	case directURL != "":
+		candidate.URL = directURL
+		candidate.Format = "m4a"
+		candidate.ConvertToFLAC = true
+	default:
+		candidate.URL = ""
+		candidate.Segments = append([]string{initURL}, mediaURLs...)
+		candidate.Format = "m4a"
+		candidate.ConvertToFLAC = true
+	}
+	return candidate, nil
 }
 
-func (t *TidalDownloader) DownloadByURLWithFallback(tidalURL, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool) (string, error) {
-	apis, err := t.GetAvailableAPIs()
-	if err != nil {
-		return "", fmt.Errorf("no APIs available for fallback: %w", err)
-	}
-
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return "", fmt.Errorf("directory error: %w", err)
-		}
+// tidalTrackID extracts the numeric track ID from a Tidal track URL
+func tidalTrackID(tidalURL string) (int64, error) {
+	parts := strings.Split(tidalURL, "/track/")
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("invalid tidal URL format")
 	}
 
-	fmt.Printf("Using Tidal URL: %s\n", tidalURL)
-
-	trackID, err := t.GetTrackIDFromURL(tidalURL)
+	trackIDStr := strings.TrimSpace(strings.Split(parts[1], "?")[0])
+	trackID, err := strconv.ParseInt(trackIDStr, 10, 64)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("failed to parse track ID: %w", err)
 	}
-
 	if trackID == 0 {
-		return "", fmt.Errorf("no track ID found")
-	}
-
-	artistName := spotifyArtistName
-	trackTitle := spotifyTrackName
-	albumTitle := spotifyAlbumName
-
-	artistNameForFile := sanitizeFilename(artistName)
-	albumArtistForFile := sanitizeFilename(spotifyAlbumArtist)
-
-	if useFirstArtistOnly {
-		artistNameForFile = sanitizeFilename(GetFirstArtist(artistName))
-		albumArtistForFile = sanitizeFilename(GetFirstArtist(spotifyAlbumArtist))
-	}
-
-	trackTitleForFile := sanitizeFilename(trackTitle)
-	albumTitleForFile := sanitizeFilename(albumTitle)
-
-	filename := buildTidalFilename(trackTitleForFile, artistNameForFile, albumTitleForFile, albumArtistForFile, spotifyReleaseDate, spotifyTrackNumber, spotifyDiscNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	outputFilename := filepath.Join(outputDir, filename)
-
-	if fileInfo, err := os.Stat(outputFilename); err == nil && fileInfo.Size() > 0 {
-		fmt.Printf("File already exists: %s (%.2f MB)\n", outputFilename, float64(fileInfo.Size())/(1024*1024))
-		return "EXISTS:" + outputFilename, nil
-	}
-
-	successAPI, downloadURL, err := getDownloadURLRotated(apis, trackID, quality)
-	if err != nil {
-		if quality == "HI_RES" && allowFallback {
-			fmt.Println("⚠ HI_RES unavailable/failed on all APIs, falling back to LOSSLESS...")
-			successAPI, downloadURL, err = getDownloadURLRotated(apis, trackID, "LOSSLESS")
-			if err != nil {
-				return "", fmt.Errorf("failed to get download URL (HI_RES & LOSSLESS both failed): %w", err)
-			}
-		} else {
-			return "", err
-		}
-	}
-
-	isrcChan := make(chan string, 1)
-	if spotifyURL != "" {
-		go func() {
-			var isrc string
-			parts := strings.Split(spotifyURL, "/")
-			if len(parts) > 0 {
-				sID := strings.Split(parts[len(parts)-1], "?")[0]
-				if sID != "" {
-					client := NewSongLinkClient()
-					if val, err := client.GetISRC(sID); err == nil {
-						isrc = val
-					}
-				}
-			}
-			isrcChan <- isrc
-		}()
-	} else {
-		close(isrcChan)
-	}
-
-	fmt.Printf("Downloading to: %s\n", outputFilename)
-	downloader := NewTidalDownloader(successAPI)
-	if err := downloader.DownloadFile(downloadURL, outputFilename); err != nil {
-		return "", err
-	}
-
-	var isrc string
-	if spotifyURL != "" {
-		isrc = <-isrcChan
-	}
-
-	fmt.Println("Adding metadata...")
-
-	coverPath := ""
-
-	if spotifyCoverURL != "" {
-		coverPath = outputFilename + ".cover.jpg"
-		coverClient := NewCoverClient()
-		if err := coverClient.DownloadCoverToPath(spotifyCoverURL, coverPath, embedMaxQualityCover); err != nil {
-			fmt.Printf("Warning: Failed to download Spotify cover: %v\n", err)
-			coverPath = ""
-		} else {
-			defer os.Remove(coverPath)
-			fmt.Println("Spotify cover downloaded")
-		}
-	}
-
-	trackNumberToEmbed := spotifyTrackNumber
-	if trackNumberToEmbed == 0 {
-		trackNumberToEmbed = 1
-	}
-
-	metadata := Metadata{
-		Title:       trackTitle,
-		Artist:      artistName,
-		Album:       albumTitle,
-		AlbumArtist: spotifyAlbumArtist,
-		Date:        spotifyReleaseDate,
-		TrackNumber: trackNumberToEmbed,
-		TotalTracks: spotifyTotalTracks,
-		DiscNumber:  spotifyDiscNumber,
-		TotalDiscs:  spotifyTotalDiscs,
-		URL:         spotifyURL,
-		Copyright:   spotifyCopyright,
-		Publisher:   spotifyPublisher,
-		Description: "https://github.com/afkarxyz/SpotiFLAC",
-		ISRC:        isrc,
-	}
-
-	if err := EmbedMetadata(outputFilename, metadata, coverPath); err != nil {
-		fmt.Printf("Tagging failed: %v\n", err)
-	} else {
-		fmt.Println("Metadata saved")
-	}
-
-	fmt.Println("Done")
-	fmt.Println("✓ Downloaded successfully from Tidal")
-	return outputFilename, nil
-}
-
-func (t *TidalDownloader) Download(spotifyTrackID, outputDir, quality, filenameFormat string, includeTrackNumber bool, position int, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate string, useAlbumTrackNumber bool, spotifyCoverURL string, embedMaxQualityCover bool, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks int, spotifyTotalDiscs int, spotifyCopyright, spotifyPublisher, spotifyURL string, allowFallback bool, useFirstArtistOnly bool) (string, error) {
-
-	tidalURL, err := t.GetTidalURLFromSpotify(spotifyTrackID)
-	if err != nil {
-		return "", fmt.Errorf("songlink couldn't find Tidal URL: %w", err)
+		return 0, fmt.Errorf("no track ID found")
 	}
-
-	return t.DownloadByURLWithFallback(tidalURL, outputDir, quality, filenameFormat, includeTrackNumber, position, spotifyTrackName, spotifyArtistName, spotifyAlbumName, spotifyAlbumArtist, spotifyReleaseDate, useAlbumTrackNumber, spotifyCoverURL, embedMaxQualityCover, spotifyTrackNumber, spotifyDiscNumber, spotifyTotalTracks, spotifyTotalDiscs, spotifyCopyright, spotifyPublisher, spotifyURL, allowFallback, useFirstArtistOnly)
+	return trackID, nil
 }
 
 type SegmentTemplate struct {
@@ -774,11 +214,11 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 			return "", "", nil, "", fmt.Errorf("no URLs in BTS manifest")
 		}
 
-		fmt.Printf("Manifest: BTS format (%s, %s)\n", btsManifest.MimeType, btsManifest.Codecs)
+		slog.Debug("Tidal manifest: BTS format", "mime_type", btsManifest.MimeType, "codecs", btsManifest.Codecs)
 		return btsManifest.URLs[0], "", nil, btsManifest.MimeType, nil
 	}
 
-	fmt.Println("Manifest: DASH format")
+	slog.Debug("Tidal manifest: DASH format")
 
 	var mpd MPD
 	var segTemplate *SegmentTemplate
@@ -814,7 +254,7 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 		}
 
 		if selectedBandwidth > 0 {
-			fmt.Printf("Selected stream: Codec=%s, Bandwidth=%d bps\n", selectedCodecs, selectedBandwidth)
+			slog.Debug("Selected DASH stream", "codecs", selectedCodecs, "bandwidth", selectedBandwidth)
 		}
 	}
 
@@ -834,7 +274,7 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 		initURL = strings.ReplaceAll(initURL, "&amp;", "&")
 		mediaTemplate = strings.ReplaceAll(mediaTemplate, "&amp;", "&")
 
-		fmt.Printf("Parsed manifest via XML: %d segments\n", segmentCount)
+		slog.Debug("Parsed DASH manifest via XML", "segments", segmentCount)
 
 		for i := 1; i <= segmentCount; i++ {
 			mediaURL := strings.ReplaceAll(mediaTemplate, "$Number$", fmt.Sprintf("%d", i))
@@ -843,7 +283,7 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 		return "", initURL, mediaURLs, "", nil
 	}
 
-	fmt.Println("Using regex fallback for DASH manifest...")
+	slog.Debug("Using regex fallback for DASH manifest")
 
 	initRe := regexp.MustCompile(`initialization="([^"]+)"`)
 	mediaRe := regexp.MustCompile(`media="([^"]+)"`)
@@ -880,7 +320,7 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 		return "", "", nil, "", fmt.Errorf("no segments found in manifest (XML: %d, Regex: 0)", len(matches))
 	}
 
-	fmt.Printf("Parsed manifest via Regex: %d segments\n", segmentCount)
+	slog.Debug("Parsed DASH manifest via regex", "segments", segmentCount)
 
 	for i := 1; i <= segmentCount; i++ {
 		mediaURL := strings.ReplaceAll(mediaTemplate, "$Number$", fmt.Sprintf("%d", i))
@@ -890,52 +330,38 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 	return "", initURL, mediaURLs, "", nil
 }
 
-func getDownloadURLRotated(apis []string, trackID int64, quality string) (string, string, error) {
+// getDownloadURLRotated asks the APIs for a stream of trackID in the order
+// of their mirror health, skipping APIs whose circuit is open. Returns the
+// API that answered and the stream URL or "MANIFEST:" and the manifest.
+func getDownloadURLRotated(ctx context.Context, apis []Endpoint, trackID int64, quality string) (string, string, error) {
 	if len(apis) == 0 {
 		return "", "", fmt.Errorf("no APIs available")
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(apis), func(i, j int) { apis[i], apis[j] = apis[j], apis[i] })
+	apis = rankEndpoints("tidal", apis)
 
-	fmt.Printf("Rotating through %d APIs...\n", len(apis))
+	slog.DebugContext(ctx, "Rotating through Tidal APIs", "apis", len(apis))
 
 	var lastError error
 	var errors []string
 
-	for _, apiURL := range apis {
-		fmt.Printf("Trying API: %s\n", apiURL)
-
-		client := &http.Client{
-			Timeout: 15 * time.Second,
-		}
+	for _, api := range apis {
+		apiURL := strings.TrimRight(api.URL, "/")
+		slog.DebugContext(ctx, "Trying Tidal API", "api", apiURL)
 
-		url := fmt.Sprintf("%s/track/?id=%d&quality=%s", apiURL, trackID, quality)
-		resp, err := client.Get(url)
+		start := time.Now()
+		body, err := api.get(ctx, fmt.Sprintf("%s/track/?id=%d&quality=%s", apiURL, trackID, quality))
 		if err != nil {
+			observeUpstream("tidal", mirrorLabel(apiURL), start, err)
 			lastError = err
 			errors = append(errors, fmt.Sprintf("%s: %v", apiURL, err))
 			continue
 		}
 
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			lastError = fmt.Errorf("HTTP %d", resp.StatusCode)
-			errors = append(errors, fmt.Sprintf("%s: %v", apiURL, lastError))
-			continue
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			lastError = err
-			errors = append(errors, fmt.Sprintf("%s: read body failed", apiURL))
-			continue
-		}
-
 		var v2Response TidalAPIResponseV2
 		if err := json.Unmarshal(body, &v2Response); err == nil && v2Response.Data.Manifest != "" {
-			fmt.Printf("✓ Success with: %s\n", apiURL)
+			observeUpstream("tidal", mirrorLabel(apiURL), start, nil)
+			slog.InfoContext(ctx, "Tidal API succeeded", "api", apiURL)
 			return apiURL, "MANIFEST:" + v2Response.Data.Manifest, nil
 		}
 
@@ -943,74 +369,19 @@ func getDownloadURLRotated(apis []string, trackID int64, quality string) (string
 		if err := json.Unmarshal(body, &v1Responses); err == nil {
 			for _, item := range v1Responses {
 				if item.OriginalTrackURL != "" {
-					fmt.Printf("✓ Success with: %s\n", apiURL)
+					observeUpstream("tidal", mirrorLabel(apiURL), start, nil)
+					slog.InfoContext(ctx, "Tidal API succeeded", "api", apiURL)
 					return apiURL, item.OriginalTrackURL, nil
 				}
 			}
 		}
 
 		lastError = fmt.Errorf("no download URL or manifest in response")
+		observeUpstream("tidal", mirrorLabel(apiURL), start, lastError)
 		errors = append(errors, fmt.Sprintf("%s: %v", apiURL, lastError))
 	}
 
-	fmt.Println("All APIs failed:")
-	for _, e := range errors {
-		fmt.Printf("  ✗ %s\n", e)
-	}
+	slog.WarnContext(ctx, "All Tidal APIs failed", "errors", errors)
 
 	return "", "", fmt.Errorf("all %d APIs failed. Last error: %v", len(apis), lastError)
 }
-
-func buildTidalFilename(title, artist, album, albumArtist, releaseDate string, trackNumber, discNumber int, format string, includeTrackNumber bool, position int, useAlbumTrackNumber bool) string {
-	var filename string
-
-	numberToUse := position
-	if useAlbumTrackNumber && trackNumber > 0 {
-		numberToUse = trackNumber
-	}
-
-	year := ""
-	if len(releaseDate) >= 4 {
-		year = releaseDate[:4]
-	}
-
-	if strings.Contains(format, "{") {
-		filename = format
-		filename = strings.ReplaceAll(filename, "{title}", title)
-		filename = strings.ReplaceAll(filename, "{artist}", artist)
-		filename = strings.ReplaceAll(filename, "{album}", album)
-		filename = strings.ReplaceAll(filename, "{album_artist}", albumArtist)
-		filename = strings.ReplaceAll(filename, "{year}", year)
-
-		if discNumber > 0 {
-			filename = strings.ReplaceAll(filename, "{disc}", fmt.Sprintf("%d", discNumber))
-		} else {
-			filename = strings.ReplaceAll(filename, "{disc}", "")
-		}
-
-		if numberToUse > 0 {
-			filename = strings.ReplaceAll(filename, "{track}", fmt.Sprintf("%02d", numberToUse))
-		} else {
-
-			filename = regexp.MustCompile(`\{track\}\.\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*-\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*`).ReplaceAllString(filename, "")
-		}
-	} else {
-
-		switch format {
-		case "artist-title":
-			filename = fmt.Sprintf("%s - %s", artist, title)
-		case "title":
-			filename = title
-		default:
-			filename = fmt.Sprintf("%s - %s", title, artist)
-		}
-
-		if includeTrackNumber && position > 0 {
-			filename = fmt.Sprintf("%02d. %s", numberToUse, filename)
-		}
-	}
-
-	return filename + ".flac"
-}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// transcodeFormat is an output format for TranscodeAudio
+type transcodeFormat struct {
+	codec       string
+	container   string
+	contentType string
+}
+
+var transcodeFormats = map[string]transcodeFormat{
+	"mp3":  {codec: "libmp3lame", container: "mp3", contentType: "audio/mpeg"},
+	"opus": {codec: "libopus", container: "ogg", contentType: "audio/ogg"},
+}
+
+// TranscodeContentType returns the Content-Type of a transcode format and
+// whether the format is supported
+func TranscodeContentType(format string) (string, bool) {
+	f, ok := transcodeFormats[format]
+	return f.contentType, ok
+}
+
+// TranscodeAudio converts inputPath to format ("mp3" or "opus") at
+// bitrateKbps and writes the result to w while ffmpeg produces it. The
+// output is streamable, so its length is not known in advance. Cancelling
+// ctx stops ffmpeg.
+func TranscodeAudio(ctx context.Context, inputPath, format string, bitrateKbps int, w io.Writer) error {
+	f, ok := transcodeFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported transcode format: %s", format)
+	}
+
+	ffmpegPath, err := GetFFmpegPath()
+	if err != nil {
+		return fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	if err := ValidateExecutable(ffmpegPath); err != nil {
+		return fmt.Errorf("invalid ffmpeg executable: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", inputPath,
+		"-map", "0:a:0",
+		"-map_metadata", "0",
+		"-codec:a", f.codec,
+		"-b:a", strconv.Itoa(bitrateKbps)+"k",
+		"-f", f.container,
+		"pipe:1",
+	)
+	setHideWindow(cmd)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg transcode failed: %w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const usersBucket = "Users"
+
+// UserRole controls what a user can see and change
+type UserRole string
+
+const (
+	// RoleAdmin sees every user's queue and history and manages users and
+	// the global settings
+	RoleAdmin UserRole = "admin"
+	RoleUser  UserRole = "user"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("username already taken")
+	ErrLastAdmin    = errors.New("cannot remove the last admin")
+)
+
+// usernamePattern keeps usernames safe to use as a directory name
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{1,31}$`)
+
+// User is an account of the HTTP server. PasswordHash is a bcrypt hash and
+// must never be sent to clients.
+type User struct {
+	ID           string       `json:"id"`
+	Username     string       `json:"username"`
+	PasswordHash string       `json:"password_hash"`
+	Role         UserRole     `json:"role"`
+	Settings     UserSettings `json:"settings"`
+	CreatedAt    int64        `json:"created_at"`
+
+	// TokenVersion is part of every session token and bumped whenever the
+	// password changes, which ends all existing sessions of the user
+	TokenVersion int `json:"token_version"`
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// UserSettings is a user's overlay on top of the download and UI settings
+// of config.yml. Unset fields fall back to config.yml.
+type UserSettings struct {
+	FilenameFormat       *string `json:"filename_format,omitempty"`
+	AudioFormat          *string `json:"audio_format,omitempty"`
+	EmbedLyrics          *bool   `json:"embed_lyrics,omitempty"`
+	EmbedMaxQualityCover *bool   `json:"embed_max_quality_cover,omitempty"`
+	TrackNumber          *bool   `json:"track_number,omitempty"`
+	UseAlbumTrackNumber  *bool   `json:"use_album_track_number,omitempty"`
+	UseFirstArtistOnly   *bool   `json:"use_first_artist_only,omitempty"`
+	AllowFallback        *bool   `json:"allow_fallback,omitempty"`
+	CreateM3U8           *bool   `json:"create_m3u8,omitempty"`
+	DefaultService       *string `json:"default_service,omitempty"`
+	Theme                *string `json:"theme,omitempty"`
+	ThemeMode            *string `json:"theme_mode,omitempty"`
+	FontFamily           *string `json:"font_family,omitempty"`
+}
+
+// NormalizeUsername lower-cases a username and checks it is usable as a
+// directory name
+func NormalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return "", fmt.Errorf("username must be 2-32 characters of a-z, 0-9, '_', '.' or '-'")
+	}
+	return username, nil
+}
+
+// HashPassword hashes a password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the user's hash
+func (u User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// CreateUser stores a new user with an already hashed password
+func CreateUser(username, passwordHash string, role UserRole) (User, error) {
+	if historyDB == nil {
+		return User{}, fmt.Errorf("history database not initialized")
+	}
+	username, err := NormalizeUsername(username)
+	if err != nil {
+		return User{}, err
+	}
+	if role != RoleAdmin && role != RoleUser {
+		return User{}, fmt.Errorf("invalid role: %s", role)
+	}
+	if _, err := bcrypt.Cost([]byte(passwordHash)); err != nil {
+		return User{}, fmt.Errorf("password hash is not a bcrypt hash")
+	}
+
+	var user User
+	err = historyDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(usersBucket))
+		if err != nil {
+			return err
+		}
+		if _, found := findUserByName(b, username); found {
+			return ErrUserExists
+		}
+
+		seq, _ := b.NextSequence()
+		user = User{
+			ID:           fmt.Sprintf("u%d", seq),
+			Username:     username,
+			PasswordHash: passwordHash,
+			Role:         role,
+			CreatedAt:    time.Now().Unix(),
+		}
+		return putUser(b, user)
+	})
+	return user, err
+}
+
+// GetUser returns the user with the given ID
+func GetUser(id string) (User, error) {
+	var user User
+	err := viewUsers(func(b *bolt.Bucket) error {
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrUserNotFound
+		}
+		return json.Unmarshal(v, &user)
+	})
+	return user, err
+}
+
+// GetUserByUsername returns the user with the given username
+func GetUserByUsername(username string) (User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	var user User
+	err := viewUsers(func(b *bolt.Bucket) error {
+		found, ok := findUserByName(b, username)
+		if !ok {
+			return ErrUserNotFound
+		}
+		user = found
+		return nil
+	})
+	return user, err
+}
+
+// ListUsers returns all users ordered by creation
+func ListUsers() ([]User, error) {
+	var users []User
+	err := viewUsers(func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err == nil {
+				users = append(users, user)
+			}
+			return nil
+		})
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		err = nil
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt < users[j].CreatedAt
+	})
+	return users, err
+}
+
+// UpdateUser loads a user, applies update and stores the result. Demoting
+// the last admin is rejected.
+func UpdateUser(id string, update func(user *User) error) (User, error) {
+	if historyDB == nil {
+		return User{}, fmt.Errorf("history database not initialized")
+	}
+
+	var user User
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if b == nil {
+			return ErrUserNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrUserNotFound
+		}
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+
+		wasAdmin := user.IsAdmin()
+		if err := update(&user); err != nil {
+			return err
+		}
+		user.ID = id
+		if user.Role != RoleAdmin && user.Role != RoleUser {
+			return fmt.Errorf("invalid role: %s", user.Role)
+		}
+		if wasAdmin && !user.IsAdmin() && countAdmins(b) <= 1 {
+			return ErrLastAdmin
+		}
+		return putUser(b, user)
+	})
+	return user, err
+}
+
+// DeleteUser removes a user account. Downloads and history entries of the
+// user are kept.
+func DeleteUser(id string) error {
+	if historyDB == nil {
+		return fmt.Errorf("history database not initialized")
+	}
+	return historyDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if b == nil {
+			return ErrUserNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrUserNotFound
+		}
+		var user User
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		if user.IsAdmin() && countAdmins(b) <= 1 {
+			return ErrLastAdmin
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// CountUsers returns the number of stored users
+func CountUsers() int {
+	count := 0
+	viewUsers(func(b *bolt.Bucket) error {
+		count = b.Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// EnsureAdminUser creates an admin with the given bcrypt hash unless a user
+// with that name already exists. It is used to seed accounts from the auth
+// section of config.yml; existing accounts are never overwritten.
+func EnsureAdminUser(username, passwordHash string) (bool, error) {
+	normalized, err := NormalizeUsername(username)
+	if err != nil {
+		return false, err
+	}
+	if _, err := GetUserByUsername(normalized); err == nil {
+		return false, nil
+	}
+	if _, err := CreateUser(normalized, passwordHash, RoleAdmin); err != nil {
+		if errors.Is(err, ErrUserExists) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func viewUsers(fn func(b *bolt.Bucket) error) error {
+	if historyDB == nil {
+		return fmt.Errorf("history database not initialized")
+	}
+	return historyDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if b == nil {
+			return ErrUserNotFound
+		}
+		return fn(b)
+	})
+}
+
+func findUserByName(b *bolt.Bucket, username string) (User, bool) {
+	var found User
+	ok := false
+	b.ForEach(func(k, v []byte) error {
+		var user User
+		if err := json.Unmarshal(v, &user); err == nil && user.Username == username {
+			found, ok = user, true
+		}
+		return nil
+	})
+	return found, ok
+}
+
+func countAdmins(b *bolt.Bucket) int {
+	count := 0
+	b.ForEach(func(k, v []byte) error {
+		var user User
+		if err := json.Unmarshal(v, &user); err == nil && user.IsAdmin() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func putUser(b *bolt.Bucket, user User) error {
+	buf, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(user.ID), buf)
+}
@@ -0,0 +1,643 @@
+// Code generated by go run ./cmd/apigen; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// AnalyzeTrack calls POST /api/analysis/track: Spectrum and quality analysis of an audio file.
+func (c *Client) AnalyzeTrack(ctx context.Context, body AnalyzeTrackRequest) (AnalysisResult, error) {
+	var out AnalysisResult
+	err := c.do(ctx, "POST", "/api/analysis/track", nil, body, &out)
+	return out, err
+}
+
+// Login calls POST /api/auth/login: Exchange username and password for a session token.
+func (c *Client) Login(ctx context.Context, body LoginRequest) (LoginResponse, error) {
+	var out LoginResponse
+	err := c.do(ctx, "POST", "/api/auth/login", nil, body, &out)
+	return out, err
+}
+
+// Me calls GET /api/auth/me: The authenticated caller.
+func (c *Client) Me(ctx context.Context) (Principal, error) {
+	var out Principal
+	err := c.do(ctx, "GET", "/api/auth/me", nil, nil, &out)
+	return out, err
+}
+
+// ChangePassword calls POST /api/auth/password: Change the caller's password.
+func (c *Client) ChangePassword(ctx context.Context, body ChangePasswordRequest) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/auth/password", nil, body, &out)
+	return out, err
+}
+
+// StartAvailabilityCheck calls POST /api/availability: Check tracks in the background, results arrive as events.
+func (c *Client) StartAvailabilityCheck(ctx context.Context, body AvailabilityRequest) (AvailabilityResponse, error) {
+	var out AvailabilityResponse
+	err := c.do(ctx, "POST", "/api/availability", nil, body, &out)
+	return out, err
+}
+
+// CancelAvailabilityCheck calls DELETE /api/availability/{id}: Cancel the unchecked tracks of a check.
+func (c *Client) CancelAvailabilityCheck(ctx context.Context, id string) (AvailabilityCheck, error) {
+	var out AvailabilityCheck
+	err := c.do(ctx, "DELETE", "/api/availability/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetAvailabilityCheck calls GET /api/availability/{id}: Progress and results of a check.
+func (c *Client) GetAvailabilityCheck(ctx context.Context, id string) (AvailabilityCheck, error) {
+	var out AvailabilityCheck
+	err := c.do(ctx, "GET", "/api/availability/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetDefaults calls GET /api/defaults: Default values of the host.
+func (c *Client) GetDefaults(ctx context.Context) (map[string]string, error) {
+	var out map[string]string
+	err := c.do(ctx, "GET", "/api/defaults", nil, nil, &out)
+	return out, err
+}
+
+// DownloadAvatar calls POST /api/download/avatar: Save an artist's avatar.
+func (c *Client) DownloadAvatar(ctx context.Context, body AvatarRequest) (AvatarDownloadResponse, error) {
+	var out AvatarDownloadResponse
+	err := c.do(ctx, "POST", "/api/download/avatar", nil, body, &out)
+	return out, err
+}
+
+// DownloadCollection calls POST /api/download/collection: Queue every track of an album, playlist or artist.
+func (c *Client) DownloadCollection(ctx context.Context, body DownloadCollectionRequest) (CollectionResponse, error) {
+	var out CollectionResponse
+	err := c.do(ctx, "POST", "/api/download/collection", nil, body, &out)
+	return out, err
+}
+
+// DownloadCover calls POST /api/download/cover: Save the cover of a track.
+func (c *Client) DownloadCover(ctx context.Context, body CoverRequest) (CoverDownloadResponse, error) {
+	var out CoverDownloadResponse
+	err := c.do(ctx, "POST", "/api/download/cover", nil, body, &out)
+	return out, err
+}
+
+// DownloadCoverBatch calls POST /api/download/cover/batch: Save the covers of several tracks.
+func (c *Client) DownloadCoverBatch(ctx context.Context, body AssetBatchRequest) (AssetBatchResponse, error) {
+	var out AssetBatchResponse
+	err := c.do(ctx, "POST", "/api/download/cover/batch", nil, body, &out)
+	return out, err
+}
+
+// DownloadGalleryImage calls POST /api/download/gallery: Save one artist gallery image.
+func (c *Client) DownloadGalleryImage(ctx context.Context, body GalleryImageRequest) (GalleryImageDownloadResponse, error) {
+	var out GalleryImageDownloadResponse
+	err := c.do(ctx, "POST", "/api/download/gallery", nil, body, &out)
+	return out, err
+}
+
+// DownloadGalleryBatch calls POST /api/download/gallery/batch: Save several artist gallery images.
+func (c *Client) DownloadGalleryBatch(ctx context.Context, body GalleryBatchRequest) (AssetBatchResponse, error) {
+	var out AssetBatchResponse
+	err := c.do(ctx, "POST", "/api/download/gallery/batch", nil, body, &out)
+	return out, err
+}
+
+// DownloadHeader calls POST /api/download/header: Save an artist's header image.
+func (c *Client) DownloadHeader(ctx context.Context, body HeaderRequest) (HeaderDownloadResponse, error) {
+	var out HeaderDownloadResponse
+	err := c.do(ctx, "POST", "/api/download/header", nil, body, &out)
+	return out, err
+}
+
+// DownloadLyrics calls POST /api/download/lyrics: Save the synced lyrics of a track.
+func (c *Client) DownloadLyrics(ctx context.Context, body LyricsRequest) (LyricsDownloadResponse, error) {
+	var out LyricsDownloadResponse
+	err := c.do(ctx, "POST", "/api/download/lyrics", nil, body, &out)
+	return out, err
+}
+
+// DownloadLyricsBatch calls POST /api/download/lyrics/batch: Save the lyrics of several tracks.
+func (c *Client) DownloadLyricsBatch(ctx context.Context, body AssetBatchRequest) (AssetBatchResponse, error) {
+	var out AssetBatchResponse
+	err := c.do(ctx, "POST", "/api/download/lyrics/batch", nil, body, &out)
+	return out, err
+}
+
+// GetDownloadProgressParams are the query parameters of GetDownloadProgress
+type GetDownloadProgressParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// GetDownloadProgress calls GET /api/download/progress: Progress of the running download.
+func (c *Client) GetDownloadProgress(ctx context.Context, params *GetDownloadProgressParams) (ProgressInfo, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out ProgressInfo
+	err := c.do(ctx, "GET", "/api/download/progress", query, nil, &out)
+	return out, err
+}
+
+// GetDownloadQueueParams are the query parameters of GetDownloadQueue
+type GetDownloadQueueParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// GetDownloadQueue calls GET /api/download/queue: Queue items and counters.
+func (c *Client) GetDownloadQueue(ctx context.Context, params *GetDownloadQueueParams) (DownloadQueueInfo, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out DownloadQueueInfo
+	err := c.do(ctx, "GET", "/api/download/queue", query, nil, &out)
+	return out, err
+}
+
+// CancelAllQueuedItemsParams are the query parameters of CancelAllQueuedItems
+type CancelAllQueuedItemsParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// CancelAllQueuedItems calls POST /api/download/queue/cancel-all: Skip all queued items.
+func (c *Client) CancelAllQueuedItems(ctx context.Context, params *CancelAllQueuedItemsParams) (SuccessResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/download/queue/cancel-all", query, nil, &out)
+	return out, err
+}
+
+// ClearCompletedDownloadsParams are the query parameters of ClearCompletedDownloads
+type ClearCompletedDownloadsParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// ClearCompletedDownloads calls POST /api/download/queue/clear: Remove finished items.
+func (c *Client) ClearCompletedDownloads(ctx context.Context, params *ClearCompletedDownloadsParams) (SuccessResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/download/queue/clear", query, nil, &out)
+	return out, err
+}
+
+// ClearAllDownloadsParams are the query parameters of ClearAllDownloads
+type ClearAllDownloadsParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// ClearAllDownloads calls POST /api/download/queue/clear-all: Remove all items that are not running.
+func (c *Client) ClearAllDownloads(ctx context.Context, params *ClearAllDownloadsParams) (SuccessResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/download/queue/clear-all", query, nil, &out)
+	return out, err
+}
+
+// CancelDownloadItem calls POST /api/download/queue/{id}/cancel: Cancel a queued, paused or running item.
+func (c *Client) CancelDownloadItem(ctx context.Context, id string) (QueueItemResponse, error) {
+	var out QueueItemResponse
+	err := c.do(ctx, "POST", "/api/download/queue/"+url.PathEscape(id)+"/cancel", nil, nil, &out)
+	return out, err
+}
+
+// PauseDownloadItem calls POST /api/download/queue/{id}/pause: Pause a queued or running item.
+func (c *Client) PauseDownloadItem(ctx context.Context, id string) (QueueItemResponse, error) {
+	var out QueueItemResponse
+	err := c.do(ctx, "POST", "/api/download/queue/"+url.PathEscape(id)+"/pause", nil, nil, &out)
+	return out, err
+}
+
+// ResumeDownloadItem calls POST /api/download/queue/{id}/resume: Queue a paused item again.
+func (c *Client) ResumeDownloadItem(ctx context.Context, id string) (QueueItemResponse, error) {
+	var out QueueItemResponse
+	err := c.do(ctx, "POST", "/api/download/queue/"+url.PathEscape(id)+"/resume", nil, nil, &out)
+	return out, err
+}
+
+// RetryDownloadItem calls POST /api/download/queue/{id}/retry: Queue a failed, cancelled or skipped item again.
+func (c *Client) RetryDownloadItem(ctx context.Context, id string) (QueueItemResponse, error) {
+	var out QueueItemResponse
+	err := c.do(ctx, "POST", "/api/download/queue/"+url.PathEscape(id)+"/retry", nil, nil, &out)
+	return out, err
+}
+
+// DownloadTrack calls POST /api/download/track: Queue a track download.
+func (c *Client) DownloadTrack(ctx context.Context, body DownloadTrackRequest) (DownloadResponse, error) {
+	var out DownloadResponse
+	err := c.do(ctx, "POST", "/api/download/track", nil, body, &out)
+	return out, err
+}
+
+// StreamEventsParams are the query parameters of StreamEvents
+type StreamEventsParams struct {
+	// Comma separated event types to receive
+	Types string
+	// Replay events after this ID, like the Last-Event-ID header
+	LastEventID string
+}
+
+// StreamEvents calls GET /api/events: Queue and availability events as Server-Sent Events.
+// The caller reads and closes the response body.
+func (c *Client) StreamEvents(ctx context.Context, params *StreamEventsParams) (*http.Response, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Types != "" {
+			query.Set("types", params.Types)
+		}
+		if params.LastEventID != "" {
+			query.Set("last_event_id", params.LastEventID)
+		}
+	}
+	return c.send(ctx, "GET", "/api/events", query, nil)
+}
+
+// ListAudioFilesParams are the query parameters of ListAudioFiles
+type ListAudioFilesParams struct {
+	// Directory relative to the download directory
+	Path string
+}
+
+// ListAudioFiles calls GET /api/files/audio: Audio files below a path.
+func (c *Client) ListAudioFiles(ctx context.Context, params *ListAudioFilesParams) (FileListResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Path != "" {
+			query.Set("path", params.Path)
+		}
+	}
+	var out FileListResponse
+	err := c.do(ctx, "GET", "/api/files/audio", query, nil, &out)
+	return out, err
+}
+
+// ListFilesParams are the query parameters of ListFiles
+type ListFilesParams struct {
+	// Directory relative to the download directory
+	Path string
+}
+
+// ListFiles calls GET /api/files/list: Directory tree below a path.
+func (c *Client) ListFiles(ctx context.Context, params *ListFilesParams) (FileListResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Path != "" {
+			query.Set("path", params.Path)
+		}
+	}
+	var out FileListResponse
+	err := c.do(ctx, "GET", "/api/files/list", query, nil, &out)
+	return out, err
+}
+
+// ReadFileMetadataParams are the query parameters of ReadFileMetadata
+type ReadFileMetadataParams struct {
+	// File relative to the download directory
+	Path string
+}
+
+// ReadFileMetadata calls GET /api/files/metadata: Tags of an audio file.
+func (c *Client) ReadFileMetadata(ctx context.Context, params *ReadFileMetadataParams) (AudioMetadata, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Path != "" {
+			query.Set("path", params.Path)
+		}
+	}
+	var out AudioMetadata
+	err := c.do(ctx, "GET", "/api/files/metadata", query, nil, &out)
+	return out, err
+}
+
+// RenameFiles calls POST /api/files/rename: Rename audio files from their tags.
+func (c *Client) RenameFiles(ctx context.Context, body RenameRequest) ([]RenameResult, error) {
+	var out []RenameResult
+	err := c.do(ctx, "POST", "/api/files/rename", nil, body, &out)
+	return out, err
+}
+
+// PreviewRename calls POST /api/files/rename/preview: Names a rename would give the files.
+func (c *Client) PreviewRename(ctx context.Context, body RenameRequest) ([]RenamePreview, error) {
+	var out []RenamePreview
+	err := c.do(ctx, "POST", "/api/files/rename/preview", nil, body, &out)
+	return out, err
+}
+
+// GetFileSizes calls POST /api/files/sizes: Size in bytes of each file.
+func (c *Client) GetFileSizes(ctx context.Context, body FileSizesRequest) (map[string]int64, error) {
+	var out map[string]int64
+	err := c.do(ctx, "POST", "/api/files/sizes", nil, body, &out)
+	return out, err
+}
+
+// GetDownloadHistoryParams are the query parameters of GetDownloadHistory
+type GetDownloadHistoryParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// GetDownloadHistory calls GET /api/history/downloads: Download history, newest first.
+func (c *Client) GetDownloadHistory(ctx context.Context, params *GetDownloadHistoryParams) ([]HistoryItem, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out []HistoryItem
+	err := c.do(ctx, "GET", "/api/history/downloads", query, nil, &out)
+	return out, err
+}
+
+// ClearDownloadHistoryParams are the query parameters of ClearDownloadHistory
+type ClearDownloadHistoryParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// ClearDownloadHistory calls POST /api/history/downloads/clear: Clear the download history.
+func (c *Client) ClearDownloadHistory(ctx context.Context, params *ClearDownloadHistoryParams) (SuccessResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/history/downloads/clear", query, nil, &out)
+	return out, err
+}
+
+// DeleteDownloadHistoryItem calls DELETE /api/history/downloads/{id}: Delete a download history entry.
+func (c *Client) DeleteDownloadHistoryItem(ctx context.Context, id string) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "DELETE", "/api/history/downloads/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// GetFetchHistoryParams are the query parameters of GetFetchHistory
+type GetFetchHistoryParams struct {
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// GetFetchHistory calls GET /api/history/fetch: Fetch history, newest first.
+func (c *Client) GetFetchHistory(ctx context.Context, params *GetFetchHistoryParams) ([]FetchHistoryItem, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out []FetchHistoryItem
+	err := c.do(ctx, "GET", "/api/history/fetch", query, nil, &out)
+	return out, err
+}
+
+// AddFetchHistory calls POST /api/history/fetch: Record a fetched URL.
+func (c *Client) AddFetchHistory(ctx context.Context, body FetchHistoryRequest) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/history/fetch", nil, body, &out)
+	return out, err
+}
+
+// ClearFetchHistoryParams are the query parameters of ClearFetchHistory
+type ClearFetchHistoryParams struct {
+	// Only clear entries of this type: track, album, playlist or artist
+	Type string
+	// Admins only: limit to the entries of this user
+	UserID string
+}
+
+// ClearFetchHistory calls POST /api/history/fetch/clear: Clear the fetch history, or the entries of one type.
+func (c *Client) ClearFetchHistory(ctx context.Context, params *ClearFetchHistoryParams) (SuccessResponse, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Type != "" {
+			query.Set("type", params.Type)
+		}
+		if params.UserID != "" {
+			query.Set("user_id", params.UserID)
+		}
+	}
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/history/fetch/clear", query, nil, &out)
+	return out, err
+}
+
+// DeleteFetchHistoryItem calls DELETE /api/history/fetch/{id}: Delete a fetch history entry.
+func (c *Client) DeleteFetchHistoryItem(ctx context.Context, id string) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "DELETE", "/api/history/fetch/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// DownloadLibraryArchiveParams are the query parameters of DownloadLibraryArchive
+type DownloadLibraryArchiveParams struct {
+	// Comma separated download history entry IDs
+	IDs string
+	// Directory relative to the download directory
+	Path string
+	// Archive name
+	Name string
+}
+
+// DownloadLibraryArchive calls GET /api/library/archive: ZIP of history entries or a directory, resumable.
+// The caller reads and closes the response body.
+func (c *Client) DownloadLibraryArchive(ctx context.Context, params *DownloadLibraryArchiveParams) (*http.Response, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.IDs != "" {
+			query.Set("ids", params.IDs)
+		}
+		if params.Path != "" {
+			query.Set("path", params.Path)
+		}
+		if params.Name != "" {
+			query.Set("name", params.Name)
+		}
+	}
+	return c.send(ctx, "GET", "/api/library/archive", query, nil)
+}
+
+// StreamLibraryItemParams are the query parameters of StreamLibraryItem
+type StreamLibraryItemParams struct {
+	// Transcode to mp3 or opus
+	Format string
+	// Transcode bitrate in kbps, e.g. 192 or 192k
+	Bitrate string
+	// Send as attachment
+	Download bool
+}
+
+// StreamLibraryItem calls GET /api/library/stream/{id}: Stream the file of a download history entry, with Range support.
+// The caller reads and closes the response body.
+func (c *Client) StreamLibraryItem(ctx context.Context, id string, params *StreamLibraryItemParams) (*http.Response, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.Bitrate != "" {
+			query.Set("bitrate", params.Bitrate)
+		}
+		if params.Download {
+			query.Set("download", "true")
+		}
+	}
+	return c.send(ctx, "GET", "/api/library/stream/"+url.PathEscape(id), query, nil)
+}
+
+// GetMirrorHealth calls GET /api/mirrors: Health and circuit state of every provider mirror (admin).
+func (c *Client) GetMirrorHealth(ctx context.Context) (MirrorHealthResponse, error) {
+	var out MirrorHealthResponse
+	err := c.do(ctx, "GET", "/api/mirrors", nil, nil, &out)
+	return out, err
+}
+
+// GetOpenAPI calls GET /api/openapi.json: OpenAPI 3 document of this API.
+func (c *Client) GetOpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "GET", "/api/openapi.json", nil, nil, &out)
+	return out, err
+}
+
+// ReloadProviders calls POST /api/providers/reload: Apply the provider endpoints of config.yml without a restart (admin).
+func (c *Client) ReloadProviders(ctx context.Context) (MirrorHealthResponse, error) {
+	var out MirrorHealthResponse
+	err := c.do(ctx, "POST", "/api/providers/reload", nil, nil, &out)
+	return out, err
+}
+
+// GetSettings calls GET /api/settings: Settings with the caller's overlay applied.
+func (c *Client) GetSettings(ctx context.Context) (map[string]any, error) {
+	var out map[string]any
+	err := c.do(ctx, "GET", "/api/settings", nil, nil, &out)
+	return out, err
+}
+
+// SaveSettings calls POST /api/settings: Change config.yml (admin) or the caller's overlay.
+func (c *Client) SaveSettings(ctx context.Context, body map[string]any) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "POST", "/api/settings", nil, body, &out)
+	return out, err
+}
+
+// GetSpotifyMetadata calls POST /api/spotify/metadata: Metadata of a track, album, playlist or artist URL.
+func (c *Client) GetSpotifyMetadata(ctx context.Context, body MetadataRequest) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "POST", "/api/spotify/metadata", nil, body, &out)
+	return out, err
+}
+
+// SearchSpotify calls POST /api/spotify/search: Search tracks, albums, artists and playlists.
+func (c *Client) SearchSpotify(ctx context.Context, body SearchRequest) (SearchResponse, error) {
+	var out SearchResponse
+	err := c.do(ctx, "POST", "/api/spotify/search", nil, body, &out)
+	return out, err
+}
+
+// SearchSpotifyByType calls POST /api/spotify/search-by-type: Search one type with paging.
+func (c *Client) SearchSpotifyByType(ctx context.Context, body SearchByTypeRequest) ([]SearchResult, error) {
+	var out []SearchResult
+	err := c.do(ctx, "POST", "/api/spotify/search-by-type", nil, body, &out)
+	return out, err
+}
+
+// GetStreamingURLs calls POST /api/spotify/streaming-urls: Tidal and Amazon URLs of a track.
+func (c *Client) GetStreamingURLs(ctx context.Context, body StreamingURLsRequest) (SongLinkURLs, error) {
+	var out SongLinkURLs
+	err := c.do(ctx, "POST", "/api/spotify/streaming-urls", nil, body, &out)
+	return out, err
+}
+
+// CheckFFmpegInstalled calls GET /api/system/ffmpeg/status: Whether FFmpeg is installed.
+func (c *Client) CheckFFmpegInstalled(ctx context.Context) (FFmpegStatusResponse, error) {
+	var out FFmpegStatusResponse
+	err := c.do(ctx, "GET", "/api/system/ffmpeg/status", nil, nil, &out)
+	return out, err
+}
+
+// ListUsers calls GET /api/users: List user accounts (admin).
+func (c *Client) ListUsers(ctx context.Context) ([]UserInfo, error) {
+	var out []UserInfo
+	err := c.do(ctx, "GET", "/api/users", nil, nil, &out)
+	return out, err
+}
+
+// CreateUser calls POST /api/users: Create a user account (admin).
+func (c *Client) CreateUser(ctx context.Context, body CreateUserRequest) (UserInfo, error) {
+	var out UserInfo
+	err := c.do(ctx, "POST", "/api/users", nil, body, &out)
+	return out, err
+}
+
+// DeleteUser calls DELETE /api/users/{id}: Delete a user account, keeping its files (admin).
+func (c *Client) DeleteUser(ctx context.Context, id string) (SuccessResponse, error) {
+	var out SuccessResponse
+	err := c.do(ctx, "DELETE", "/api/users/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// UpdateUser calls PATCH /api/users/{id}: Change a user's password or role (admin).
+func (c *Client) UpdateUser(ctx context.Context, id string, body UpdateUserRequest) (UserInfo, error) {
+	var out UserInfo
+	err := c.do(ctx, "PATCH", "/api/users/"+url.PathEscape(id), nil, body, &out)
+	return out, err
+}
+
+// Health calls GET /health: Server health.
+func (c *Client) Health(ctx context.Context) (HealthResponse, error) {
+	var out HealthResponse
+	err := c.do(ctx, "GET", "/health", nil, nil, &out)
+	return out, err
+}
+
+// HealthLive calls GET /health/live: Liveness probe.
+func (c *Client) HealthLive(ctx context.Context) (HealthResponse, error) {
+	var out HealthResponse
+	err := c.do(ctx, "GET", "/health/live", nil, nil, &out)
+	return out, err
+}
+
+// HealthReady calls GET /health/ready: Readiness probe, 503 while a required component is down.
+func (c *Client) HealthReady(ctx context.Context) (ReadinessResponse, error) {
+	var out ReadinessResponse
+	err := c.do(ctx, "GET", "/health/ready", nil, nil, &out)
+	return out, err
+}
+
+// Metrics calls GET /metrics: Prometheus metrics (admin unless metrics.public).
+// The caller reads and closes the response body.
+func (c *Client) Metrics(ctx context.Context) (*http.Response, error) {
+	return c.send(ctx, "GET", "/metrics", nil, nil)
+}
@@ -0,0 +1,560 @@
+// Code generated by go run ./cmd/apigen; DO NOT EDIT.
+
+package client
+
+type AnalysisResult struct {
+	BitDepth      string       `json:"bit_depth,omitempty"`
+	BitsPerSample int          `json:"bits_per_sample,omitempty"`
+	Channels      int          `json:"channels,omitempty"`
+	Duration      float64      `json:"duration,omitempty"`
+	DynamicRange  float64      `json:"dynamic_range,omitempty"`
+	FilePath      string       `json:"file_path,omitempty"`
+	FileSize      int64        `json:"file_size,omitempty"`
+	PeakAmplitude float64      `json:"peak_amplitude,omitempty"`
+	RmsLevel      float64      `json:"rms_level,omitempty"`
+	SampleRate    int          `json:"sample_rate,omitempty"`
+	Spectrum      SpectrumData `json:"spectrum,omitempty"`
+	TotalSamples  int64        `json:"total_samples,omitempty"`
+}
+
+type AnalyzeTrackRequest struct {
+	FilePath string `json:"file_path"`
+}
+
+type AssetBatchRequest struct {
+	FilenameFormat      string       `json:"filename_format,omitempty"`
+	OutputDir           string       `json:"output_dir,omitempty"`
+	TrackNumber         *bool        `json:"track_number,omitempty"`
+	Tracks              []AssetTrack `json:"tracks"`
+	UseAlbumTrackNumber *bool        `json:"use_album_track_number,omitempty"`
+}
+
+type AssetBatchResponse struct {
+	Failed    int           `json:"failed,omitempty"`
+	Results   []AssetResult `json:"results,omitempty"`
+	Succeeded int           `json:"succeeded,omitempty"`
+	Total     int           `json:"total,omitempty"`
+}
+
+type AssetResult struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Index         int    `json:"index,omitempty"`
+	SpotifyID     string `json:"spotify_id,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type AssetTrack struct {
+	AlbumArtist string `json:"album_artist,omitempty"`
+	AlbumName   string `json:"album_name,omitempty"`
+	ArtistName  string `json:"artist_name,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	Position    int    `json:"position,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	SpotifyID   string `json:"spotify_id,omitempty"`
+	TrackName   string `json:"track_name,omitempty"`
+}
+
+type AudioMetadata struct {
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	Title       string `json:"title,omitempty"`
+	TrackNumber int    `json:"track_number,omitempty"`
+	Year        string `json:"year,omitempty"`
+}
+
+type AvailabilityCheck struct {
+	CreatedAt  int64               `json:"created_at,omitempty"`
+	Done       int                 `json:"done,omitempty"`
+	Errors     map[string]string   `json:"errors,omitempty"`
+	FinishedAt int64               `json:"finished_at,omitempty"`
+	ID         string              `json:"id,omitempty"`
+	Results    []TrackAvailability `json:"results,omitempty"`
+	Status     string              `json:"status,omitempty"`
+	Total      int                 `json:"total,omitempty"`
+	UserID     string              `json:"user_id,omitempty"`
+}
+
+type AvailabilityRequest struct {
+	SpotifyIDs []string `json:"spotify_ids"`
+}
+
+type AvailabilityResponse struct {
+	CheckID     string `json:"check_id,omitempty"`
+	QueuedAhead int    `json:"queued_ahead,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Total       int    `json:"total,omitempty"`
+}
+
+type AvatarDownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type AvatarRequest struct {
+	ArtistName string `json:"artist_name,omitempty"`
+	AvatarURL  string `json:"avatar_url,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type CollectionResponse struct {
+	BatchID string   `json:"batch_id,omitempty"`
+	ItemIDs []string `json:"item_ids,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Success bool     `json:"success,omitempty"`
+	Total   int      `json:"total,omitempty"`
+	Type    string   `json:"type,omitempty"`
+}
+
+type ComponentHealth struct {
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Required  bool   `json:"required,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+type CoverDownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type CoverRequest struct {
+	AlbumArtist         string `json:"album_artist,omitempty"`
+	AlbumName           string `json:"album_name,omitempty"`
+	ArtistName          string `json:"artist_name,omitempty"`
+	CoverURL            string `json:"cover_url,omitempty"`
+	DiscNumber          int    `json:"disc_number,omitempty"`
+	FilenameFormat      string `json:"filename_format,omitempty"`
+	OutputDir           string `json:"output_dir,omitempty"`
+	Position            int    `json:"position,omitempty"`
+	ReleaseDate         string `json:"release_date,omitempty"`
+	SpotifyID           string `json:"spotify_id,omitempty"`
+	TrackName           string `json:"track_name,omitempty"`
+	TrackNumber         *bool  `json:"track_number,omitempty"`
+	UseAlbumTrackNumber *bool  `json:"use_album_track_number,omitempty"`
+}
+
+type CreateUserRequest struct {
+	Password string `json:"password"`
+	Role     string `json:"role,omitempty"`
+	Username string `json:"username"`
+}
+
+type DownloadCollectionRequest struct {
+	AllowFallback        *bool   `json:"allow_fallback,omitempty"`
+	AudioFormat          string  `json:"audio_format,omitempty"`
+	CreateM3U8           *bool   `json:"create_m3u8,omitempty"`
+	EmbedLyrics          *bool   `json:"embed_lyrics,omitempty"`
+	EmbedMaxQualityCover *bool   `json:"embed_max_quality_cover,omitempty"`
+	FilenameFormat       string  `json:"filename_format,omitempty"`
+	OutputDir            string  `json:"output_dir,omitempty"`
+	Service              string  `json:"service,omitempty"`
+	Timeout              float64 `json:"timeout,omitempty"`
+	TrackNumber          *bool   `json:"track_number,omitempty"`
+	URL                  string  `json:"url"`
+	UseAlbumTrackNumber  *bool   `json:"use_album_track_number,omitempty"`
+	UseFirstArtistOnly   *bool   `json:"use_first_artist_only,omitempty"`
+}
+
+type DownloadItem struct {
+	AlbumName    string  `json:"album_name,omitempty"`
+	ArtistName   string  `json:"artist_name,omitempty"`
+	EndTime      int64   `json:"end_time,omitempty"`
+	ErrorMessage string  `json:"error_message,omitempty"`
+	FilePath     string  `json:"file_path,omitempty"`
+	ID           string  `json:"id,omitempty"`
+	Progress     float64 `json:"progress,omitempty"`
+	Provider     string  `json:"provider,omitempty"`
+	Speed        float64 `json:"speed,omitempty"`
+	SpotifyID    string  `json:"spotify_id,omitempty"`
+	StartTime    int64   `json:"start_time,omitempty"`
+	Status       string  `json:"status,omitempty"`
+	TotalSize    float64 `json:"total_size,omitempty"`
+	TrackName    string  `json:"track_name,omitempty"`
+	UserID       string  `json:"user_id,omitempty"`
+}
+
+type DownloadQueueInfo struct {
+	CancelledCount   int            `json:"cancelled_count,omitempty"`
+	CompletedCount   int            `json:"completed_count,omitempty"`
+	CurrentSpeed     float64        `json:"current_speed,omitempty"`
+	DownloadingCount int            `json:"downloading_count,omitempty"`
+	FailedCount      int            `json:"failed_count,omitempty"`
+	IsDownloading    bool           `json:"is_downloading,omitempty"`
+	PausedCount      int            `json:"paused_count,omitempty"`
+	Queue            []DownloadItem `json:"queue,omitempty"`
+	QueuedCount      int            `json:"queued_count,omitempty"`
+	SessionStartTime int64          `json:"session_start_time,omitempty"`
+	SkippedCount     int            `json:"skipped_count,omitempty"`
+	TotalDownloaded  float64        `json:"total_downloaded,omitempty"`
+}
+
+type DownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	ItemID        string `json:"item_id,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type DownloadTrackRequest struct {
+	AlbumArtist          string `json:"album_artist,omitempty"`
+	AlbumName            string `json:"album_name,omitempty"`
+	AllowFallback        *bool  `json:"allow_fallback,omitempty"`
+	ArtistName           string `json:"artist_name,omitempty"`
+	AudioFormat          string `json:"audio_format,omitempty"`
+	Copyright            string `json:"copyright,omitempty"`
+	CoverURL             string `json:"cover_url,omitempty"`
+	Duration             int    `json:"duration,omitempty"`
+	EmbedLyrics          *bool  `json:"embed_lyrics,omitempty"`
+	EmbedMaxQualityCover *bool  `json:"embed_max_quality_cover,omitempty"`
+	FilenameFormat       string `json:"filename_format,omitempty"`
+	OutputDir            string `json:"output_dir,omitempty"`
+	PlaylistName         string `json:"playlist_name,omitempty"`
+	PlaylistOwner        string `json:"playlist_owner,omitempty"`
+	Position             int    `json:"position,omitempty"`
+	Publisher            string `json:"publisher,omitempty"`
+	ReleaseDate          string `json:"release_date,omitempty"`
+	Service              string `json:"service,omitempty"`
+	ServiceURL           string `json:"service_url,omitempty"`
+	SpotifyDiscNumber    int    `json:"spotify_disc_number,omitempty"`
+	SpotifyID            string `json:"spotify_id,omitempty"`
+	SpotifyTotalDiscs    int    `json:"spotify_total_discs,omitempty"`
+	SpotifyTotalTracks   int    `json:"spotify_total_tracks,omitempty"`
+	SpotifyTrackNumber   int    `json:"spotify_track_number,omitempty"`
+	TrackName            string `json:"track_name,omitempty"`
+	TrackNumber          *bool  `json:"track_number,omitempty"`
+	UseAlbumTrackNumber  *bool  `json:"use_album_track_number,omitempty"`
+	UseFirstArtistOnly   *bool  `json:"use_first_artist_only,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+type FFmpegStatusResponse struct {
+	Installed bool `json:"installed,omitempty"`
+}
+
+type FetchHistoryItem struct {
+	Data      string `json:"data,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Image     string `json:"image,omitempty"`
+	Info      string `json:"info,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Type      string `json:"type,omitempty"`
+	URL       string `json:"url,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+}
+
+type FetchHistoryRequest struct {
+	Data  string `json:"data,omitempty"`
+	Image string `json:"image,omitempty"`
+	Info  string `json:"info,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+}
+
+type FileInfo struct {
+	Children []FileInfo `json:"children,omitempty"`
+	IsDir    bool       `json:"is_dir,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Path     string     `json:"path,omitempty"`
+	Size     int64      `json:"size,omitempty"`
+}
+
+type FileListResponse struct {
+	Files []FileInfo `json:"files,omitempty"`
+	Path  string     `json:"path,omitempty"`
+}
+
+type FileSizesRequest struct {
+	Files []string `json:"files"`
+}
+
+type GalleryBatchRequest struct {
+	ArtistName string   `json:"artist_name,omitempty"`
+	ImageURLs  []string `json:"image_urls"`
+	OutputDir  string   `json:"output_dir,omitempty"`
+}
+
+type GalleryImageDownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type GalleryImageRequest struct {
+	ArtistName string `json:"artist_name,omitempty"`
+	ImageIndex int    `json:"image_index,omitempty"`
+	ImageURL   string `json:"image_url,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+}
+
+type HeaderDownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type HeaderRequest struct {
+	ArtistName string `json:"artist_name,omitempty"`
+	HeaderURL  string `json:"header_url,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status,omitempty"`
+	Time   int64  `json:"time,omitempty"`
+}
+
+type HistoryItem struct {
+	Album       string `json:"album,omitempty"`
+	Artists     string `json:"artists,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	DurationStr string `json:"duration_str,omitempty"`
+	Format      string `json:"format,omitempty"`
+	ID          string `json:"id,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	Quality     string `json:"quality,omitempty"`
+	SpotifyID   string `json:"spotify_id,omitempty"`
+	Timestamp   int64  `json:"timestamp,omitempty"`
+	Title       string `json:"title,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+}
+
+type LoginRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+type LoginResponse struct {
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	User      UserInfo `json:"user,omitempty"`
+}
+
+type LyricsDownloadResponse struct {
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+	File          string `json:"file,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Success       bool   `json:"success,omitempty"`
+}
+
+type LyricsRequest struct {
+	AlbumArtist         string `json:"album_artist,omitempty"`
+	AlbumName           string `json:"album_name,omitempty"`
+	ArtistName          string `json:"artist_name,omitempty"`
+	CoverURL            string `json:"cover_url,omitempty"`
+	DiscNumber          int    `json:"disc_number,omitempty"`
+	FilenameFormat      string `json:"filename_format,omitempty"`
+	OutputDir           string `json:"output_dir,omitempty"`
+	Position            int    `json:"position,omitempty"`
+	ReleaseDate         string `json:"release_date,omitempty"`
+	SpotifyID           string `json:"spotify_id,omitempty"`
+	TrackName           string `json:"track_name,omitempty"`
+	TrackNumber         *bool  `json:"track_number,omitempty"`
+	UseAlbumTrackNumber *bool  `json:"use_album_track_number,omitempty"`
+}
+
+type MetadataRequest struct {
+	Batch   bool    `json:"batch,omitempty"`
+	Delay   float64 `json:"delay,omitempty"`
+	Timeout float64 `json:"timeout,omitempty"`
+	URL     string  `json:"url"`
+}
+
+type MirrorHealth struct {
+	ConsecutiveFailures int     `json:"consecutive_failures,omitempty"`
+	Failures            int64   `json:"failures,omitempty"`
+	LastError           string  `json:"last_error,omitempty"`
+	LastFailure         int64   `json:"last_failure,omitempty"`
+	LastSuccess         int64   `json:"last_success,omitempty"`
+	LatencyMs           float64 `json:"latency_ms,omitempty"`
+	Mirror              string  `json:"mirror,omitempty"`
+	OpenUntil           int64   `json:"open_until,omitempty"`
+	Provider            string  `json:"provider,omitempty"`
+	Requests            int64   `json:"requests,omitempty"`
+	Score               float64 `json:"score,omitempty"`
+	State               string  `json:"state,omitempty"`
+	SuccessRate         float64 `json:"success_rate,omitempty"`
+	Weight              float64 `json:"weight,omitempty"`
+}
+
+type MirrorHealthResponse struct {
+	Mirrors []MirrorHealth `json:"mirrors,omitempty"`
+	Time    int64          `json:"time,omitempty"`
+}
+
+type Principal struct {
+	Kind     string `json:"kind,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type ProgressInfo struct {
+	IsDownloading bool    `json:"is_downloading,omitempty"`
+	MbDownloaded  float64 `json:"mb_downloaded,omitempty"`
+	SpeedMbps     float64 `json:"speed_mbps,omitempty"`
+}
+
+type QueueItemResponse struct {
+	ItemID  string `json:"item_id,omitempty"`
+	Success bool   `json:"success,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+	Status     string                     `json:"status,omitempty"`
+	Time       int64                      `json:"time,omitempty"`
+}
+
+type RenamePreview struct {
+	Error    string        `json:"error,omitempty"`
+	Metadata AudioMetadata `json:"metadata,omitempty"`
+	NewName  string        `json:"new_name,omitempty"`
+	NewPath  string        `json:"new_path,omitempty"`
+	OldName  string        `json:"old_name,omitempty"`
+	OldPath  string        `json:"old_path,omitempty"`
+}
+
+type RenameRequest struct {
+	Files  []string `json:"files"`
+	Format string   `json:"format"`
+}
+
+type RenameResult struct {
+	Error   string `json:"error,omitempty"`
+	NewPath string `json:"new_path,omitempty"`
+	OldPath string `json:"old_path,omitempty"`
+	Success bool   `json:"success,omitempty"`
+}
+
+type SearchByTypeRequest struct {
+	Limit      int    `json:"limit,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Query      string `json:"query"`
+	SearchType string `json:"search_type"`
+}
+
+type SearchRequest struct {
+	Limit int    `json:"limit,omitempty"`
+	Query string `json:"query"`
+}
+
+type SearchResponse struct {
+	Albums    []SearchResult `json:"albums,omitempty"`
+	Artists   []SearchResult `json:"artists,omitempty"`
+	Playlists []SearchResult `json:"playlists,omitempty"`
+	Tracks    []SearchResult `json:"tracks,omitempty"`
+}
+
+type SearchResult struct {
+	AlbumName    string `json:"album_name,omitempty"`
+	Artists      string `json:"artists,omitempty"`
+	DurationMs   int    `json:"duration_ms,omitempty"`
+	ExternalURLs string `json:"external_urls,omitempty"`
+	ID           string `json:"id,omitempty"`
+	Images       string `json:"images,omitempty"`
+	IsExplicit   bool   `json:"is_explicit,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	ReleaseDate  string `json:"release_date,omitempty"`
+	TotalTracks  int    `json:"total_tracks,omitempty"`
+	Type         string `json:"type,omitempty"`
+}
+
+type SongLinkURLs struct {
+	AmazonURL string `json:"amazon_url,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+	TidalURL  string `json:"tidal_url,omitempty"`
+}
+
+type SpectrumData struct {
+	Duration   float64     `json:"duration,omitempty"`
+	FreqBins   int         `json:"freq_bins,omitempty"`
+	MaxFreq    float64     `json:"max_freq,omitempty"`
+	SampleRate int         `json:"sample_rate,omitempty"`
+	TimeSlices []TimeSlice `json:"time_slices,omitempty"`
+}
+
+type StreamingURLsRequest struct {
+	Region         string `json:"region,omitempty"`
+	SpotifyTrackID string `json:"spotify_track_id"`
+}
+
+type SuccessResponse struct {
+	Success bool `json:"success,omitempty"`
+}
+
+type TimeSlice struct {
+	Magnitudes []float64 `json:"magnitudes,omitempty"`
+	Time       float64   `json:"time,omitempty"`
+}
+
+type TrackAvailability struct {
+	Amazon    bool   `json:"amazon,omitempty"`
+	AmazonURL string `json:"amazon_url,omitempty"`
+	Qobuz     bool   `json:"qobuz,omitempty"`
+	QobuzURL  string `json:"qobuz_url,omitempty"`
+	SpotifyID string `json:"spotify_id,omitempty"`
+	Tidal     bool   `json:"tidal,omitempty"`
+	TidalURL  string `json:"tidal_url,omitempty"`
+}
+
+type UpdateUserRequest struct {
+	Password *string `json:"password,omitempty"`
+	Role     *string `json:"role,omitempty"`
+}
+
+type UserInfo struct {
+	CreatedAt int64        `json:"created_at,omitempty"`
+	ID        string       `json:"id,omitempty"`
+	Role      string       `json:"role,omitempty"`
+	Settings  UserSettings `json:"settings,omitempty"`
+	Username  string       `json:"username,omitempty"`
+}
+
+type UserSettings struct {
+	AllowFallback        *bool   `json:"allow_fallback,omitempty"`
+	AudioFormat          *string `json:"audio_format,omitempty"`
+	CreateM3U8           *bool   `json:"create_m3u8,omitempty"`
+	DefaultService       *string `json:"default_service,omitempty"`
+	EmbedLyrics          *bool   `json:"embed_lyrics,omitempty"`
+	EmbedMaxQualityCover *bool   `json:"embed_max_quality_cover,omitempty"`
+	FilenameFormat       *string `json:"filename_format,omitempty"`
+	FontFamily           *string `json:"font_family,omitempty"`
+	Theme                *string `json:"theme,omitempty"`
+	ThemeMode            *string `json:"theme_mode,omitempty"`
+	TrackNumber          *bool   `json:"track_number,omitempty"`
+	UseAlbumTrackNumber  *bool   `json:"use_album_track_number,omitempty"`
+	UseFirstArtistOnly   *bool   `json:"use_first_artist_only,omitempty"`
+}
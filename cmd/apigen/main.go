@@ -0,0 +1,340 @@
+// Command apigen generates the Go client in client/ from the OpenAPI
+// document the server builds from its routes, so the client cannot drift
+// from the API. It writes one type per schema and one method per
+// operation:
+//
+//	go generate ./client
+//
+// With -check it only reports whether the generated files are current,
+// for use in CI.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"spotiflac/server/api"
+)
+
+const header = "// Code generated by go run ./cmd/apigen; DO NOT EDIT.\n\n"
+
+func main() {
+	out := flag.String("out", "client", "directory of the client package")
+	check := flag.Bool("check", false, "fail if the generated files are out of date instead of writing them")
+	flag.Parse()
+
+	doc, err := api.BuildOpenAPI(nil)
+	if err != nil {
+		log.Fatalf("Failed to build OpenAPI document: %v", err)
+	}
+
+	files := map[string][]byte{
+		"types.go":      generateTypes(doc),
+		"operations.go": generateOperations(doc),
+	}
+
+	stale := false
+	for name, src := range files {
+		formatted, err := format.Source(src)
+		if err != nil {
+			log.Fatalf("Generated %s does not compile: %v\n%s", name, err, src)
+		}
+
+		path := filepath.Join(*out, name)
+		if *check {
+			current, _ := os.ReadFile(path)
+			if !bytes.Equal(current, formatted) {
+				fmt.Fprintf(os.Stderr, "%s is out of date, run go generate ./client\n", path)
+				stale = true
+			}
+			continue
+		}
+		if err := os.WriteFile(path, formatted, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+// generateTypes writes a struct for every component schema
+func generateTypes(doc *api.OpenAPIDocument) []byte {
+	var body bytes.Buffer
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		fmt.Fprintf(&body, "type %s %s\n\n", name, goStruct(doc.Components.Schemas[name]))
+	}
+	return withImports(body.String())
+}
+
+// generateOperations writes a method for every operation. HEAD requests
+// and the WebSocket upgrade have no use in a Go client and are skipped.
+func generateOperations(doc *api.OpenAPIDocument) []byte {
+	var body bytes.Buffer
+	for _, path := range sortedKeys(doc.Paths) {
+		for _, method := range sortedKeys(doc.Paths[path]) {
+			op := doc.Paths[path][method]
+			if method == "head" || op.Responses["101"] != nil {
+				continue
+			}
+			writeOperation(&body, strings.ToUpper(method), path, op)
+		}
+	}
+	return withImports(body.String())
+}
+
+func writeOperation(w *bytes.Buffer, method, path string, op *api.OpenAPIOperation) {
+	args := []string{"ctx context.Context"}
+	var query []api.OpenAPIParameter
+	for _, param := range op.Parameters {
+		if param.In == "path" {
+			args = append(args, lowerName(param.Name)+" string")
+		} else {
+			query = append(query, param)
+		}
+	}
+
+	// Path segments are escaped, query parameters come from a Params struct
+	pathExpr := strconv.Quote(path)
+	for _, param := range op.Parameters {
+		if param.In == "path" {
+			pathExpr = strings.ReplaceAll(pathExpr, "{"+param.Name+"}", `"+url.PathEscape(`+lowerName(param.Name)+`)+"`)
+		}
+	}
+	pathExpr = strings.TrimSuffix(pathExpr, `+""`)
+
+	paramsType := op.OperationID + "Params"
+	if len(query) > 0 {
+		fmt.Fprintf(w, "// %s are the query parameters of %s\ntype %s struct {\n", paramsType, op.OperationID, paramsType)
+		for _, param := range query {
+			if param.Description != "" {
+				fmt.Fprintf(w, "// %s\n", param.Description)
+			}
+			fmt.Fprintf(w, "%s %s\n", goName(param.Name), goType(param.Schema, false))
+		}
+		fmt.Fprintf(w, "}\n\n")
+		args = append(args, "params *"+paramsType)
+	}
+
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		args = append(args, "body "+goType(op.RequestBody.Content["application/json"].Schema, false))
+		bodyArg = "body"
+	}
+
+	success := successResponse(op)
+	var result string
+	var raw bool
+	if success != nil {
+		for contentType, media := range success.Content {
+			if contentType == "application/json" {
+				result = goType(media.Schema, true)
+			} else {
+				raw = true
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "// %s calls %s %s", op.OperationID, method, path)
+	if op.Summary != "" {
+		fmt.Fprintf(w, ": %s", op.Summary)
+	}
+	fmt.Fprintf(w, ".\n")
+	if raw {
+		fmt.Fprintf(w, "// The caller reads and closes the response body.\n")
+	}
+
+	queryArg := "nil"
+	switch {
+	case raw:
+		fmt.Fprintf(w, "func (c *Client) %s(%s) (*http.Response, error) {\n", op.OperationID, strings.Join(args, ", "))
+	case result != "":
+		fmt.Fprintf(w, "func (c *Client) %s(%s) (%s, error) {\n", op.OperationID, strings.Join(args, ", "), result)
+	default:
+		fmt.Fprintf(w, "func (c *Client) %s(%s) error {\n", op.OperationID, strings.Join(args, ", "))
+	}
+
+	if len(query) > 0 {
+		queryArg = "query"
+		fmt.Fprintf(w, "query := url.Values{}\nif params != nil {\n")
+		for _, param := range query {
+			field := "params." + goName(param.Name)
+			switch param.Schema.Type {
+			case "boolean":
+				fmt.Fprintf(w, "if %s {\nquery.Set(%q, \"true\")\n}\n", field, param.Name)
+			case "integer":
+				fmt.Fprintf(w, "if %s != 0 {\nquery.Set(%q, strconv.Itoa(%s))\n}\n", field, param.Name, field)
+			default:
+				fmt.Fprintf(w, "if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, param.Name, field)
+			}
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+
+	switch {
+	case raw:
+		fmt.Fprintf(w, "return c.send(ctx, %q, %s, %s, %s)\n", method, pathExpr, queryArg, bodyArg)
+	case result != "":
+		fmt.Fprintf(w, "var out %s\nerr := c.do(ctx, %q, %s, %s, %s, &out)\nreturn out, err\n", result, method, pathExpr, queryArg, bodyArg)
+	default:
+		fmt.Fprintf(w, "return c.do(ctx, %q, %s, %s, %s, nil)\n", method, pathExpr, queryArg, bodyArg)
+	}
+	fmt.Fprintf(w, "}\n\n")
+}
+
+// successResponse returns the 2xx response of an operation
+func successResponse(op *api.OpenAPIOperation) *api.OpenAPIResponse {
+	for status, response := range op.Responses {
+		if strings.HasPrefix(status, "2") {
+			return response
+		}
+	}
+	return nil
+}
+
+// goStruct renders an object schema as a struct type. Fields are sorted by
+// JSON name; required fields are always sent.
+func goStruct(s *api.Schema) string {
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range sortedKeys(s.Properties) {
+		tag := name
+		if !contains(s.Required, name) {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", goName(name), goType(s.Properties[name], false), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// goType maps a schema to a Go type. Schemas that allow any value become
+// json.RawMessage as a result, so callers can decode them into their own
+// types, and any elsewhere.
+func goType(s *api.Schema, result bool) string {
+	if s == nil {
+		return "any"
+	}
+	if s.Ref != "" {
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	}
+
+	var t string
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			t = "time.Time"
+		case "byte":
+			t = "[]byte"
+		default:
+			t = "string"
+		}
+	case "integer":
+		t = "int"
+		if s.Format == "int64" {
+			t = "int64"
+		}
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		return "[]" + goType(s.Items, false)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + goType(s.AdditionalProperties, false)
+		}
+		return goStruct(s)
+	default:
+		if result {
+			return "json.RawMessage"
+		}
+		return "any"
+	}
+
+	if s.Nullable {
+		return "*" + t
+	}
+	return t
+}
+
+// initialisms are kept upper case in Go names
+var initialisms = map[string]string{
+	"api": "API", "id": "ID", "ids": "IDs", "ip": "IP", "isrc": "ISRC", "json": "JSON",
+	"m3u8": "M3U8", "ui": "UI", "url": "URL", "urls": "URLs", "utc": "UTC",
+}
+
+// goName converts a JSON name such as spotify_id or downloadPath to an
+// exported Go name
+func goName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if upper, ok := initialisms[strings.ToLower(part)]; ok {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func lowerName(name string) string {
+	n := goName(name)
+	if upper, ok := initialisms[strings.ToLower(name)]; ok && upper == n {
+		return strings.ToLower(n)
+	}
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+// withImports prepends the package clause and the imports src uses
+func withImports(src string) []byte {
+	imports := []string{}
+	for _, imp := range []struct{ path, use string }{
+		{"context", "context."},
+		{"encoding/json", "json."},
+		{"net/http", "http."},
+		{"net/url", "url."},
+		{"strconv", "strconv."},
+		{"time", "time."},
+	} {
+		if strings.Contains(src, imp.use) {
+			imports = append(imports, strconv.Quote(imp.path))
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("package client\n\n")
+	if len(imports) > 0 {
+		fmt.Fprintf(&b, "import (\n%s\n)\n\n", strings.Join(imports, "\n"))
+	}
+	b.WriteString(src)
+	return b.Bytes()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
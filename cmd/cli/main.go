@@ -43,6 +43,7 @@ Download Spotify tracks, albums, and playlists using configuration from config.y
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		// Cleanup
+		backend.FlushMirrorHealth()
 		backend.CloseHistoryDB()
 	},
 }
@@ -229,14 +230,13 @@ var configSetCmd = &cobra.Command{
 		key := args[0]
 		value := args[1]
 
-		if err := setConfigValue(cfg, key, value); err != nil {
+		err := config.Update(configFile, func(next *config.Config) error {
+			return setConfigValue(next, key, value)
+		})
+		if err != nil {
 			log.Fatalf("Failed to set config value: %v", err)
 		}
 
-		if err := config.Save(cfg, configFile); err != nil {
-			log.Fatalf("Failed to save configuration: %v", err)
-		}
-
 		if !jsonOutput {
 			fmt.Printf("Set %s = %s\n", key, value)
 		} else {
@@ -289,8 +289,13 @@ func getConfigValue(cfg *config.Config, key string) interface{} {
 		switch parts[1] {
 		case "default_service":
 			return cfg.Services.DefaultService
-		case "tidal_api_url":
-			return cfg.Services.TidalAPIURL
+		}
+	case "providers":
+		if len(parts) == 1 {
+			return cfg.Providers
+		}
+		if provider, ok := cfg.Providers[parts[1]]; ok {
+			return provider.Endpoints
 		}
 	case "server":
 		if len(parts) == 1 {
@@ -337,8 +342,6 @@ func setConfigValue(cfg *config.Config, key, value string) error {
 		switch parts[1] {
 		case "default_service":
 			cfg.Services.DefaultService = value
-		case "tidal_api_url":
-			cfg.Services.TidalAPIURL = value
 		default:
 			return fmt.Errorf("unknown config key: %s", key)
 		}
@@ -1,12 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"spotiflac/backend"
 	"spotiflac/backend/config"
 	"spotiflac/server"
 )
@@ -23,12 +25,21 @@ func main() {
 
 	cfg, err := config.Load(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
 	}
 
-	log.Printf("Configuration loaded successfully")
-	log.Printf("Server will listen on %s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Download path: %s", cfg.Download.Path)
+	if err := backend.ConfigureLogging(os.Stderr, cfg.Logging.Level, cfg.Logging.Format); err != nil {
+		slog.Error("Failed to configure logging", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Configuration loaded",
+		"host", cfg.Server.Host,
+		"port", cfg.Server.Port,
+		"download_path", cfg.Download.Path,
+		"log_level", cfg.Logging.Level,
+	)
 
 	// Create and configure server
 	srv := server.NewServer(cfg)
@@ -38,18 +49,49 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	// SIGHUP reloads the provider endpoints from the configuration file
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 	go func() {
-		<-sigChan
-		fmt.Println("\nShutting down server...")
-		if err := srv.Stop(); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+		for range hupChan {
+			if err := srv.ReloadProviders(); err != nil {
+				slog.Error("Failed to reload providers, keeping the current endpoints", "error", err)
+				continue
+			}
+			slog.Info("AUDIT providers reloaded", "by", "SIGHUP")
 		}
-		os.Exit(0)
 	}()
 
 	// Start server
 	// Following rule #10: Run with least privilege (non-root user)
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Start()
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			slog.Error("Server failed to start", "error", err)
+			os.Exit(1)
+		}
+
+	case sig := <-sigChan:
+		timeout := time.Duration(cfg.Server.ShutdownTimeoutSeconds) * time.Second
+		drainTimeout := time.Duration(cfg.Server.DrainTimeoutSeconds) * time.Second
+		slog.Info("Shutting down server", "signal", sig.String(), "timeout", timeout.String(), "drain_timeout", drainTimeout.String())
+
+		// A second signal skips the drain
+		go func() {
+			<-sigChan
+			slog.Warn("Forced shutdown")
+			os.Exit(1)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Stop(ctx); err != nil {
+			slog.Error("Error during shutdown", "error", err)
+		}
 	}
 }
@@ -39,7 +39,6 @@ import { useAvailability } from "@/hooks/useAvailability";
 import { useDownloadQueueDialog } from "@/hooks/useDownloadQueueDialog";
 import { useDownloadProgress } from "@/hooks/useDownloadProgress";
 import { WindowMinimise, WindowToggleMaximise, Quit, OnFileDrop, OnFileDropOff } from "./api/runtime";
-const HISTORY_KEY = "spotiflac_fetch_history";
 const MAX_HISTORY = 5;
 function App() {
     const [currentPage, setCurrentPage] = useState<PageType>("main");
@@ -165,12 +164,18 @@ function App() {
             console.error("Failed to check for updates:", err);
         }
     };
-    const loadHistory = () => {
+    const loadHistory = async () => {
         try {
-            const saved = localStorage.getItem(HISTORY_KEY);
-            if (saved) {
-                setFetchHistory(JSON.parse(saved));
-            }
+            const items = await apiClient.GetFetchHistory();
+            setFetchHistory((items || []).slice(0, MAX_HISTORY).map((item: any) => ({
+                id: item.id,
+                url: item.url,
+                type: item.type,
+                name: item.name,
+                artist: item.info,
+                image: item.image,
+                timestamp: item.timestamp * 1000,
+            })));
         }
         catch (err) {
             console.error("Failed to load history:", err);
@@ -214,33 +219,30 @@ function App() {
             setFfmpegInstallStatus("");
         }
     };
-    const saveHistory = (history: HistoryItem[]) => {
+    const addToHistory = async (item: Omit<HistoryItem, "id" | "timestamp">, data: unknown) => {
         try {
-            localStorage.setItem(HISTORY_KEY, JSON.stringify(history));
+            await apiClient.AddFetchHistory({
+                url: item.url,
+                type: item.type,
+                name: item.name,
+                info: item.artist,
+                image: item.image,
+                data: JSON.stringify(data),
+            });
+            await loadHistory();
         }
         catch (err) {
             console.error("Failed to save history:", err);
         }
     };
-    const addToHistory = (item: Omit<HistoryItem, "id" | "timestamp">) => {
-        setFetchHistory((prev) => {
-            const filtered = prev.filter((h) => h.url !== item.url);
-            const newItem: HistoryItem = {
-                ...item,
-                id: crypto.randomUUID(),
-                timestamp: Date.now(),
-            };
-            const updated = [newItem, ...filtered].slice(0, MAX_HISTORY);
-            saveHistory(updated);
-            return updated;
-        });
-    };
-    const removeFromHistory = (id: string) => {
-        setFetchHistory((prev) => {
-            const updated = prev.filter((h) => h.id !== id);
-            saveHistory(updated);
-            return updated;
-        });
+    const removeFromHistory = async (id: string) => {
+        setFetchHistory((prev) => prev.filter((h) => h.id !== id));
+        try {
+            await apiClient.DeleteFetchHistoryItem(id);
+        }
+        catch (err) {
+            console.error("Failed to remove history item:", err);
+        }
     };
     const handleHistorySelect = async (item: HistoryItem) => {
         setSpotifyUrl(item.url);
@@ -300,7 +302,7 @@ function App() {
             };
         }
         if (historyItem) {
-            addToHistory(historyItem);
+            addToHistory(historyItem, metadata.metadata);
         }
     }, [metadata.metadata]);
     const handleSearchChange = (value: string) => {
@@ -150,25 +150,33 @@ class ApiClient {
     }
 
     async GetFetchHistory(): Promise<any[]> {
-        // This is stored client-side in the current implementation
-        // Keep using localStorage
-        return [];
+        return this.fetch('/api/history/fetch');
     }
 
-    async AddFetchHistory(item: any): Promise<void> {
-        // Client-side only
+    async AddFetchHistory(item: {
+        url: string;
+        type: string;
+        name?: string;
+        info?: string;
+        image?: string;
+        data?: string;
+    }): Promise<void> {
+        await this.fetch('/api/history/fetch', {
+            method: 'POST',
+            body: JSON.stringify(item),
+        });
     }
 
     async ClearFetchHistory(): Promise<void> {
-        // Client-side only
+        await this.fetch('/api/history/fetch/clear', { method: 'POST' });
     }
 
     async DeleteFetchHistoryItem(id: string): Promise<void> {
-        // Client-side only
+        await this.fetch(`/api/history/fetch/${encodeURIComponent(id)}`, { method: 'DELETE' });
     }
 
     async ClearFetchHistoryByType(itemType: string): Promise<void> {
-        // Client-side only
+        await this.fetch(`/api/history/fetch/clear?type=${encodeURIComponent(itemType)}`, { method: 'POST' });
     }
 
     // ==================== Settings ====================
@@ -225,6 +233,44 @@ class ApiClient {
         return '';
     }
 
+    // ==================== File Manager ====================
+    // Paths are limited to the download directory on the server
+
+    async ListDirectoryFiles(dirPath: string): Promise<any[]> {
+        const data = await this.fetch<{ files: any[] }>(`/api/files/list?path=${encodeURIComponent(dirPath)}`);
+        return data.files;
+    }
+
+    async ListAudioFilesInDir(dirPath: string): Promise<any[]> {
+        const data = await this.fetch<{ files: any[] }>(`/api/files/audio?path=${encodeURIComponent(dirPath)}`);
+        return data.files;
+    }
+
+    async ReadFileMetadata(filePath: string): Promise<any> {
+        return this.fetch(`/api/files/metadata?path=${encodeURIComponent(filePath)}`);
+    }
+
+    async GetFileSizes(files: string[]): Promise<Record<string, number>> {
+        return this.fetch('/api/files/sizes', {
+            method: 'POST',
+            body: JSON.stringify({ files }),
+        });
+    }
+
+    async PreviewRenameFiles(files: string[], format: string): Promise<any[]> {
+        return this.fetch('/api/files/rename/preview', {
+            method: 'POST',
+            body: JSON.stringify({ files, format }),
+        });
+    }
+
+    async RenameFilesByMetadata(files: string[], format: string): Promise<any[]> {
+        return this.fetch('/api/files/rename', {
+            method: 'POST',
+            body: JSON.stringify({ files, format }),
+        });
+    }
+
     // ==================== Analysis ====================
 
     async AnalyzeTrack(filePath: string): Promise<string> {
@@ -244,14 +290,59 @@ class ApiClient {
     // ==================== Lyrics & Covers ====================
 
     async DownloadLyrics(req: any): Promise<any> {
-        // These could be added as API endpoints if needed
-        console.warn('DownloadLyrics would need API endpoint');
-        return { success: false };
+        return this.fetch('/api/download/lyrics', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadLyricsBatch(req: { tracks: any[]; [option: string]: any }): Promise<any> {
+        return this.fetch('/api/download/lyrics/batch', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
     }
 
     async DownloadCover(req: any): Promise<any> {
-        console.warn('DownloadCover would need API endpoint');
-        return { success: false };
+        return this.fetch('/api/download/cover', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadCoverBatch(req: { tracks: any[]; [option: string]: any }): Promise<any> {
+        return this.fetch('/api/download/cover/batch', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadHeader(req: any): Promise<any> {
+        return this.fetch('/api/download/header', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadGalleryImage(req: any): Promise<any> {
+        return this.fetch('/api/download/gallery', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadGalleryBatch(req: { image_urls: string[]; artist_name: string; output_dir?: string }): Promise<any> {
+        return this.fetch('/api/download/gallery/batch', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
+    }
+
+    async DownloadAvatar(req: any): Promise<any> {
+        return this.fetch('/api/download/avatar', {
+            method: 'POST',
+            body: JSON.stringify(req),
+        });
     }
 
     // ==================== Other ====================
@@ -265,13 +356,42 @@ class ApiClient {
         console.warn('CreateM3U8File not implemented');
     }
 
-    async CheckTrackAvailability(spotifyUrl: string): Promise<any> {
-        return this.fetch('/api/analysis/availability', {
+    async StartAvailabilityCheck(spotifyIds: string[]): Promise<{
+        check_id: string;
+        status: string;
+        total: number;
+        queued_ahead: number;
+    }> {
+        return this.fetch('/api/availability', {
             method: 'POST',
-            body: JSON.stringify({ spotify_url: spotifyUrl }),
+            body: JSON.stringify({ spotify_ids: spotifyIds }),
         });
     }
 
+    async GetAvailabilityCheck(checkId: string): Promise<any> {
+        return this.fetch(`/api/availability/${encodeURIComponent(checkId)}`);
+    }
+
+    async CancelAvailabilityCheck(checkId: string): Promise<any> {
+        return this.fetch(`/api/availability/${encodeURIComponent(checkId)}`, { method: 'DELETE' });
+    }
+
+    // Checks one track and resolves with the result as JSON once the
+    // server got to it; song.link allows only a few lookups per minute
+    async CheckTrackAvailability(spotifyId: string): Promise<string> {
+        const { check_id } = await this.StartAvailabilityCheck([spotifyId]);
+        for (;;) {
+            await new Promise((resolve) => setTimeout(resolve, 2000));
+            const check = await this.GetAvailabilityCheck(check_id);
+            if (check.status === 'completed' || check.status === 'cancelled') {
+                if (check.results?.length) {
+                    return JSON.stringify(check.results[0]);
+                }
+                throw new Error(check.errors?.[spotifyId] || 'Availability check failed');
+            }
+        }
+    }
+
     async GetPreviewURL(spotifyID: string): Promise<string> {
         const data = await this.fetch<{ preview_url: string }>('/api/preview/' + spotifyID);
         return data.preview_url || '';
@@ -13,10 +13,10 @@ import { getSettings } from "@/lib/settings";
 import { Dialog, DialogContent, DialogDescription, DialogFooter, DialogHeader, DialogTitle, } from "@/components/ui/dialog";
 import { apiClient } from "../api/client";
 // File Manager functions will use API client
-const ListDirectoryFiles = (path: string): Promise<any[]> => (window as any)['go']['main']['App']['ListDirectoryFiles'](path);
-const PreviewRenameFiles = (files: string[], format: string): Promise<any[]> => (window as any)['go']['main']['App']['PreviewRenameFiles'](files, format);
-const RenameFilesByMetadata = (files: string[], format: string): Promise<any[]> => (window as any)['go']['main']['App']['RenameFilesByMetadata'](files, format);
-const ReadFileMetadata = (path: string): Promise<any> => (window as any)['go']['main']['App']['ReadFileMetadata'](path);
+const ListDirectoryFiles = (path: string): Promise<any[]> => apiClient.ListDirectoryFiles(path);
+const PreviewRenameFiles = (files: string[], format: string): Promise<any[]> => apiClient.PreviewRenameFiles(files, format);
+const RenameFilesByMetadata = (files: string[], format: string): Promise<any[]> => apiClient.RenameFilesByMetadata(files, format);
+const ReadFileMetadata = (path: string): Promise<any> => apiClient.ReadFileMetadata(path);
 const ReadTextFile = (path: string): Promise<string> => (window as any)['go']['main']['App']['ReadTextFile'](path);
 const RenameFileTo = (oldPath: string, newName: string): Promise<void> => (window as any)['go']['main']['App']['RenameFileTo'](oldPath, newName);
 const ReadImageAsBase64 = (path: string): Promise<string> => (window as any)['go']['main']['App']['ReadImageAsBase64'](path);
@@ -185,7 +185,12 @@ export function HistoryPage({ onHistorySelect }: HistoryPageProps) {
         setDownloadHistory(prev => prev.filter(item => item.id !== id));
     };
     const handleClearFetchHistory = async () => {
-        await apiClient.ClearFetchHistoryByType(activeFetchTab);
+        if (activeFetchTab === "all") {
+            await apiClient.ClearFetchHistory();
+        }
+        else {
+            await apiClient.ClearFetchHistoryByType(activeFetchTab);
+        }
         fetchFetchHistory();
         setShowClearFetchConfirm(false);
     };
@@ -50,15 +50,23 @@ export async function downloadCover(request: CoverDownloadRequest): Promise<Cove
     return await apiClient.DownloadCover(request);
 }
 
-// Note: The following image download functions are not yet implemented on the server
+/**
+ * Downloads an artist's header image
+ */
 export async function downloadHeader(request: HeaderDownloadRequest): Promise<HeaderDownloadResponse> {
-    return { success: false, message: "Not implemented" };
+    return await apiClient.DownloadHeader(request);
 }
 
+/**
+ * Downloads one image of an artist's gallery
+ */
 export async function downloadGalleryImage(request: GalleryImageDownloadRequest): Promise<GalleryImageDownloadResponse> {
-    return { success: false, message: "Not implemented" };
+    return await apiClient.DownloadGalleryImage(request);
 }
 
+/**
+ * Downloads an artist's avatar
+ */
 export async function downloadAvatar(request: AvatarDownloadRequest): Promise<AvatarDownloadResponse> {
-    return { success: false, message: "Not implemented" };
+    return await apiClient.DownloadAvatar(request);
 }
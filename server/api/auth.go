@@ -0,0 +1,356 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Principal kinds
+const (
+	PrincipalAPIKey    = "api_key"
+	PrincipalUser      = "user"
+	PrincipalAnonymous = "anonymous"
+	// PrincipalNone is the caller of a route without AuthRequired
+	PrincipalNone = "none"
+)
+
+// noUserScope is the scope of principals without a user account that are
+// not admins; no item belongs to it, so they see nothing
+const noUserScope = "\x00none"
+
+// principalContextKey is the gin context key holding the *Principal of an
+// authenticated request
+const principalContextKey = "principal"
+
+// sessionTokenVersion prefixes session tokens so the format can change
+// without accepting old tokens under new rules
+const sessionTokenVersion = "v1"
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Principal is the caller of an authenticated request. UserID is set for
+// user accounts and API keys bound to one.
+type Principal struct {
+	Kind     string           `json:"kind"`
+	Name     string           `json:"name"`
+	UserID   string           `json:"user_id,omitempty"`
+	Username string           `json:"username,omitempty"`
+	Role     backend.UserRole `json:"role"`
+}
+
+// IsAdmin reports whether the caller may see and manage everything
+func (p *Principal) IsAdmin() bool {
+	return p.Role == backend.RoleAdmin
+}
+
+// Scope returns the user ID the caller's view of the queue, history and
+// events is limited to. Admins are not limited and get "".
+func (p *Principal) Scope() string {
+	if p.IsAdmin() {
+		return ""
+	}
+	if p.UserID == "" {
+		return noUserScope
+	}
+	return p.UserID
+}
+
+// userPrincipal builds the principal of a user account
+func userPrincipal(kind, name string, user backend.User) *Principal {
+	return &Principal{
+		Kind:     kind,
+		Name:     name,
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	}
+}
+
+// Authenticator checks API keys and issues/verifies signed session tokens
+// for the user accounts in the database. It is safe for concurrent use.
+type Authenticator struct {
+	enabled           bool
+	apiKeys           []config.APIKeyConfig
+	secret            []byte
+	sessionTTL        time.Duration
+	minPasswordLength int
+	dummyHash         []byte
+}
+
+// sessionClaims is the signed payload of a session token
+type sessionClaims struct {
+	Subject   string `json:"sub"`
+	Version   int    `json:"ver"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// NewAuthenticator builds an Authenticator from the auth config section and
+// creates the admin accounts listed in it. The history database must be
+// initialized. Without a configured session secret a random one is
+// generated, so session tokens stop working when the process restarts.
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	for _, user := range cfg.Users {
+		created, err := backend.EnsureAdminUser(user.Username, user.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user %q: %w", user.Username, err)
+		}
+		if created {
+			slog.Info("AUDIT admin account created from config", "user", user.Username)
+		}
+	}
+
+	// An enabled auth section without any credential would lock everyone out
+	if cfg.Enabled && len(cfg.AllAPIKeys()) == 0 && backend.CountUsers() == 0 {
+		return nil, errors.New("auth is enabled but no API keys or users are configured (set SPOTIFLAC_API_KEYS or add auth.users)")
+	}
+
+	a := &Authenticator{
+		enabled:           cfg.Enabled,
+		apiKeys:           cfg.AllAPIKeys(),
+		sessionTTL:        time.Duration(cfg.SessionTTLHours) * time.Hour,
+		minPasswordLength: cfg.MinPasswordLength,
+	}
+
+	if secret := cfg.EffectiveSessionSecret(); secret != "" {
+		a.secret = []byte(secret)
+	} else {
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			return nil, err
+		}
+		if a.enabled && backend.CountUsers() > 0 {
+			slog.Warn("No session secret configured, sessions will not survive a restart (set SPOTIFLAC_SESSION_SECRET)")
+		}
+	}
+
+	// Compared against for unknown usernames so a failed login takes the
+	// same time whether or not the user exists
+	dummy := make([]byte, 16)
+	rand.Read(dummy)
+	hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(dummy)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	a.dummyHash = hash
+
+	return a, nil
+}
+
+// Enabled reports whether requests must be authenticated
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// authenticateAPIKey resolves an API key to its principal. Every key is
+// compared in constant time so the response time does not leak prefixes.
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, bool) {
+	var match *config.APIKeyConfig
+	for i := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(a.apiKeys[i].Key), []byte(key)) == 1 {
+			match = &a.apiKeys[i]
+		}
+	}
+	if match == nil {
+		return nil, false
+	}
+
+	if match.User == "" {
+		return &Principal{Kind: PrincipalAPIKey, Name: match.Name, Role: backend.RoleAdmin}, true
+	}
+	user, err := backend.GetUserByUsername(match.User)
+	if err != nil {
+		slog.Warn("API key is bound to unknown user", "key", match.Name, "user", match.User)
+		return nil, false
+	}
+	return userPrincipal(PrincipalAPIKey, match.Name, user), true
+}
+
+// checkPassword verifies a username/password pair against the stored bcrypt
+// hash
+func (a *Authenticator) checkPassword(username, password string) (backend.User, bool) {
+	user, err := backend.GetUserByUsername(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return backend.User{}, false
+	}
+	return user, user.CheckPassword(password)
+}
+
+// validatePassword enforces the configured password policy
+func (a *Authenticator) validatePassword(password string) error {
+	if len(password) < a.minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", a.minPasswordLength)
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything after 72 bytes
+		return fmt.Errorf("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+// issueToken signs a session token for user
+func (a *Authenticator) issueToken(user backend.User, now time.Time) (string, time.Time, error) {
+	expires := now.Add(a.sessionTTL)
+	payload, err := json.Marshal(sessionClaims{
+		Subject:   user.ID,
+		Version:   user.TokenVersion,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	body := sessionTokenVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + a.sign(body), expires, nil
+}
+
+// verifyToken checks the signature and expiry of a session token and
+// returns its user. Tokens of deleted users and tokens issued before the
+// last password change are rejected.
+func (a *Authenticator) verifyToken(token string, now time.Time) (backend.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != sessionTokenVersion {
+		return backend.User{}, errInvalidToken
+	}
+
+	body := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(a.sign(body)), []byte(parts[2])) {
+		return backend.User{}, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return backend.User{}, errInvalidToken
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return backend.User{}, errInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return backend.User{}, errInvalidToken
+	}
+
+	user, err := backend.GetUser(claims.Subject)
+	if err != nil || user.TokenVersion != claims.Version {
+		return backend.User{}, errInvalidToken
+	}
+
+	return user, nil
+}
+
+func (a *Authenticator) sign(body string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authenticate resolves a credential (API key or session token) to a
+// principal
+func (a *Authenticator) authenticate(credential string) (*Principal, bool) {
+	if credential == "" {
+		return nil, false
+	}
+	if strings.HasPrefix(credential, sessionTokenVersion+".") {
+		user, err := a.verifyToken(credential, time.Now())
+		if err != nil {
+			return nil, false
+		}
+		return userPrincipal(PrincipalUser, user.Username, user), true
+	}
+	return a.authenticateAPIKey(credential)
+}
+
+// anonymousPrincipal is the caller when authentication is disabled: a
+// single-user setup where everything is visible. Only AuthRequired hands
+// it out.
+func anonymousPrincipal() *Principal {
+	return &Principal{Kind: PrincipalAnonymous, Name: PrincipalAnonymous, Role: backend.RoleAdmin}
+}
+
+// CurrentPrincipal returns the caller set by AuthRequired. Routes without
+// it get a principal without any rights (rule #15: Fail Securely), so a
+// missing middleware never grants admin access.
+func CurrentPrincipal(c *gin.Context) *Principal {
+	if value, ok := c.Get(principalContextKey); ok {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return &Principal{Kind: PrincipalNone, Name: PrincipalNone}
+}
+
+// LoginRequest is the body of POST /api/auth/login
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse is the body of a successful login
+type LoginResponse struct {
+	Token     string   `json:"token"`
+	TokenType string   `json:"token_type"`
+	ExpiresAt int64    `json:"expires_at"`
+	User      UserInfo `json:"user"`
+}
+
+// Login exchanges a username and password for a session token
+// Endpoint: POST /api/auth/login
+func (h *Handler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+
+	if h.auth == nil || !h.auth.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Password login is not enabled"})
+		return
+	}
+
+	// Audit log (rule #16): never log the password
+	user, ok := h.auth.checkPassword(req.Username, req.Password)
+	if !ok {
+		slog.WarnContext(c.Request.Context(), "AUDIT login failed", "user", req.Username, "client_ip", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	token, expires, err := h.auth.issueToken(user, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "AUDIT login succeeded", "user", user.Username, "client_ip", c.ClientIP())
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expires.Unix(),
+		User:      newUserInfo(user),
+	})
+}
+
+// Me returns the authenticated caller
+// Endpoint: GET /api/auth/me
+func (h *Handler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, CurrentPrincipal(c))
+}
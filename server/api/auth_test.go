@@ -0,0 +1,142 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"spotiflac/backend"
+)
+
+// initTestDB opens a fresh history database below a temporary home
+// directory and closes it when the test ends
+func initTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := backend.InitHistoryDB("SpotiFLAC"); err != nil {
+		t.Fatalf("InitHistoryDB() error = %v", err)
+	}
+	t.Cleanup(backend.CloseHistoryDB)
+}
+
+// createTestUser stores a user account with a throwaway password
+func createTestUser(t *testing.T, username string, role backend.UserRole) backend.User {
+	t.Helper()
+	hash, err := backend.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	user, err := backend.CreateUser(username, hash, role)
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user
+}
+
+func TestSessionToken(t *testing.T) {
+	initTestDB(t)
+	user := createTestUser(t, "alice", backend.RoleUser)
+
+	a := &Authenticator{secret: []byte("0123456789abcdef0123456789abcdef"), sessionTTL: time.Hour}
+	now := time.Unix(1700000000, 0)
+
+	token, expires, err := a.issueToken(user, now)
+	if err != nil {
+		t.Fatalf("issueToken() error = %v", err)
+	}
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("expires = %v, want %v", expires, now.Add(time.Hour))
+	}
+	if !strings.HasPrefix(token, sessionTokenVersion+".") {
+		t.Errorf("token %q lacks the version prefix", token)
+	}
+
+	got, err := a.verifyToken(token, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("verifyToken() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("verifyToken() user = %s, want %s", got.ID, user.ID)
+	}
+
+	parts := strings.Split(token, ".")
+	other := &Authenticator{secret: []byte("another secret of thirty-two b."), sessionTTL: time.Hour}
+	forged, _, _ := other.issueToken(user, now)
+
+	rejected := map[string]struct {
+		token string
+		now   time.Time
+	}{
+		"expired":          {token, now.Add(time.Hour)},
+		"tampered payload": {parts[0] + "." + parts[1] + "x." + parts[2], now},
+		"tampered mac":     {parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), now},
+		"other secret":     {forged, now},
+		"unknown version":  {"v0." + parts[1] + "." + parts[2], now},
+		"not a token":      {"garbage", now},
+	}
+	for name, tt := range rejected {
+		t.Run(name, func(t *testing.T) {
+			if _, err := a.verifyToken(tt.token, tt.now); err != errInvalidToken {
+				t.Errorf("verifyToken() error = %v, want %v", err, errInvalidToken)
+			}
+		})
+	}
+}
+
+func TestSessionTokenRevocation(t *testing.T) {
+	initTestDB(t)
+	createTestUser(t, "admin", backend.RoleAdmin)
+	user := createTestUser(t, "bob", backend.RoleUser)
+
+	a := &Authenticator{secret: []byte("0123456789abcdef0123456789abcdef"), sessionTTL: time.Hour}
+	now := time.Now()
+	token, _, err := a.issueToken(user, now)
+	if err != nil {
+		t.Fatalf("issueToken() error = %v", err)
+	}
+
+	// A password change bumps the token version and logs out every session
+	if _, err := backend.UpdateUser(user.ID, func(u *backend.User) error {
+		u.TokenVersion++
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if _, err := a.verifyToken(token, now); err != errInvalidToken {
+		t.Errorf("token after password change: error = %v, want %v", err, errInvalidToken)
+	}
+
+	// New tokens carry the new version
+	user, _ = backend.GetUser(user.ID)
+	token, _, _ = a.issueToken(user, now)
+	if _, err := a.verifyToken(token, now); err != nil {
+		t.Fatalf("new token: error = %v", err)
+	}
+
+	if err := backend.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if _, err := a.verifyToken(token, now); err != errInvalidToken {
+		t.Errorf("token of deleted user: error = %v, want %v", err, errInvalidToken)
+	}
+}
+
+func TestPrincipalScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      string
+	}{
+		{"admin sees everything", &Principal{Kind: PrincipalAPIKey, Role: backend.RoleAdmin}, ""},
+		{"anonymous with auth disabled", anonymousPrincipal(), ""},
+		{"user sees own items", &Principal{Kind: PrincipalUser, UserID: "u2", Role: backend.RoleUser}, "u2"},
+		{"no principal sees nothing", &Principal{Kind: PrincipalNone}, noUserScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Scope(); got != tt.want {
+				t.Errorf("Scope() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
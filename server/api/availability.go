@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"spotiflac/backend"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AvailabilityRequest is the body of POST /api/availability
+type AvailabilityRequest struct {
+	SpotifyIDs []string `json:"spotify_ids" binding:"required"`
+}
+
+// AvailabilityResponse is the body of POST /api/availability. QueuedAhead
+// is the number of tracks of other checks still waiting.
+type AvailabilityResponse struct {
+	CheckID     string `json:"check_id"`
+	Status      string `json:"status"`
+	Total       int    `json:"total"`
+	QueuedAhead int    `json:"queued_ahead"`
+}
+
+// StartAvailabilityCheck queues a batch of tracks for an availability
+// check and returns at once. Results arrive as availability_result events
+// on /api/events and /ws, followed by one availability_done event.
+// Endpoint: POST /api/availability
+func (h *Handler) StartAvailabilityCheck(c *gin.Context) {
+	var req AvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	cfg, err := userConfig(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	// Input validation (rule #9: Zero Trust Input)
+	if len(req.SpotifyIDs) == 0 || len(req.SpotifyIDs) > cfg.Availability.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("spotify_ids must contain between 1 and %d IDs", cfg.Availability.MaxBatchSize)})
+		return
+	}
+	for _, id := range req.SpotifyIDs {
+		if !spotifyIDPattern.MatchString(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "spotify_ids must contain Spotify track IDs"})
+			return
+		}
+	}
+
+	check, ahead, err := backend.StartAvailabilityCheck(req.SpotifyIDs, CurrentPrincipal(c).UserID)
+	if err != nil {
+		if errors.Is(err, backend.ErrAvailabilityQueueFull) {
+			c.Header("Retry-After", "60")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start availability check"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, AvailabilityResponse{
+		CheckID:     check.ID,
+		Status:      check.Status,
+		Total:       check.Total,
+		QueuedAhead: ahead,
+	})
+}
+
+// GetAvailabilityCheck returns the progress and results so far of a check,
+// for clients that poll instead of listening for events
+// Endpoint: GET /api/availability/:id
+func (h *Handler) GetAvailabilityCheck(c *gin.Context) {
+	check, err := backend.GetAvailabilityCheck(c.Param("id"), CurrentPrincipal(c).Scope())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, check)
+}
+
+// CancelAvailabilityCheck drops the tracks of a check that were not
+// checked yet
+// Endpoint: DELETE /api/availability/:id
+func (h *Handler) CancelAvailabilityCheck(c *gin.Context) {
+	check, err := backend.CancelAvailabilityCheck(c.Param("id"), CurrentPrincipal(c).Scope())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, check)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"spotiflac/backend"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotEventType is sent first on a new stream (or when replay is not
+// possible) and carries the full DownloadQueueInfo
+const snapshotEventType = "queue_snapshot"
+
+// sseHeartbeatInterval keeps idle connections open through proxies
+const sseHeartbeatInterval = 15 * time.Second
+
+// sseSubscriberBuffer is the number of events buffered per stream
+const sseSubscriberBuffer = 256
+
+// StreamEvents streams queue and availability events as Server-Sent
+// Events. Users only receive events of their own items and checks.
+// Endpoint: GET /api/events
+//
+// Query parameters:
+//   - types: comma separated event types to receive (default: all)
+//   - last_event_id: replay start for clients that cannot set the
+//     Last-Event-ID header
+func (h *Handler) StreamEvents(c *gin.Context) {
+	filter := parseEventTypes(c.QueryArray("types"))
+	scope := CurrentPrincipal(c).Scope()
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(strings.TrimSpace(lastEventID), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+		lastID = id
+	}
+
+	replay, complete, start, events, unsubscribe := backend.SubscribeEventsSince(lastID, sseSubscriberBuffer)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Fresh clients and clients whose events were already evicted get the
+	// full queue state instead of a partial replay
+	if (lastID == 0 || !complete) && filter.allows(snapshotEventType) {
+		writeSSE(c.Writer, "", snapshotEventType, backend.GetDownloadQueueForUser(scope))
+	}
+
+	sent := lastID
+	send := func(event backend.Event) {
+		// Live only events carry no ID and leave Last-Event-ID alone
+		id := ""
+		if event.ID > 0 {
+			if event.ID <= sent {
+				return
+			}
+			sent = event.ID
+			id = strconv.FormatUint(event.ID, 10)
+		}
+		if filter.allows(string(event.Type)) && (scope == "" || event.UserID() == scope) {
+			writeSSE(c.Writer, id, string(event.Type), event)
+		}
+	}
+
+	for _, event := range replay {
+		send(event)
+	}
+	c.Writer.Flush()
+	// The snapshot or the replay covers everything up to the subscription
+	sent = max(sent, start)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// The subscription drops events when this stream falls behind;
+			// fill the gap from the ring buffer before going on
+			if event.ID > sent+1 {
+				missed, _ := backend.EventsSince(sent)
+				for _, m := range missed {
+					if m.ID < event.ID {
+						send(m)
+					}
+				}
+			}
+			send(event)
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// eventTypeFilter is the set of event types a stream subscribed to; an
+// empty filter allows everything
+type eventTypeFilter map[string]bool
+
+func parseEventTypes(values []string) eventTypeFilter {
+	filter := eventTypeFilter{}
+	for _, value := range values {
+		for _, eventType := range strings.Split(value, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if eventType != "" {
+				filter[eventType] = true
+			}
+		}
+	}
+	return filter
+}
+
+func (f eventTypeFilter) allows(eventType string) bool {
+	return len(f) == 0 || f[eventType]
+}
+
+// writeSSE writes one Server-Sent Event. JSON never contains raw newlines,
+// so the payload always fits on a single data line.
+func writeSSE(w io.Writer, id, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+}
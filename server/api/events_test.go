@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spotiflac/backend"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueTestEvents queues n items and returns the IDs of their events
+func queueTestEvents(t *testing.T, n int) []uint64 {
+	t.Helper()
+	events, unsubscribe := backend.SubscribeEvents(n)
+	defer unsubscribe()
+
+	for i := 0; i < n; i++ {
+		id := "sse-test-" + strconv.Itoa(i)
+		backend.AddToQueue(id, "Track", "Artist", "Album", "")
+	}
+	t.Cleanup(func() { backend.ClearAllDownloads("") })
+
+	ids := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, (<-events).ID)
+	}
+	return ids
+}
+
+// streamEvents runs StreamEvents as an admin until the replay is written
+// and returns the body
+func streamEvents(t *testing.T, header, query string) (int, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events"+query, nil).WithContext(ctx)
+	if header != "" {
+		req.Header.Set("Last-Event-ID", header)
+	}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	c.Set(principalContextKey, anonymousPrincipal())
+
+	(&Handler{}).StreamEvents(c)
+	return rec.Code, rec.Body.String()
+}
+
+func TestStreamEventsReplay(t *testing.T) {
+	backend.SetEventHistorySize(100)
+	ids := queueTestEvents(t, 3)
+
+	tests := []struct {
+		name         string
+		header       string
+		query        string
+		wantSnapshot bool
+		wantIDs      []uint64
+		skipIDs      []uint64
+	}{
+		{"fresh stream gets a snapshot", "", "", true, nil, ids},
+		{"header replays newer events", strconv.FormatUint(ids[0], 10), "", false, ids[1:], ids[:1]},
+		{"query parameter replays newer events", "", "?last_event_id=" + strconv.FormatUint(ids[1], 10), false, ids[2:], ids[:2]},
+		{"up to date stream gets nothing", strconv.FormatUint(ids[2], 10), "", false, nil, ids},
+		{"id of a previous run gets a snapshot", strconv.FormatUint(ids[2]+1000, 10), "", true, nil, ids},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := streamEvents(t, tt.header, tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", code)
+			}
+			if got := strings.Contains(body, "event: "+snapshotEventType); got != tt.wantSnapshot {
+				t.Errorf("snapshot sent = %v, want %v\n%s", got, tt.wantSnapshot, body)
+			}
+			for _, id := range tt.wantIDs {
+				if !strings.Contains(body, "id: "+strconv.FormatUint(id, 10)+"\n") {
+					t.Errorf("event %d not replayed\n%s", id, body)
+				}
+			}
+			for _, id := range tt.skipIDs {
+				if strings.Contains(body, "id: "+strconv.FormatUint(id, 10)+"\n") {
+					t.Errorf("event %d replayed again\n%s", id, body)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamEventsEvicted(t *testing.T) {
+	backend.SetEventHistorySize(2)
+	t.Cleanup(func() { backend.SetEventHistorySize(100) })
+	ids := queueTestEvents(t, 4)
+
+	// Events after ids[0] partly left the buffer: the client gets the full
+	// queue state and whatever is still buffered
+	code, body := streamEvents(t, strconv.FormatUint(ids[0], 10), "")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if !strings.Contains(body, "event: "+snapshotEventType) {
+		t.Errorf("no snapshot after eviction\n%s", body)
+	}
+	for _, id := range ids[2:] {
+		if !strings.Contains(body, "id: "+strconv.FormatUint(id, 10)+"\n") {
+			t.Errorf("buffered event %d not replayed\n%s", id, body)
+		}
+	}
+}
+
+func TestStreamEventsInvalidLastEventID(t *testing.T) {
+	code, _ := streamEvents(t, "abc", "")
+	if code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", code)
+	}
+}
+
+// gatedWriter holds back the stream until open is closed, so events pile up
+// in the subscription meanwhile. blocked is closed on the first write.
+type gatedWriter struct {
+	open    chan struct{}
+	blocked chan struct{}
+	once    sync.Once
+	header  http.Header
+	lock    sync.Mutex
+	body    bytes.Buffer
+}
+
+func (w *gatedWriter) Header() http.Header { return w.header }
+func (w *gatedWriter) WriteHeader(int)     {}
+func (w *gatedWriter) Flush()              {}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.blocked) })
+	<-w.open
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.body.Write(p)
+}
+
+// waitFor waits until the stream wrote the event with id
+func (w *gatedWriter) waitFor(t *testing.T, id uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		w.lock.Lock()
+		written := strings.Contains(w.body.String(), "id: "+strconv.FormatUint(id, 10)+"\n")
+		w.lock.Unlock()
+		if written {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("event %d not streamed", id)
+}
+
+func TestStreamEventsFillsGap(t *testing.T) {
+	backend.SetEventHistorySize(1000)
+	t.Cleanup(func() { backend.SetEventHistorySize(100) })
+
+	w := &gatedWriter{open: make(chan struct{}), blocked: make(chan struct{}), header: http.Header{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/events", nil).WithContext(ctx)
+		c.Set(principalContextKey, anonymousPrincipal())
+		(&Handler{}).StreamEvents(c)
+	}()
+
+	// The stream is subscribed once it writes its snapshot; more events
+	// than it buffers arrive while it is held back
+	<-w.blocked
+	ids := queueTestEvents(t, sseSubscriberBuffer+10)
+	close(w.open)
+	w.waitFor(t, ids[sseSubscriberBuffer-1])
+
+	// The next event shows the dropped ones missing
+	last := queueTestEvents(t, 1)[0]
+	w.waitFor(t, last)
+	cancel()
+	<-done
+
+	for _, id := range ids {
+		if !strings.Contains(w.body.String(), "id: "+strconv.FormatUint(id, 10)+"\n") {
+			t.Errorf("dropped event %d not filled in", id)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFileBatch caps the number of paths in one rename or size request
+const maxFileBatch = 1000
+
+// errOutsideRoot is returned for paths that resolve outside the download root
+var errOutsideRoot = errors.New("path is outside the download directory")
+
+// jailPath resolves a client supplied path against root (rule #9: Zero
+// Trust Input). Relative paths are taken relative to root. The path must
+// exist and stay inside root both as written and after following symlinks,
+// so neither ".." nor a symlink can reach files outside. The returned path
+// is absolute and cleaned but keeps its symlinks, matching what the
+// listings return.
+func jailPath(root, path string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", err
+	}
+
+	resolved := absRoot
+	if path = strings.TrimSpace(path); path != "" {
+		if filepath.IsAbs(path) {
+			resolved = filepath.Clean(path)
+		} else {
+			resolved = filepath.Join(absRoot, path)
+		}
+	}
+	if !isWithin(absRoot, resolved) {
+		return "", errOutsideRoot
+	}
+
+	realPath, err := filepath.EvalSymlinks(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(realRoot, realPath) {
+		return "", errOutsideRoot
+	}
+
+	return resolved, nil
+}
+
+// isWithin reports whether path is root or below it. Both must be clean
+// absolute paths.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileRoot returns the directory the current principal may browse: the
+// download root for admins, the user's own download directory otherwise.
+// Admin accounts still download into their own directory (userConfig), but
+// browse and stream the files of every user.
+func fileRoot(c *gin.Context) (string, error) {
+	root := config.Get().Download.Path
+	if !CurrentPrincipal(c).IsAdmin() {
+		cfg, err := userConfig(c)
+		if err != nil {
+			return "", err
+		}
+		root = cfg.Download.Path
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// resolveFilePaths jails every path of a batch request and aborts the
+// request with an error response if one of them is rejected
+func resolveFilePaths(c *gin.Context, paths []string) ([]string, bool) {
+	if len(paths) == 0 || len(paths) > maxFileBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("files must contain between 1 and %d paths", maxFileBatch)})
+		return nil, false
+	}
+
+	root, err := fileRoot(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return nil, false
+	}
+
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		p, err := jailPath(root, path)
+		if err != nil {
+			respondPathError(c, err)
+			return nil, false
+		}
+		resolved = append(resolved, p)
+	}
+	return resolved, true
+}
+
+// resolveFilePath jails the "path" query parameter
+func resolveFilePath(c *gin.Context) (string, bool) {
+	root, err := fileRoot(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return "", false
+	}
+
+	path, err := jailPath(root, c.Query("path"))
+	if err != nil {
+		respondPathError(c, err)
+		return "", false
+	}
+	return path, true
+}
+
+// respondPathError maps a jailPath error without echoing the path
+func respondPathError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOutsideRoot):
+		slog.WarnContext(c.Request.Context(), "Rejected path outside download directory", "principal", CurrentPrincipal(c).Name, "client_ip", c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Path is outside your download directory"})
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path not found"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+	}
+}
+
+// validRenameFormat rejects formats that would move files into another
+// directory
+func validRenameFormat(format string) bool {
+	return strings.TrimSpace(format) != "" && !strings.ContainsAny(format, `/\`) && !strings.Contains(format, "..")
+}
+
+// FileListResponse is the body of the directory listings
+type FileListResponse struct {
+	Path  string             `json:"path"`
+	Files []backend.FileInfo `json:"files"`
+}
+
+// ListFiles returns the directory tree below a path
+// Endpoint: GET /api/files/list?path=
+func (h *Handler) ListFiles(c *gin.Context) {
+	dir, ok := resolveFilePath(c)
+	if !ok {
+		return
+	}
+
+	files, err := backend.ListDirectory(dir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is not a readable directory"})
+		return
+	}
+	if files == nil {
+		files = []backend.FileInfo{}
+	}
+
+	c.JSON(http.StatusOK, FileListResponse{Path: dir, Files: files})
+}
+
+// ListAudioFiles returns all FLAC, MP3 and M4A files below a path
+// Endpoint: GET /api/files/audio?path=
+func (h *Handler) ListAudioFiles(c *gin.Context) {
+	dir, ok := resolveFilePath(c)
+	if !ok {
+		return
+	}
+
+	files, err := backend.ListAudioFiles(dir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is not a readable directory"})
+		return
+	}
+	if files == nil {
+		files = []backend.FileInfo{}
+	}
+
+	c.JSON(http.StatusOK, FileListResponse{Path: dir, Files: files})
+}
+
+// ReadFileMetadata returns the tags of an audio file
+// Endpoint: GET /api/files/metadata?path=
+func (h *Handler) ReadFileMetadata(c *gin.Context) {
+	path, ok := resolveFilePath(c)
+	if !ok {
+		return
+	}
+
+	metadata, err := backend.ReadAudioMetadata(path)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to read metadata"})
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// RenameRequest is the body of the rename endpoints
+type RenameRequest struct {
+	Files  []string `json:"files" binding:"required"`
+	Format string   `json:"format" binding:"required"`
+}
+
+// PreviewRename shows the names RenameFiles would give the files
+// Endpoint: POST /api/files/rename/preview
+func (h *Handler) PreviewRename(c *gin.Context) {
+	var req RenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if !validRenameFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must not be empty or contain path separators or .."})
+		return
+	}
+
+	files, ok := resolveFilePaths(c, req.Files)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, backend.PreviewRename(files, req.Format))
+}
+
+// RenameFiles renames audio files from their tags within their directory
+// Endpoint: POST /api/files/rename
+func (h *Handler) RenameFiles(c *gin.Context) {
+	var req RenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if !validRenameFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must not be empty or contain path separators or .."})
+		return
+	}
+
+	files, ok := resolveFilePaths(c, req.Files)
+	if !ok {
+		return
+	}
+
+	results := backend.RenameFiles(files, req.Format)
+
+	renamed := 0
+	for _, result := range results {
+		if result.Success {
+			renamed++
+		}
+	}
+	slog.InfoContext(c.Request.Context(), "AUDIT files renamed", "requested", len(files), "renamed", renamed, "by", CurrentPrincipal(c).Name)
+
+	c.JSON(http.StatusOK, results)
+}
+
+// FileSizesRequest is the body of POST /api/files/sizes
+type FileSizesRequest struct {
+	Files []string `json:"files" binding:"required"`
+}
+
+// GetFileSizes returns the size in bytes of each file
+// Endpoint: POST /api/files/sizes
+func (h *Handler) GetFileSizes(c *gin.Context) {
+	var req FileSizesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	files, ok := resolveFilePaths(c, req.Files)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, backend.GetFileSizes(files))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJailPath(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "downloads")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "album"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "album", "track.flac"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "album"), filepath.Join(root, "shortcut")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"empty is the root", "", root, nil},
+		{"relative", "album/track.flac", filepath.Join(root, "album", "track.flac"), nil},
+		{"absolute inside", filepath.Join(root, "album"), filepath.Join(root, "album"), nil},
+		{"symlink inside keeps its name", "shortcut/track.flac", filepath.Join(root, "shortcut", "track.flac"), nil},
+		{"dot dot", "../outside/secret.txt", "", errOutsideRoot},
+		{"dot dot within root", "album/../album/track.flac", filepath.Join(root, "album", "track.flac"), nil},
+		{"absolute outside", filepath.Join(outside, "secret.txt"), "", errOutsideRoot},
+		{"symlink out of root", "escape/secret.txt", "", errOutsideRoot},
+		{"missing", "album/missing.flac", "", fs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jailPath(root, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("jailPath(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jailPath(%q) error = %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("jailPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileRoot(t *testing.T) {
+	initTestDB(t)
+	root := t.TempDir()
+	t.Setenv("SPOTIFLAC_DOWNLOAD_PATH", root)
+	t.Setenv("SPOTIFLAC_API_KEYS", "admin:0123456789abcdef0123456789abcdef")
+	if _, err := config.Load("../../config.yml"); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	user := createTestUser(t, "carol", backend.RoleUser)
+	admin := createTestUser(t, "dave", backend.RoleAdmin)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      string
+		wantErr   bool
+	}{
+		{"api key admin browses everything", &Principal{Kind: PrincipalAPIKey, Name: "admin", Role: backend.RoleAdmin}, root, false},
+		{"admin account browses everything", userPrincipal(PrincipalUser, admin.Username, admin), root, false},
+		{"anonymous with auth disabled", anonymousPrincipal(), root, false},
+		{"user is jailed to own directory", userPrincipal(PrincipalUser, user.Username, user), filepath.Join(root, "users", "carol"), false},
+		{"route without auth gets nothing", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.principal != nil {
+				c.Set(principalContextKey, tt.principal)
+			}
+
+			got, err := fileRoot(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("fileRoot() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fileRoot() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("fileRoot() = %q, want %q", got, tt.want)
+			}
+			if info, err := os.Stat(got); err != nil || !info.IsDir() {
+				t.Errorf("fileRoot() did not create %s", got)
+			}
+		})
+	}
+}
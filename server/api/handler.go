@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 	"spotiflac/backend"
 	"spotiflac/backend/config"
 	"strings"
@@ -17,30 +21,54 @@ import (
 type Handler struct {
 	// We could embed the App struct here, but we'll access backend directly
 	// to avoid Wails dependencies
+	auth *Authenticator
+
+	// openAPI is the encoded document served by OpenAPI
+	openAPI []byte
 }
 
 // NewHandler creates a new API handler
-func NewHandler() *Handler {
-	return &Handler{}
+func NewHandler(auth *Authenticator) *Handler {
+	return &Handler{auth: auth}
+}
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// SuccessResponse is the body of actions that return nothing else
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+// HealthResponse is the body of GET /health and GET /health/live
+type HealthResponse struct {
+	Status string `json:"status"`
+	Time   int64  `json:"time"`
 }
 
 // HealthCheck returns server health status
 func (h *Handler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status": "healthy",
-		"time":   time.Now().Unix(),
+	c.JSON(http.StatusOK, HealthResponse{
+		Status: "healthy",
+		Time:   time.Now().Unix(),
 	})
 }
 
+// MetadataRequest is the body of POST /api/spotify/metadata. Delay and
+// Timeout are in seconds.
+type MetadataRequest struct {
+	URL     string  `json:"url" binding:"required"`
+	Batch   bool    `json:"batch"`
+	Delay   float64 `json:"delay"`
+	Timeout float64 `json:"timeout"`
+}
+
 // GetSpotifyMetadata handles metadata fetching from Spotify URLs
 // Endpoint: POST /api/spotify/metadata
 func (h *Handler) GetSpotifyMetadata(c *gin.Context) {
-	var req struct {
-		URL     string  `json:"url" binding:"required"`
-		Batch   bool    `json:"batch"`
-		Delay   float64 `json:"delay"`
-		Timeout float64 `json:"timeout"`
-	}
+	var req MetadataRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
@@ -101,13 +129,16 @@ func (h *Handler) GetSpotifyMetadata(c *gin.Context) {
 	c.JSON(http.StatusOK, data)
 }
 
+// SearchRequest is the body of POST /api/spotify/search
+type SearchRequest struct {
+	Query string `json:"query" binding:"required"`
+	Limit int    `json:"limit"`
+}
+
 // SearchSpotify handles Spotify search requests
 // Endpoint: POST /api/spotify/search
 func (h *Handler) SearchSpotify(c *gin.Context) {
-	var req struct {
-		Query string `json:"query" binding:"required"`
-		Limit int    `json:"limit"`
-	}
+	var req SearchRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
@@ -139,15 +170,18 @@ func (h *Handler) SearchSpotify(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// SearchByTypeRequest is the body of POST /api/spotify/search-by-type
+type SearchByTypeRequest struct {
+	Query      string `json:"query" binding:"required"`
+	SearchType string `json:"search_type" binding:"required"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+}
+
 // SearchSpotifyByType handles type-specific Spotify searches
 // Endpoint: POST /api/spotify/search-by-type
 func (h *Handler) SearchSpotifyByType(c *gin.Context) {
-	var req struct {
-		Query      string `json:"query" binding:"required"`
-		SearchType string `json:"search_type" binding:"required"`
-		Limit      int    `json:"limit"`
-		Offset     int    `json:"offset"`
-	}
+	var req SearchByTypeRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
@@ -176,13 +210,16 @@ func (h *Handler) SearchSpotifyByType(c *gin.Context) {
 	c.JSON(http.StatusOK, results)
 }
 
+// StreamingURLsRequest is the body of POST /api/spotify/streaming-urls
+type StreamingURLsRequest struct {
+	SpotifyTrackID string `json:"spotify_track_id" binding:"required"`
+	Region         string `json:"region"`
+}
+
 // GetStreamingURLs retrieves streaming URLs for a track
 // Endpoint: POST /api/spotify/streaming-urls
 func (h *Handler) GetStreamingURLs(c *gin.Context) {
-	var req struct {
-		SpotifyTrackID string `json:"spotify_track_id" binding:"required"`
-		Region         string `json:"region"`
-	}
+	var req StreamingURLsRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
@@ -199,7 +236,7 @@ func (h *Handler) GetStreamingURLs(c *gin.Context) {
 	}
 
 	client := backend.NewSongLinkClient()
-	urls, err := client.GetAllURLsFromSpotify(req.SpotifyTrackID, req.Region)
+	urls, err := client.GetAllURLsFromSpotify(c.Request.Context(), req.SpotifyTrackID, req.Region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to get streaming URLs: %v", err),
@@ -210,13 +247,22 @@ func (h *Handler) GetStreamingURLs(c *gin.Context) {
 	c.JSON(http.StatusOK, urls)
 }
 
-// GetSettings returns current configuration settings
+// GetSettings returns current configuration settings. User accounts get
+// config.yml with their own settings overlay and download directory.
 // Endpoint: GET /api/settings
 func (h *Handler) GetSettings(c *gin.Context) {
-	cfg := config.Get()
+	cfg, err := userConfig(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settingsMap(cfg))
+}
 
-	// Convert config to map format expected by frontend
-	settings := map[string]interface{}{
+// settingsMap converts the config to the map format expected by the frontend
+func settingsMap(cfg *config.Config) map[string]interface{} {
+	return map[string]interface{}{
 		"downloadPath":         cfg.Download.Path,
 		"filenameFormat":       cfg.Download.FilenameFormat,
 		"audioFormat":          cfg.Download.AudioFormat,
@@ -226,19 +272,18 @@ func (h *Handler) GetSettings(c *gin.Context) {
 		"useAlbumTrackNumber":  cfg.Download.UseAlbumTrackNumber,
 		"useFirstArtistOnly":   cfg.Download.UseFirstArtistOnly,
 		"allowFallback":        cfg.Download.AllowFallback,
+		"createM3U8":           cfg.Download.CreateM3U8,
 		"defaultService":       cfg.Services.DefaultService,
-		"tidalAPIUrl":          cfg.Services.TidalAPIURL,
 		"useSpotFetchAPI":      cfg.Services.UseSpotFetchAPI,
 		"spotFetchAPIUrl":      cfg.Services.SpotFetchAPIURL,
 		"theme":                cfg.UI.Theme,
 		"themeMode":            cfg.UI.ThemeMode,
 		"fontFamily":           cfg.UI.FontFamily,
 	}
-
-	c.JSON(http.StatusOK, settings)
 }
 
-// SaveSettings updates configuration settings
+// SaveSettings updates configuration settings. Admins change config.yml,
+// other users their own settings overlay.
 // Endpoint: POST /api/settings
 func (h *Handler) SaveSettings(c *gin.Context) {
 	var settings map[string]interface{}
@@ -248,87 +293,125 @@ func (h *Handler) SaveSettings(c *gin.Context) {
 		return
 	}
 
-	// Get current config
-	cfg := config.Get()
+	principal := CurrentPrincipal(c)
+	if !principal.IsAdmin() {
+		h.saveUserSettings(c, principal, settings)
+		return
+	}
 
-	// Update fields that are present in the request
 	// Following rule #9: validate all input before applying
-	if val, ok := settings["downloadPath"].(string); ok {
-		// Validate path (prevent path traversal)
-		if strings.Contains(val, "..") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download path"})
-			return
-		}
-		cfg.Download.Path = val
+	if val, ok := settings["downloadPath"].(string); ok && strings.Contains(val, "..") {
+		// Prevent path traversal
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download path"})
+		return
 	}
-
-	if val, ok := settings["filenameFormat"].(string); ok {
-		cfg.Download.FilenameFormat = val
+	if val, ok := settings["defaultService"].(string); ok && !backend.ProviderEnabled(val) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or disabled service"})
+		return
 	}
 
-	if val, ok := settings["audioFormat"].(string); ok {
-		cfg.Download.AudioFormat = val
-	}
+	// Update fields that are present in the request on a copy of the
+	// current config and save it to the file it was loaded from
+	err := config.Update(config.Path(), func(cfg *config.Config) error {
+		if val, ok := settings["downloadPath"].(string); ok {
+			cfg.Download.Path = val
+		}
 
-	if val, ok := settings["embedLyrics"].(bool); ok {
-		cfg.Download.EmbedLyrics = val
-	}
+		if val, ok := settings["filenameFormat"].(string); ok {
+			cfg.Download.FilenameFormat = val
+		}
 
-	if val, ok := settings["embedMaxQualityCover"].(bool); ok {
-		cfg.Download.EmbedMaxQualityCover = val
-	}
+		if val, ok := settings["audioFormat"].(string); ok {
+			cfg.Download.AudioFormat = val
+		}
 
-	if val, ok := settings["trackNumber"].(bool); ok {
-		cfg.Download.TrackNumber = val
-	}
+		if val, ok := settings["embedLyrics"].(bool); ok {
+			cfg.Download.EmbedLyrics = val
+		}
 
-	if val, ok := settings["useAlbumTrackNumber"].(bool); ok {
-		cfg.Download.UseAlbumTrackNumber = val
-	}
+		if val, ok := settings["embedMaxQualityCover"].(bool); ok {
+			cfg.Download.EmbedMaxQualityCover = val
+		}
 
-	if val, ok := settings["useFirstArtistOnly"].(bool); ok {
-		cfg.Download.UseFirstArtistOnly = val
-	}
+		if val, ok := settings["trackNumber"].(bool); ok {
+			cfg.Download.TrackNumber = val
+		}
 
-	if val, ok := settings["allowFallback"].(bool); ok {
-		cfg.Download.AllowFallback = val
-	}
+		if val, ok := settings["useAlbumTrackNumber"].(bool); ok {
+			cfg.Download.UseAlbumTrackNumber = val
+		}
 
-	if val, ok := settings["defaultService"].(string); ok {
-		cfg.Services.DefaultService = val
-	}
+		if val, ok := settings["useFirstArtistOnly"].(bool); ok {
+			cfg.Download.UseFirstArtistOnly = val
+		}
 
-	if val, ok := settings["tidalAPIUrl"].(string); ok {
-		cfg.Services.TidalAPIURL = val
-	}
+		if val, ok := settings["allowFallback"].(bool); ok {
+			cfg.Download.AllowFallback = val
+		}
 
-	if val, ok := settings["useSpotFetchAPI"].(bool); ok {
-		cfg.Services.UseSpotFetchAPI = val
-	}
+		if val, ok := settings["createM3U8"].(bool); ok {
+			cfg.Download.CreateM3U8 = val
+		}
 
-	if val, ok := settings["spotFetchAPIUrl"].(string); ok {
-		cfg.Services.SpotFetchAPIURL = val
-	}
+		if val, ok := settings["defaultService"].(string); ok {
+			cfg.Services.DefaultService = val
+		}
 
-	if val, ok := settings["theme"].(string); ok {
-		cfg.UI.Theme = val
-	}
+		if val, ok := settings["useSpotFetchAPI"].(bool); ok {
+			cfg.Services.UseSpotFetchAPI = val
+		}
 
-	if val, ok := settings["themeMode"].(string); ok {
-		cfg.UI.ThemeMode = val
-	}
+		if val, ok := settings["spotFetchAPIUrl"].(string); ok {
+			cfg.Services.SpotFetchAPIURL = val
+		}
 
-	if val, ok := settings["fontFamily"].(string); ok {
-		cfg.UI.FontFamily = val
-	}
+		if val, ok := settings["theme"].(string); ok {
+			cfg.UI.Theme = val
+		}
+
+		if val, ok := settings["themeMode"].(string); ok {
+			cfg.UI.ThemeMode = val
+		}
 
-	// Save to config.yml
-	if err := config.Save(cfg, "config.yml"); err != nil {
+		if val, ok := settings["fontFamily"].(string); ok {
+			cfg.UI.FontFamily = val
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to save settings",
 		})
 		return
 	}
+	slog.InfoContext(c.Request.Context(), "AUDIT global settings changed", "by", principal.Name)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// saveUserSettings stores a settings request in the caller's overlay
+func (h *Handler) saveUserSettings(c *gin.Context, principal *Principal, settings map[string]interface{}) {
+	current, err := userConfig(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	_, err = backend.UpdateUser(principal.UserID, func(user *backend.User) error {
+		return updateUserSettings(&user.Settings, settings, settingsMap(current))
+	})
+	if err != nil {
+		if errors.Is(err, backend.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errInvalidSetting) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
@@ -343,76 +426,394 @@ func (h *Handler) GetDefaults(c *gin.Context) {
 	c.JSON(http.StatusOK, defaults)
 }
 
-// DownloadResponse matches the response structure from app.go
-type DownloadResponse struct {
-	Success       bool   `json:"success"`
-	Message       string `json:"message"`
-	File          string `json:"file,omitempty"`
-	Error         string `json:"error,omitempty"`
-	AlreadyExists bool   `json:"already_exists,omitempty"`
-	ItemID        string `json:"item_id,omitempty"`
+// DownloadOptions are the per-request download settings shared by the track
+// and collection endpoints. Fields left out of the request fall back to the
+// download section of config.yml.
+type DownloadOptions struct {
+	Service string `json:"service"`
+
+	// OutputDir is a subdirectory relative to download.path. Absolute
+	// paths and paths escaping the download root are rejected.
+	OutputDir string `json:"output_dir"`
+
+	// Optional overrides for config.yml download settings
+	AudioFormat          string `json:"audio_format"`
+	FilenameFormat       string `json:"filename_format"`
+	TrackNumber          *bool  `json:"track_number"`
+	UseAlbumTrackNumber  *bool  `json:"use_album_track_number"`
+	EmbedLyrics          *bool  `json:"embed_lyrics"`
+	EmbedMaxQualityCover *bool  `json:"embed_max_quality_cover"`
+	AllowFallback        *bool  `json:"allow_fallback"`
+	UseFirstArtistOnly   *bool  `json:"use_first_artist_only"`
+}
+
+// DownloadTrackRequest is the request body for POST /api/download/track.
+// A minimal request only needs a Spotify ID.
+type DownloadTrackRequest struct {
+	SpotifyID          string `json:"spotify_id"`
+	ServiceURL         string `json:"service_url"`
+	TrackName          string `json:"track_name"`
+	ArtistName         string `json:"artist_name"`
+	AlbumName          string `json:"album_name"`
+	AlbumArtist        string `json:"album_artist"`
+	ReleaseDate        string `json:"release_date"`
+	CoverURL           string `json:"cover_url"`
+	Duration           int    `json:"duration"`
+	Position           int    `json:"position"`
+	SpotifyTrackNumber int    `json:"spotify_track_number"`
+	SpotifyDiscNumber  int    `json:"spotify_disc_number"`
+	SpotifyTotalTracks int    `json:"spotify_total_tracks"`
+	SpotifyTotalDiscs  int    `json:"spotify_total_discs"`
+	Copyright          string `json:"copyright"`
+	Publisher          string `json:"publisher"`
+	PlaylistName       string `json:"playlist_name"`
+	PlaylistOwner      string `json:"playlist_owner"`
+
+	DownloadOptions
 }
 
-// DownloadTrack handles track download requests
+// DownloadCollectionRequest is the request body for POST /api/download/collection
+type DownloadCollectionRequest struct {
+	URL        string  `json:"url" binding:"required"`
+	Timeout    float64 `json:"timeout"`
+	CreateM3U8 *bool   `json:"create_m3u8"`
+
+	DownloadOptions
+}
+
+// toBackendRequest validates the options and merges them with the configured
+// download defaults into a request template without any track fields
+// (rule #9: Zero Trust Input)
+func (o DownloadOptions) toBackendRequest(cfg *config.Config) (backend.DownloadRequest, error) {
+	service := strings.ToLower(strings.TrimSpace(o.Service))
+	if service == "" {
+		service = cfg.Services.DefaultService
+	}
+	if !backend.ProviderEnabled(service) {
+		return backend.DownloadRequest{}, fmt.Errorf("unknown or disabled service: %s", service)
+	}
+
+	outputDir, err := resolveDownloadDir(cfg.Download.Path, o.OutputDir)
+	if err != nil {
+		return backend.DownloadRequest{}, err
+	}
+
+	req := backend.DownloadRequest{
+		Service:              service,
+		OutputDir:            outputDir,
+		AudioFormat:          cfg.Download.AudioFormat,
+		FilenameFormat:       cfg.Download.FilenameFormat,
+		TrackNumber:          boolOrDefault(o.TrackNumber, cfg.Download.TrackNumber),
+		UseAlbumTrackNumber:  boolOrDefault(o.UseAlbumTrackNumber, cfg.Download.UseAlbumTrackNumber),
+		EmbedLyrics:          boolOrDefault(o.EmbedLyrics, cfg.Download.EmbedLyrics),
+		EmbedMaxQualityCover: boolOrDefault(o.EmbedMaxQualityCover, cfg.Download.EmbedMaxQualityCover),
+		AllowFallback:        boolOrDefault(o.AllowFallback, cfg.Download.AllowFallback),
+		UseFirstArtistOnly:   boolOrDefault(o.UseFirstArtistOnly, cfg.Download.UseFirstArtistOnly),
+	}
+
+	if o.AudioFormat != "" {
+		req.AudioFormat = o.AudioFormat
+	}
+	if format := strings.TrimSpace(o.FilenameFormat); format != "" {
+		// A format is a file name, not a path (rule #9: Zero Trust Input)
+		if !validRenameFormat(format) {
+			return backend.DownloadRequest{}, fmt.Errorf("filename_format must not contain path separators or ..")
+		}
+		req.FilenameFormat = format
+	}
+
+	return req, nil
+}
+
+// toBackendRequest validates the track fields and fills them into the
+// request built from the download options
+func (r DownloadTrackRequest) toBackendRequest(cfg *config.Config) (backend.DownloadRequest, error) {
+	req, err := r.DownloadOptions.toBackendRequest(cfg)
+	if err != nil {
+		return backend.DownloadRequest{}, err
+	}
+
+	req.SpotifyID = strings.TrimSpace(r.SpotifyID)
+	req.ServiceURL = strings.TrimSpace(r.ServiceURL)
+	if req.SpotifyID == "" && req.ServiceURL == "" {
+		return backend.DownloadRequest{}, fmt.Errorf("spotify_id or service_url is required")
+	}
+	if req.Service == "qobuz" && req.SpotifyID == "" {
+		return backend.DownloadRequest{}, fmt.Errorf("spotify_id is required for qobuz")
+	}
+
+	req.TrackName = strings.TrimSpace(r.TrackName)
+	req.ArtistName = strings.TrimSpace(r.ArtistName)
+	req.AlbumName = strings.TrimSpace(r.AlbumName)
+	req.AlbumArtist = strings.TrimSpace(r.AlbumArtist)
+	req.ReleaseDate = strings.TrimSpace(r.ReleaseDate)
+	req.CoverURL = strings.TrimSpace(r.CoverURL)
+	req.Duration = r.Duration
+	req.Position = r.Position
+	req.SpotifyTrackNumber = r.SpotifyTrackNumber
+	req.SpotifyDiscNumber = r.SpotifyDiscNumber
+	req.SpotifyTotalTracks = r.SpotifyTotalTracks
+	req.SpotifyTotalDiscs = r.SpotifyTotalDiscs
+	req.Copyright = r.Copyright
+	req.Publisher = r.Publisher
+	req.PlaylistName = r.PlaylistName
+	req.PlaylistOwner = r.PlaylistOwner
+
+	return req, nil
+}
+
+// boolOrDefault returns the request value if it was sent, else the default
+func boolOrDefault(value *bool, def bool) bool {
+	if value == nil {
+		return def
+	}
+	return *value
+}
+
+// resolveDownloadDir joins a client supplied subdirectory onto the download
+// root and makes sure the result stays inside it (rule #9: prevent path traversal)
+func resolveDownloadDir(root, subDir string) (string, error) {
+	subDir = strings.TrimSpace(subDir)
+	if subDir == "" {
+		return root, nil
+	}
+	if filepath.IsAbs(subDir) {
+		return "", fmt.Errorf("output_dir must be relative to the download path")
+	}
+
+	dir := filepath.Join(root, subDir)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output_dir must stay inside the download path")
+	}
+
+	return dir, nil
+}
+
+// DownloadTrack queues a track download and returns its queue item ID
+// immediately. The download runs asynchronously on the backend worker;
+// progress is reported through the download queue.
 // Endpoint: POST /api/download/track
-// This is a complex endpoint that will be continued in the next file section
 func (h *Handler) DownloadTrack(c *gin.Context) {
-	// This will be implemented similarly to app.go's DownloadTrack method
-	// but adapted for HTTP context
-	var req map[string]interface{}
+	var req DownloadTrackRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	// For now, return a placeholder
-	// Full implementation will follow the app.go logic
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Download endpoint - implementation in progress",
-		"request": req,
+	cfg, err := userConfig(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	downloadReq, err := req.toBackendRequest(cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	downloadReq.UserID = CurrentPrincipal(c).UserID
+	downloadReq.RequestID = backend.RequestIDFromContext(c.Request.Context())
+
+	itemID := backend.EnqueueDownload(downloadReq)
+
+	c.JSON(http.StatusAccepted, backend.DownloadResponse{
+		Success: true,
+		Message: "Download queued",
+		ItemID:  itemID,
 	})
 }
 
-// GetDownloadQueue returns the current download queue status
+// CollectionResponse is the body of POST /api/download/collection
+type CollectionResponse struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	BatchID string   `json:"batch_id"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	ItemIDs []string `json:"item_ids"`
+	Total   int      `json:"total"`
+}
+
+// DownloadCollection resolves an album, playlist or artist URL and queues
+// every track as its own download item. An M3U8 playlist is written into
+// the collection folder once the last item has finished.
+// Endpoint: POST /api/download/collection
+func (h *Handler) DownloadCollection(c *gin.Context) {
+	var req DownloadCollectionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL parameter is required"})
+		return
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = 300.0
+	}
+
+	cfg, err := userConfig(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	template, err := req.DownloadOptions.toBackendRequest(cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template.UserID = CurrentPrincipal(c).UserID
+	template.RequestID = backend.RequestIDFromContext(c.Request.Context())
+
+	spotFetchURL := ""
+	if cfg.Services.UseSpotFetchAPI {
+		spotFetchURL = cfg.Services.SpotFetchAPIURL
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(req.Timeout*float64(time.Second)))
+	defer cancel()
+
+	collection, err := backend.ResolveSpotifyCollection(ctx, req.URL, spotFetchURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Failed to resolve collection: %v", err),
+		})
+		return
+	}
+	if len(collection.Tracks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection has no tracks"})
+		return
+	}
+
+	batch := backend.EnqueueCollection(collection, template, boolOrDefault(req.CreateM3U8, cfg.Download.CreateM3U8))
+
+	c.JSON(http.StatusAccepted, CollectionResponse{
+		Success: true,
+		Message: "Collection queued",
+		BatchID: batch.ID,
+		Type:    batch.Type,
+		Name:    batch.Name,
+		ItemIDs: batch.ItemIDs,
+		Total:   len(batch.ItemIDs),
+	})
+}
+
+// GetDownloadQueue returns the current download queue status. Users see
+// their own items; admins see all items or those of ?user_id=.
 // Endpoint: GET /api/download/queue
 func (h *Handler) GetDownloadQueue(c *gin.Context) {
-	queue := backend.GetDownloadQueue()
+	queue := backend.GetDownloadQueueForUser(requestScope(c))
 	c.JSON(http.StatusOK, queue)
 }
 
-// GetDownloadProgress returns download progress information
+// requestScope returns the user whose data a request works on: the caller
+// for users, the optional user_id query parameter for admins
+func requestScope(c *gin.Context) string {
+	principal := CurrentPrincipal(c)
+	if principal.IsAdmin() {
+		return c.Query("user_id")
+	}
+	return principal.Scope()
+}
+
+// GetDownloadProgress returns the progress of the caller's running
+// downloads
 // Endpoint: GET /api/download/progress
 func (h *Handler) GetDownloadProgress(c *gin.Context) {
-	progress := backend.GetDownloadProgress()
+	progress := backend.GetDownloadProgress(requestScope(c))
 	c.JSON(http.StatusOK, progress)
 }
 
 // ClearCompletedDownloads clears completed items from queue
 // Endpoint: POST /api/download/queue/clear
 func (h *Handler) ClearCompletedDownloads(c *gin.Context) {
-	backend.ClearDownloadQueue()
+	backend.ClearDownloadQueue(requestScope(c))
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
 // ClearAllDownloads clears all downloads from queue
 // Endpoint: POST /api/download/queue/clear-all
 func (h *Handler) ClearAllDownloads(c *gin.Context) {
-	backend.ClearAllDownloads()
+	backend.ClearAllDownloads(requestScope(c))
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
 // CancelAllQueuedItems cancels all queued download items
 // Endpoint: POST /api/download/queue/cancel-all
 func (h *Handler) CancelAllQueuedItems(c *gin.Context) {
-	backend.CancelAllQueuedItems()
+	backend.CancelAllQueuedItems(requestScope(c))
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// QueueItemResponse is the body of the per-item queue actions
+type QueueItemResponse struct {
+	Success bool   `json:"success"`
+	ItemID  string `json:"item_id"`
+}
+
+// queueItemAction runs a per-item queue operation and maps its error to an
+// HTTP status: unknown IDs and items of other users are 404, invalid state
+// changes 409
+func queueItemAction(c *gin.Context, action func(id string) error) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item ID is required"})
+		return
+	}
+
+	if scope := CurrentPrincipal(c).Scope(); scope != "" {
+		if item, ok := backend.GetDownloadItem(id); !ok || item.UserID != scope {
+			c.JSON(http.StatusNotFound, gin.H{"error": backend.ErrQueueItemNotFound.Error()})
+			return
+		}
+	}
+
+	if err := action(id); err != nil {
+		if errors.Is(err, backend.ErrQueueItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, QueueItemResponse{Success: true, ItemID: id})
+}
+
+// CancelDownloadItem cancels a single queued, paused or running item
+// Endpoint: POST /api/download/queue/:id/cancel
+func (h *Handler) CancelDownloadItem(c *gin.Context) {
+	queueItemAction(c, backend.CancelDownloadItem)
+}
+
+// PauseDownloadItem pauses a single queued or running item
+// Endpoint: POST /api/download/queue/:id/pause
+func (h *Handler) PauseDownloadItem(c *gin.Context) {
+	queueItemAction(c, backend.PauseDownloadItem)
+}
+
+// ResumeDownloadItem puts a paused item back into the queue
+// Endpoint: POST /api/download/queue/:id/resume
+func (h *Handler) ResumeDownloadItem(c *gin.Context) {
+	queueItemAction(c, backend.ResumeDownloadItem)
+}
+
+// RetryDownloadItem re-queues a failed, cancelled or skipped item
+// Endpoint: POST /api/download/queue/:id/retry
+func (h *Handler) RetryDownloadItem(c *gin.Context) {
+	queueItemAction(c, backend.RetryDownloadItem)
+}
+
 // GetDownloadHistory returns download history
 // Endpoint: GET /api/history/downloads
 func (h *Handler) GetDownloadHistory(c *gin.Context) {
-	history, err := backend.GetHistoryItems("SpotiFLAC")
+	history, err := backend.GetHistoryItems(requestScope(c), "SpotiFLAC")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get download history",
@@ -426,7 +827,7 @@ func (h *Handler) GetDownloadHistory(c *gin.Context) {
 // ClearDownloadHistory clears download history
 // Endpoint: POST /api/history/downloads/clear
 func (h *Handler) ClearDownloadHistory(c *gin.Context) {
-	if err := backend.ClearHistory("SpotiFLAC"); err != nil {
+	if err := backend.ClearHistory(requestScope(c), "SpotiFLAC"); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to clear history",
 		})
@@ -441,7 +842,11 @@ func (h *Handler) ClearDownloadHistory(c *gin.Context) {
 func (h *Handler) DeleteDownloadHistoryItem(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := backend.DeleteHistoryItem(id, "SpotiFLAC"); err != nil {
+	if err := backend.DeleteHistoryItem(id, CurrentPrincipal(c).Scope(), "SpotiFLAC"); err != nil {
+		if errors.Is(err, backend.ErrHistoryItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to delete history item",
 		})
@@ -451,6 +856,135 @@ func (h *Handler) DeleteDownloadHistoryItem(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// maxFetchHistoryBody caps a fetch history entry, which carries the
+// fetched metadata so it can be shown again without refetching
+const maxFetchHistoryBody = 8 << 20
+
+// fetchHistoryTypes are the kinds of Spotify URLs a fetch history entry
+// can describe
+var fetchHistoryTypes = map[string]bool{"track": true, "album": true, "playlist": true, "artist": true}
+
+// GetFetchHistory returns the fetch history
+// Endpoint: GET /api/history/fetch
+func (h *Handler) GetFetchHistory(c *gin.Context) {
+	history, err := backend.GetFetchHistoryItems(requestScope(c), "SpotiFLAC")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get fetch history",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// FetchHistoryRequest is the body of POST /api/history/fetch. Data holds
+// the fetched metadata as a JSON string.
+type FetchHistoryRequest struct {
+	URL   string `json:"url" binding:"required"`
+	Type  string `json:"type" binding:"required"`
+	Name  string `json:"name"`
+	Info  string `json:"info"`
+	Image string `json:"image"`
+	Data  string `json:"data"`
+}
+
+// AddFetchHistory records a fetched URL, replacing an earlier entry of the
+// same URL and type
+// Endpoint: POST /api/history/fetch
+func (h *Handler) AddFetchHistory(c *gin.Context) {
+	var req FetchHistoryRequest
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFetchHistoryBody)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Fetch history entry is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Input validation (rule #9: Zero Trust Input)
+	if !fetchHistoryTypes[req.Type] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of track, album, playlist, artist"})
+		return
+	}
+	if len(req.URL) > 2048 || len(req.Name) > 1024 || len(req.Info) > 1024 || len(req.Image) > 2048 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url, name, info or image is too long"})
+		return
+	}
+
+	item := backend.FetchHistoryItem{
+		URL:    req.URL,
+		Type:   req.Type,
+		Name:   req.Name,
+		Info:   req.Info,
+		Image:  req.Image,
+		Data:   req.Data,
+		UserID: CurrentPrincipal(c).UserID,
+	}
+	if err := backend.AddFetchHistoryItem(item, "SpotiFLAC"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to add fetch history item",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true})
+}
+
+// ClearFetchHistory clears the fetch history, or only the entries of one
+// type when ?type= is set
+// Endpoint: POST /api/history/fetch/clear
+func (h *Handler) ClearFetchHistory(c *gin.Context) {
+	itemType := c.Query("type")
+
+	var err error
+	switch {
+	case itemType == "":
+		err = backend.ClearFetchHistory(requestScope(c), "SpotiFLAC")
+	case fetchHistoryTypes[itemType]:
+		err = backend.ClearFetchHistoryByType(itemType, requestScope(c), "SpotiFLAC")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of track, album, playlist, artist"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to clear fetch history",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// DeleteFetchHistoryItem deletes a specific fetch history item
+// Endpoint: DELETE /api/history/fetch/:id
+func (h *Handler) DeleteFetchHistoryItem(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := backend.DeleteFetchHistoryItem(id, CurrentPrincipal(c).Scope(), "SpotiFLAC"); err != nil {
+		if errors.Is(err, backend.ErrHistoryItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete fetch history item",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// FFmpegStatusResponse is the body of GET /api/system/ffmpeg/status
+type FFmpegStatusResponse struct {
+	Installed bool `json:"installed"`
+}
+
 // CheckFFmpegInstalled checks if FFmpeg is installed
 // Endpoint: GET /api/system/ffmpeg/status
 func (h *Handler) CheckFFmpegInstalled(c *gin.Context) {
@@ -462,30 +996,38 @@ func (h *Handler) CheckFFmpegInstalled(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"installed": installed,
-	})
+	c.JSON(http.StatusOK, FFmpegStatusResponse{Installed: installed})
+}
+
+// AnalyzeTrackRequest is the body of POST /api/analysis/track
+type AnalyzeTrackRequest struct {
+	FilePath string `json:"file_path" binding:"required"`
 }
 
 // AnalyzeTrack analyzes an audio file
 // Endpoint: POST /api/analysis/track
 func (h *Handler) AnalyzeTrack(c *gin.Context) {
-	var req struct {
-		FilePath string `json:"file_path" binding:"required"`
-	}
+	var req AnalyzeTrackRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	// Validate file path (rule #9: prevent path traversal)
-	if strings.Contains(req.FilePath, "..") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file path"})
+	// Only files in the principal's download directory (rule #9: prevent
+	// path traversal, also through symlinks)
+	root, err := fileRoot(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+	filePath, err := jailPath(root, req.FilePath)
+	if err != nil {
+		respondPathError(c, err)
 		return
 	}
 
-	result, err := backend.AnalyzeTrack(req.FilePath)
+	result, err := backend.AnalyzeTrack(filePath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to analyze track: %v", err),
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadTestConfig loads the shipped configuration with the download root in
+// a temporary directory and enables tidal
+func loadTestConfig(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("SPOTIFLAC_DOWNLOAD_PATH", root)
+	t.Setenv("SPOTIFLAC_API_KEYS", "admin:0123456789abcdef0123456789abcdef")
+	if _, err := config.Load("../../config.yml"); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	if err := backend.EnableProviders([]string{"tidal"}); err != nil {
+		t.Fatalf("EnableProviders() error = %v", err)
+	}
+	return root
+}
+
+// postJSON runs handler on a POST request with body as p
+func postJSON(handler gin.HandlerFunc, p *Principal, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(principalContextKey, p)
+	handler(c)
+	return rec
+}
+
+var traversalFormats = []string{
+	"../../../../tmp/{title}",
+	"{artist}/{title}",
+	`..\{title}`,
+	"..{title}",
+}
+
+func TestDownloadTrackFilenameFormat(t *testing.T) {
+	loadTestConfig(t)
+	t.Cleanup(func() { backend.ClearAllDownloads("") })
+	h := &Handler{}
+
+	for _, format := range traversalFormats {
+		t.Run(format, func(t *testing.T) {
+			body := `{"spotify_id": "4uLU6hMCjMI75M1A2tKUQC", "filename_format": "` + strings.ReplaceAll(format, `\`, `\\`) + `"}`
+			rec := postJSON(h.DownloadTrack, anonymousPrincipal(), body)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "filename_format") {
+				t.Errorf("status = %d %s, want 400 for the filename format", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := postJSON(h.DownloadTrack, anonymousPrincipal(), `{"spotify_id": "4uLU6hMCjMI75M1A2tKUQC", "filename_format": "{title} - {artist}"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("status = %d %s, want 202 for a plain format", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDownloadCollectionFilenameFormat(t *testing.T) {
+	loadTestConfig(t)
+	h := &Handler{}
+
+	// Rejected before the collection is resolved, so no track is queued
+	for _, format := range traversalFormats {
+		t.Run(format, func(t *testing.T) {
+			body := `{"url": "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy", "filename_format": "` + strings.ReplaceAll(format, `\`, `\\`) + `"}`
+			rec := postJSON(h.DownloadCollection, anonymousPrincipal(), body)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "filename_format") {
+				t.Errorf("status = %d %s, want 400 for the filename format", rec.Code, rec.Body.String())
+			}
+			if queue := backend.GetDownloadQueue().Queue; len(queue) != 0 {
+				t.Errorf("%d items queued", len(queue))
+			}
+		})
+	}
+}
+
+func TestSaveSettingsConfigPath(t *testing.T) {
+	shipped, err := os.ReadFile("../../config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "spotiflac.yml")
+	if err := os.WriteFile(path, shipped, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SPOTIFLAC_API_KEYS", "admin:0123456789abcdef0123456789abcdef")
+	if _, err := config.Load(path); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	t.Cleanup(func() { loadTestConfig(t) })
+
+	rec := postJSON((&Handler{}).SaveSettings, anonymousPrincipal(), `{"fontFamily": "saved-font"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s, want 200", rec.Code, rec.Body.String())
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), "saved-font") {
+		t.Error("settings not saved to the loaded file")
+	}
+	if _, err := os.Stat("config.yml"); !os.IsNotExist(err) {
+		os.Remove("config.yml")
+		t.Error("settings saved to config.yml in the working directory")
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness states
+const (
+	readinessReady    = "ready"
+	readinessDegraded = "degraded"
+	readinessNotReady = "not_ready"
+)
+
+// ReadinessResponse is the body of GET /health/ready
+type ReadinessResponse struct {
+	Status     string                             `json:"status"`
+	Time       int64                              `json:"time"`
+	Components map[string]backend.ComponentHealth `json:"components"`
+}
+
+// HealthLive reports that the process is running and serving HTTP. It
+// checks no dependencies so a broken mirror never gets the server restarted.
+// Endpoint: GET /health/live
+func (h *Handler) HealthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{
+		Status: "alive",
+		Time:   time.Now().Unix(),
+	})
+}
+
+// HealthReady checks the dependencies needed to serve downloads and
+// answers 503 while a required one is down, so orchestrators stop routing
+// traffic here (rule #15: Fail Securely)
+// Endpoint: GET /health/ready
+func (h *Handler) HealthReady(c *gin.Context) {
+	cfg := config.Get()
+
+	components := backend.CheckReadiness(c.Request.Context(), backend.HealthOptions{
+		DownloadPath:     cfg.Download.Path,
+		MinFreeBytes:     uint64(cfg.Health.MinFreeSpaceMB) << 20,
+		Timeout:          time.Duration(cfg.Health.TimeoutSeconds) * time.Second,
+		CheckSpotify:     cfg.Health.CheckSpotify,
+		CheckProviders:   cfg.Health.CheckProviders,
+		ExternalCacheTTL: time.Duration(cfg.Health.ExternalCacheSeconds) * time.Second,
+	})
+
+	status, code := readinessReady, http.StatusOK
+	for _, component := range components {
+		if component.Status == backend.HealthUp {
+			continue
+		}
+		if component.Required {
+			status, code = readinessNotReady, http.StatusServiceUnavailable
+			break
+		}
+		status = readinessDegraded
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, ReadinessResponse{
+		Status:     status,
+		Time:       time.Now().Unix(),
+		Components: components,
+	})
+}
+
+// MirrorHealthResponse is the body of GET /api/mirrors
+type MirrorHealthResponse struct {
+	Time    int64                  `json:"time"`
+	Mirrors []backend.MirrorHealth `json:"mirrors"`
+}
+
+// GetMirrorHealth lists the success rate, latency, last failure and
+// circuit state of every provider mirror
+// Endpoint: GET /api/mirrors
+func (h *Handler) GetMirrorHealth(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, MirrorHealthResponse{
+		Time:    time.Now().Unix(),
+		Mirrors: backend.MirrorHealthReport(),
+	})
+}
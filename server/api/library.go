@@ -0,0 +1,377 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioContentTypes maps the extensions written by the downloaders to the
+// Content-Type browsers expect; the system MIME table is often missing them
+var audioContentTypes = map[string]string{
+	".flac": "audio/flac",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+}
+
+// activeTranscodes counts running ffmpeg transcodes
+var activeTranscodes atomic.Int32
+
+// audioContentType returns the Content-Type of an audio file by extension
+func audioContentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := audioContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// StreamLibraryItem serves a downloaded file by history ID. Range and HEAD
+// requests are supported for the original file; ?transcode=mp3|opus
+// converts it with ffmpeg while streaming, which cannot be seeked.
+// Endpoint: GET /api/library/stream/:id?transcode=&bitrate=&download=
+func (h *Handler) StreamLibraryItem(c *gin.Context) {
+	item, err := backend.GetHistoryItem(c.Param("id"), CurrentPrincipal(c).Scope())
+	if err != nil {
+		if errors.Is(err, backend.ErrHistoryItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "History item not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to read history item", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read history"})
+		return
+	}
+	if item.Path == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "History item has no file"})
+		return
+	}
+
+	// The history path is re-checked against the caller's root; it may
+	// point anywhere if the download directory was changed since
+	root, err := fileRoot(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+	path, err := jailPath(root, item.Path)
+	if err != nil {
+		respondPathError(c, err)
+		return
+	}
+
+	if format := c.Query("transcode"); format != "" {
+		streamTranscoded(c, path, format)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		respondPathError(c, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path not found"})
+		return
+	}
+
+	setContentDisposition(c, filepath.Base(path))
+	c.Header("Content-Type", audioContentType(path))
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), file)
+}
+
+// streamTranscoded converts path to format and streams the output. The
+// length is unknown up front, so Range requests are answered with the
+// whole stream.
+func streamTranscoded(c *gin.Context, path, format string) {
+	cfg := config.Get().Library.Transcode
+	if !cfg.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Transcoding is disabled"})
+		return
+	}
+
+	contentType, ok := backend.TranscodeContentType(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "transcode must be mp3 or opus"})
+		return
+	}
+
+	bitrate := cfg.DefaultBitrateKbps
+	if value := c.Query("bitrate"); value != "" {
+		parsed, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(value), "k"))
+		if err != nil || parsed < 32 || parsed > cfg.MaxBitrateKbps {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bitrate must be between 32 and " + strconv.Itoa(cfg.MaxBitrateKbps)})
+			return
+		}
+		bitrate = parsed
+	}
+
+	if c.Request.Method != http.MethodHead {
+		// Each transcode runs its own ffmpeg, so their number is capped
+		// (rule #13: Defense in Depth)
+		if activeTranscodes.Add(1) > int32(cfg.MaxConcurrent) {
+			activeTranscodes.Add(-1)
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many transcodes in progress"})
+			return
+		}
+		defer activeTranscodes.Add(-1)
+	}
+
+	c.Header("Accept-Ranges", "none")
+	c.Header("Content-Type", contentType)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "." + format
+	setContentDisposition(c, name)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	err := backend.TranscodeAudio(c.Request.Context(), path, format, bitrate, c.Writer)
+	if err == nil || c.Request.Context().Err() != nil {
+		return
+	}
+
+	slog.ErrorContext(c.Request.Context(), "Transcode failed", "format", format, "bitrate_kbps", bitrate, "error", err)
+	if !c.Writer.Written() {
+		// c.JSON keeps an existing Content-Type
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transcode failed"})
+	}
+}
+
+// setContentDisposition plays the file inline unless ?download=1 asks for
+// an attachment
+func setContentDisposition(c *gin.Context, name string) {
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+}
+
+// archiveCoverNames are the album covers included next to archived tracks
+var archiveCoverNames = []string{"cover.jpg", "cover.png", "folder.jpg", "folder.png"}
+
+// DownloadLibraryArchive streams a ZIP of history items (?ids=a,b,c) or of
+// a directory (?path=) below the caller's download directory. Items bring
+// their lyrics and covers along plus a generated M3U8; a directory is
+// archived as it is. Range requests resume the download.
+// Endpoint: GET /api/library/archive?ids=&path=&name=
+func (h *Handler) DownloadLibraryArchive(c *gin.Context) {
+	cfg := config.Get().Library.Archive
+	if !cfg.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Archive downloads are disabled"})
+		return
+	}
+
+	ids := strings.FieldsFunc(c.Query("ids"), func(r rune) bool { return r == ',' })
+	if (len(ids) == 0) == (c.Query("path") == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Specify either ids or path"})
+		return
+	}
+	if len(ids) > maxFileBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids must contain between 1 and %d items", maxFileBatch)})
+		return
+	}
+
+	root, err := fileRoot(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+
+	var (
+		baseDir string
+		files   []string
+		tracks  []string
+		ok      bool
+	)
+	if len(ids) > 0 {
+		if tracks, ok = resolveHistoryTracks(c, root, ids); !ok {
+			return
+		}
+		baseDir = commonDir(tracks)
+		files = withSidecarFiles(tracks)
+	} else {
+		dir, ok := resolveFilePath(c)
+		if !ok {
+			return
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Path is not a directory"})
+			return
+		}
+		if files, err = listArchiveFiles(dir, cfg.MaxFiles); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Path is not a readable directory"})
+			return
+		}
+		baseDir = dir
+	}
+	if len(files) > cfg.MaxFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Archives are limited to %d files", cfg.MaxFiles)})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = filepath.Base(baseDir)
+	}
+	name = backend.SanitizeFilename(name)
+
+	entries := make([]backend.ArchiveEntry, 0, len(files)+1)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "A file of the archive is missing"})
+			return
+		}
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+			return
+		}
+		entries = append(entries, backend.ArchiveEntry{
+			Name:     name + "/" + filepath.ToSlash(rel),
+			Path:     file,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+
+	if len(tracks) > 0 {
+		var playlist bytes.Buffer
+		if err := backend.WriteM3U8(&playlist, baseDir, tracks); err == nil {
+			entries = append(entries, backend.ArchiveEntry{Name: name + "/" + name + ".m3u8", Data: playlist.Bytes()})
+		}
+	}
+
+	archive, err := backend.NewArchive(entries)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to lay out archive", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create archive"})
+		return
+	}
+	reader := archive.Reader()
+	defer reader.Close()
+
+	slog.InfoContext(c.Request.Context(), "Serving library archive", "files", len(entries), "bytes", archive.Size(), "range", c.GetHeader("Range") != "", "principal", CurrentPrincipal(c).Name)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Header("ETag", archive.ETag())
+	http.ServeContent(c.Writer, c.Request, "", archive.ModTime(), reader)
+}
+
+// resolveHistoryTracks looks up the files of history items and jails them
+// to root, aborting the request if one is missing or outside
+func resolveHistoryTracks(c *gin.Context, root string, ids []string) ([]string, bool) {
+	scope := CurrentPrincipal(c).Scope()
+	seen := make(map[string]bool, len(ids))
+	tracks := make([]string, 0, len(ids))
+	for _, id := range ids {
+		item, err := backend.GetHistoryItem(strings.TrimSpace(id), scope)
+		if err != nil || item.Path == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "History item not found", "id": id})
+			return nil, false
+		}
+		path, err := jailPath(root, item.Path)
+		if err != nil {
+			respondPathError(c, err)
+			return nil, false
+		}
+		if !seen[path] {
+			seen[path] = true
+			tracks = append(tracks, path)
+		}
+	}
+	return tracks, true
+}
+
+// withSidecarFiles adds the lyrics, cover and album cover files found next
+// to the tracks. Symlinks are skipped as they were not checked by jailPath.
+func withSidecarFiles(tracks []string) []string {
+	seen := make(map[string]bool, len(tracks))
+	files := make([]string, 0, len(tracks)*2)
+	add := func(path string) {
+		if seen[path] {
+			return
+		}
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+
+	for _, track := range tracks {
+		seen[track] = true
+		files = append(files, track)
+
+		base := strings.TrimSuffix(track, filepath.Ext(track))
+		add(base + ".lrc")
+		add(base + ".cover.jpg")
+		for _, cover := range archiveCoverNames {
+			add(filepath.Join(filepath.Dir(track), cover))
+		}
+	}
+	return files
+}
+
+// listArchiveFiles returns the regular files below dir, skipping symlinks
+// so the archive cannot reach outside the download directory. It stops
+// once more than maxFiles are found.
+func listArchiveFiles(dir string, maxFiles int) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || backend.IsPartialDownload(d.Name()) {
+			return nil
+		}
+		files = append(files, path)
+		if len(files) > maxFiles {
+			return errTooManyFiles
+		}
+		return nil
+	})
+	if errors.Is(err, errTooManyFiles) {
+		return files, nil
+	}
+	return files, err
+}
+
+var errTooManyFiles = errors.New("too many files")
+
+// commonDir returns the deepest directory containing all paths
+func commonDir(paths []string) string {
+	dir := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !isWithin(dir, path) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
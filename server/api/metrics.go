@@ -0,0 +1,22 @@
+package api
+
+import (
+	"log/slog"
+
+	"spotiflac/backend"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metrics returns download, provider, queue and WebSocket metrics for
+// Prometheus
+// Endpoint: GET /metrics
+func (h *Handler) Metrics(c *gin.Context) {
+	c.Header("Content-Type", metricsContentType)
+	if err := backend.WriteMetrics(c.Writer); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to write metrics", "error", err)
+	}
+}
@@ -1,7 +1,15 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"spotiflac/backend"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,7 +24,7 @@ func ErrorHandler() gin.HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				// Log detailed error for developers (rule #16: Audit Logging)
-				c.Error(err.(error))
+				slog.ErrorContext(c.Request.Context(), "panic while handling request", "panic", err, "path", c.Request.URL.Path)
 
 				// Return neutral error message to user (rule #15: don't expose internals)
 				c.JSON(http.StatusInternalServerError, gin.H{
@@ -29,23 +37,70 @@ func ErrorHandler() gin.HandlerFunc {
 	}
 }
 
-// RequestLogger logs all requests for audit purposes
+// RequestIDHeader carries the request ID. A valid ID sent by the client (or
+// a proxy) is kept, otherwise a new one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits accepted client IDs to characters that are safe in
+// logs (rule #9: Zero Trust Input)
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestLogger assigns every request an ID, stores it in the request
+// context for the backend and logs the request when it completes
 // Following rule #16: Audit Logs - know who did what when
 func RequestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Log request details
-		// In production, this should write to a centralized logging system
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(backend.WithRequestID(c.Request.Context(), requestID))
+
 		c.Next()
 
-		// Log after request completes to capture status and errors
-		statusCode := c.Writer.Status()
-		if statusCode >= 400 {
-			// Log error requests with more detail
-			c.Error(c.Errors.Last())
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		}
+		if value, ok := c.Get(principalContextKey); ok {
+			principal := value.(*Principal)
+			name := principal.Name
+			if name == "" {
+				name = principal.Kind
+			}
+			attrs = append(attrs, "principal", name)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.String())
+		}
+
+		ctx := c.Request.Context()
+		switch {
+		case status >= 500:
+			slog.ErrorContext(ctx, "request failed", attrs...)
+		case status >= 400:
+			slog.WarnContext(ctx, "request rejected", attrs...)
+		default:
+			slog.InfoContext(ctx, "request", attrs...)
 		}
 	}
 }
 
+// newRequestID returns a random 16 byte hex ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
 // SecurityHeaders adds security headers to all responses
 // Following rule #14: Secure by Default - set security headers
 func SecurityHeaders() gin.HandlerFunc {
@@ -75,3 +130,74 @@ func InputSanitizer() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AuthRequired rejects requests without a valid API key or session token
+// Following rule #14: Secure by Default - every protected route needs a credential
+//
+// Credentials are read from "Authorization: Bearer <key|token>" or the
+// X-API-Key header. Browsers cannot set headers on WebSocket upgrades,
+// EventSource requests, media elements or download links, so those and the
+// routes in queryTokenRoutes may pass the credential as the access_token
+// query parameter instead.
+func AuthRequired(auth *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth == nil || !auth.Enabled() {
+			c.Set(principalContextKey, anonymousPrincipal())
+			c.Next()
+			return
+		}
+
+		principal, ok := auth.authenticate(requestCredential(c))
+		if !ok {
+			// Audit log (rule #16): record rejected requests without the credential
+			slog.WarnContext(c.Request.Context(), "AUDIT unauthorized request", "method", c.Request.Method, "path", c.Request.URL.Path, "client_ip", c.ClientIP())
+			c.Header("WWW-Authenticate", `Bearer realm="spotiflac"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// queryTokenRoutes are the routes besides WebSocket and SSE that accept the
+// access_token query parameter, keyed by route pattern
+var queryTokenRoutes = map[string]bool{
+	"/api/library/stream/:id": true,
+	"/api/library/archive":    true,
+}
+
+// requestCredential extracts the API key or session token of a request
+func requestCredential(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, value, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+		return ""
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+
+	isUpgrade := strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+	isEventStream := strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+	if isUpgrade || isEventStream || queryTokenRoutes[c.FullPath()] {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// AdminRequired rejects callers without the admin role. It must run after
+// AuthRequired.
+// Following rule #10: Least Privilege - user management is admin only
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CurrentPrincipal(c).IsAdmin() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin rights required"})
+			return
+		}
+		c.Next()
+	}
+}
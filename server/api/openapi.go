@@ -0,0 +1,414 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIVersion is the version of the API described by the document
+const OpenAPIVersion = "1.0.0"
+
+// OpenAPIDocument is an OpenAPI 3.0 document, limited to the parts the
+// SpotiFLAC API uses
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	// Security is empty for public routes and unset for the default
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*Schema               `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	Name   string `json:"name,omitempty"`
+	In     string `json:"in,omitempty"`
+}
+
+// Schema is a JSON schema. An empty schema allows any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// apiParam is a query parameter, or documents a path parameter
+type apiParam struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Description string
+}
+
+// apiOperation describes one route. Request and Response are zero values
+// of the body types; their schemas are derived by reflection.
+type apiOperation struct {
+	Method string
+	Path   string // in gin syntax, e.g. /api/history/downloads/:id
+	// ID is the operationId and the method name in the generated client
+	ID      string
+	Tag     string
+	Summary string
+	Query   []apiParam
+	// PathParams documents the :name segments of Path
+	PathParams []apiParam
+	Request    any
+	Response   any
+	// Status is the success status, 200 when zero
+	Status int
+	// Content is the success content type when it is not JSON
+	Content string
+	Public  bool
+	// Optional routes are only registered when enabled in config.yml
+	Optional bool
+}
+
+var ginParamPattern = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+// BuildOpenAPI describes routes as an OpenAPI document. Every route must
+// have an entry in apiOperations and every entry that is not optional must
+// be registered, so a route added without documentation, or documentation
+// left over from a removed route, fails server start instead of drifting.
+// With nil routes all operations are described without checking; the
+// client generator uses that.
+func BuildOpenAPI(routes gin.RoutesInfo) (*OpenAPIDocument, error) {
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	documented := make(map[string]bool, len(apiOperations))
+	var problems []string
+	for _, op := range apiOperations {
+		key := op.Method + " " + op.Path
+		if documented[key] {
+			problems = append(problems, "documented twice: "+key)
+		}
+		documented[key] = true
+		if routes != nil && !registered[key] && !op.Optional {
+			problems = append(problems, "documented but not registered: "+key)
+		}
+	}
+	for _, route := range routes {
+		if !documented[route.Method+" "+route.Path] {
+			problems = append(problems, "registered but not documented: "+route.Method+" "+route.Path)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("OpenAPI document does not match the routes: %s", strings.Join(problems, "; "))
+	}
+
+	b := &schemaBuilder{schemas: map[string]*Schema{}, types: map[string]reflect.Type{}}
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "SpotiFLAC HTTP API",
+			Version:     OpenAPIVersion,
+			Description: "Errors are answered with an ErrorResponse body. Credentials go in \"Authorization: Bearer\" or X-API-Key; WebSocket, event stream and library routes also accept the access_token query parameter.",
+		},
+		Paths: map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				"bearerAuth":  {Type: "http", Scheme: "bearer"},
+				"apiKey":      {Type: "apiKey", Name: "X-API-Key", In: "header"},
+				"accessToken": {Type: "apiKey", Name: "access_token", In: "query"},
+			},
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}},
+	}
+	errorSchema := b.schema(reflect.TypeOf(ErrorResponse{}))
+
+	for _, op := range apiOperations {
+		if routes != nil && !registered[op.Method+" "+op.Path] {
+			continue
+		}
+
+		path := ginParamPattern.ReplaceAllString(op.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = b.operation(op, errorSchema)
+	}
+
+	if b.err != nil {
+		return nil, b.err
+	}
+	return doc, nil
+}
+
+// operation describes one apiOperation
+func (b *schemaBuilder) operation(op apiOperation, errorSchema *Schema) *OpenAPIOperation {
+	out := &OpenAPIOperation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Tags:        []string{op.Tag},
+		Responses:   map[string]*OpenAPIResponse{},
+	}
+
+	for _, match := range ginParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		param := apiParam{Name: match[1], Type: "string"}
+		for _, documented := range op.PathParams {
+			if documented.Name == param.Name {
+				param = documented
+			}
+		}
+		out.Parameters = append(out.Parameters, openAPIParameter(param, "path"))
+	}
+	for _, param := range op.Query {
+		out.Parameters = append(out.Parameters, openAPIParameter(param, "query"))
+	}
+
+	switch {
+	case op.Public:
+		out.Security = &[]map[string][]string{}
+	case queryTokenRoutes[op.Path] || op.Path == "/ws" || op.Path == "/api/events":
+		out.Security = &[]map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}, {"accessToken": {}}}
+	}
+
+	if op.Request != nil {
+		out.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content:  map[string]OpenAPIMediaType{"application/json": {Schema: b.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &OpenAPIResponse{Description: http.StatusText(status)}
+	switch {
+	case op.Content != "":
+		success.Content = map[string]OpenAPIMediaType{op.Content: {}}
+	case op.Response != nil:
+		success.Content = map[string]OpenAPIMediaType{"application/json": {Schema: b.schema(reflect.TypeOf(op.Response))}}
+	}
+	out.Responses[strconv.Itoa(status)] = success
+	out.Responses["default"] = &OpenAPIResponse{
+		Description: "Error",
+		Content:     map[string]OpenAPIMediaType{"application/json": {Schema: errorSchema}},
+	}
+
+	return out
+}
+
+func openAPIParameter(param apiParam, in string) OpenAPIParameter {
+	typ := param.Type
+	if typ == "" {
+		typ = "string"
+	}
+	return OpenAPIParameter{
+		Name:        param.Name,
+		In:          in,
+		Required:    in == "path",
+		Description: param.Description,
+		Schema:      &Schema{Type: typ},
+	}
+}
+
+// schemaBuilder derives schemas from Go types the way encoding/json
+// marshals them. Named structs become components referenced by name.
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+	err     error
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if s.Type != "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return b.component(t)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+
+	b.fail(fmt.Errorf("no schema for type %s", t))
+	return &Schema{}
+}
+
+// component registers a named struct once and references it
+func (b *schemaBuilder) component(t reflect.Type) *Schema {
+	name := t.Name()
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if existing, ok := b.types[name]; ok {
+		if existing != t {
+			b.fail(fmt.Errorf("schema name %s is used by %s and %s", name, existing, t))
+		}
+		return ref
+	}
+
+	// Registered before its fields so recursive types terminate
+	b.types[name] = t
+	b.schemas[name] = &Schema{}
+	*b.schemas[name] = *b.object(t)
+	return ref
+}
+
+func (b *schemaBuilder) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	return s
+}
+
+// addFields adds the JSON fields of t, flattening embedded structs like
+// encoding/json. Fields with binding:"required" are required.
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(s, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = b.schema(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func (b *schemaBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// LoadOpenAPI builds the document of routes and serves it from
+// GET /api/openapi.json
+func (h *Handler) LoadOpenAPI(routes gin.RoutesInfo) error {
+	doc, err := BuildOpenAPI(routes)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	h.openAPI = data
+	return nil
+}
+
+// OpenAPI returns the OpenAPI document of the routes this server serves
+// Endpoint: GET /api/openapi.json
+func (h *Handler) OpenAPI(c *gin.Context) {
+	if h.openAPI == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpenAPI document is not loaded"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.openAPI)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+
+	"spotiflac/backend"
+)
+
+// userIDParam narrows the views of admins to one user
+var userIDParam = apiParam{Name: "user_id", Description: "Admins only: limit to the entries of this user"}
+
+// idParam documents the :id segment of a path
+func idParam(description string) []apiParam {
+	return []apiParam{{Name: "id", Description: description}}
+}
+
+// apiOperations documents every route. BuildOpenAPI refuses to start the
+// server when this list and the router disagree.
+var apiOperations = []apiOperation{
+	// Health and metrics
+	{Method: "GET", Path: "/health", ID: "Health", Tag: "Health", Summary: "Server health", Response: HealthResponse{}, Public: true},
+	{Method: "GET", Path: "/health/live", ID: "HealthLive", Tag: "Health", Summary: "Liveness probe", Response: HealthResponse{}, Public: true},
+	{Method: "GET", Path: "/health/ready", ID: "HealthReady", Tag: "Health", Summary: "Readiness probe, 503 while a required component is down", Response: ReadinessResponse{}, Public: true},
+	{Method: "GET", Path: "/metrics", ID: "Metrics", Tag: "Health", Summary: "Prometheus metrics (admin unless metrics.public)", Content: metricsContentType, Optional: true},
+	{Method: "GET", Path: "/api/mirrors", ID: "GetMirrorHealth", Tag: "Health", Summary: "Health and circuit state of every provider mirror (admin)", Response: MirrorHealthResponse{}},
+	{Method: "POST", Path: "/api/providers/reload", ID: "ReloadProviders", Tag: "Health", Summary: "Apply the provider endpoints of config.yml without a restart (admin)", Response: MirrorHealthResponse{}},
+
+	// Authentication and users
+	{Method: "POST", Path: "/api/auth/login", ID: "Login", Tag: "Auth", Summary: "Exchange username and password for a session token", Request: LoginRequest{}, Response: LoginResponse{}, Public: true},
+	{Method: "GET", Path: "/api/auth/me", ID: "Me", Tag: "Auth", Summary: "The authenticated caller", Response: Principal{}},
+	{Method: "POST", Path: "/api/auth/password", ID: "ChangePassword", Tag: "Auth", Summary: "Change the caller's password", Request: ChangePasswordRequest{}, Response: SuccessResponse{}},
+	{Method: "GET", Path: "/api/users", ID: "ListUsers", Tag: "Users", Summary: "List user accounts (admin)", Response: []UserInfo{}},
+	{Method: "POST", Path: "/api/users", ID: "CreateUser", Tag: "Users", Summary: "Create a user account (admin)", Request: CreateUserRequest{}, Response: UserInfo{}, Status: http.StatusCreated},
+	{Method: "PATCH", Path: "/api/users/:id", ID: "UpdateUser", Tag: "Users", Summary: "Change a user's password or role (admin)", Request: UpdateUserRequest{}, Response: UserInfo{}},
+	{Method: "DELETE", Path: "/api/users/:id", ID: "DeleteUser", Tag: "Users", Summary: "Delete a user account, keeping its files (admin)", Response: SuccessResponse{}},
+
+	// Spotify
+	{Method: "POST", Path: "/api/spotify/metadata", ID: "GetSpotifyMetadata", Tag: "Spotify", Summary: "Metadata of a track, album, playlist or artist URL", Request: MetadataRequest{}, Response: new(any)},
+	{Method: "POST", Path: "/api/spotify/search", ID: "SearchSpotify", Tag: "Spotify", Summary: "Search tracks, albums, artists and playlists", Request: SearchRequest{}, Response: backend.SearchResponse{}},
+	{Method: "POST", Path: "/api/spotify/search-by-type", ID: "SearchSpotifyByType", Tag: "Spotify", Summary: "Search one type with paging", Request: SearchByTypeRequest{}, Response: []backend.SearchResult{}},
+	{Method: "POST", Path: "/api/spotify/streaming-urls", ID: "GetStreamingURLs", Tag: "Spotify", Summary: "Tidal and Amazon URLs of a track", Request: StreamingURLsRequest{}, Response: backend.SongLinkURLs{}},
+
+	// Events
+	{Method: "GET", Path: "/api/events", ID: "StreamEvents", Tag: "Events", Summary: "Queue and availability events as Server-Sent Events", Content: "text/event-stream", Query: []apiParam{
+		{Name: "types", Description: "Comma separated event types to receive"},
+		{Name: "last_event_id", Description: "Replay events after this ID, like the Last-Event-ID header"},
+	}},
+	{Method: "GET", Path: "/ws", ID: "WebSocket", Tag: "Events", Summary: "Queue and availability events over WebSocket", Status: http.StatusSwitchingProtocols},
+
+	// Downloads and queue
+	{Method: "POST", Path: "/api/download/track", ID: "DownloadTrack", Tag: "Downloads", Summary: "Queue a track download", Request: DownloadTrackRequest{}, Response: backend.DownloadResponse{}, Status: http.StatusAccepted},
+	{Method: "POST", Path: "/api/download/collection", ID: "DownloadCollection", Tag: "Downloads", Summary: "Queue every track of an album, playlist or artist", Request: DownloadCollectionRequest{}, Response: CollectionResponse{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/download/queue", ID: "GetDownloadQueue", Tag: "Queue", Summary: "Queue items and counters", Query: []apiParam{userIDParam}, Response: backend.DownloadQueueInfo{}},
+	{Method: "GET", Path: "/api/download/progress", ID: "GetDownloadProgress", Tag: "Queue", Summary: "Progress of the running download", Query: []apiParam{userIDParam}, Response: backend.ProgressInfo{}},
+	{Method: "POST", Path: "/api/download/queue/clear", ID: "ClearCompletedDownloads", Tag: "Queue", Summary: "Remove finished items", Query: []apiParam{userIDParam}, Response: SuccessResponse{}},
+	{Method: "POST", Path: "/api/download/queue/clear-all", ID: "ClearAllDownloads", Tag: "Queue", Summary: "Remove all items that are not running", Query: []apiParam{userIDParam}, Response: SuccessResponse{}},
+	{Method: "POST", Path: "/api/download/queue/cancel-all", ID: "CancelAllQueuedItems", Tag: "Queue", Summary: "Skip all queued items", Query: []apiParam{userIDParam}, Response: SuccessResponse{}},
+	{Method: "POST", Path: "/api/download/queue/:id/cancel", ID: "CancelDownloadItem", Tag: "Queue", Summary: "Cancel a queued, paused or running item", PathParams: idParam("Queue item ID"), Response: QueueItemResponse{}},
+	{Method: "POST", Path: "/api/download/queue/:id/pause", ID: "PauseDownloadItem", Tag: "Queue", Summary: "Pause a queued or running item", PathParams: idParam("Queue item ID"), Response: QueueItemResponse{}},
+	{Method: "POST", Path: "/api/download/queue/:id/resume", ID: "ResumeDownloadItem", Tag: "Queue", Summary: "Queue a paused item again", PathParams: idParam("Queue item ID"), Response: QueueItemResponse{}},
+	{Method: "POST", Path: "/api/download/queue/:id/retry", ID: "RetryDownloadItem", Tag: "Queue", Summary: "Queue a failed, cancelled or skipped item again", PathParams: idParam("Queue item ID"), Response: QueueItemResponse{}},
+
+	// Lyrics and artwork
+	{Method: "POST", Path: "/api/download/lyrics", ID: "DownloadLyrics", Tag: "Assets", Summary: "Save the synced lyrics of a track", Request: LyricsRequest{}, Response: backend.LyricsDownloadResponse{}},
+	{Method: "POST", Path: "/api/download/lyrics/batch", ID: "DownloadLyricsBatch", Tag: "Assets", Summary: "Save the lyrics of several tracks", Request: AssetBatchRequest{}, Response: AssetBatchResponse{}},
+	{Method: "POST", Path: "/api/download/cover", ID: "DownloadCover", Tag: "Assets", Summary: "Save the cover of a track", Request: CoverRequest{}, Response: backend.CoverDownloadResponse{}},
+	{Method: "POST", Path: "/api/download/cover/batch", ID: "DownloadCoverBatch", Tag: "Assets", Summary: "Save the covers of several tracks", Request: AssetBatchRequest{}, Response: AssetBatchResponse{}},
+	{Method: "POST", Path: "/api/download/header", ID: "DownloadHeader", Tag: "Assets", Summary: "Save an artist's header image", Request: HeaderRequest{}, Response: backend.HeaderDownloadResponse{}},
+	{Method: "POST", Path: "/api/download/gallery", ID: "DownloadGalleryImage", Tag: "Assets", Summary: "Save one artist gallery image", Request: GalleryImageRequest{}, Response: backend.GalleryImageDownloadResponse{}},
+	{Method: "POST", Path: "/api/download/gallery/batch", ID: "DownloadGalleryBatch", Tag: "Assets", Summary: "Save several artist gallery images", Request: GalleryBatchRequest{}, Response: AssetBatchResponse{}},
+	{Method: "POST", Path: "/api/download/avatar", ID: "DownloadAvatar", Tag: "Assets", Summary: "Save an artist's avatar", Request: AvatarRequest{}, Response: backend.AvatarDownloadResponse{}},
+
+	// History
+	{Method: "GET", Path: "/api/history/downloads", ID: "GetDownloadHistory", Tag: "History", Summary: "Download history, newest first", Query: []apiParam{userIDParam}, Response: []backend.HistoryItem{}},
+	{Method: "POST", Path: "/api/history/downloads/clear", ID: "ClearDownloadHistory", Tag: "History", Summary: "Clear the download history", Query: []apiParam{userIDParam}, Response: SuccessResponse{}},
+	{Method: "DELETE", Path: "/api/history/downloads/:id", ID: "DeleteDownloadHistoryItem", Tag: "History", Summary: "Delete a download history entry", PathParams: idParam("History entry ID"), Response: SuccessResponse{}},
+	{Method: "GET", Path: "/api/history/fetch", ID: "GetFetchHistory", Tag: "History", Summary: "Fetch history, newest first", Query: []apiParam{userIDParam}, Response: []backend.FetchHistoryItem{}},
+	{Method: "POST", Path: "/api/history/fetch", ID: "AddFetchHistory", Tag: "History", Summary: "Record a fetched URL", Request: FetchHistoryRequest{}, Response: SuccessResponse{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/api/history/fetch/clear", ID: "ClearFetchHistory", Tag: "History", Summary: "Clear the fetch history, or the entries of one type", Query: []apiParam{
+		{Name: "type", Description: "Only clear entries of this type: track, album, playlist or artist"},
+		userIDParam,
+	}, Response: SuccessResponse{}},
+	{Method: "DELETE", Path: "/api/history/fetch/:id", ID: "DeleteFetchHistoryItem", Tag: "History", Summary: "Delete a fetch history entry", PathParams: idParam("History entry ID"), Response: SuccessResponse{}},
+
+	// Availability
+	{Method: "POST", Path: "/api/availability", ID: "StartAvailabilityCheck", Tag: "Availability", Summary: "Check tracks in the background, results arrive as events", Request: AvailabilityRequest{}, Response: AvailabilityResponse{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/availability/:id", ID: "GetAvailabilityCheck", Tag: "Availability", Summary: "Progress and results of a check", PathParams: idParam("Check ID"), Response: backend.AvailabilityCheck{}},
+	{Method: "DELETE", Path: "/api/availability/:id", ID: "CancelAvailabilityCheck", Tag: "Availability", Summary: "Cancel the unchecked tracks of a check", PathParams: idParam("Check ID"), Response: backend.AvailabilityCheck{}},
+
+	// Settings
+	{Method: "GET", Path: "/api/settings", ID: "GetSettings", Tag: "Settings", Summary: "Settings with the caller's overlay applied", Response: map[string]any{}},
+	{Method: "POST", Path: "/api/settings", ID: "SaveSettings", Tag: "Settings", Summary: "Change config.yml (admin) or the caller's overlay", Request: map[string]any{}, Response: SuccessResponse{}},
+	{Method: "GET", Path: "/api/defaults", ID: "GetDefaults", Tag: "Settings", Summary: "Default values of the host", Response: map[string]string{}},
+
+	// Files
+	{Method: "GET", Path: "/api/files/list", ID: "ListFiles", Tag: "Files", Summary: "Directory tree below a path", Query: []apiParam{{Name: "path", Description: "Directory relative to the download directory"}}, Response: FileListResponse{}},
+	{Method: "GET", Path: "/api/files/audio", ID: "ListAudioFiles", Tag: "Files", Summary: "Audio files below a path", Query: []apiParam{{Name: "path", Description: "Directory relative to the download directory"}}, Response: FileListResponse{}},
+	{Method: "GET", Path: "/api/files/metadata", ID: "ReadFileMetadata", Tag: "Files", Summary: "Tags of an audio file", Query: []apiParam{{Name: "path", Description: "File relative to the download directory"}}, Response: backend.AudioMetadata{}},
+	{Method: "POST", Path: "/api/files/sizes", ID: "GetFileSizes", Tag: "Files", Summary: "Size in bytes of each file", Request: FileSizesRequest{}, Response: map[string]int64{}},
+	{Method: "POST", Path: "/api/files/rename/preview", ID: "PreviewRename", Tag: "Files", Summary: "Names a rename would give the files", Request: RenameRequest{}, Response: []backend.RenamePreview{}},
+	{Method: "POST", Path: "/api/files/rename", ID: "RenameFiles", Tag: "Files", Summary: "Rename audio files from their tags", Request: RenameRequest{}, Response: []backend.RenameResult{}},
+
+	// Library
+	{Method: "GET", Path: "/api/library/stream/:id", ID: "StreamLibraryItem", Tag: "Library", Summary: "Stream the file of a download history entry, with Range support", PathParams: idParam("Download history entry ID"), Query: streamParams, Content: "audio/*"},
+	{Method: "HEAD", Path: "/api/library/stream/:id", ID: "HeadLibraryItem", Tag: "Library", Summary: "Headers of a stream", PathParams: idParam("Download history entry ID"), Query: streamParams, Content: "audio/*"},
+	{Method: "GET", Path: "/api/library/archive", ID: "DownloadLibraryArchive", Tag: "Library", Summary: "ZIP of history entries or a directory, resumable", Query: archiveParams, Content: "application/zip"},
+	{Method: "HEAD", Path: "/api/library/archive", ID: "HeadLibraryArchive", Tag: "Library", Summary: "Headers of an archive", Query: archiveParams, Content: "application/zip"},
+
+	// System and analysis
+	{Method: "GET", Path: "/api/system/ffmpeg/status", ID: "CheckFFmpegInstalled", Tag: "System", Summary: "Whether FFmpeg is installed", Response: FFmpegStatusResponse{}},
+	{Method: "POST", Path: "/api/analysis/track", ID: "AnalyzeTrack", Tag: "Analysis", Summary: "Spectrum and quality analysis of an audio file", Request: AnalyzeTrackRequest{}, Response: backend.AnalysisResult{}},
+	{Method: "GET", Path: "/api/openapi.json", ID: "GetOpenAPI", Tag: "System", Summary: "OpenAPI 3 document of this API", Response: new(any)},
+}
+
+var streamParams = []apiParam{
+	{Name: "format", Description: "Transcode to mp3 or opus"},
+	{Name: "bitrate", Description: "Transcode bitrate in kbps, e.g. 192 or 192k"},
+	{Name: "download", Type: "boolean", Description: "Send as attachment"},
+}
+
+var archiveParams = []apiParam{
+	{Name: "ids", Description: "Comma separated download history entry IDs"},
+	{Name: "path", Description: "Directory relative to the download directory"},
+	{Name: "name", Description: "Archive name"},
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApplyProviderEndpoints hands the configured endpoint lists to the
+// providers. Disabled endpoints are left out; ${NAME} in header values is
+// replaced by the environment variable so tokens stay out of config.yml
+// (rule #11).
+func ApplyProviderEndpoints(providers map[string]config.ProviderConfig) error {
+	endpoints := make(map[string][]backend.Endpoint, len(providers))
+	for name, provider := range providers {
+		list := []backend.Endpoint{}
+		for _, e := range provider.Endpoints {
+			if !e.IsEnabled() {
+				continue
+			}
+			headers, err := expandHeaders(e.Headers)
+			if err != nil {
+				return fmt.Errorf("providers.%s endpoint %s: %w", name, e.URL, err)
+			}
+			list = append(list, backend.Endpoint{
+				URL:     e.URL,
+				Kind:    e.Kind,
+				Weight:  e.Weight,
+				Timeout: time.Duration(e.TimeoutSeconds) * time.Second,
+				Headers: headers,
+			})
+		}
+		endpoints[name] = list
+	}
+	return backend.SetProviderEndpoints(endpoints)
+}
+
+// expandHeaders resolves environment references in header values. An unset
+// variable is an error rather than an empty header (rule #15: Fail
+// Securely).
+func expandHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	expanded := make(map[string]string, len(headers))
+	for header, value := range headers {
+		var missing string
+		expanded[header] = os.Expand(value, func(name string) string {
+			v, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return v
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("header %s references unset variable %s", header, missing)
+		}
+	}
+	return expanded, nil
+}
+
+// ReloadProviderEndpoints re-reads the providers section of the
+// configuration file and applies it. On error the running endpoints stay.
+func ReloadProviderEndpoints() error {
+	return config.ReloadProviders(ApplyProviderEndpoints)
+}
+
+// ReloadProviders applies the provider endpoints of config.yml without a
+// restart and answers with the resulting mirror list
+// Endpoint: POST /api/providers/reload
+func (h *Handler) ReloadProviders(c *gin.Context) {
+	if err := ReloadProviderEndpoints(); err != nil {
+		slog.WarnContext(c.Request.Context(), "Provider reload failed", "error", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "AUDIT providers reloaded", "by", CurrentPrincipal(c).Name)
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, MirrorHealthResponse{
+		Time:    time.Now().Unix(),
+		Mirrors: backend.MirrorHealthReport(),
+	})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit budgets, each configured in the ratelimit section of config.yml
+const (
+	BudgetMetadata = "metadata"
+	BudgetSearch   = "search"
+	BudgetDownload = "download"
+	BudgetLogin    = "login"
+)
+
+// rateLimitSweepInterval is how often idle, full buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds up to burst tokens and refills at rate tokens per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateBudget struct {
+	rate  float64 // tokens per second
+	burst float64
+}
+
+type bucketKey struct {
+	budget string
+	client string
+}
+
+// RateLimiter keeps one token bucket per client and budget
+type RateLimiter struct {
+	enabled   bool
+	budgets   map[string]rateBudget
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewRateLimiter creates a rate limiter from the ratelimit config section
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	budget := func(b config.RateLimitBudget) rateBudget {
+		return rateBudget{rate: b.RequestsPerMinute / 60, burst: float64(b.Burst)}
+	}
+
+	return &RateLimiter{
+		enabled: cfg.Enabled,
+		budgets: map[string]rateBudget{
+			BudgetMetadata: budget(cfg.Metadata),
+			BudgetSearch:   budget(cfg.Search),
+			BudgetDownload: budget(cfg.Download),
+			BudgetLogin:    budget(cfg.Login),
+		},
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket. If none is left it returns
+// how long the client has to wait for the next one.
+func (l *RateLimiter) allow(budgetName, client string, now time.Time) (bool, time.Duration) {
+	budget, ok := l.budgets[budgetName]
+	if !ok {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	key := bucketKey{budget: budgetName, client: client}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: budget.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(budget.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*budget.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / budget.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, they are the same as a
+// new bucket. Callers hold the mutex.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		budget := l.budgets[key.budget]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*budget.rate >= budget.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller for rate limiting: the API key or
+// user account if authenticated, else the client IP
+func rateLimitClient(c *gin.Context) string {
+	principal := CurrentPrincipal(c)
+	switch {
+	case principal.UserID != "":
+		return "user:" + principal.UserID
+	case principal.Kind == PrincipalAPIKey:
+		return "key:" + principal.Name
+	default:
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimit rejects requests of clients that used up the given budget with
+// 429 Too Many Requests and a Retry-After header. On authenticated routes it
+// must run after AuthRequired so clients are keyed by credential.
+// Following rule #14: Secure by Default - one client cannot exhaust the
+// upstream (Spotify) rate limits for everyone
+func RateLimit(limiter *RateLimiter, budget string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || !limiter.enabled {
+			c.Next()
+			return
+		}
+
+		allowed, wait := limiter.allow(budget, rateLimitClient(c), time.Now())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, please retry later",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
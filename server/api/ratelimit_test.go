@@ -0,0 +1,77 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"spotiflac/backend/config"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		Search:  config.RateLimitBudget{RequestsPerMinute: 60, Burst: 3},
+	})
+	now := time.Unix(1700000000, 0)
+
+	// A new client gets the whole burst
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow(BudgetSearch, "ip:1", now); !ok {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	ok, wait := limiter.allow(BudgetSearch, "ip:1", now)
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v, want 1s at one token per second", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := limiter.allow(BudgetSearch, "ip:2", now); !ok {
+		t.Error("second client rejected")
+	}
+
+	// Tokens refill with time, up to the burst
+	if ok, _ := limiter.allow(BudgetSearch, "ip:1", now.Add(time.Second)); !ok {
+		t.Error("request after a refill rejected")
+	}
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow(BudgetSearch, "ip:1", later); !ok {
+			t.Fatalf("request %d rejected after a full refill", i+1)
+		}
+	}
+	if ok, _ := limiter.allow(BudgetSearch, "ip:1", later); ok {
+		t.Error("refill exceeded the burst")
+	}
+}
+
+func TestRateLimiterUnknownBudget(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitConfig{Enabled: true})
+	for i := 0; i < 10; i++ {
+		if ok, _ := limiter.allow("unknown", "ip:1", time.Now()); !ok {
+			t.Fatal("request of an unknown budget rejected")
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		Login:   config.RateLimitBudget{RequestsPerMinute: 60, Burst: 2},
+	})
+	now := time.Unix(1700000000, 0)
+
+	limiter.allow(BudgetLogin, "ip:1", now)
+	limiter.allow(BudgetLogin, "ip:2", now.Add(2*time.Minute))
+
+	// ip:1 refilled long ago and was dropped, ip:2 is still recovering
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("buckets = %d, want 1 after the sweep", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets[bucketKey{budget: BudgetLogin, client: "ip:2"}]; !ok {
+		t.Error("bucket of the active client was dropped")
+	}
+}
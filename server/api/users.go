@@ -0,0 +1,320 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"spotiflac/backend"
+	"spotiflac/backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserInfo is the public view of a user account, without the password hash
+type UserInfo struct {
+	ID        string               `json:"id"`
+	Username  string               `json:"username"`
+	Role      backend.UserRole     `json:"role"`
+	CreatedAt int64                `json:"created_at"`
+	Settings  backend.UserSettings `json:"settings"`
+}
+
+func newUserInfo(user backend.User) UserInfo {
+	return UserInfo{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		Settings:  user.Settings,
+	}
+}
+
+// CreateUserRequest is the body of POST /api/users
+type CreateUserRequest struct {
+	Username string           `json:"username" binding:"required"`
+	Password string           `json:"password" binding:"required"`
+	Role     backend.UserRole `json:"role"`
+}
+
+// UpdateUserRequest is the body of PATCH /api/users/:id. Omitted fields are
+// left unchanged.
+type UpdateUserRequest struct {
+	Password *string           `json:"password"`
+	Role     *backend.UserRole `json:"role"`
+}
+
+// ChangePasswordRequest is the body of POST /api/auth/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// userErrorStatus maps user store errors to HTTP status codes
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, backend.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, backend.ErrUserExists), errors.Is(err, backend.ErrLastAdmin):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// ListUsers returns all user accounts
+// Endpoint: GET /api/users (admin)
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := backend.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	infos := make([]UserInfo, 0, len(users))
+	for _, user := range users {
+		infos = append(infos, newUserInfo(user))
+	}
+	c.JSON(http.StatusOK, infos)
+}
+
+// CreateUser adds a user account
+// Endpoint: POST /api/users (admin)
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = backend.RoleUser
+	}
+	if err := h.auth.validatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := backend.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	user, err := backend.CreateUser(req.Username, hash, req.Role)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "AUDIT user created", "user", user.Username, "role", user.Role, "by", CurrentPrincipal(c).Name)
+	c.JSON(http.StatusCreated, newUserInfo(user))
+}
+
+// UpdateUser changes the password or role of a user account. A new
+// password ends all sessions of the user.
+// Endpoint: PATCH /api/users/:id (admin)
+func (h *Handler) UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var hash string
+	if req.Password != nil {
+		if err := h.auth.validatePassword(*req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var err error
+		if hash, err = backend.HashPassword(*req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+	}
+
+	user, err := backend.UpdateUser(c.Param("id"), func(user *backend.User) error {
+		if hash != "" {
+			user.PasswordHash = hash
+			user.TokenVersion++
+		}
+		if req.Role != nil {
+			user.Role = *req.Role
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "AUDIT user updated", "user", user.Username, "role", user.Role, "password_changed", hash != "", "by", CurrentPrincipal(c).Name)
+	c.JSON(http.StatusOK, newUserInfo(user))
+}
+
+// DeleteUser removes a user account. Files and history entries of the user
+// are kept.
+// Endpoint: DELETE /api/users/:id (admin)
+func (h *Handler) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	if err := backend.DeleteUser(id); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "AUDIT user deleted", "user_id", id, "by", CurrentPrincipal(c).Name)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ChangePassword lets a logged in user change their own password. All
+// existing sessions, including the current one, end.
+// Endpoint: POST /api/auth/password
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current and new password are required"})
+		return
+	}
+
+	principal := CurrentPrincipal(c)
+	if principal.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Caller is not a user account"})
+		return
+	}
+	if _, ok := h.auth.checkPassword(principal.Username, req.CurrentPassword); !ok {
+		slog.WarnContext(c.Request.Context(), "AUDIT password change failed", "user", principal.Username, "client_ip", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is wrong"})
+		return
+	}
+	if err := h.auth.validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := backend.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if _, err := backend.UpdateUser(principal.UserID, func(user *backend.User) error {
+		user.PasswordHash = hash
+		user.TokenVersion++
+		return nil
+	}); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "AUDIT password changed", "user", principal.Username, "client_ip", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// userConfig returns the configuration as seen by the caller: for user
+// accounts the download path is their own directory and their settings
+// overlay is applied on top of config.yml
+func userConfig(c *gin.Context) (*config.Config, error) {
+	cfg := *config.Get()
+
+	principal := CurrentPrincipal(c)
+	if principal.UserID == "" {
+		if !principal.IsAdmin() {
+			return nil, backend.ErrUserNotFound
+		}
+		return &cfg, nil
+	}
+
+	user, err := backend.GetUser(principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Download.Path = filepath.Join(cfg.Download.Path, cfg.Download.UsersDir, user.Username)
+	applyUserSettings(&cfg, user.Settings)
+
+	return &cfg, nil
+}
+
+// applyUserSettings overlays the fields a user has set onto cfg
+func applyUserSettings(cfg *config.Config, s backend.UserSettings) {
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setBool := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setString(&cfg.Download.FilenameFormat, s.FilenameFormat)
+	setString(&cfg.Download.AudioFormat, s.AudioFormat)
+	setBool(&cfg.Download.EmbedLyrics, s.EmbedLyrics)
+	setBool(&cfg.Download.EmbedMaxQualityCover, s.EmbedMaxQualityCover)
+	setBool(&cfg.Download.TrackNumber, s.TrackNumber)
+	setBool(&cfg.Download.UseAlbumTrackNumber, s.UseAlbumTrackNumber)
+	setBool(&cfg.Download.UseFirstArtistOnly, s.UseFirstArtistOnly)
+	setBool(&cfg.Download.AllowFallback, s.AllowFallback)
+	setBool(&cfg.Download.CreateM3U8, s.CreateM3U8)
+	setString(&cfg.Services.DefaultService, s.DefaultService)
+	setString(&cfg.UI.Theme, s.Theme)
+	setString(&cfg.UI.ThemeMode, s.ThemeMode)
+	setString(&cfg.UI.FontFamily, s.FontFamily)
+}
+
+// serverOnlySettings are settings keys that only admins can change because
+// they affect every user
+var serverOnlySettings = []string{"downloadPath", "useSpotFetchAPI", "spotFetchAPIUrl"}
+
+// errInvalidSetting marks settings values that are rejected as malformed
+// rather than as not allowed for the caller
+var errInvalidSetting = errors.New("invalid setting")
+
+// updateUserSettings applies a settings request to a user's overlay.
+// Server-wide keys are accepted only if they keep their current value, so
+// the frontend can send the full settings object back.
+func updateUserSettings(s *backend.UserSettings, settings map[string]interface{}, current map[string]interface{}) error {
+	for _, key := range serverOnlySettings {
+		if val, ok := settings[key]; ok && val != current[key] {
+			return fmt.Errorf("%s can only be changed by an admin", key)
+		}
+	}
+
+	stringSetting := func(key string, dst **string) {
+		if val, ok := settings[key].(string); ok {
+			*dst = &val
+		}
+	}
+	boolSetting := func(key string, dst **bool) {
+		if val, ok := settings[key].(bool); ok {
+			*dst = &val
+		}
+	}
+
+	stringSetting("filenameFormat", &s.FilenameFormat)
+	stringSetting("audioFormat", &s.AudioFormat)
+	boolSetting("embedLyrics", &s.EmbedLyrics)
+	boolSetting("embedMaxQualityCover", &s.EmbedMaxQualityCover)
+	boolSetting("trackNumber", &s.TrackNumber)
+	boolSetting("useAlbumTrackNumber", &s.UseAlbumTrackNumber)
+	boolSetting("useFirstArtistOnly", &s.UseFirstArtistOnly)
+	boolSetting("allowFallback", &s.AllowFallback)
+	boolSetting("createM3U8", &s.CreateM3U8)
+	stringSetting("defaultService", &s.DefaultService)
+	stringSetting("theme", &s.Theme)
+	stringSetting("themeMode", &s.ThemeMode)
+	stringSetting("fontFamily", &s.FontFamily)
+
+	// The format is applied to every later download of the user, so it
+	// must stay a file name (rule #9: Zero Trust Input)
+	if s.FilenameFormat != nil && *s.FilenameFormat != "" && !validRenameFormat(*s.FilenameFormat) {
+		return fmt.Errorf("%w: filenameFormat must not contain path separators or ..", errInvalidSetting)
+	}
+	if s.DefaultService != nil && !backend.ProviderEnabled(*s.DefaultService) {
+		return fmt.Errorf("%w: unknown or disabled service: %s", errInvalidSetting, *s.DefaultService)
+	}
+	if s.ThemeMode != nil && *s.ThemeMode != "light" && *s.ThemeMode != "dark" && *s.ThemeMode != "auto" {
+		return fmt.Errorf("%w: invalid theme mode: %s", errInvalidSetting, *s.ThemeMode)
+	}
+	return nil
+}
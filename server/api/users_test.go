@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"spotiflac/backend"
+)
+
+func TestSaveUserSettingsFilenameFormat(t *testing.T) {
+	initTestDB(t)
+	loadTestConfig(t)
+	user := createTestUser(t, "erin", backend.RoleUser)
+	p := userPrincipal(PrincipalUser, user.Username, user)
+	h := &Handler{}
+
+	for _, format := range traversalFormats {
+		t.Run(format, func(t *testing.T) {
+			body := `{"filenameFormat": "` + strings.ReplaceAll(format, `\`, `\\`) + `", "theme": "dark"}`
+			rec := postJSON(h.SaveSettings, p, body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d %s, want 400", rec.Code, rec.Body.String())
+			}
+
+			stored, err := backend.GetUser(user.ID)
+			if err != nil {
+				t.Fatalf("GetUser() error = %v", err)
+			}
+			if stored.Settings.FilenameFormat != nil || stored.Settings.Theme != nil {
+				t.Error("settings of a rejected request were stored")
+			}
+		})
+	}
+
+	rec := postJSON(h.SaveSettings, p, `{"filenameFormat": "{track}. {title}"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s, want 200 for a plain format", rec.Code, rec.Body.String())
+	}
+	stored, _ := backend.GetUser(user.ID)
+	if stored.Settings.FilenameFormat == nil || *stored.Settings.FilenameFormat != "{track}. {title}" {
+		t.Errorf("stored format = %v, want {track}. {title}", stored.Settings.FilenameFormat)
+	}
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"spotiflac/backend"
+	"spotiflac/backend/config"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -18,91 +23,262 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Allow connections from configured origins only
-	CheckOrigin: func(r *http.Request) bool {
-		// This will be configured based on config.yml CORS settings
-		// For now, allow all (will be restricted in production)
+	CheckOrigin:     checkWebSocketOrigin,
+}
+
+// checkWebSocketOrigin accepts WebSocket connections from the page's own
+// origin and from server.cors_origins only. Sockets authenticate with an
+// access_token query parameter, so without this check any web page could
+// open one with a token it got hold of (rule #13: Defense in Depth).
+// Clients that send no Origin header are not browsers and are accepted.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
 		return true
-	},
+	}
+	for _, allowed := range config.Get().Server.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	slog.Warn("AUDIT rejected WebSocket origin", "origin", origin, "client_ip", r.RemoteAddr)
+	return false
+}
+
+// wsClient is a connected WebSocket client. All writes to conn go through
+// the send queue and are performed by the client's own writePump, so a slow
+// client only ever blocks itself.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+
+	// userID limits the queue events a client receives to one user's
+	// items; empty for admins
+	userID string
+}
+
+// scopedMessage is a broadcast only delivered to clients that may see the
+// items of userID
+type scopedMessage struct {
+	userID  string
+	message interface{}
+}
+
+// receives reports whether the client may see a message about userID's items
+func (client *wsClient) receives(userID string) bool {
+	return client.userID == "" || client.userID == userID
 }
 
 // WebSocketManager manages WebSocket connections and broadcasts
 type WebSocketManager struct {
-	clients   map[*websocket.Conn]bool
-	broadcast chan interface{}
-	mutex     sync.RWMutex
+	clients    map[*wsClient]bool
+	broadcast  chan interface{}
+	sendBuffer int
+	mutex      sync.RWMutex
+
+	// closing is set by Close; new connections are refused from then on
+	closing bool
 }
 
-// NewWebSocketManager creates a new WebSocket manager
-func NewWebSocketManager() *WebSocketManager {
+// NewWebSocketManager creates a new WebSocket manager. sendBuffer is the
+// number of messages queued per client before the client is dropped.
+func NewWebSocketManager(sendBuffer int) *WebSocketManager {
+	if sendBuffer <= 0 {
+		sendBuffer = 256
+	}
 	return &WebSocketManager{
-		clients:   make(map[*websocket.Conn]bool),
-		broadcast: make(chan interface{}, 100),
+		clients:    make(map[*wsClient]bool),
+		broadcast:  make(chan interface{}, 100),
+		sendBuffer: sendBuffer,
 	}
 }
 
-// Start begins the WebSocket broadcast loop
+// Start begins the WebSocket broadcast loop and forwards backend queue
+// events to all clients
 func (wsm *WebSocketManager) Start() {
 	go func() {
-		for {
-			message := <-wsm.broadcast
+		for message := range wsm.broadcast {
+			owner := ""
+			scoped, isScoped := message.(scopedMessage)
+			if isScoped {
+				owner, message = scoped.userID, scoped.message
+			}
+
+			data, err := encodeMessage(message)
+			if err != nil {
+				slog.Error("WebSocket encode error", "error", err)
+				continue
+			}
+
+			// Never block on a client while holding the read lock: clients
+			// whose send queue is full are collected and dropped afterwards
+			var slow []*wsClient
 			wsm.mutex.RLock()
 			for client := range wsm.clients {
-				err := client.WriteJSON(message)
-				if err != nil {
-					log.Printf("WebSocket write error: %v", err)
-					client.Close()
-					wsm.removeClient(client)
+				if isScoped && !client.receives(owner) {
+					continue
+				}
+				select {
+				case client.send <- data:
+				default:
+					slow = append(slow, client)
 				}
 			}
 			wsm.mutex.RUnlock()
+
+			for _, client := range slow {
+				slog.Warn("WebSocket client too slow, disconnecting")
+				wsm.removeClient(client)
+			}
 		}
 	}()
 
-	// Start polling for updates to broadcast
-	go wsm.pollUpdates()
+	go wsm.forwardEvents()
 }
 
-// pollUpdates periodically checks for download progress and queue updates
-func (wsm *WebSocketManager) pollUpdates() {
-	// This will poll backend for updates and broadcast to clients
-	// Implementation will send download progress and queue updates
-	for {
-		// Get download progress
-		progress := backend.GetDownloadProgress()
-		if progress.IsDownloading {
-			wsm.Broadcast(map[string]interface{}{
-				"type": "download_progress",
-				"data": progress,
-			})
+// forwardEvents relays typed queue and availability events from the backend
+func (wsm *WebSocketManager) forwardEvents() {
+	events, _ := backend.SubscribeEvents(wsm.sendBuffer)
+	for event := range events {
+		message := map[string]interface{}{
+			"type": event.Type,
+			"time": event.Timestamp,
+			"data": event.Payload(),
+		}
+		// Live only events carry no ID
+		if event.ID > 0 {
+			message["id"] = event.ID
 		}
+		wsm.Broadcast(scopedMessage{userID: event.UserID(), message: message})
+	}
+}
 
-		// Get queue info
-		queue := backend.GetDownloadQueue()
-		wsm.Broadcast(map[string]interface{}{
-			"type": "queue_update",
-			"data": queue,
-		})
+// encodeMessage marshals a message unless it is already encoded JSON
+func encodeMessage(message interface{}) ([]byte, error) {
+	if data, ok := message.([]byte); ok {
+		return data, nil
+	}
+	return json.Marshal(message)
+}
+
+// wsCloseWait is how long Close waits for clients to answer the close frame
+const wsCloseWait = 2 * time.Second
+
+// addClient registers a connection and starts its write pump. It returns
+// nil and closes the connection if the manager is shutting down.
+func (wsm *WebSocketManager) addClient(conn *websocket.Conn, userID string) *wsClient {
+	client := &wsClient{
+		conn:   conn,
+		send:   make(chan []byte, wsm.sendBuffer),
+		userID: userID,
+	}
 
-		// Sleep briefly to avoid excessive polling
-		// This could be optimized with channels/events from backend
-		//time.Sleep(500 * time.Millisecond)
-		break // For now, don't continuously poll
+	wsm.mutex.Lock()
+	if wsm.closing {
+		wsm.mutex.Unlock()
+		client.sendClose()
+		conn.Close()
+		return nil
 	}
+	wsm.clients[client] = true
+	wsm.mutex.Unlock()
+
+	go client.writePump()
+	return client
 }
 
-// addClient adds a new WebSocket client
-func (wsm *WebSocketManager) addClient(conn *websocket.Conn) {
+// removeClient unregisters a client and stops its write pump
+func (wsm *WebSocketManager) removeClient(client *wsClient) {
 	wsm.mutex.Lock()
 	defer wsm.mutex.Unlock()
-	wsm.clients[conn] = true
+	if wsm.clients[client] {
+		delete(wsm.clients, client)
+		close(client.send)
+	}
 }
 
-// removeClient removes a WebSocket client
-func (wsm *WebSocketManager) removeClient(conn *websocket.Conn) {
+// sendTo queues a message for a single client
+func (wsm *WebSocketManager) sendTo(client *wsClient, message interface{}) {
+	data, err := encodeMessage(message)
+	if err != nil {
+		return
+	}
+
+	wsm.mutex.RLock()
+	defer wsm.mutex.RUnlock()
+	if !wsm.clients[client] {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+	}
+}
+
+// writePump writes queued messages to the connection until the send queue
+// is closed, then closes the connection
+func (client *wsClient) writePump() {
+	defer client.conn.Close()
+
+	for data := range client.send {
+		client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			slog.Debug("WebSocket write error", "error", err)
+			// Closing the connection ends the read loop, which removes the
+			// client and closes the queue drained here
+			client.conn.Close()
+			for range client.send {
+			}
+			return
+		}
+	}
+}
+
+// sendClose writes a "going away" close frame. WriteControl may run
+// concurrently with the write pump.
+func (client *wsClient) sendClose() {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	if err := client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		slog.Debug("WebSocket close frame not sent", "error", err)
+	}
+}
+
+// Close sends a close frame to every client and waits up to wsCloseWait
+// (bounded by ctx) for them to answer and disconnect. Connections still
+// open after that are dropped.
+func (wsm *WebSocketManager) Close(ctx context.Context) {
 	wsm.mutex.Lock()
-	defer wsm.mutex.Unlock()
-	delete(wsm.clients, conn)
+	wsm.closing = true
+	clients := make([]*wsClient, 0, len(wsm.clients))
+	for client := range wsm.clients {
+		clients = append(clients, client)
+	}
+	wsm.mutex.Unlock()
+
+	for _, client := range clients {
+		client.sendClose()
+	}
+
+	// The read loop of each client returns on the close reply and
+	// removes the client
+	ctx, cancel := context.WithTimeout(ctx, wsCloseWait)
+	defer cancel()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for wsm.ClientCount() > 0 {
+		select {
+		case <-ctx.Done():
+			for _, client := range clients {
+				wsm.removeClient(client)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // Broadcast sends a message to all connected clients
@@ -110,35 +286,62 @@ func (wsm *WebSocketManager) Broadcast(message interface{}) {
 	select {
 	case wsm.broadcast <- message:
 	default:
-		log.Println("Broadcast channel full, dropping message")
+		slog.Warn("Broadcast channel full, dropping message")
 	}
 }
 
+// ClientCount returns the number of connected clients
+func (wsm *WebSocketManager) ClientCount() int {
+	wsm.mutex.RLock()
+	defer wsm.mutex.RUnlock()
+	return len(wsm.clients)
+}
+
 // Global WebSocket manager instance
 var wsManager *WebSocketManager
 
+// The client count is read on every /metrics scrape
+func init() {
+	backend.RegisterGaugeFunc("spotiflac_websocket_clients", "Connected WebSocket clients.", func() []backend.GaugeSample {
+		count := 0
+		if wsManager != nil {
+			count = wsManager.ClientCount()
+		}
+		return []backend.GaugeSample{{Value: float64(count)}}
+	})
+}
+
 // InitWebSocketManager initializes the global WebSocket manager
-func InitWebSocketManager() {
-	wsManager = NewWebSocketManager()
+func InitWebSocketManager(sendBuffer int) {
+	wsManager = NewWebSocketManager(sendBuffer)
 	wsManager.Start()
 }
 
+// CloseWebSockets closes all client connections with a close frame
+func CloseWebSockets(ctx context.Context) {
+	if wsManager != nil {
+		wsManager.Close(ctx)
+	}
+}
+
 // HandleWebSocket handles WebSocket connection requests
 // Endpoint: GET /ws
 func HandleWebSocket(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade WebSocket: %v", err)
+		slog.WarnContext(c.Request.Context(), "Failed to upgrade WebSocket", "error", err)
 		return
 	}
-	defer conn.Close()
 
-	// Add client to manager
-	wsManager.addClient(conn)
-	defer wsManager.removeClient(conn)
+	// Add client to manager; its write pump closes the connection
+	client := wsManager.addClient(conn, CurrentPrincipal(c).Scope())
+	if client == nil {
+		return
+	}
+	defer wsManager.removeClient(client)
 
-	// Send initial state
-	wsManager.Broadcast(map[string]interface{}{
+	// Send initial state to the new client only
+	wsManager.sendTo(client, map[string]interface{}{
 		"type": "connected",
 		"data": map[string]interface{}{
 			"message": "Connected to SpotiFLAC server",
@@ -151,18 +354,18 @@ func HandleWebSocket(c *gin.Context) {
 		err := conn.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				slog.Warn("WebSocket error", "error", err)
 			}
 			break
 		}
 
 		// Handle client messages if needed
-		handleClientMessage(conn, msg)
+		handleClientMessage(client, msg)
 	}
 }
 
 // handleClientMessage processes messages from WebSocket clients
-func handleClientMessage(conn *websocket.Conn, msg map[string]interface{}) {
+func handleClientMessage(client *wsClient, msg map[string]interface{}) {
 	msgType, ok := msg["type"].(string)
 	if !ok {
 		return
@@ -171,16 +374,16 @@ func handleClientMessage(conn *websocket.Conn, msg map[string]interface{}) {
 	switch msgType {
 	case "ping":
 		// Respond to ping
-		conn.WriteJSON(map[string]interface{}{
+		wsManager.sendTo(client, map[string]interface{}{
 			"type": "pong",
 		})
 
 	case "request_status":
 		// Send current status
-		progress := backend.GetDownloadProgress()
-		queue := backend.GetDownloadQueue()
+		progress := backend.GetDownloadProgress(client.userID)
+		queue := backend.GetDownloadQueueForUser(client.userID)
 
-		conn.WriteJSON(map[string]interface{}{
+		wsManager.sendTo(client, map[string]interface{}{
 			"type": "status_update",
 			"data": map[string]interface{}{
 				"progress": progress,
@@ -190,27 +393,6 @@ func handleClientMessage(conn *websocket.Conn, msg map[string]interface{}) {
 	}
 }
 
-// BroadcastDownloadProgress sends download progress to all WebSocket clients
-// This can be called from backend when progress updates occur
-func BroadcastDownloadProgress(progress backend.ProgressInfo) {
-	if wsManager != nil {
-		wsManager.Broadcast(map[string]interface{}{
-			"type": "download_progress",
-			"data": progress,
-		})
-	}
-}
-
-// BroadcastQueueUpdate sends queue updates to all WebSocket clients
-func BroadcastQueueUpdate(queue backend.DownloadQueueInfo) {
-	if wsManager != nil {
-		wsManager.Broadcast(map[string]interface{}{
-			"type": "queue_update",
-			"data": queue,
-		})
-	}
-}
-
 // BroadcastMessage sends a generic message to all clients
 func BroadcastMessage(messageType string, data interface{}) error {
 	if wsManager == nil {
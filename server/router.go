@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"spotiflac/backend"
 	"spotiflac/backend/config"
 	"spotiflac/server/api"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,8 +17,11 @@ import (
 
 // Server represents the HTTP server
 type Server struct {
-	router *gin.Engine
-	config *config.Config
+	router     *gin.Engine
+	httpServer *http.Server
+	config     *config.Config
+	auth       *api.Authenticator
+	limiter    *api.RateLimiter
 }
 
 // NewServer creates a new HTTP server instance
@@ -24,6 +31,13 @@ func NewServer(cfg *config.Config) *Server {
 
 	router := gin.New()
 
+	// Only trust X-Forwarded-For from configured proxies, otherwise any
+	// client could pick its own IP for rate limiting (rule #9)
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("Invalid server.trusted_proxies, trusting no proxy", "error", err)
+		router.SetTrustedProxies(nil)
+	}
+
 	// Add middleware
 	router.Use(gin.Recovery())        // Panic recovery
 	router.Use(api.RequestLogger())   // Request logging (rule #16)
@@ -35,46 +49,112 @@ func NewServer(cfg *config.Config) *Server {
 	corsConfig := cors.Config{
 		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "X-Request-ID"},
 		AllowCredentials: true,
 	}
 	router.Use(cors.New(corsConfig))
 
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler: router,
+	}
+	// Server-Sent Event streams never end on their own, close them as soon
+	// as the listener stops so Shutdown does not wait for them
+	httpServer.RegisterOnShutdown(backend.CloseEventSubscribers)
+
 	return &Server{
-		router: router,
-		config: cfg,
+		router:     router,
+		httpServer: httpServer,
+		config:     cfg,
+		limiter:    api.NewRateLimiter(cfg.RateLimit),
 	}
 }
 
-// SetupRoutes configures all HTTP routes
-func (s *Server) SetupRoutes() {
-	handler := api.NewHandler()
+// SetupRoutes configures all HTTP routes and the OpenAPI document
+// describing them
+func (s *Server) SetupRoutes() error {
+	handler := api.NewHandler(s.auth)
+	requireAuth := api.AuthRequired(s.auth)
 
-	// Health check
+	// Per-client budgets (rule #14), applied after authentication so
+	// clients are keyed by credential
+	metadataLimit := api.RateLimit(s.limiter, api.BudgetMetadata)
+	searchLimit := api.RateLimit(s.limiter, api.BudgetSearch)
+	downloadLimit := api.RateLimit(s.limiter, api.BudgetDownload)
+
+	// Health checks, public so orchestrator probes need no credentials
 	s.router.GET("/health", handler.HealthCheck)
+	s.router.GET("/health/live", handler.HealthLive)
+	s.router.GET("/health/ready", handler.HealthReady)
+
+	// Prometheus metrics, admin only unless metrics.public is set (rule #10)
+	if s.config.Metrics.Enabled {
+		if s.config.Metrics.Public {
+			s.router.GET("/metrics", handler.Metrics)
+		} else {
+			s.router.GET("/metrics", requireAuth, api.AdminRequired(), handler.Metrics)
+		}
+	}
+
+	// Login is the only public API route
+	s.router.POST("/api/auth/login", api.RateLimit(s.limiter, api.BudgetLogin), handler.Login)
 
 	// API routes
-	apiGroup := s.router.Group("/api")
+	apiGroup := s.router.Group("/api", requireAuth)
 	{
+		apiGroup.GET("/auth/me", handler.Me)
+		apiGroup.POST("/auth/password", handler.ChangePassword)
+
+		// Mirror health and circuit state (admin only)
+		apiGroup.GET("/mirrors", api.AdminRequired(), handler.GetMirrorHealth)
+		apiGroup.POST("/providers/reload", api.AdminRequired(), handler.ReloadProviders)
+
+		// User management (admin only)
+		users := apiGroup.Group("/users", api.AdminRequired())
+		{
+			users.GET("", handler.ListUsers)
+			users.POST("", handler.CreateUser)
+			users.PATCH("/:id", handler.UpdateUser)
+			users.DELETE("/:id", handler.DeleteUser)
+		}
+
 		// Spotify metadata and search
 		spotify := apiGroup.Group("/spotify")
 		{
-			spotify.POST("/metadata", handler.GetSpotifyMetadata)
-			spotify.POST("/search", handler.SearchSpotify)
-			spotify.POST("/search-by-type", handler.SearchSpotifyByType)
-			spotify.POST("/streaming-urls", handler.GetStreamingURLs)
+			spotify.POST("/metadata", metadataLimit, handler.GetSpotifyMetadata)
+			spotify.POST("/search", searchLimit, handler.SearchSpotify)
+			spotify.POST("/search-by-type", searchLimit, handler.SearchSpotifyByType)
+			spotify.POST("/streaming-urls", metadataLimit, handler.GetStreamingURLs)
 		}
 
+		// Queue and progress events as Server-Sent Events
+		apiGroup.GET("/events", handler.StreamEvents)
+
 		// Download operations
 		download := apiGroup.Group("/download")
 		{
-			download.POST("/track", handler.DownloadTrack)
+			download.POST("/track", downloadLimit, handler.DownloadTrack)
+			download.POST("/collection", downloadLimit, metadataLimit, handler.DownloadCollection)
 			download.GET("/queue", handler.GetDownloadQueue)
 			download.GET("/progress", handler.GetDownloadProgress)
 			download.POST("/queue/clear", handler.ClearCompletedDownloads)
 			download.POST("/queue/clear-all", handler.ClearAllDownloads)
 			download.POST("/queue/cancel-all", handler.CancelAllQueuedItems)
+			download.POST("/queue/:id/cancel", handler.CancelDownloadItem)
+			download.POST("/queue/:id/pause", handler.PauseDownloadItem)
+			download.POST("/queue/:id/resume", handler.ResumeDownloadItem)
+			download.POST("/queue/:id/retry", handler.RetryDownloadItem)
+
+			// Lyrics and artwork
+			download.POST("/lyrics", downloadLimit, handler.DownloadLyrics)
+			download.POST("/lyrics/batch", downloadLimit, handler.DownloadLyricsBatch)
+			download.POST("/cover", downloadLimit, handler.DownloadCover)
+			download.POST("/cover/batch", downloadLimit, handler.DownloadCoverBatch)
+			download.POST("/header", downloadLimit, handler.DownloadHeader)
+			download.POST("/gallery", downloadLimit, handler.DownloadGalleryImage)
+			download.POST("/gallery/batch", downloadLimit, handler.DownloadGalleryBatch)
+			download.POST("/avatar", downloadLimit, handler.DownloadAvatar)
 		}
 
 		// History
@@ -83,6 +163,18 @@ func (s *Server) SetupRoutes() {
 			history.GET("/downloads", handler.GetDownloadHistory)
 			history.POST("/downloads/clear", handler.ClearDownloadHistory)
 			history.DELETE("/downloads/:id", handler.DeleteDownloadHistoryItem)
+			history.GET("/fetch", handler.GetFetchHistory)
+			history.POST("/fetch", handler.AddFetchHistory)
+			history.POST("/fetch/clear", handler.ClearFetchHistory)
+			history.DELETE("/fetch/:id", handler.DeleteFetchHistoryItem)
+		}
+
+		// Availability checks, answered through events
+		availability := apiGroup.Group("/availability")
+		{
+			availability.POST("", metadataLimit, handler.StartAvailabilityCheck)
+			availability.GET("/:id", handler.GetAvailabilityCheck)
+			availability.DELETE("/:id", handler.CancelAvailabilityCheck)
 		}
 
 		// Settings
@@ -90,6 +182,27 @@ func (s *Server) SetupRoutes() {
 		apiGroup.POST("/settings", handler.SaveSettings)
 		apiGroup.GET("/defaults", handler.GetDefaults)
 
+		// File manager, jailed to the principal's download directory
+		files := apiGroup.Group("/files")
+		{
+			files.GET("/list", handler.ListFiles)
+			files.GET("/audio", handler.ListAudioFiles)
+			files.GET("/metadata", handler.ReadFileMetadata)
+			files.POST("/sizes", handler.GetFileSizes)
+			files.POST("/rename/preview", handler.PreviewRename)
+			files.POST("/rename", handler.RenameFiles)
+		}
+
+		// Library playback and archives; both accept access_token so they
+		// work as <audio> sources and plain download links
+		library := apiGroup.Group("/library")
+		{
+			library.GET("/stream/:id", handler.StreamLibraryItem)
+			library.HEAD("/stream/:id", handler.StreamLibraryItem)
+			library.GET("/archive", handler.DownloadLibraryArchive)
+			library.HEAD("/archive", handler.DownloadLibraryArchive)
+		}
+
 		// System
 		system := apiGroup.Group("/system")
 		{
@@ -101,37 +214,132 @@ func (s *Server) SetupRoutes() {
 		{
 			analysis.POST("/track", handler.AnalyzeTrack)
 		}
+
+		// OpenAPI document of the routes above
+		apiGroup.GET("/openapi.json", handler.OpenAPI)
 	}
 
 	// WebSocket endpoint for real-time updates
-	s.router.GET("/ws", api.HandleWebSocket)
+	s.router.GET("/ws", requireAuth, api.HandleWebSocket)
+
+	// Every route must be documented, so the document cannot drift
+	return handler.LoadOpenAPI(s.router.Routes())
 }
 
-// Start initializes and starts the HTTP server
+// Start initializes and starts the HTTP server. It blocks until the server
+// fails or Stop is called; after Stop it returns nil.
 func (s *Server) Start() error {
 	// Initialize backend components
+	backend.SetEventHistorySize(s.config.Server.EventHistorySize)
+
 	if err := backend.InitHistoryDB(s.config.Database.Path); err != nil {
 		return fmt.Errorf("failed to initialize history database: %w", err)
 	}
 
+	// Resume downloads left in the persisted queue by a previous run
+	resumed, err := backend.RestoreDownloadQueue()
+	if err != nil {
+		return fmt.Errorf("failed to restore download queue: %w", err)
+	}
+	if resumed > 0 {
+		slog.Info("Resuming queued downloads", "count", resumed)
+	}
+
+	// Mirror health survives restarts so known dead mirrors stay skipped
+	backend.ConfigureMirrorBreaker(s.config.Mirrors.FailureThreshold,
+		time.Duration(s.config.Mirrors.CooldownSeconds)*time.Second,
+		time.Duration(s.config.Mirrors.MaxCooldownSeconds)*time.Second)
+	if restored, err := backend.RestoreMirrorHealth(); err != nil {
+		slog.Warn("Failed to restore mirror health", "error", err)
+	} else if restored > 0 {
+		slog.Info("Restored mirror health", "mirrors", restored)
+	}
+	backend.StartMirrorHealthFlusher(time.Duration(s.config.Mirrors.FlushIntervalSeconds) * time.Second)
+
+	// Only the configured providers take downloads
+	if err := backend.EnableProviders(s.config.Services.EnabledProviders); err != nil {
+		return fmt.Errorf("invalid services.enabled_providers: %w", err)
+	}
+	if err := backend.SetFallbackChain(s.config.Services.FallbackChain); err != nil {
+		return fmt.Errorf("invalid services.fallback_chain: %w", err)
+	}
+	if err := api.ApplyProviderEndpoints(s.config.Providers); err != nil {
+		return fmt.Errorf("invalid providers: %w", err)
+	}
+	for service := range s.config.Download.ProviderConcurrency {
+		if !backend.ProviderRegistered(service) {
+			return fmt.Errorf("invalid download.provider_concurrency: %w: %s", backend.ErrUnknownProvider, service)
+		}
+	}
+
+	// Interrupted transfers resume from their .part files
+	backend.SetStreamRetries(s.config.Download.StreamRetries)
+
+	// Start the worker pool for queued downloads
+	backend.StartDownloadWorkers(s.config.Download.Concurrency, s.config.Download.ProviderConcurrency)
+
+	// Start the availability checker, which owns the song.link budget
+	backend.StartAvailabilityChecker(s.config.Availability.MaxQueued, time.Duration(s.config.Availability.CacheMinutes)*time.Minute)
+
 	// Initialize WebSocket manager
-	api.InitWebSocketManager()
+	api.InitWebSocketManager(s.config.Server.WSSendBuffer)
+
+	auth, err := api.NewAuthenticator(s.config.Auth)
+	if err != nil {
+		return fmt.Errorf("failed to initialize authentication: %w", err)
+	}
+	s.auth = auth
+	if !auth.Enabled() {
+		slog.Warn("Authentication is disabled, anyone who can reach the server controls it", "host", s.config.Server.Host, "port", s.config.Server.Port)
+	}
 
 	// Setup routes
-	s.SetupRoutes()
+	if err := s.SetupRoutes(); err != nil {
+		return err
+	}
 
 	// Start server
-	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
-	log.Printf("Starting SpotiFLAC server on %s", addr)
+	slog.Info("Starting SpotiFLAC server", "addr", s.httpServer.Addr)
+
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
 
-	return s.router.Run(addr)
+// ReloadProviders applies the provider endpoints of the configuration file
+// while the server runs
+func (s *Server) ReloadProviders() error {
+	return api.ReloadProviderEndpoints()
 }
 
-// Stop gracefully shuts down the server
-func (s *Server) Stop() error {
+// Stop gracefully shuts down the server (rule #15: Fail Securely). It
+// stops accepting requests and waits for in-flight ones until ctx expires,
+// closes WebSocket clients with a close frame, then gives running downloads
+// server.drain_timeout_seconds to finish, however long the requests took.
+// Downloads still running are checkpointed back to queued and resume on
+// the next start.
+func (s *Server) Stop(ctx context.Context) error {
+	var shutdownErr error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		shutdownErr = fmt.Errorf("failed to drain HTTP requests: %w", err)
+	}
+
+	api.CloseWebSockets(ctx)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.Server.DrainTimeoutSeconds)*time.Second)
+	defer cancel()
+	if checkpointed := backend.DrainDownloads(drainCtx); checkpointed > 0 {
+		slog.Info("Checkpointed running downloads back to queued", "count", checkpointed)
+	}
+	if removed := backend.RemoveTempFiles(); removed > 0 {
+		slog.Info("Removed temporary download files", "count", removed)
+	}
+
 	// Close database connections
+	backend.StopMirrorHealthFlusher()
 	backend.CloseHistoryDB()
 
-	log.Println("Server stopped")
-	return nil
+	slog.Info("Server stopped")
+	return shutdownErr
 }
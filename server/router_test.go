@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+
+	"spotiflac/backend/config"
+	"spotiflac/server/api"
+)
+
+// TestRoutesMatchOpenAPI builds the router from the shipped configuration
+// and checks that every registered route is documented and vice versa
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	t.Setenv("SPOTIFLAC_API_KEYS", "admin:0123456789abcdef0123456789abcdef")
+	cfg, err := config.Load("../config.yml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	s := NewServer(cfg)
+	if err := s.SetupRoutes(); err != nil {
+		t.Fatalf("SetupRoutes() error = %v", err)
+	}
+
+	doc, err := api.BuildOpenAPI(s.router.Routes())
+	if err != nil {
+		t.Fatalf("BuildOpenAPI() error = %v", err)
+	}
+	if len(doc.Paths) == 0 {
+		t.Fatal("BuildOpenAPI() documented no paths")
+	}
+}